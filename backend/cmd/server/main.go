@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -21,8 +22,12 @@ import (
 	"github.com/homelab/filemanager/internal/middleware"
 	"github.com/homelab/filemanager/internal/model"
 	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/remotefs"
+	"github.com/homelab/filemanager/internal/s3"
 	"github.com/homelab/filemanager/internal/service"
+	"github.com/homelab/filemanager/internal/sftp"
 	"github.com/homelab/filemanager/internal/static"
+	"github.com/homelab/filemanager/internal/webdav"
 	"github.com/homelab/filemanager/internal/websocket"
 )
 
@@ -52,25 +57,40 @@ func main() {
 	defer cancel()
 
 	// Initialize components
-	server, hub, jobService, authService, streamHandler, _, err := initializeServer(ctx, cfg)
+	srv, err := initializeServer(ctx, cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize server")
 	}
 
 	// Start WebSocket hub in background
-	go hub.Run(ctx)
+	go srv.hub.Run(ctx)
 	log.Info().Msg("WebSocket hub started")
 
+	// Start directory watcher
+	srv.watchService.Start(ctx)
+	log.Info().Msg("Directory watcher started")
+
 	// Start job service workers
-	jobService.Start(ctx)
+	srv.jobService.Start(ctx)
 	log.Info().Msg("Job service started")
 
+	// Start job scheduler
+	srv.scheduleService.Start(ctx)
+	log.Info().Msg("Job scheduler started")
+
 	// Start auth service cleanup
-	authService.StartCleanup(ctx)
+	srv.authService.StartCleanup(ctx)
 	log.Info().Msg("Auth service cleanup started")
 
+	// Restore upload sessions interrupted by a restart
+	if restored, err := srv.streamHandler.RestoreUploads(); err != nil {
+		log.Warn().Err(err).Msg("Could not restore upload sessions")
+	} else {
+		log.Info().Int("count", restored).Msg("Upload sessions restored")
+	}
+
 	// Start upload session cleanup
-	streamHandler.StartCleanup(ctx)
+	srv.streamHandler.StartCleanup(ctx)
 	log.Info().Msg("Upload session cleanup started")
 
 	// Ensure data directory exists for settings storage
@@ -84,19 +104,71 @@ func main() {
 	go func() {
 		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 		log.Info().Str("addr", addr).Msg("Starting HTTP server")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("HTTP server error")
 		}
 	}()
 
+	// Start SFTP server in background
+	if srv.sftpServer != nil {
+		go func() {
+			addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.SFTPPort)
+			log.Info().Str("addr", addr).Msg("Starting SFTP server")
+			if err := srv.sftpServer.ListenAndServe(addr); err != nil && err != sftp.ErrServerClosed {
+				log.Fatal().Err(err).Msg("SFTP server error")
+			}
+		}()
+	}
+
+	// Start S3 gateway in background
+	if srv.s3Server != nil {
+		go func() {
+			log.Info().Str("addr", srv.s3Server.Addr).Msg("Starting S3 gateway")
+			if err := srv.s3Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Err(err).Msg("S3 gateway error")
+			}
+		}()
+	}
+
 	// Wait for shutdown signal
-	waitForShutdown(ctx, cancel, server, jobService, authService, streamHandler)
+	waitForShutdown(ctx, cancel, srv)
+}
+
+// server holds the components main starts and stops
+type server struct {
+	httpServer      *http.Server
+	sftpServer      *sftp.Server           // nil unless SFTP is enabled
+	s3Server        *http.Server           // nil unless the S3 gateway is enabled
+	remotes         []*remotefs.Filesystem // Remote mount points, written back on shutdown
+	hub             *websocket.Hub
+	jobService      service.JobService
+	scheduleService service.ScheduleService
+	watchService    service.WatchService
+	authService     service.AuthService
+	shareService    service.ShareService
+	streamHandler   *handler.StreamHandler
 }
 
 // initializeServer creates and configures all server components
-func initializeServer(ctx context.Context, cfg *model.ServerConfig) (*http.Server, *websocket.Hub, service.JobService, service.AuthService, *handler.StreamHandler, *handler.SettingsHandler, error) {
-	// Create filesystem abstraction (using real OS filesystem)
-	fs := filesystem.NewOsFS()
+func initializeServer(ctx context.Context, cfg *model.ServerConfig) (*server, error) {
+	// Create filesystem abstraction (the real OS filesystem, with remote
+	// mount points mounted into it)
+	fs := filesystem.NewMountFS(filesystem.NewOsFS())
+	var remotes []*remotefs.Filesystem
+	for i, mp := range cfg.MountPoints {
+		if !mp.IsRemote() {
+			continue
+		}
+		remote, err := remotefs.New(mp)
+		if err != nil {
+			return nil, err
+		}
+		root := filepath.Join(config.RemoteMountRoot, mp.Name)
+		fs.Mount(root, remote)
+		remotes = append(remotes, remote)
+		log.Info().Str("name", mp.Name).Str("type", string(mp.Type)).Str("path", mp.Path).Msg("Remote mount point configured")
+		cfg.MountPoints[i].Path = root
+	}
 
 	// Ensure mount point directories exist
 	for _, mp := range cfg.MountPoints {
@@ -119,6 +191,7 @@ func initializeServer(ctx context.Context, cfg *model.ServerConfig) (*http.Serve
 			Name:     mp.Name,
 			Path:     mp.Path,
 			ReadOnly: mp.ReadOnly,
+			Type:     mp.Type,
 		}
 	}
 
@@ -132,9 +205,15 @@ func initializeServer(ctx context.Context, cfg *model.ServerConfig) (*http.Serve
 		log.Warn().Msg("No users configured, using default admin:admin credentials")
 		users = map[string]string{"admin": "admin"}
 	}
+	authorizedKeys, err := sftp.ParseAuthorizedKeys(cfg.AuthorizedKeys)
+	if err != nil {
+		return nil, err
+	}
 	authService := service.NewAuthService(service.AuthServiceConfig{
-		JWTSecret: cfg.JWTSecret,
-		Users:     users,
+		JWTSecret:      cfg.JWTSecret,
+		Users:          users,
+		Admins:         cfg.Admins,
+		AuthorizedKeys: authorizedKeys,
 	})
 
 	fileService := service.NewFileService(fs, service.FileServiceConfig{
@@ -145,9 +224,32 @@ func initializeServer(ctx context.Context, cfg *model.ServerConfig) (*http.Serve
 		MountPoints: mountPoints,
 	})
 
+	hashIndex := service.NewHashIndex(fs, service.HashIndexConfig{
+		DataDir: config.DefaultDataDir,
+	})
+
+	fetchMaxMB := cfg.FetchMaxMB
+	if fetchMaxMB == 0 {
+		fetchMaxMB = cfg.MaxUploadMB
+	}
 	jobService := service.NewJobService(fs, hub, service.JobServiceConfig{
 		Workers:     4,
 		MountPoints: mountPoints,
+		HashIndex:   hashIndex,
+		Fetch: service.FetchConfig{
+			MaxBytes:   int64(fetchMaxMB) * config.BytesPerMB,
+			AllowHosts: cfg.FetchAllowHosts,
+			DenyHosts:  cfg.FetchDenyHosts,
+		},
+	})
+
+	scheduleService := service.NewScheduleService(fs, jobService, service.ScheduleServiceConfig{
+		DataDir: config.DefaultDataDir,
+		IsAdmin: authService.IsAdmin,
+	})
+
+	watchService := service.NewWatchService(fs, hub, service.WatchServiceConfig{
+		MountPoints: mountPoints,
 	})
 
 	systemService := service.NewSystemService()
@@ -156,22 +258,39 @@ func initializeServer(ctx context.Context, cfg *model.ServerConfig) (*http.Serve
 		DataDir: config.DefaultDataDir,
 	})
 
+	shareService := service.NewShareService(fs, fileService, service.ShareServiceConfig{
+		DataDir: config.DefaultDataDir,
+	})
+
 	// Create handlers
 	authHandler := handler.NewAuthHandler(authService)
 	fileHandler := handler.NewFileHandler(fileService)
-	streamHandler := handler.NewStreamHandler(fileService, cfg.ChunkSizeMB)
+	streamHandler := handler.NewStreamHandler(fileService, hub, handler.StreamHandlerConfig{
+		ChunkSizeMB:   cfg.ChunkSizeMB,
+		DataDir:       config.DefaultDataDir,
+		MaxUploadMB:   cfg.MaxUploadMB,
+		UploadQuotaMB: cfg.UploadQuotaMB,
+		UploadQuotas:  cfg.UploadQuotas,
+		HashIndex:     hashIndex,
+	})
 	jobHandler := handler.NewJobHandler(jobService)
+	scheduleHandler := handler.NewScheduleHandler(scheduleService)
 	searchHandler := handler.NewSearchHandler(searchService)
 	wsHandler := handler.NewWebSocketHandler(hub, authService, cfg.AllowedOrigins)
+	eventsHandler := handler.NewEventsHandler(hub)
 	systemHandler := handler.NewSystemHandler(systemService)
 	settingsHandler := handler.NewSettingsHandler(settingsService)
+	shareHandler := handler.NewShareHandler(shareService, fileService, streamHandler, hub)
+	davHandler := webdav.NewHandler(fileService, webdav.Config{
+		Prefix:  config.WebDAVPrefix,
+		DataDir: config.DefaultDataDir,
+	})
 
 	// Create router
-	router := createRouter(cfg, authService, authHandler, fileHandler, streamHandler, jobHandler, searchHandler, wsHandler, systemHandler, settingsHandler, mountPoints)
+	router := createRouter(cfg, authService, authHandler, fileHandler, streamHandler, jobHandler, scheduleHandler, searchHandler, wsHandler, eventsHandler, systemHandler, settingsHandler, shareHandler, davHandler, mountPoints)
 
 	// Create HTTP server
-	// Create HTTP server
-	server := &http.Server{
+	httpServer := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
 		Handler:      router,
 		ReadTimeout:  config.HTTPReadTimeout,
@@ -179,7 +298,61 @@ func initializeServer(ctx context.Context, cfg *model.ServerConfig) (*http.Serve
 		IdleTimeout:  config.HTTPIdleTimeout,
 	}
 
-	return server, hub, jobService, authService, streamHandler, settingsHandler, nil
+	// Create SFTP server if enabled
+	var sftpServer *sftp.Server
+	if cfg.SFTPPort != 0 {
+		hostKeyPath := cfg.SFTPHostKey
+		if hostKeyPath == "" {
+			hostKeyPath = filepath.Join(config.DefaultDataDir, config.SFTPHostKeyFileName)
+		}
+		sftpServer, err = sftp.NewServer(fileService, authService, sftp.Config{
+			HostKeyPath:  hostKeyPath,
+			RateLimitRPS: cfg.RateLimitRPS,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create S3 gateway if enabled
+	var s3Server *http.Server
+	if cfg.S3Port != 0 {
+		keys := make(map[string]s3.Key, len(cfg.S3Keys))
+		for _, key := range cfg.S3Keys {
+			if _, ok := users[key.User]; !ok {
+				log.Warn().Str("user", key.User).Msg("S3 access key of unknown user ignored")
+				continue
+			}
+			keys[key.AccessKey] = s3.Key{User: key.User, Secret: key.SecretKey}
+		}
+		gateway := s3.NewGateway(fileService, streamHandler.UploadManager(), s3.Config{
+			Keys:           keys,
+			DataDir:        config.DefaultDataDir,
+			MaxUploadBytes: int64(cfg.MaxUploadMB) * config.BytesPerMB,
+			RateLimitRPS:   cfg.RateLimitRPS,
+		})
+		// Objects may take longer to transfer than the HTTP timeouts allow
+		s3Server = &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", cfg.Host, cfg.S3Port),
+			Handler:           gateway,
+			ReadHeaderTimeout: config.HTTPReadTimeout,
+			IdleTimeout:       config.HTTPIdleTimeout,
+		}
+	}
+
+	return &server{
+		httpServer:      httpServer,
+		sftpServer:      sftpServer,
+		s3Server:        s3Server,
+		remotes:         remotes,
+		hub:             hub,
+		jobService:      jobService,
+		scheduleService: scheduleService,
+		watchService:    watchService,
+		authService:     authService,
+		shareService:    shareService,
+		streamHandler:   streamHandler,
+	}, nil
 }
 
 // createRouter sets up chi router with all routes and middleware
@@ -190,10 +363,14 @@ func createRouter(
 	fileHandler *handler.FileHandler,
 	streamHandler *handler.StreamHandler,
 	jobHandler *handler.JobHandler,
+	scheduleHandler *handler.ScheduleHandler,
 	searchHandler *handler.SearchHandler,
 	wsHandler *handler.WebSocketHandler,
+	eventsHandler *handler.EventsHandler,
 	systemHandler *handler.SystemHandler,
 	settingsHandler *handler.SettingsHandler,
+	shareHandler *handler.ShareHandler,
+	davHandler *webdav.Handler,
 	mountPoints []model.MountPoint,
 ) chi.Router {
 	r := chi.NewRouter()
@@ -227,6 +404,13 @@ func createRouter(
 			authHandler.RegisterRoutes(r)
 		})
 
+		// Public share links are rate-limited like the auth routes, since
+		// they can be password protected
+		r.Route("/s", func(r chi.Router) {
+			r.Use(middleware.RateLimit(cfg.RateLimitRPS))
+			shareHandler.RegisterPublicRoutes(r)
+		})
+
 		// Protected routes (auth required)
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.JWTAuth(authService))
@@ -253,6 +437,16 @@ func createRouter(
 				jobHandler.RegisterRoutes(r)
 			})
 
+			// Recurring job schedules
+			r.Route("/schedules", func(r chi.Router) {
+				scheduleHandler.RegisterRoutes(r)
+			})
+
+			// Share link management
+			r.Route("/shares", func(r chi.Router) {
+				shareHandler.RegisterRoutes(r)
+			})
+
 			// System operations
 			r.Route("/system", func(r chi.Router) {
 				systemHandler.RegisterRoutes(r)
@@ -262,12 +456,23 @@ func createRouter(
 			r.Route("/settings", func(r chi.Router) {
 				settingsHandler.RegisterRoutes(r)
 			})
+
+			// Server-Sent Events fallback for the WebSocket endpoint
+			r.Get("/events", eventsHandler.ServeSSE)
 		})
 
 		// WebSocket endpoint (auth handled in handler)
 		r.Get("/ws", wsHandler.ServeWS)
 	})
 
+	// WebDAV drive, with Basic auth since its clients cannot use tokens
+	if cfg.WebDAV {
+		r.Route(config.WebDAVPrefix, func(r chi.Router) {
+			r.Use(middleware.BasicAuth(authService, config.WebDAVRealm, cfg.RateLimitRPS))
+			davHandler.RegisterRoutes(r)
+		})
+	}
+
 	// Static file handler for SPA frontend (catch-all)
 	// This must be after all API routes
 	staticHandler, err := static.NewHandler()
@@ -282,7 +487,7 @@ func createRouter(
 }
 
 // waitForShutdown handles graceful shutdown on interrupt signals
-func waitForShutdown(ctx context.Context, cancel context.CancelFunc, server *http.Server, jobService service.JobService, authService service.AuthService, streamHandler *handler.StreamHandler) {
+func waitForShutdown(ctx context.Context, cancel context.CancelFunc, srv *server) {
 	// Create channel to receive OS signals
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
@@ -298,19 +503,55 @@ func waitForShutdown(ctx context.Context, cancel context.CancelFunc, server *htt
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
+	// Stop the scheduler before the job service it submits to
+	log.Info().Msg("Stopping job scheduler...")
+	srv.scheduleService.Stop()
+
 	// Stop job service
 	log.Info().Msg("Stopping job service...")
-	jobService.Stop()
+	srv.jobService.Stop()
+
+	// Stop directory watcher
+	log.Info().Msg("Stopping directory watcher...")
+	srv.watchService.Stop()
 
 	// Shutdown HTTP server
 	log.Info().Msg("Shutting down HTTP server...")
-	if err := server.Shutdown(shutdownCtx); err != nil {
+	if err := srv.httpServer.Shutdown(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("Error during server shutdown")
 	}
 
+	// Close SFTP server and its connections
+	if srv.sftpServer != nil {
+		log.Info().Msg("Shutting down SFTP server...")
+		if err := srv.sftpServer.Close(); err != nil {
+			log.Error().Err(err).Msg("Error during SFTP server shutdown")
+		}
+	}
+
+	// Shutdown S3 gateway
+	if srv.s3Server != nil {
+		log.Info().Msg("Shutting down S3 gateway...")
+		if err := srv.s3Server.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Error during S3 gateway shutdown")
+		}
+	}
+
+	// Save share link access log entries still waiting to be written
+	if err := srv.shareService.Flush(); err != nil {
+		log.Error().Err(err).Msg("Error saving share links")
+	}
+
+	// Write back files still waiting to be uploaded to remote mount points
+	for _, remote := range srv.remotes {
+		if err := remote.Close(); err != nil {
+			log.Error().Err(err).Msg("Error closing remote mount point")
+		}
+	}
+
 	log.Info().Msg("Server shutdown complete")
 
 	// Stop background cleanups
-	authService.StopCleanup()
-	streamHandler.StopCleanup()
+	srv.authService.StopCleanup()
+	srv.streamHandler.StopCleanup()
 }
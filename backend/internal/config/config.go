@@ -18,6 +18,14 @@ func Load(configPath string) (*model.ServerConfig, error) {
 	v.SetDefault("host", "0.0.0.0")
 	v.SetDefault("max_upload_mb", 10240) // 10GB default
 	v.SetDefault("chunk_size_mb", 5)     // 5MB chunks
+	v.SetDefault("admins", []string{})
+	v.SetDefault("fetch_max_mb", 0) // 0 = max_upload_mb
+	v.SetDefault("fetch_allow_hosts", []string{})
+	v.SetDefault("fetch_deny_hosts", []string{})
+	v.SetDefault("webdav", false) // Opt-in, like SFTP and S3
+	v.SetDefault("sftp_port", 0) // 0 = disabled
+	v.SetDefault("sftp_host_key", "")
+	v.SetDefault("s3_port", 0) // 0 = disabled
 
 	// Config file settings
 	if configPath != "" {
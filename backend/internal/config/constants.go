@@ -48,6 +48,37 @@ const (
 
 	// WSWriteBufferSize is the write buffer size for the WebSocket upgrader
 	WSWriteBufferSize = 1024
+
+	// WSReplayBufferSize is the number of recent job events kept per user for
+	// clients that reconnect (must be less than WSSendBufferSize)
+	WSReplayBufferSize = 128
+
+	// SSEKeepAlivePeriod is how often an idle Server-Sent Events stream gets a
+	// comment line so that proxies do not close it
+	SSEKeepAlivePeriod = 30 * time.Second
+)
+
+// ============================================================================
+// Directory Watch Configuration
+// ============================================================================
+
+// Directory watch configuration constants
+const (
+	// WatchDebounce is how long changes to a watched directory are collected
+	// before they are sent as one batch
+	WatchDebounce = 250 * time.Millisecond
+
+	// WatchPollInterval is how often directories without change
+	// notifications are re-listed
+	WatchPollInterval = 10 * time.Second
+
+	// MaxWatchedDirs is the largest number of directories watched at once
+	MaxWatchedDirs = 1024
+
+	// MaxWatchedDirsPerClient is the largest number of directories one
+	// WebSocket or event stream connection watches, so that a single client
+	// cannot use up MaxWatchedDirs
+	MaxWatchedDirsPerClient = 64
 )
 
 // ============================================================================
@@ -59,17 +90,39 @@ const (
 	// DefaultJobWorkers is the default number of concurrent job workers
 	DefaultJobWorkers = 4
 
-	// JobQueueSize is the size of the job work queue channel
-	JobQueueSize = 100
-
 	// FileCopyBufferSize is the buffer size for file copy operations (1MB)
 	FileCopyBufferSize = 1024 * 1024
 
+	// SyncModTimeWindow is the largest modification time difference at which
+	// a sync job still considers two files of equal size unchanged
+	SyncModTimeWindow = 1 * time.Second
+
 	// JobRetentionPeriod is how long to keep completed jobs in memory
 	JobRetentionPeriod = 24 * time.Hour
 
 	// JobCleanupInterval is how often to run job cleanup
 	JobCleanupInterval = 1 * time.Hour
+
+	// ScheduleCheckInterval is how often the scheduler looks for due schedules
+	ScheduleCheckInterval = 30 * time.Second
+
+	// ScheduleRunHistory is the number of runs kept per schedule
+	ScheduleRunHistory = 50
+
+	// FetchAttempts is how many times a fetch job requests its URL before it
+	// fails, resuming after the bytes already received where the server allows
+	FetchAttempts = 5
+
+	// FetchRetryDelay is the wait before a fetch job's second request; each
+	// further request waits one delay longer
+	FetchRetryDelay = 2 * time.Second
+
+	// FetchStallTimeout is how long a fetch job waits for data before it
+	// gives up on the request and tries again
+	FetchStallTimeout = 60 * time.Second
+
+	// FetchMaxRedirects is the largest number of redirects a fetch job follows
+	FetchMaxRedirects = 10
 )
 
 // ============================================================================
@@ -81,14 +134,18 @@ const (
 	// DefaultChunkSizeMB is the default chunk size for uploads in megabytes
 	DefaultChunkSizeMB = 10
 
+	// BytesPerMB converts the megabyte sizes of the upload settings to bytes
+	BytesPerMB = 1024 * 1024
+
 	// SessionTimeout is how long before an upload session expires due to inactivity
 	SessionTimeout = 24 * time.Hour
 
 	// SessionCleanupInterval is how often to run session cleanup
 	SessionCleanupInterval = 1 * time.Hour
 
-	// DefaultUploadTempDir is where chunk files are stored before final assembly
-	DefaultUploadTempDir = "/tmp/filemanager"
+	// MaxBatchEntries is the largest number of files and directories in one
+	// folder upload batch
+	MaxBatchEntries = 10000
 )
 
 // ============================================================================
@@ -107,6 +164,111 @@ const (
 	TokenCleanupInterval = 1 * time.Hour
 )
 
+// ============================================================================
+// Share Configuration
+// ============================================================================
+
+// Share link configuration constants
+const (
+	// ShareTokenBytes is the number of random bytes in a share link token
+	ShareTokenBytes = 18
+
+	// ShareAccessHistory is the number of accesses kept per share link
+	ShareAccessHistory = 100
+
+	// ShareAccessSaveDelay is how long share link access log entries may
+	// wait before being written to the shares file, so that a busy link
+	// does not rewrite it on every request
+	ShareAccessSaveDelay = 5 * time.Second
+
+	// ShareResumeWindow is how long after a counted download the same
+	// visitor may continue it with range requests, such as media seeking or
+	// a resumed download, without using up another download
+	ShareResumeWindow = 12 * time.Hour
+
+	// SharePasswordIterations is the PBKDF2 iteration count for share link
+	// passwords
+	SharePasswordIterations = 100000
+)
+
+// ============================================================================
+// WebDAV Configuration
+// ============================================================================
+
+// WebDAV configuration constants
+const (
+	// WebDAVPrefix is the URL path the WebDAV drive is served at
+	WebDAVPrefix = "/dav"
+
+	// WebDAVRealm is the Basic auth realm shown by WebDAV clients
+	WebDAVRealm = "File Manager"
+)
+
+// ============================================================================
+// SFTP Configuration
+// ============================================================================
+
+// SFTP configuration constants
+const (
+	// SFTPHandshakeTimeout is how long a client has to connect and log in
+	SFTPHandshakeTimeout = 30 * time.Second
+)
+
+// ============================================================================
+// S3 Gateway Configuration
+// ============================================================================
+
+// S3 gateway configuration constants
+const (
+	// S3Region is the region the gateway reports for every bucket
+	S3Region = "us-east-1"
+
+	// S3MaxKeys is the largest number of keys returned by one listing
+	S3MaxKeys = 1000
+
+	// S3MinPartSize is the smallest size of every part of a multipart upload
+	// but the last
+	S3MinPartSize = 5 * 1024 * 1024
+
+	// S3MaxPartNumber is the highest part number of a multipart upload
+	S3MaxPartNumber = 10000
+
+	// S3MaxClockSkew is how far the time a request was signed may be from
+	// the server's clock
+	S3MaxClockSkew = 15 * time.Minute
+
+	// S3MaxPresignExpiry is the longest a presigned URL may be valid for
+	S3MaxPresignExpiry = 7 * 24 * time.Hour
+
+	// S3MaxXMLBody is the largest XML request body, such as the part list
+	// completing a multipart upload
+	S3MaxXMLBody = 1024 * 1024
+)
+
+// ============================================================================
+// Remote Storage Configuration
+// ============================================================================
+
+// Remote storage configuration constants
+const (
+	// RemoteMountRoot is the directory under which remote mount points are
+	// served. Nothing is stored there on the local disk.
+	RemoteMountRoot = "/.remote-mounts"
+
+	// RemoteTimeout is how long connecting to remote storage and waiting
+	// for the start of a response may take
+	RemoteTimeout = 30 * time.Second
+
+	// RemoteWriteBackDelay is how long a file written on an S3 or WebDAV
+	// mount is kept locally after its last handle is closed before it is
+	// uploaded, so that writes in quick succession, such as the chunks of
+	// an upload, are sent once
+	RemoteWriteBackDelay = 10 * time.Second
+
+	// RemotePartSize is the part size of multipart uploads to S3 mounts
+	RemotePartSize = 64 * 1024 * 1024
+)
+
 // ============================================================================
 // Data Storage Configuration
 // ============================================================================
@@ -118,6 +280,31 @@ const (
 
 	// DriveNamesFileName is the filename for storing custom drive names
 	DriveNamesFileName = "drive-names.json"
+
+	// SchedulesFileName is the filename for storing job schedules
+	SchedulesFileName = "schedules.json"
+
+	// UploadSessionsDirName is the directory storing in-flight upload sessions
+	UploadSessionsDirName = "uploads"
+
+	// HashIndexFileName is the append-only log mapping content hashes to
+	// files, used to deduplicate uploads
+	HashIndexFileName = "hash-index.jsonl"
+
+	// SharesFileName is the filename for storing public share links
+	SharesFileName = "shares.json"
+
+	// WebDAVPropsFileName is the filename for storing the properties WebDAV
+	// clients set on files and folders
+	WebDAVPropsFileName = "webdav-props.json"
+
+	// SFTPHostKeyFileName is the filename for the SFTP server's generated
+	// host key
+	SFTPHostKeyFileName = "sftp-host-key"
+
+	// S3UploadsDirName is the directory storing the parts of unfinished S3
+	// multipart uploads
+	S3UploadsDirName = "s3-uploads"
 )
 
 // ============================================================================
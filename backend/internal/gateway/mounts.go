@@ -0,0 +1,147 @@
+// Package gateway maps the paths of the file protocol gateways (SFTP,
+// WebDAV and S3) to the file service's mount points. The root of a gateway
+// is a read-only folder holding one folder per mount. Like the web
+// interface, the gateways show every mount point to every user; read-only
+// mounts refuse writes for everyone.
+package gateway
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/validator"
+	"github.com/homelab/filemanager/internal/service"
+)
+
+// Mounts resolves gateway paths against the file service's mount points
+type Mounts struct {
+	files  service.FileService
+	fs     filesystem.FS
+	denied error // What the gateway's protocol reports refused operations with
+}
+
+// NewMounts creates a resolver for a gateway that reports refused
+// operations with denied
+func NewMounts(fileService service.FileService, denied error) *Mounts {
+	return &Mounts{files: fileService, fs: fileService.GetFilesystem(), denied: denied}
+}
+
+// Target is a gateway path resolved to a mount point
+type Target struct {
+	Path   string // Virtual path; empty for the root
+	Mount  *model.MountPoint
+	FsPath string
+}
+
+// IsMount reports whether the target is a mount point's own folder
+func (t Target) IsMount() bool {
+	return t.Mount != nil && t.Path == strings.TrimPrefix(t.Mount.Name, "/")
+}
+
+// Resolve maps a gateway path to a mount point. The root resolves to a
+// target without a mount. Writes are refused on the root, directly below it
+// and on read-only mounts; other paths outside the mount points do not
+// exist.
+func (m *Mounts) Resolve(op, name string, write bool) (Target, error) {
+	virtual := strings.Trim(path.Clean("/"+name), "/")
+	if virtual == "" {
+		if write {
+			return Target{}, m.Denied(op, name)
+		}
+		return Target{}, nil
+	}
+
+	mount, fsPath, err := m.files.ResolvePath(virtual)
+	if err != nil {
+		// New entries directly below the root would be mount points
+		if errors.Is(err, validator.ErrOutsideMountPoint) && !(write && !strings.Contains(virtual, "/")) {
+			return Target{}, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		return Target{}, m.Denied(op, name)
+	}
+	if write && mount.ReadOnly {
+		return Target{}, m.Denied(op, name)
+	}
+	return Target{Path: virtual, Mount: mount, FsPath: fsPath}, nil
+}
+
+// Mount returns the mount point with a name, or nil
+func (m *Mounts) Mount(name string) *model.MountPoint {
+	for _, mount := range m.files.ListMountPoints() {
+		if strings.Trim(mount.Name, "/") == name {
+			return &mount
+		}
+	}
+	return nil
+}
+
+// List returns the folders of the mount points that exist, named after
+// their mounts
+func (m *Mounts) List() []fs.FileInfo {
+	var entries []fs.FileInfo
+	for _, mount := range m.files.ListMountPoints() {
+		info, err := m.fs.Stat(mount.Path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		entries = append(entries, namedInfo{FileInfo: info, name: strings.Trim(mount.Name, "/")})
+	}
+	return entries
+}
+
+// Stat returns information about a target. The root is described by
+// RootInfo and a mount point's folder is named after the mount.
+func (m *Mounts) Stat(t Target) (fs.FileInfo, error) {
+	if t.Mount == nil {
+		return RootInfo{}, nil
+	}
+
+	info, err := m.fs.Stat(t.FsPath)
+	if err != nil {
+		return nil, err
+	}
+	if t.IsMount() {
+		return namedInfo{FileInfo: info, name: t.Path}, nil
+	}
+	return info, nil
+}
+
+// CheckParent returns a not-exist error unless the target's parent folder
+// exists, so that clients do not create folders by accident
+func (m *Mounts) CheckParent(op, name string, t Target) error {
+	isDir, err := m.fs.IsDir(filepath.Dir(t.FsPath))
+	if err != nil || !isDir {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// Denied returns the gateway's error for a refused operation on a path
+func (m *Mounts) Denied(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: m.denied}
+}
+
+// RootInfo describes the root folder
+type RootInfo struct{}
+
+func (RootInfo) Name() string       { return "/" }
+func (RootInfo) Size() int64        { return 0 }
+func (RootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (RootInfo) ModTime() time.Time { return time.Time{} }
+func (RootInfo) IsDir() bool        { return true }
+func (RootInfo) Sys() any           { return nil }
+
+// namedInfo shows a mount point's folder under the mount's name
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i namedInfo) Name() string { return i.name }
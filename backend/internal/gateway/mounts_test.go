@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+)
+
+// errDenied stands in for a gateway's refusal error
+var errDenied = errors.New("denied")
+
+// newTestMounts returns a resolver for a writable and a read-only mount,
+// and a configured mount whose folder is missing
+func newTestMounts() *Mounts {
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media/photos", 0755)
+	fs.MkdirAll("/data/archive", 0755)
+	fileSvc := service.NewFileService(fs, service.FileServiceConfig{MountPoints: []model.MountPoint{
+		{Name: "media", Path: "/data/media"},
+		{Name: "archive", Path: "/data/archive", ReadOnly: true},
+		{Name: "missing", Path: "/data/missing"},
+	}})
+	return NewMounts(fileSvc, errDenied)
+}
+
+func TestResolve(t *testing.T) {
+	mounts := newTestMounts()
+	cases := []struct {
+		name   string
+		write  bool
+		fsPath string
+		mount  bool
+		err    error
+	}{
+		{name: "/", fsPath: ""},
+		{name: "/", write: true, err: errDenied},
+		{name: "media", fsPath: "/data/media", mount: true},
+		{name: "/media/photos/../photos", write: true, fsPath: "/data/media/photos"},
+		{name: "archive/old.txt", fsPath: "/data/archive/old.txt"},
+		{name: "archive/old.txt", write: true, err: errDenied},
+		{name: "other/file", err: os.ErrNotExist},
+		{name: "other/file", write: true, err: os.ErrNotExist},
+		{name: "other", write: true, err: errDenied},
+	}
+	for _, tc := range cases {
+		target, err := mounts.Resolve("test", tc.name, tc.write)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Resolve(%q, %v): expected %v, got %v", tc.name, tc.write, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || target.FsPath != tc.fsPath || target.IsMount() != tc.mount {
+			t.Errorf("Resolve(%q, %v) = %+v, %v; want %s, mount %v", tc.name, tc.write, target, err, tc.fsPath, tc.mount)
+		}
+	}
+}
+
+func TestListAndStat(t *testing.T) {
+	mounts := newTestMounts()
+
+	var names []string
+	for _, info := range mounts.List() {
+		names = append(names, info.Name())
+	}
+	if len(names) != 2 || names[0] != "media" || names[1] != "archive" {
+		t.Fatalf("expected the existing mount folders, got %v", names)
+	}
+
+	if info, err := mounts.Stat(Target{}); err != nil || info.Name() != "/" || !info.IsDir() {
+		t.Fatalf("expected the root folder, got %v (%v)", info, err)
+	}
+	target, _ := mounts.Resolve("stat", "media", false)
+	if info, err := mounts.Stat(target); err != nil || info.Name() != "media" {
+		t.Fatalf("expected the mount folder named after the mount, got %v (%v)", info, err)
+	}
+
+	if err := mounts.CheckParent("mkdir", "media/a/b", Target{FsPath: "/data/media/a/b"}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing parent to be reported, got %v", err)
+	}
+	if err := mounts.CheckParent("mkdir", "media/photos/b", Target{FsPath: "/data/media/photos/b"}); err != nil {
+		t.Fatalf("expected an existing parent to pass, got %v", err)
+	}
+}
@@ -0,0 +1,875 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/validator"
+)
+
+// batchesDirName is the directory of the upload state directory that holds
+// the batch records
+const batchesDirName = "batches"
+
+// errBatchFailed is reported to the other files of a batch when one of its
+// files cannot be finished
+var errBatchFailed = errors.New("another file of the batch failed")
+
+// UploadBatch groups the upload sessions of the files of a folder upload
+// under one destination root. An atomic batch keeps every complete file in
+// its temp file until all of them are complete, then moves them into place
+// together.
+type UploadBatch struct {
+	ID           string                 `json:"id"`
+	Owner        string                 `json:"owner"`
+	Root         string                 `json:"root"` // Virtual destination root
+	Atomic       bool                   `json:"atomic"`
+	ChunkSize    int64                  `json:"chunkSize"`
+	Files        []*BatchFile           `json:"files"`
+	Dirs         []string               `json:"dirs"` // Filesystem paths of the directories the batch created, parents first
+	State        model.UploadBatchState `json:"state"`
+	Error        string                 `json:"error,omitempty"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	LastActivity time.Time              `json:"lastActivity"`
+	mu           sync.Mutex
+	removed      bool // Set once the batch is gone, so that late saves do not recreate it
+}
+
+// BatchFile is one file of an upload batch
+type BatchFile struct {
+	Path     string `json:"path"` // Virtual path
+	FsPath   string `json:"fsPath"`
+	UploadID string `json:"uploadId,omitempty"` // Empty files have no session
+	Size     int64  `json:"size"`
+	Ready    bool   `json:"ready,omitempty"` // Complete and flushed, waiting for an atomic batch to commit
+	Done     bool   `json:"done,omitempty"`  // Moved into place
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// BatchRequest describes a folder upload
+type BatchRequest struct {
+	Root        string             `json:"root"`
+	Files       []BatchFileRequest `json:"files"`
+	Directories []string           `json:"directories"` // Directories to create even if empty, relative to root
+	Atomic      bool               `json:"atomic"`
+}
+
+// BatchFileRequest describes one file of a folder upload
+type BatchFileRequest struct {
+	Path string `json:"path"` // Relative to the batch root
+	Size int64  `json:"size"`
+}
+
+// BatchResponse describes an upload batch and its progress
+type BatchResponse struct {
+	BatchID        string                 `json:"batchId"`
+	Root           string                 `json:"root"`
+	Atomic         bool                   `json:"atomic"`
+	State          model.UploadBatchState `json:"state"`
+	Error          string                 `json:"error,omitempty"`
+	ChunkSize      int64                  `json:"chunkSize"`
+	TotalFiles     int                    `json:"totalFiles"`
+	CompletedFiles int                    `json:"completedFiles"`
+	TotalSize      int64                  `json:"totalSize"`
+	ReceivedBytes  int64                  `json:"receivedBytes"`
+	Files          []BatchFileResponse    `json:"files"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	LastActivity   time.Time              `json:"lastActivity"`
+}
+
+// BatchFileResponse describes one file of an upload batch. Files with an
+// upload ID are uploaded in chunks of the batch's chunk size to
+// /upload/{path} with that ID; empty files need no upload.
+type BatchFileResponse struct {
+	Path          string `json:"path"`
+	UploadID      string `json:"uploadId,omitempty"`
+	TotalSize     int64  `json:"totalSize"`
+	TotalChunks   int    `json:"totalChunks"`
+	ReceivedBytes int64  `json:"receivedBytes"`
+	Complete      bool   `json:"complete"`
+}
+
+// registerBatchRoutes registers the folder upload batch routes
+func (h *StreamHandler) registerBatchRoutes(r chi.Router) {
+	r.Post("/", h.CreateBatch)
+	r.Get("/{id}", h.GetBatch)
+	r.Delete("/{id}", h.CancelBatch)
+}
+
+// CreateBatch starts a folder upload: it validates every path against the
+// root, creates the directories and opens an upload session per file
+// POST /api/v1/stream/batches
+func (h *StreamHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	if req.Root == "" {
+		writeBadRequest(w, "root is required")
+		return
+	}
+	entries := len(req.Files) + len(req.Directories)
+	if entries == 0 {
+		writeBadRequest(w, "files or directories are required")
+		return
+	}
+	if entries > config.MaxBatchEntries {
+		writeBadRequest(w, fmt.Sprintf("A batch may have at most %d files and directories", config.MaxBatchEntries))
+		return
+	}
+
+	mount, rootFsPath, err := h.fileService.ResolvePath(req.Root)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+	if mount.ReadOnly {
+		writeError(w, "Mount point is read-only", model.ErrCodeReadOnly, http.StatusForbidden)
+		return
+	}
+	root := strings.Trim(path.Clean("/"+req.Root), "/")
+
+	owner, _ := requestUser(r)
+	batch := &UploadBatch{
+		Owner:     owner,
+		Root:      root,
+		Atomic:    req.Atomic,
+		ChunkSize: int64(h.chunkSizeMB) * config.BytesPerMB,
+		Files:     make([]*BatchFile, 0, len(req.Files)),
+	}
+
+	// Every entry must lie below the root, once, and no file may be the
+	// parent of another entry
+	rootFsPath = filepath.Clean(rootFsPath)
+	seen := make(map[string]bool, entries)
+	files := make(map[string]bool, len(req.Files))
+	resolve := func(rel string) (string, string, bool) {
+		fsPath, err := validator.SanitizePath(rootFsPath, rel)
+		if err != nil || fsPath == rootFsPath || seen[fsPath] {
+			writeBadRequest(w, fmt.Sprintf("Invalid or duplicate path %q", rel))
+			return "", "", false
+		}
+		seen[fsPath] = true
+		relPath, _ := filepath.Rel(rootFsPath, fsPath)
+		return fsPath, path.Join(root, filepath.ToSlash(relPath)), true
+	}
+	var dirs []string
+	for _, f := range req.Files {
+		if f.Size < 0 {
+			writeBadRequest(w, fmt.Sprintf("Invalid size for %q", f.Path))
+			return
+		}
+		fsPath, virtualPath, ok := resolve(f.Path)
+		if !ok {
+			return
+		}
+		files[fsPath] = true
+		batch.Files = append(batch.Files, &BatchFile{Path: virtualPath, FsPath: fsPath, Size: f.Size})
+		dirs = append(dirs, filepath.Dir(fsPath))
+	}
+	for _, d := range req.Directories {
+		fsPath, _, ok := resolve(d)
+		if !ok {
+			return
+		}
+		dirs = append(dirs, fsPath)
+	}
+	for entry := range seen {
+		for dir := filepath.Dir(entry); dir != rootFsPath; dir = filepath.Dir(dir) {
+			if files[dir] {
+				rel, _ := filepath.Rel(rootFsPath, dir)
+				writeBadRequest(w, fmt.Sprintf("%q is both a file and a directory", filepath.ToSlash(rel)))
+				return
+			}
+		}
+	}
+
+	if err := h.uploadManager.CreateBatch(batch, rootFsPath, dirs); err != nil {
+		if errors.Is(err, errBatchConflict) {
+			writeConflict(w, err.Error())
+			return
+		}
+		writeUploadError(w, "Failed to create upload batch", err)
+		return
+	}
+
+	writeJSON(w, h.uploadManager.batchResponse(batch), http.StatusCreated)
+}
+
+// GetBatch reports the progress of one of the current user's upload batches
+// GET /api/v1/stream/batches/{id}
+func (h *StreamHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, ok := h.ownBatch(r)
+	if !ok {
+		writeNotFound(w, "Upload batch not found")
+		return
+	}
+	writeJSON(w, h.uploadManager.batchResponse(batch), http.StatusOK)
+}
+
+// CancelBatch abandons one of the current user's upload batches. Files that
+// were already moved into place are kept.
+// DELETE /api/v1/stream/batches/{id}
+func (h *StreamHandler) CancelBatch(w http.ResponseWriter, r *http.Request) {
+	batch, ok := h.ownBatch(r)
+	if !ok {
+		writeNotFound(w, "Upload batch not found")
+		return
+	}
+	h.uploadManager.CancelBatch(batch)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownBatch returns the batch named in the request if it belongs to the
+// current user
+func (h *StreamHandler) ownBatch(r *http.Request) (*UploadBatch, bool) {
+	owner, _ := requestUser(r)
+	batch, ok := h.uploadManager.GetBatch(chi.URLParam(r, "id"))
+	if !ok || batch.Owner != owner {
+		return nil, false
+	}
+	return batch, true
+}
+
+// errBatchConflict is returned when a batch entry's destination is taken by
+// an entry of the other kind
+var errBatchConflict = errors.New("path conflicts with an existing entry")
+
+// CreateBatch admits a batch as a whole, then creates its directories, the
+// parents of its files among them, and an upload session per non-empty
+// file. Empty files are created right away, or on commit for an atomic
+// batch. Nothing is left behind if any step fails.
+func (m *UploadManager) CreateBatch(batch *UploadBatch, rootFsPath string, dirs []string) error {
+	var total, largest int64
+	for _, file := range batch.Files {
+		total += file.Size
+		largest = max(largest, file.Size)
+		if info, err := m.fs.Stat(file.FsPath); err == nil && info.IsDir() {
+			return fmt.Errorf("%w: %s", errBatchConflict, file.Path)
+		}
+	}
+
+	m.mu.Lock()
+	err := m.admit(batch.Owner, rootFsPath, total, largest)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	batch.ID = uuid.NewString()
+	batch.State = model.UploadBatchUploading
+	batch.CreatedAt = time.Now()
+	batch.LastActivity = batch.CreatedAt
+	batch.Dirs, err = m.missingDirs(rootFsPath, dirs)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	// Recorded first, so that nothing created below is left without a record
+	if err := m.saveBatch(batch); err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("failed to save upload batch: %w", err)
+	}
+	sessions, err := m.createBatchFiles(batch, rootFsPath)
+	if err != nil {
+		m.dropBatch(batch)
+		m.mu.Unlock()
+		return err
+	}
+	m.batches[batch.ID] = batch
+	m.mu.Unlock()
+
+	for _, session := range sessions {
+		m.notify(session, model.UploadEventCreated, "")
+	}
+	if len(sessions) == 0 {
+		// Nothing to upload; an atomic batch still creates its empty files
+		batch.State = model.UploadBatchCommitting
+		return m.commitBatch(batch)
+	}
+	return nil
+}
+
+// createBatchFiles creates a new batch's directories, its empty files unless
+// the batch is atomic, and its upload sessions. The caller must hold mu.
+func (m *UploadManager) createBatchFiles(batch *UploadBatch, rootFsPath string) ([]*UploadSession, error) {
+	for _, dir := range batch.Dirs {
+		if err := m.fs.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	var sessions []*UploadSession
+	for i, file := range batch.Files {
+		if file.Size == 0 {
+			file.Ready = true
+			continue
+		}
+		file.UploadID = batch.ID + "." + strconv.Itoa(i)
+		session := &UploadSession{
+			ID:          file.UploadID,
+			Owner:       batch.Owner,
+			Path:        file.Path,
+			TotalChunks: int((file.Size + batch.ChunkSize - 1) / batch.ChunkSize),
+			ChunkSize:   batch.ChunkSize,
+			TotalSize:   file.Size,
+			BatchID:     batch.ID,
+		}
+		if err := m.create(session, file.FsPath); err != nil {
+			for _, created := range sessions {
+				m.dropSession(created.ID)
+			}
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if !batch.Atomic {
+		for _, file := range batch.Files {
+			if file.Size == 0 {
+				if err := m.fs.WriteFile(file.FsPath, nil, 0644); err != nil {
+					for _, created := range sessions {
+						m.dropSession(created.ID)
+					}
+					return nil, fmt.Errorf("failed to create file: %w", err)
+				}
+				file.Done = true
+			}
+		}
+	}
+	if err := m.saveBatch(batch); err != nil {
+		for _, created := range sessions {
+			m.dropSession(created.ID)
+		}
+		return nil, fmt.Errorf("failed to save upload batch: %w", err)
+	}
+	return sessions, nil
+}
+
+// missingDirs returns the directories among dirs and their parents below
+// rootFsPath, including it, that do not exist yet, parents first. A file in
+// the place of one of them is a conflict.
+func (m *UploadManager) missingDirs(rootFsPath string, dirs []string) ([]string, error) {
+	rootFsPath = filepath.Clean(rootFsPath)
+	missing := make(map[string]bool)
+	for _, dir := range dirs {
+		for ; ; dir = filepath.Dir(dir) {
+			if missing[dir] {
+				break
+			}
+			if info, err := m.fs.Stat(dir); err == nil {
+				if !info.IsDir() {
+					rel, _ := filepath.Rel(rootFsPath, dir)
+					return nil, fmt.Errorf("%w: %s", errBatchConflict, filepath.ToSlash(rel))
+				}
+				break
+			}
+			missing[dir] = true
+			if dir == rootFsPath || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+
+	result := make([]string, 0, len(missing))
+	for dir := range missing {
+		result = append(result, dir)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// GetBatch retrieves an upload batch by ID
+func (m *UploadManager) GetBatch(id string) (*UploadBatch, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	batch, ok := m.batches[id]
+	return batch, ok
+}
+
+// FinishBatchFile handles a complete file of a batch and reports whether it
+// is in place. Outside an atomic batch the file is moved into place right
+// away; in an atomic batch it is flushed and waits until every file is
+// ready, when the whole batch is moved into place. A file that cannot be
+// finished fails the batch, abandoning its unfinished files.
+func (m *UploadManager) FinishBatchFile(session *UploadSession, fsPath, expectedChecksum string) (bool, error) {
+	batch, ok := m.GetBatch(session.BatchID)
+	if !ok {
+		return true, m.Finish(session, fsPath, expectedChecksum)
+	}
+
+	if !batch.Atomic {
+		if err := m.Finish(session, fsPath, expectedChecksum); err != nil {
+			m.failBatch(batch, err)
+			return false, err
+		}
+		m.notify(session, model.UploadEventAssembled, "")
+		batch.mu.Lock()
+		batch.file(session.ID).Done = true
+		batch.LastActivity = time.Now()
+		complete := batch.allDone()
+		batch.mu.Unlock()
+		if complete {
+			return true, m.completeBatch(batch)
+		}
+		return true, m.saveBatch(batch)
+	}
+
+	checksum, err := m.seal(session, expectedChecksum)
+	if err != nil {
+		m.DeleteSession(session.ID)
+		m.failBatch(batch, err)
+		return false, err
+	}
+	batch.mu.Lock()
+	file := batch.file(session.ID)
+	file.Ready = true
+	file.Checksum = checksum
+	batch.LastActivity = time.Now()
+	commit := batch.State == model.UploadBatchUploading && batch.allReady()
+	if commit {
+		batch.State = model.UploadBatchCommitting
+	}
+	batch.mu.Unlock()
+
+	if err := m.saveBatch(batch); err != nil {
+		return false, err
+	}
+	if !commit {
+		m.notify(session, model.UploadEventReady, "")
+		return false, nil
+	}
+	return true, m.commitBatch(batch)
+}
+
+// commitBatch moves every file of an atomic batch into place. If one of them
+// cannot be, the commit is rolled back before the batch fails, so that no
+// file of the batch is left in place. A commit cut short by a restart is
+// resumed on startup, skipping the files already moved. The sessions are
+// kept until every file is in place, and the files they replace until the
+// commit is complete.
+func (m *UploadManager) commitBatch(batch *UploadBatch) error {
+	batch.mu.Lock()
+	files := append([]*BatchFile(nil), batch.Files...)
+	batch.mu.Unlock()
+
+	for _, file := range files {
+		batch.mu.Lock()
+		done := file.Done
+		batch.mu.Unlock()
+		if done {
+			continue
+		}
+
+		err := m.placeBatchFile(batch, file)
+		if err == nil {
+			batch.mu.Lock()
+			file.Done = true
+			batch.mu.Unlock()
+			err = m.saveBatch(batch)
+		}
+		if err != nil {
+			m.rollbackBatch(batch, files)
+			m.failBatch(batch, err)
+			return err
+		}
+	}
+
+	var assembled []*UploadSession
+	m.mu.Lock()
+	for _, file := range files {
+		if session := m.dropSession(file.UploadID); session != nil {
+			assembled = append(assembled, session)
+		}
+	}
+	m.mu.Unlock()
+	for _, file := range files {
+		_ = m.fs.Remove(replacedPath(batch, file))
+		if m.hashes != nil && file.Checksum != "" {
+			m.hashes.Record(file.FsPath, file.Checksum)
+		}
+	}
+
+	err := m.completeBatch(batch)
+	for _, session := range assembled {
+		m.notify(session, model.UploadEventAssembled, "")
+	}
+	return err
+}
+
+// placeBatchFile moves one file of an atomic batch into place, or creates it
+// if it is empty. A file it replaces is moved aside first, so that a failed
+// commit can restore it.
+func (m *UploadManager) placeBatchFile(batch *UploadBatch, file *BatchFile) error {
+	tempPath := uploadTempPath(file.FsPath, file.UploadID)
+	if file.UploadID != "" {
+		if exists, _ := m.fs.Exists(tempPath); !exists {
+			// Moved before a restart
+			return nil
+		}
+	}
+
+	// A file moved aside before a restart is the one to restore
+	backup := replacedPath(batch, file)
+	if exists, _ := m.fs.Exists(backup); !exists {
+		if exists, _ := m.fs.Exists(file.FsPath); exists {
+			if err := m.fs.Rename(file.FsPath, backup); err != nil {
+				return fmt.Errorf("failed to move aside existing file: %w", err)
+			}
+		}
+	}
+
+	if file.UploadID == "" {
+		return m.fs.WriteFile(file.FsPath, nil, 0644)
+	}
+	if err := m.fs.Rename(tempPath, file.FsPath); err != nil {
+		return fmt.Errorf("failed to finalize uploaded file: %w", err)
+	}
+	return nil
+}
+
+// rollbackBatch undoes a failed commit: the files already moved into place
+// go back to their temp files, empty ones are removed, and the files they
+// replaced are restored
+func (m *UploadManager) rollbackBatch(batch *UploadBatch, files []*BatchFile) {
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		batch.mu.Lock()
+		done := file.Done
+		file.Done = false
+		batch.mu.Unlock()
+
+		if done {
+			if file.UploadID == "" {
+				_ = m.fs.Remove(file.FsPath)
+			} else {
+				_ = m.fs.Rename(file.FsPath, uploadTempPath(file.FsPath, file.UploadID))
+			}
+		}
+		backup := replacedPath(batch, file)
+		if exists, _ := m.fs.Exists(backup); exists {
+			_ = m.fs.Rename(backup, file.FsPath)
+		}
+	}
+}
+
+// replacedPath returns where a commit keeps the file a batch file replaces.
+// It is named like an upload temp file, so that listings skip it.
+func replacedPath(batch *UploadBatch, file *BatchFile) string {
+	return uploadTempPath(file.FsPath, batch.ID+".replaced")
+}
+
+// completeBatch marks a batch whose files are all in place as complete. It
+// is kept until it expires so that its final state can be queried.
+func (m *UploadManager) completeBatch(batch *UploadBatch) error {
+	batch.mu.Lock()
+	batch.State = model.UploadBatchComplete
+	batch.LastActivity = time.Now()
+	batch.mu.Unlock()
+	return m.saveBatch(batch)
+}
+
+// failBatch marks a batch as failed and abandons its unfinished files
+func (m *UploadManager) failBatch(batch *UploadBatch, cause error) {
+	batch.mu.Lock()
+	if batch.State == model.UploadBatchFailed || batch.State == model.UploadBatchComplete {
+		batch.mu.Unlock()
+		return
+	}
+	batch.State = model.UploadBatchFailed
+	batch.Error = cause.Error()
+	batch.LastActivity = time.Now()
+	batch.mu.Unlock()
+
+	m.mu.Lock()
+	abandoned := m.abandonBatch(batch)
+	m.mu.Unlock()
+	_ = m.saveBatch(batch)
+
+	for _, session := range abandoned {
+		m.notify(session, model.UploadEventFailed, errBatchFailed.Error())
+	}
+}
+
+// CancelBatch removes a batch and abandons its unfinished files
+func (m *UploadManager) CancelBatch(batch *UploadBatch) {
+	m.mu.Lock()
+	abandoned := m.dropBatch(batch)
+	m.mu.Unlock()
+
+	for _, session := range abandoned {
+		m.notify(session, model.UploadEventCancelled, "")
+	}
+}
+
+// abandonBatch removes the sessions of a batch's unfinished files, and then
+// the directories the batch created that are left empty. It returns the
+// removed sessions. The caller must hold mu.
+//
+// Lock order: the manager's mu is taken before a batch's mu, never the other
+// way round, so code holding a batch's mu must not call methods that take the
+// manager's mu, such as GetSession.
+func (m *UploadManager) abandonBatch(batch *UploadBatch) []*UploadSession {
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+
+	var abandoned []*UploadSession
+	for _, file := range batch.Files {
+		if file.UploadID == "" || file.Done {
+			continue
+		}
+		if session := m.dropSession(file.UploadID); session != nil {
+			abandoned = append(abandoned, session)
+		}
+	}
+	for i := len(batch.Dirs) - 1; i >= 0; i-- {
+		if entries, err := m.fs.ReadDir(batch.Dirs[i]); err == nil && len(entries) == 0 {
+			_ = m.fs.Remove(batch.Dirs[i])
+		}
+	}
+	return abandoned
+}
+
+// dropBatch abandons a batch's unfinished files and removes the batch and its
+// record, returning the removed sessions. The caller must hold mu.
+func (m *UploadManager) dropBatch(batch *UploadBatch) []*UploadSession {
+	abandoned := m.abandonBatch(batch)
+	delete(m.batches, batch.ID)
+
+	batch.mu.Lock()
+	batch.removed = true
+	batch.mu.Unlock()
+	_ = m.fs.Remove(m.batchRecordPath(batch.ID))
+	return abandoned
+}
+
+// expireBatches removes the batches without activity for longer than the
+// session timeout, abandoning their unfinished files, and returns the
+// removed sessions. The caller must hold mu.
+func (m *UploadManager) expireBatches(now time.Time) []*UploadSession {
+	var expired []*UploadSession
+	for _, batch := range m.batches {
+		batch.mu.Lock()
+		last := batch.LastActivity
+		uploadIDs := make([]string, 0, len(batch.Files))
+		for _, file := range batch.Files {
+			uploadIDs = append(uploadIDs, file.UploadID)
+		}
+		batch.mu.Unlock()
+
+		for _, id := range uploadIDs {
+			if session, ok := m.sessions[id]; ok {
+				if activity := session.GetLastActivity(); activity.After(last) {
+					last = activity
+				}
+			}
+		}
+		if now.Sub(last) > config.SessionTimeout {
+			expired = append(expired, m.dropBatch(batch)...)
+		}
+	}
+	return expired
+}
+
+// batchRecordPath returns the path of a batch's record
+func (m *UploadManager) batchRecordPath(id string) string {
+	return filepath.Join(m.stateDir, batchesDirName, id+".json")
+}
+
+// saveBatch writes a batch's current state to its record, replacing the
+// previous one atomically
+func (m *UploadManager) saveBatch(batch *UploadBatch) error {
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+	if batch.removed {
+		return nil
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	path := m.batchRecordPath(batch.ID)
+	if err := m.fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := m.fs.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return m.fs.Rename(path+".tmp", path)
+}
+
+// restoreBatches rebuilds the batches recorded by an earlier run, after
+// their sessions. Unfinished work is picked up again: a commit cut short is
+// completed, files whose last chunk arrived just before the restart are
+// finished, and a batch whose sessions are gone fails. Sessions of batches
+// that are gone are removed.
+func (m *UploadManager) restoreBatches() error {
+	dir := filepath.Join(m.stateDir, batchesDirName)
+	entries, err := m.fs.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read upload batches: %w", err)
+	}
+
+	var restored []*UploadBatch
+	m.mu.Lock()
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			_ = m.fs.Remove(path)
+			continue
+		}
+		data, err := m.fs.ReadFile(path)
+		batch := &UploadBatch{}
+		if err != nil || json.Unmarshal(data, batch) != nil || batch.ID != id || batch.ChunkSize < 1 {
+			_ = m.fs.Remove(path)
+			continue
+		}
+		m.batches[id] = batch
+		restored = append(restored, batch)
+	}
+	for id, session := range m.sessions {
+		if session.BatchID != "" && m.batches[session.BatchID] == nil {
+			m.dropSession(id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, batch := range restored {
+		m.resumeBatch(batch)
+	}
+	return nil
+}
+
+// resumeBatch continues the work a restart interrupted on a restored batch
+func (m *UploadManager) resumeBatch(batch *UploadBatch) {
+	switch batch.State {
+	case model.UploadBatchCommitting:
+		_ = m.commitBatch(batch)
+		return
+	case model.UploadBatchUploading:
+	default:
+		return
+	}
+
+	for _, file := range batch.Files {
+		if file.UploadID == "" || file.Done {
+			continue
+		}
+		session, ok := m.GetSession(file.UploadID)
+		if !ok {
+			m.failBatch(batch, fmt.Errorf("upload of %s was lost", file.Path))
+			return
+		}
+		if file.Ready {
+			// Sealed before the restart
+			session.claimFinish()
+			continue
+		}
+		if session.claimFinish() {
+			if _, err := m.FinishBatchFile(session, file.FsPath, ""); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// file returns the batch file uploaded by a session. The caller must hold
+// the batch's mu.
+func (b *UploadBatch) file(uploadID string) *BatchFile {
+	for _, file := range b.Files {
+		if file.UploadID == uploadID {
+			return file
+		}
+	}
+	return &BatchFile{}
+}
+
+// allDone reports whether every file is in place. The caller must hold mu.
+func (b *UploadBatch) allDone() bool {
+	for _, file := range b.Files {
+		if !file.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// allReady reports whether every file is ready to be moved into place. The
+// caller must hold mu.
+func (b *UploadBatch) allReady() bool {
+	for _, file := range b.Files {
+		if !file.Ready && !file.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// batchResponse describes a batch and the progress of its files. The
+// sessions of the files still uploading are looked up after releasing the
+// batch's mu, keeping to the lock order.
+func (m *UploadManager) batchResponse(batch *UploadBatch) BatchResponse {
+	batch.mu.Lock()
+	resp := BatchResponse{
+		BatchID:      batch.ID,
+		Root:         batch.Root,
+		Atomic:       batch.Atomic,
+		State:        batch.State,
+		Error:        batch.Error,
+		ChunkSize:    batch.ChunkSize,
+		TotalFiles:   len(batch.Files),
+		Files:        make([]BatchFileResponse, len(batch.Files)),
+		CreatedAt:    batch.CreatedAt,
+		LastActivity: batch.LastActivity,
+	}
+	var uploading []int
+	for i, file := range batch.Files {
+		received := file.Size
+		if !file.Ready && !file.Done {
+			received = 0
+			uploading = append(uploading, i)
+		}
+		complete := file.Done
+		resp.Files[i] = BatchFileResponse{
+			Path:          file.Path,
+			UploadID:      file.UploadID,
+			TotalSize:     file.Size,
+			TotalChunks:   int((file.Size + batch.ChunkSize - 1) / batch.ChunkSize),
+			ReceivedBytes: received,
+			Complete:      complete,
+		}
+		resp.TotalSize += file.Size
+		resp.ReceivedBytes += received
+		if complete {
+			resp.CompletedFiles++
+		}
+	}
+	batch.mu.Unlock()
+
+	for _, i := range uploading {
+		if session, ok := m.GetSession(resp.Files[i].UploadID); ok {
+			received := session.GetOffset()
+			resp.Files[i].ReceivedBytes = received
+			resp.ReceivedBytes += received
+		}
+	}
+	return resp
+}
@@ -0,0 +1,305 @@
+// Package handler provides HTTP handlers for the file manager API.
+// This file contains property-based tests for folder upload batches.
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	iofs "io/fs"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// createBatch starts a folder upload and returns the status code and batch
+func createBatch(router http.Handler, req BatchRequest) (int, BatchResponse) {
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, asUser(httptest.NewRequest("POST", "/api/v1/batches", bytes.NewReader(body)), "alice"))
+	var resp BatchResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp
+}
+
+// uploadBatchFile uploads a batch file as a single chunk, with a final
+// checksum that is wrong if corrupt is set, and returns the status code
+func uploadBatchFile(router http.Handler, batch BatchResponse, file BatchFileResponse, content []byte, corrupt bool) int {
+	sum := sha256.Sum256(content)
+	if corrupt {
+		sum[0]++
+	}
+	req := httptest.NewRequest("POST", "/api/v1/upload/"+file.Path, bytes.NewReader(content))
+	req.Header.Set("X-Upload-ID", file.UploadID)
+	req.Header.Set("X-Batch-ID", batch.BatchID)
+	req.Header.Set("X-Chunk-Index", "0")
+	req.Header.Set("X-Total-Chunks", "1")
+	req.Header.Set("X-Chunk-Size", strconv.FormatInt(batch.ChunkSize, 10))
+	req.Header.Set("X-Total-Size", strconv.Itoa(len(content)))
+	req.Header.Set("X-Checksum", "sha256:"+hex.EncodeToString(sum[:]))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, asUser(req, "alice"))
+	return rec.Code
+}
+
+// getBatch returns the progress of a batch
+func getBatch(router http.Handler, id string) (int, BatchResponse) {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, asUser(httptest.NewRequest("GET", "/api/v1/batches/"+id, nil), "alice"))
+	var resp BatchResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp
+}
+
+// **Feature: homelab-file-manager, Property 37: Folder Upload Batches**
+//
+// Property: For any folder of files uploaded as a batch in any order, every file SHALL end
+// up at its relative path below the batch root with its original content, and the batch
+// SHALL report its files complete with all bytes received. An all-or-nothing batch SHALL
+// move no file into place before every file is complete, and when one of its files fails,
+// no file SHALL be moved into place and the directories it created SHALL be removed. A
+// batch with a path escaping its root SHALL be rejected without creating anything.
+
+func TestProperty_FolderUploadBatches(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 10
+
+	properties := gopter.NewProperties(parameters)
+
+	dirNames := []string{"src", "docs", "src/lib", "assets/img"}
+
+	properties.Property("folders are uploaded with their structure", prop.ForAll(
+		func(sizes []int, dirIdx []int, atomic bool, fail int, escape bool, seed int64) bool {
+			handler, fs, _ := setupTestStreamHandler()
+			router := createStreamTestRouter(handler)
+
+			req := BatchRequest{Root: "media/project", Atomic: atomic, Directories: []string{"empty/dir"}}
+			contents := make(map[string][]byte)
+			for i, size := range sizes {
+				rel := fmt.Sprintf("%s/file-%d.txt", dirNames[dirIdx[i%len(dirIdx)]], i)
+				content := bytes.Repeat([]byte{byte('a' + i%26)}, size)
+				contents["media/project/"+rel] = content
+				req.Files = append(req.Files, BatchFileRequest{Path: rel, Size: int64(size)})
+			}
+
+			if escape {
+				bad := req
+				bad.Files = append(append([]BatchFileRequest(nil), req.Files...), BatchFileRequest{Path: "../outside.txt", Size: 1})
+				if code, _ := createBatch(router, bad); code != http.StatusBadRequest {
+					return false
+				}
+				if exists, _ := fs.Exists("/data/media/project"); exists {
+					return false
+				}
+			}
+
+			code, batch := createBatch(router, req)
+			if code != http.StatusCreated || len(batch.Files) != len(sizes) {
+				return false
+			}
+			if isDir, _ := fs.IsDir("/data/media/project/empty/dir"); !isDir {
+				return false
+			}
+
+			// Files are uploaded in a random order; one of them fails when
+			// fail picks a non-empty file
+			order := rand.New(rand.NewSource(seed)).Perm(len(batch.Files))
+			failing := -1
+			if fail < len(batch.Files) && batch.Files[fail].UploadID != "" {
+				failing = fail
+			}
+			pending := 0
+			for _, file := range batch.Files {
+				if file.UploadID != "" {
+					pending++
+				}
+			}
+			for _, i := range order {
+				file := batch.Files[i]
+				if file.UploadID == "" {
+					continue
+				}
+				if i == failing {
+					if uploadBatchFile(router, batch, file, contents[file.Path], true) != http.StatusUnprocessableEntity {
+						return false
+					}
+					break
+				}
+				code := uploadBatchFile(router, batch, file, contents[file.Path], false)
+				if code != http.StatusCreated && code != http.StatusAccepted {
+					return false
+				}
+				pending--
+
+				// Nothing of an atomic batch is in place before its last file
+				if atomic && pending > 0 {
+					for _, other := range batch.Files {
+						if exists, _ := fs.Exists("/data/" + other.Path); exists && other.UploadID != "" {
+							return false
+						}
+					}
+				}
+			}
+
+			code, status := getBatch(router, batch.BatchID)
+			if code != http.StatusOK {
+				return false
+			}
+
+			if failing >= 0 {
+				if status.State != model.UploadBatchFailed {
+					return false
+				}
+				if atomic {
+					for _, file := range batch.Files {
+						if exists, _ := fs.Exists("/data/" + file.Path); exists {
+							return false
+						}
+					}
+					if exists, _ := fs.Exists("/data/media/project"); exists {
+						return false
+					}
+				}
+				for _, session := range handler.uploadManager.ListSessions("alice") {
+					if session.BatchID == batch.BatchID {
+						return false
+					}
+				}
+				return true
+			}
+
+			if status.State != model.UploadBatchComplete || status.CompletedFiles != len(sizes) ||
+				status.ReceivedBytes != status.TotalSize {
+				return false
+			}
+			for virtualPath, content := range contents {
+				data, err := fs.ReadFile("/data/" + virtualPath)
+				if err != nil || !bytes.Equal(data, content) {
+					return false
+				}
+			}
+			entries, _ := fs.ReadDir("/data/media/project/src")
+			for _, entry := range entries {
+				if strings.Contains(entry.Name(), ".uploading.") {
+					return false
+				}
+			}
+			return true
+		},
+		gen.SliceOf(gen.IntRange(0, 30)),
+		gen.SliceOfN(3, gen.IntRange(0, len(dirNames)-1)),
+		gen.Bool(),
+		gen.IntRange(0, 15),
+		gen.Bool(),
+		gen.Int64(),
+	))
+
+	properties.TestingRun(t)
+}
+
+func TestRestoreBatchKeepsReadyFiles(t *testing.T) {
+	handler, fs, fileSvc := setupTestStreamHandler()
+	router := createStreamTestRouter(handler)
+
+	contents := map[string][]byte{"media/project/a.txt": []byte("abc"), "media/project/b/c.txt": []byte("defg")}
+	code, batch := createBatch(router, BatchRequest{
+		Root:   "media/project",
+		Atomic: true,
+		Files:  []BatchFileRequest{{Path: "a.txt", Size: 3}, {Path: "b/c.txt", Size: 4}},
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("create batch: got %d", code)
+	}
+	if code := uploadBatchFile(router, batch, batch.Files[0], contents[batch.Files[0].Path], false); code != http.StatusAccepted {
+		t.Fatalf("first file: expected 202, got %d", code)
+	}
+
+	restarted := NewStreamHandler(fileSvc, nil, StreamHandlerConfig{ChunkSizeMB: 1})
+	if restored, err := restarted.RestoreUploads(); err != nil || restored != 2 {
+		t.Fatalf("expected 2 restored sessions, got %d (%v)", restored, err)
+	}
+	router = createStreamTestRouter(restarted)
+
+	if _, status := getBatch(router, batch.BatchID); status.State != model.UploadBatchUploading || status.ReceivedBytes != 3 {
+		t.Fatalf("expected an uploading batch with 3 bytes received, got %s with %d", status.State, status.ReceivedBytes)
+	}
+	if exists, _ := fs.Exists("/data/media/project/a.txt"); exists {
+		t.Fatal("expected the ready file to wait for the rest of the batch")
+	}
+
+	if code := uploadBatchFile(router, batch, batch.Files[1], contents[batch.Files[1].Path], false); code != http.StatusCreated {
+		t.Fatalf("last file: expected 201, got %d", code)
+	}
+	for virtualPath, content := range contents {
+		if data, err := fs.ReadFile("/data/" + virtualPath); err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("expected %s to be in place, got %q (%v)", virtualPath, data, err)
+		}
+	}
+	if _, status := getBatch(router, batch.BatchID); status.State != model.UploadBatchComplete || status.CompletedFiles != 2 {
+		t.Fatalf("expected a complete batch, got %s with %d files", status.State, status.CompletedFiles)
+	}
+}
+
+// failingRenameFS fails every rename onto one path
+type failingRenameFS struct {
+	*filesystem.AferoFS
+	target string
+}
+
+// Rename fails when newpath is the target
+func (f *failingRenameFS) Rename(oldpath, newpath string) error {
+	if newpath == f.target {
+		return &iofs.PathError{Op: "rename", Path: oldpath, Err: iofs.ErrPermission}
+	}
+	return f.AferoFS.Rename(oldpath, newpath)
+}
+
+func TestAtomicBatchRollsBackFailedCommit(t *testing.T) {
+	handler, fs, _ := setupTestStreamHandler()
+	router := createStreamTestRouter(handler)
+	fs.MkdirAll("/data/media/project", 0755)
+	fs.WriteFile("/data/media/project/a.txt", []byte("old"), 0644)
+	handler.uploadManager.fs = &failingRenameFS{AferoFS: fs, target: "/data/media/project/b.txt"}
+
+	code, batch := createBatch(router, BatchRequest{
+		Root:   "media/project",
+		Atomic: true,
+		Files:  []BatchFileRequest{{Path: "a.txt", Size: 3}, {Path: "b.txt", Size: 4}},
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("create batch: got %d", code)
+	}
+	if code := uploadBatchFile(router, batch, batch.Files[0], []byte("new"), false); code != http.StatusAccepted {
+		t.Fatalf("first file: expected 202, got %d", code)
+	}
+	if code := uploadBatchFile(router, batch, batch.Files[1], []byte("defg"), false); code == http.StatusCreated {
+		t.Fatal("expected the commit to fail")
+	}
+
+	if data, err := fs.ReadFile("/data/media/project/a.txt"); err != nil || string(data) != "old" {
+		t.Fatalf("expected the replaced file to be restored, got %q (%v)", data, err)
+	}
+	entries, _ := fs.ReadDir("/data/media/project")
+	if len(entries) != 1 {
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Fatalf("expected only the original file to be left, got %v", names)
+	}
+	if _, status := getBatch(router, batch.BatchID); status.State != model.UploadBatchFailed || status.CompletedFiles != 0 {
+		t.Fatalf("expected a failed batch with no file in place, got %s with %d", status.State, status.CompletedFiles)
+	}
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+)
+
+// maxUniqueNameAttempts bounds the search for a free name for a dropped file
+const maxUniqueNameAttempts = 10000
+
+// DropUpload receives a guest's chunked upload through a drop link. It takes
+// the same headers as Upload, except X-Batch-ID, and the password of a
+// protected link in X-Share-Password; it is not accepted in the URL. The link
+// is checked when the upload starts and again when it completes; the file is
+// stored under a name that is not taken yet, and the link's owner is notified.
+// POST /api/v1/s/:token/upload/:name
+func (h *ShareHandler) DropUpload(w http.ResponseWriter, r *http.Request) {
+	uploadReq, err := h.stream.parseUploadHeaders(r)
+	if err != nil {
+		writeError(w, err.Error(), model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	if uploadReq.BatchID != "" {
+		writeBadRequest(w, "Drop links do not accept folder uploads")
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+	shareReq := model.ShareRequest{
+		Token:      token,
+		Password:   r.Header.Get("X-Share-Password"),
+		Path:       path.Clean("/" + chi.URLParam(r, "name")),
+		Action:     model.ShareActionUpload,
+		RemoteAddr: r.RemoteAddr,
+		Size:       uploadReq.TotalSize,
+	}
+
+	// Sessions are tied to the link, so chunks cannot be sent to another
+	// user's upload. The target is fixed by the first chunk.
+	var dropTarget string
+	var limit SessionLimit
+	if session, ok := h.stream.uploadManager.GetSession(uploadReq.UploadID); ok && session.Owner == dropOwner(token) {
+		dropTarget = session.Path
+	} else {
+		var share *model.Share
+		share, dropTarget, err = h.shareService.Open(r.Context(), shareReq)
+		if err != nil {
+			HandleServiceError(w, err)
+			return
+		}
+		limit = dropSessionLimit(share)
+	}
+	shareReq.Path = path.Base(dropTarget)
+
+	h.stream.receiveChunk(w, r, uploadReq, uploadTarget{
+		Path:  dropTarget,
+		Owner: dropOwner(token),
+		Limit: limit,
+		Place: func(session *UploadSession, fsPath, checksum string) (string, error) {
+			share, placed, err := h.shareService.CompleteUpload(r.Context(), shareReq, func(target string) (string, error) {
+				dst, err := uniqueFilePath(h.fileService.GetFilesystem(), fsPath)
+				if err != nil {
+					return "", err
+				}
+				if err := h.stream.uploadManager.Finish(session, dst, checksum); err != nil {
+					return "", err
+				}
+				return path.Join(path.Dir(target), filepath.Base(dst)), nil
+			})
+			if err != nil {
+				// Refused before the upload was moved into place
+				h.stream.uploadManager.DeleteSession(session.ID)
+				return "", err
+			}
+
+			if h.hub != nil {
+				h.hub.SendShareUpload(share.Owner, model.ShareUploadEvent{
+					ShareID:    share.ID,
+					Path:       placed,
+					Size:       session.TotalSize,
+					RemoteAddr: r.RemoteAddr,
+					Time:       time.Now(),
+				})
+			}
+			// Guests only learn the name the file was stored under
+			return path.Base(placed), nil
+		},
+	})
+}
+
+// dropOwner returns the owner of upload sessions started through a drop
+// link. It is derived from the token without revealing it.
+func dropOwner(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "share:" + hex.EncodeToString(sum[:8])
+}
+
+// dropSessionLimit returns what is left of a drop link's limits after its
+// finished uploads. The unfinished uploads through the link share it, since
+// each one already takes up its full size in the folder.
+func dropSessionLimit(share *model.Share) SessionLimit {
+	var limit SessionLimit
+	if share.Drop.MaxBytes > 0 {
+		limit.MaxBytes = share.Drop.MaxBytes - share.UploadedBytes
+	}
+	if share.Drop.MaxFiles > 0 {
+		limit.MaxFiles = share.Drop.MaxFiles - share.Uploads
+	}
+	return limit
+}
+
+// uniqueFilePath returns fsPath, or if it is taken, the first free path
+// that adds " (n)" before its extension
+func uniqueFilePath(fs filesystem.FS, fsPath string) (string, error) {
+	ext := filepath.Ext(fsPath)
+	base := strings.TrimSuffix(fsPath, ext)
+	candidate := fsPath
+	for n := 1; n <= maxUniqueNameAttempts; n++ {
+		exists, err := fs.Exists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	return "", fmt.Errorf("no free name for %s", filepath.Base(fsPath))
+}
@@ -32,6 +32,28 @@ var serviceErrorMappings = []ErrorMapping{
 	{service.ErrJobNotCancellable, "Job cannot be cancelled", model.ErrCodeValidationError, http.StatusBadRequest},
 	{service.ErrInvalidJobType, "Invalid job type", model.ErrCodeValidationError, http.StatusBadRequest},
 	{service.ErrInvalidJobParams, "Invalid job parameters", model.ErrCodeValidationError, http.StatusBadRequest},
+	{service.ErrJobNotRetryable, "Job cannot be retried", model.ErrCodeValidationError, http.StatusBadRequest},
+	{service.ErrJobNotQueued, "Job is not queued", model.ErrCodeConflict, http.StatusConflict},
+	{service.ErrNoSyncReport, "Sync report not available", model.ErrCodeNotFound, http.StatusNotFound},
+	{service.ErrFetchNotAllowed, "Downloads from this host are not allowed", model.ErrCodeAccessDenied, http.StatusForbidden},
+
+	// Schedule service errors
+	{service.ErrScheduleNotFound, "Schedule not found", model.ErrCodeNotFound, http.StatusNotFound},
+	{service.ErrInvalidSchedule, "Invalid schedule", model.ErrCodeValidationError, http.StatusBadRequest},
+	{service.ErrPriorityNotAllowed, "High priority requires admin rights", model.ErrCodePermissionDenied, http.StatusForbidden},
+
+	// Share service errors
+	{service.ErrShareNotFound, "Share not found", model.ErrCodeNotFound, http.StatusNotFound},
+	{service.ErrInvalidShare, "Invalid share", model.ErrCodeValidationError, http.StatusBadRequest},
+	{service.ErrShareExpired, "Share link has expired", model.ErrCodeShareUnavailable, http.StatusGone},
+	{service.ErrShareExhausted, "Share link usage limit reached", model.ErrCodeShareUnavailable, http.StatusGone},
+	{service.ErrSharePasswordRequired, "Password required", model.ErrCodePasswordRequired, http.StatusUnauthorized},
+	{service.ErrShareInvalidPassword, "Invalid password", model.ErrCodeUnauthorized, http.StatusUnauthorized},
+	{service.ErrShareUploadOnly, "Share link only accepts uploads", model.ErrCodeAccessDenied, http.StatusForbidden},
+	{service.ErrShareNotWritable, "Share link does not accept uploads", model.ErrCodeAccessDenied, http.StatusForbidden},
+	{service.ErrShareFileTooLarge, "File exceeds the share link's size limit", model.ErrCodeValidationError, http.StatusRequestEntityTooLarge},
+	{service.ErrShareQuotaExceeded, "Share link upload quota exceeded", model.ErrCodeQuotaExceeded, http.StatusRequestEntityTooLarge},
+	{service.ErrInvalidUploadName, "Upload name must be a plain file name", model.ErrCodeValidationError, http.StatusBadRequest},
 
 	// Search service errors
 	{service.ErrEmptyQuery, "Search query cannot be empty", model.ErrCodeValidationError, http.StatusBadRequest},
@@ -43,15 +65,23 @@ var serviceErrorMappings = []ErrorMapping{
 	{service.ErrTokenRevoked, "Token has been revoked", model.ErrCodeTokenInvalid, http.StatusUnauthorized},
 }
 
-// HandleServiceError converts service errors to HTTP responses
-// This is the centralized error handler that should be used by all handlers
-func HandleServiceError(w http.ResponseWriter, err error) {
+// lookupServiceError returns the HTTP response mapping of a service error
+func lookupServiceError(err error) (ErrorMapping, bool) {
 	for _, mapping := range serviceErrorMappings {
 		if errors.Is(err, mapping.Error) {
-			writeError(w, mapping.Message, mapping.Code, mapping.StatusCode)
-			return
+			return mapping, true
 		}
 	}
+	return ErrorMapping{}, false
+}
+
+// HandleServiceError converts service errors to HTTP responses
+// This is the centralized error handler that should be used by all handlers
+func HandleServiceError(w http.ResponseWriter, err error) {
+	if mapping, ok := lookupServiceError(err); ok {
+		writeError(w, mapping.Message, mapping.Code, mapping.StatusCode)
+		return
+	}
 	// Default to internal server error
 	writeError(w, "Internal server error", model.ErrCodeInternalError, http.StatusInternalServerError)
 }
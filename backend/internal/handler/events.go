@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+
+	ws "github.com/homelab/filemanager/internal/websocket"
+)
+
+// EventsHandler streams hub events as Server-Sent Events, for clients whose
+// network does not let WebSocket upgrades through
+type EventsHandler struct {
+	hub *ws.Hub
+}
+
+// NewEventsHandler creates a new events handler
+func NewEventsHandler(hub *ws.Hub) *EventsHandler {
+	return &EventsHandler{
+		hub: hub,
+	}
+}
+
+// ServeSSE streams the events a WebSocket client would receive. Each "job"
+// parameter subscribes to a job and each "watch" parameter watches a
+// directory, as the matching WebSocket messages do. A reconnecting client
+// resumes after the resume token in Last-Event-ID, or in "since".
+// GET /api/v1/events?job=&watch=&since=
+func (h *EventsHandler) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeInternalError(w, "Streaming not supported")
+		return
+	}
+
+	username, admin := requestUser(r)
+	client := ws.NewStreamClient(h.hub, username, admin)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("since")
+	}
+	if epoch, since, ok := ws.ParseResumeToken(lastID); ok {
+		client.ResumeAfter(epoch, since)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	h.hub.Register(client)
+	for _, jobID := range r.URL.Query()["job"] {
+		client.Handle(ws.ClientMessage{Type: ws.MessageTypeSubscribe, JobID: jobID})
+	}
+	for _, dir := range r.URL.Query()["watch"] {
+		client.Handle(ws.ClientMessage{Type: ws.MessageTypeWatch, Path: dir})
+	}
+
+	if err := client.WriteEvents(r.Context(), w, flusher.Flush); err != nil {
+		// The client went away; the hub has not closed it yet
+		h.hub.Unregister(client)
+	}
+}
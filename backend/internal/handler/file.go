@@ -93,7 +93,7 @@ func (h *FileHandler) GetPath(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse query parameters for listing options
-	opts := h.parseListOptions(r)
+	opts := parseListOptions(r)
 
 	// Check if this is a directory or file
 	info, err := h.fileService.GetInfo(r.Context(), path)
@@ -238,7 +238,7 @@ func (h *FileHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 
 // parseListOptions extracts listing options from query parameters
-func (h *FileHandler) parseListOptions(r *http.Request) model.ListOptions {
+func parseListOptions(r *http.Request) model.ListOptions {
 	opts := model.DefaultListOptions()
 
 	if page := r.URL.Query().Get("page"); page != "" {
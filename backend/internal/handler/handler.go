@@ -6,7 +6,8 @@
 //   - AuthHandler: Authentication (login, logout, token refresh)
 //   - FileHandler: File operations (list, create, rename, delete)
 //   - StreamHandler: Streaming uploads and downloads
-//   - JobHandler: Background job management (copy, move, delete)
+//   - JobHandler: Background job management (copy, move, delete, sync)
+//   - ScheduleHandler: Recurring job schedules
 //   - SearchHandler: File search operations
 //   - WebSocketHandler: Real-time updates via WebSocket
 //   - SystemHandler: System information (drives, mount points)
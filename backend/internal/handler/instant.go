@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+)
+
+// Ways an instant upload places an existing file's contents at its destination
+const (
+	instantMethodReflink = "reflink"
+	instantMethodCopy    = "copy"
+)
+
+// errInstantSourceChanged is returned when the indexed file no longer holds
+// the requested content by the time it is copied
+var errInstantSourceChanged = errors.New("source file changed")
+
+// InstantUploadRequest describes a file the client is about to upload
+type InstantUploadRequest struct {
+	Checksum string `json:"checksum"` // Hex SHA256 of the whole file, optionally prefixed with "sha256:"
+	Size     int64  `json:"size"`
+}
+
+// InstantUploadResponse reports whether an upload was satisfied from a file
+// already on the server
+type InstantUploadResponse struct {
+	Path         string `json:"path"`
+	Deduplicated bool   `json:"deduplicated"`
+	Method       string `json:"method,omitempty"` // reflink or copy
+}
+
+// InstantUpload places a file at path without transferring it when a file
+// with the same content already exists on a configured mount. Otherwise it
+// reports that the client must upload the file as usual. Files outside the
+// mount points are never used as a source, and a file that exists but cannot
+// be used gets the same answer as one that does not exist.
+// POST /api/v1/stream/instant/*path
+func (h *StreamHandler) InstantUpload(w http.ResponseWriter, r *http.Request) {
+	path := chi.URLParam(r, "*")
+	if path == "" {
+		writeError(w, "Path is required", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+
+	var req InstantUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	checksum := strings.ToLower(strings.TrimPrefix(req.Checksum, "sha256:"))
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		writeBadRequest(w, "checksum must be a hex SHA256 digest")
+		return
+	}
+	if req.Size < 1 {
+		writeBadRequest(w, "size must be a positive integer")
+		return
+	}
+
+	mount, fsPath, err := h.fileService.ResolvePath(path)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+	if mount.ReadOnly {
+		writeError(w, "Mount point is read-only", model.ErrCodeReadOnly, http.StatusForbidden)
+		return
+	}
+	if h.maxUploadSize > 0 && req.Size > h.maxUploadSize {
+		writeUploadError(w, "Upload rejected", ErrUploadTooLarge)
+		return
+	}
+
+	miss := InstantUploadResponse{Path: path}
+	if h.hashes == nil {
+		writeJSON(w, miss, http.StatusOK)
+		return
+	}
+	source, ok := h.hashes.Lookup(checksum, req.Size, func(p string) bool {
+		return p != fsPath && h.inMountPoint(p)
+	})
+	if !ok {
+		writeJSON(w, miss, http.StatusOK)
+		return
+	}
+
+	method, err := h.placeCopy(source, fsPath, checksum, req.Size)
+	if errors.Is(err, errInstantSourceChanged) || os.IsNotExist(err) {
+		// The source went away or changed after it was indexed
+		h.hashes.Forget(source)
+		writeJSON(w, miss, http.StatusOK)
+		return
+	}
+	if err != nil {
+		writeUploadError(w, "Failed to place file", err)
+		return
+	}
+	h.hashes.Record(fsPath, checksum)
+
+	writeJSON(w, InstantUploadResponse{
+		Path:         path,
+		Deduplicated: true,
+		Method:       method,
+	}, http.StatusCreated)
+}
+
+// inMountPoint reports whether a filesystem path lies inside a configured
+// mount point, which every user may read
+func (h *StreamHandler) inMountPoint(fsPath string) bool {
+	for _, mount := range h.fileService.ListMountPoints() {
+		root := filepath.Clean(mount.Path)
+		if fsPath == root || strings.HasPrefix(fsPath, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeCopy gives dst the contents of src, cloning it where the filesystem
+// supports reflinks and copying it otherwise. Hard links are never used:
+// files are overwritten in place elsewhere, which would change both names.
+// The copy is made beside dst and renamed into place, so dst is never seen
+// half written.
+func (h *StreamHandler) placeCopy(src, dst, checksum string, size int64) (string, error) {
+	fsys := h.fileService.GetFilesystem()
+	if err := fsys.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to create parent directory: %w", err)
+	}
+	tmp := fileutil.UploadTempPath(dst, uuid.NewString())
+
+	method := instantMethodReflink
+	err := filesystem.ErrReflinkUnsupported
+	if rf, ok := fsys.(filesystem.Reflinker); ok {
+		err = rf.Reflink(src, tmp)
+	}
+	if errors.Is(err, filesystem.ErrReflinkUnsupported) {
+		method = instantMethodCopy
+		err = h.copyVerified(src, tmp, checksum, size)
+	}
+	if err != nil {
+		_ = fsys.Remove(tmp)
+		return "", err
+	}
+
+	if err := fsys.Rename(tmp, dst); err != nil {
+		_ = fsys.Remove(tmp)
+		return "", fmt.Errorf("failed to finalize file: %w", err)
+	}
+	return method, nil
+}
+
+// copyVerified copies src into the new file dst, checking that the bytes
+// copied still have the expected size and hash
+func (h *StreamHandler) copyVerified(src, dst, checksum string, size int64) error {
+	fsys := h.fileService.GetFilesystem()
+	if reporter, ok := fsys.(filesystem.SpaceReporter); ok {
+		free, err := reporter.FreeSpace(filepath.Dir(dst))
+		if err == nil && free < size {
+			return ErrInsufficientStorage
+		}
+	}
+
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := fsys.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	hasher := sha256.New()
+	buf := make([]byte, config.FileCopyBufferSize)
+	copied, err := io.CopyBuffer(io.MultiWriter(out, hasher), in, buf)
+	if err != nil {
+		return err
+	}
+	if copied != size || hex.EncodeToString(hasher.Sum(nil)) != checksum {
+		return errInstantSourceChanged
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,146 @@
+// Package handler provides HTTP handlers for the file manager API.
+// This file contains property-based tests for instant uploads.
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// instantUpload asks the server to place content at path without uploading
+// it and returns the status code and raw response body
+func instantUpload(router http.Handler, path string, content []byte) (int, []byte) {
+	sum := sha256.Sum256(content)
+	body, _ := json.Marshal(InstantUploadRequest{
+		Checksum: "sha256:" + hex.EncodeToString(sum[:]),
+		Size:     int64(len(content)),
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, asUser(httptest.NewRequest("POST", "/api/v1/instant/"+path, bytes.NewReader(body)), "alice"))
+	return rec.Code, rec.Body.Bytes()
+}
+
+// Where the content of a file in the instant upload property exists
+const (
+	instantSourceUploaded = iota // Uploaded to a mount point
+	instantSourceModified        // Uploaded, then changed in place
+	instantSourcePrivate         // Indexed, but outside the mount points
+	instantSourceNone            // Nowhere
+)
+
+// **Feature: homelab-file-manager, Property 36: Instant Upload Deduplication**
+//
+// Property: For any set of files, an instant upload of content that was uploaded to a mount
+// point and is unchanged SHALL create the destination with identical content, including
+// after the hash index is reloaded from disk. Content that was changed after it was indexed,
+// that exists only outside the mount points, or that does not exist SHALL get the same
+// response, apart from the requested path, and SHALL leave nothing at the destination.
+
+func TestProperty_InstantUploadDeduplication(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 8
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("instant uploads reuse only unchanged content on mount points", prop.ForAll(
+		func(sizes []int, sources []int, reload bool) bool {
+			fs := filesystem.NewMemMapFS()
+			fs.MkdirAll("/data/media", 0755)
+			fs.MkdirAll("/data/documents", 0755)
+			fs.MkdirAll("/data/private", 0755)
+			fileSvc := service.NewFileService(fs, service.FileServiceConfig{
+				MountPoints: []model.MountPoint{
+					{Name: "media", Path: "/data/media"},
+					{Name: "documents", Path: "/data/documents"},
+				},
+			})
+			hashes := service.NewHashIndex(fs, service.HashIndexConfig{DataDir: "/appdata"})
+			handler := NewStreamHandler(fileSvc, nil, StreamHandlerConfig{ChunkSizeMB: 1, HashIndex: hashes})
+			router := createStreamTestRouter(handler)
+
+			contents := make([][]byte, len(sizes))
+			for i, size := range sizes {
+				// The index makes every file's content unique
+				content := bytes.Repeat([]byte{byte(i)}, size)
+				content[0] = byte(size)
+				contents[i] = content
+
+				id := fmt.Sprintf("file-%d", i)
+				switch sources[i%len(sources)] {
+				case instantSourceUploaded, instantSourceModified:
+					if performChunkedUpload(router, "media/"+id+".bin", id, content, 2, "") != nil {
+						return false
+					}
+				case instantSourcePrivate:
+					path := "/data/private/" + id + ".bin"
+					sum := sha256.Sum256(content)
+					if fs.WriteFile(path, content, 0644) != nil || hashes.Record(path, hex.EncodeToString(sum[:])) != nil {
+						return false
+					}
+				}
+				if sources[i%len(sources)] == instantSourceModified {
+					path := "/data/media/" + id + ".bin"
+					changed := bytes.Repeat([]byte{0xff}, size)
+					fs.WriteFile(path, changed, 0644)
+					fs.Chtimes(path, time.Now(), time.Now().Add(time.Hour))
+				}
+			}
+
+			if reload {
+				handler.hashes = service.NewHashIndex(fs, service.HashIndexConfig{DataDir: "/appdata"})
+			}
+
+			var missBody []byte
+			for i, content := range contents {
+				dest := fmt.Sprintf("documents/copy-%d.bin", i)
+				code, body := instantUpload(router, dest, content)
+
+				if sources[i%len(sources)] == instantSourceUploaded {
+					var resp InstantUploadResponse
+					if code != http.StatusCreated || json.Unmarshal(body, &resp) != nil || !resp.Deduplicated {
+						return false
+					}
+					data, err := fs.ReadFile("/data/" + dest)
+					if err != nil || !bytes.Equal(data, content) {
+						return false
+					}
+					continue
+				}
+
+				if code != http.StatusOK {
+					return false
+				}
+				body = bytes.Replace(body, []byte(dest), nil, 1)
+				if missBody == nil {
+					missBody = body
+				} else if !bytes.Equal(body, missBody) {
+					return false
+				}
+				if exists, _ := fs.Exists("/data/" + dest); exists {
+					return false
+				}
+			}
+			return true
+		},
+		gen.SliceOf(gen.IntRange(2, 40)),
+		gen.SliceOfN(4, gen.IntRange(instantSourceUploaded, instantSourceNone)),
+		gen.Bool(),
+	))
+
+	properties.TestingRun(t)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/middleware"
 	"github.com/homelab/filemanager/internal/model"
 	"github.com/homelab/filemanager/internal/service"
 )
@@ -25,29 +26,59 @@ func NewJobHandler(jobService service.JobService) *JobHandler {
 func (h *JobHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/", h.List)
 	r.Post("/", h.Create)
+	r.Get("/queue", h.Queue)
 	r.Get("/{id}", h.Get)
 	r.Delete("/{id}", h.Cancel)
+	r.Get("/{id}/errors", h.Errors)
+	r.Get("/{id}/checksums", h.Checksums)
+	r.Post("/{id}/retry", h.Retry)
+	r.Get("/{id}/report", h.Report)
+	r.Post("/{id}/move", h.Move)
+	r.Post("/{id}/bump", h.Bump)
 }
 
 // CreateJobRequest represents the create job request body
 type CreateJobRequest struct {
-	Type       string `json:"type"`
-	SourcePath string `json:"sourcePath"`
-	DestPath   string `json:"destPath,omitempty"`
+	Type            string              `json:"type"`
+	SourcePath      string              `json:"sourcePath"`
+	DestPath        string              `json:"destPath,omitempty"`
+	ContinueOnError bool                `json:"continueOnError,omitempty"`
+	Verify          bool                `json:"verify,omitempty"`
+	Sync            *model.SyncOptions  `json:"sync,omitempty"`
+	Fetch           *model.FetchOptions `json:"fetch,omitempty"`
+	Priority        string              `json:"priority,omitempty"`
+}
+
+// MoveJobRequest represents the move job request body
+type MoveJobRequest struct {
+	Position int `json:"position"` // 1-based queue position
 }
 
 // JobResponse represents a job in API responses
 type JobResponse struct {
-	ID          string `json:"id"`
-	Type        string `json:"type"`
-	State       string `json:"state"`
-	Progress    int    `json:"progress"`
-	SourcePath  string `json:"sourcePath"`
-	DestPath    string `json:"destPath,omitempty"`
-	Error       string `json:"error,omitempty"`
-	CreatedAt   string `json:"createdAt"`
-	StartedAt   string `json:"startedAt,omitempty"`
-	CompletedAt string `json:"completedAt,omitempty"`
+	ID              string              `json:"id"`
+	Type            string              `json:"type"`
+	State           string              `json:"state"`
+	Progress        int                 `json:"progress"`
+	SourcePath      string              `json:"sourcePath"`
+	DestPath        string              `json:"destPath,omitempty"`
+	Error           string              `json:"error,omitempty"`
+	ContinueOnError bool                `json:"continueOnError,omitempty"`
+	Verify          bool                `json:"verify,omitempty"`
+	Items           []string            `json:"items,omitempty"`
+	ErrorCount      int                 `json:"errorCount,omitempty"`
+	VerifiedCount   int                 `json:"verifiedCount,omitempty"`
+	RetryOf         string              `json:"retryOf,omitempty"`
+	Sync            *model.SyncOptions  `json:"sync,omitempty"`
+	Fetch           *model.FetchOptions `json:"fetch,omitempty"`
+	BytesDone       int64               `json:"bytesDone,omitempty"`
+	BytesTotal      int64               `json:"bytesTotal,omitempty"`
+	Owner           string              `json:"owner,omitempty"`
+	Priority        string              `json:"priority"`
+	QueuePosition   int                 `json:"queuePosition,omitempty"`
+	CreatedAt       string              `json:"createdAt"`
+	StartedAt       string              `json:"startedAt,omitempty"`
+	CompletedAt     string              `json:"completedAt,omitempty"`
 }
 
 // JobListResponse represents the list of jobs
@@ -55,8 +86,26 @@ type JobListResponse struct {
 	Jobs []JobResponse `json:"jobs"`
 }
 
+// JobErrorsResponse represents the per-item errors of a job
+type JobErrorsResponse struct {
+	JobID  string           `json:"jobId"`
+	Errors []model.JobError `json:"errors"`
+}
+
+// JobChecksumsResponse represents the verified file hashes of a job
+type JobChecksumsResponse struct {
+	JobID     string               `json:"jobId"`
+	Checksums []model.FileChecksum `json:"checksums"`
+}
+
+// JobReportResponse represents the planned or applied changes of a sync job
+type JobReportResponse struct {
+	JobID string `json:"jobId"`
+	*model.SyncReport
+}
+
 
-// List returns all jobs
+// List returns the jobs visible to the user; admins see every job
 // GET /api/v1/jobs
 func (h *JobHandler) List(w http.ResponseWriter, r *http.Request) {
 	jobs, err := h.jobService.List(r.Context())
@@ -64,6 +113,7 @@ func (h *JobHandler) List(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "Failed to list jobs", model.ErrCodeInternalError, http.StatusInternalServerError)
 		return
 	}
+	jobs = visibleJobs(r, jobs)
 
 	response := JobListResponse{
 		Jobs: make([]JobResponse, len(jobs)),
@@ -79,9 +129,8 @@ func (h *JobHandler) List(w http.ResponseWriter, r *http.Request) {
 // Get returns a job by ID
 // GET /api/v1/jobs/:id
 func (h *JobHandler) Get(w http.ResponseWriter, r *http.Request) {
-	jobID := chi.URLParam(r, "id")
-	if jobID == "" {
-		writeError(w, "Job ID is required", model.ErrCodeValidationError, http.StatusBadRequest)
+	jobID, ok := h.authorizeJob(w, r)
+	if !ok {
 		return
 	}
 
@@ -106,7 +155,7 @@ func (h *JobHandler) Create(w http.ResponseWriter, r *http.Request) {
 	// Validate job type
 	jobType := model.JobType(req.Type)
 	if !jobType.IsValid() {
-		writeError(w, "Invalid job type. Must be 'copy', 'move', or 'delete'", model.ErrCodeValidationError, http.StatusBadRequest)
+		writeError(w, "Invalid job type. Must be 'copy', 'move', 'delete', 'sync', or 'fetch'", model.ErrCodeValidationError, http.StatusBadRequest)
 		return
 	}
 
@@ -116,17 +165,35 @@ func (h *JobHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate destination path for copy and move
-	if (jobType == model.JobTypeCopy || jobType == model.JobTypeMove) && req.DestPath == "" {
-		writeError(w, "Destination path is required for copy and move operations", model.ErrCodeValidationError, http.StatusBadRequest)
+	// Validate destination path for copy, move and sync
+	if jobType.NeedsDestination() && req.DestPath == "" {
+		writeError(w, "Destination path is required for copy, move, sync and fetch operations", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+
+	// Validate priority; only admins may jump ahead of everyone else
+	priority := model.JobPriority(req.Priority)
+	if !priority.IsValid() {
+		writeError(w, "Invalid priority. Must be 'low', 'normal', or 'high'", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	username, admin := requestUser(r)
+	if priority == model.JobPriorityHigh && !admin {
+		writeForbidden(w, "High priority requires admin rights")
 		return
 	}
 
 	// Create job params
 	params := model.JobParams{
-		Type:       jobType,
-		SourcePath: req.SourcePath,
-		DestPath:   req.DestPath,
+		Type:            jobType,
+		SourcePath:      req.SourcePath,
+		DestPath:        req.DestPath,
+		ContinueOnError: req.ContinueOnError,
+		Verify:          req.Verify,
+		Sync:            req.Sync,
+		Fetch:           req.Fetch,
+		Owner:           username,
+		Priority:        priority,
 	}
 
 	// Create job
@@ -139,12 +206,11 @@ func (h *JobHandler) Create(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, h.toJobResponse(job), http.StatusAccepted)
 }
 
-// Cancel cancels a running job
+// Cancel cancels a running job owned by the user
 // DELETE /api/v1/jobs/:id
 func (h *JobHandler) Cancel(w http.ResponseWriter, r *http.Request) {
-	jobID := chi.URLParam(r, "id")
-	if jobID == "" {
-		writeError(w, "Job ID is required", model.ErrCodeValidationError, http.StatusBadRequest)
+	jobID, ok := h.authorizeJob(w, r)
+	if !ok {
 		return
 	}
 
@@ -156,17 +222,214 @@ func (h *JobHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]string{"message": "Job cancelled successfully"}, http.StatusOK)
 }
 
+// Errors returns the per-item errors recorded for a job
+// GET /api/v1/jobs/:id/errors
+func (h *JobHandler) Errors(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := h.authorizeJob(w, r)
+	if !ok {
+		return
+	}
+
+	jobErrors, err := h.jobService.Errors(r.Context(), jobID)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, JobErrorsResponse{JobID: jobID, Errors: jobErrors}, http.StatusOK)
+}
+
+// Checksums returns the verified file hashes recorded for a job
+// GET /api/v1/jobs/:id/checksums
+func (h *JobHandler) Checksums(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := h.authorizeJob(w, r)
+	if !ok {
+		return
+	}
+
+	checksums, err := h.jobService.Checksums(r.Context(), jobID)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, JobChecksumsResponse{JobID: jobID, Checksums: checksums}, http.StatusOK)
+}
+
+// Retry creates a new job for the failed items of a finished job
+// POST /api/v1/jobs/:id/retry
+func (h *JobHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := h.authorizeJob(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobService.Retry(r.Context(), jobID)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, h.toJobResponse(job), http.StatusAccepted)
+}
+
+// Report returns the changes a sync job planned or applied
+// GET /api/v1/jobs/:id/report
+func (h *JobHandler) Report(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := h.authorizeJob(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.jobService.SyncReport(r.Context(), jobID)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, JobReportResponse{JobID: jobID, SyncReport: report}, http.StatusOK)
+}
+
+// Queue returns the pending jobs in the order they will run
+// GET /api/v1/jobs/queue
+func (h *JobHandler) Queue(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.jobService.Queue(r.Context())
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+	jobs = visibleJobs(r, jobs)
+
+	response := JobListResponse{
+		Jobs: make([]JobResponse, len(jobs)),
+	}
+	for i, job := range jobs {
+		response.Jobs[i] = h.toJobResponse(job)
+	}
+
+	writeJSON(w, response, http.StatusOK)
+}
+
+// Move places a pending job at a position in the queue (admin only)
+// POST /api/v1/jobs/:id/move
+func (h *JobHandler) Move(w http.ResponseWriter, r *http.Request) {
+	var req MoveJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	if req.Position < 1 {
+		writeError(w, "Position must be at least 1", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+
+	h.moveJob(w, r, req.Position)
+}
+
+// Bump moves a pending job to the front of the queue (admin only)
+// POST /api/v1/jobs/:id/bump
+func (h *JobHandler) Bump(w http.ResponseWriter, r *http.Request) {
+	h.moveJob(w, r, 1)
+}
+
+// moveJob moves the job named in the URL to a queue position
+func (h *JobHandler) moveJob(w http.ResponseWriter, r *http.Request, position int) {
+	if _, admin := requestUser(r); !admin {
+		writeForbidden(w, "Reordering the queue requires admin rights")
+		return
+	}
+
+	jobID, ok := h.authorizeJob(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobService.Move(r.Context(), jobID, position)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, h.toJobResponse(job), http.StatusOK)
+}
+
+// authorizeJob returns the job ID from the URL if the job belongs to the
+// user or the user is an admin. Other users' jobs are reported as not found
+// so that job IDs do not leak.
+func (h *JobHandler) authorizeJob(w http.ResponseWriter, r *http.Request) (string, bool) {
+	jobID := chi.URLParam(r, "id")
+	if jobID == "" {
+		writeError(w, "Job ID is required", model.ErrCodeValidationError, http.StatusBadRequest)
+		return "", false
+	}
+
+	username, admin := requestUser(r)
+	if admin {
+		return jobID, true
+	}
+
+	job, err := h.jobService.Get(r.Context(), jobID)
+	if err != nil {
+		HandleServiceError(w, err)
+		return "", false
+	}
+	if job.Owner != username {
+		HandleServiceError(w, service.ErrJobNotFound)
+		return "", false
+	}
+	return jobID, true
+}
+
+// visibleJobs filters jobs down to those owned by the user unless the user
+// is an admin
+func visibleJobs(r *http.Request, jobs []*model.Job) []*model.Job {
+	username, admin := requestUser(r)
+	if admin {
+		return jobs
+	}
+
+	visible := make([]*model.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Owner == username {
+			visible = append(visible, job)
+		}
+	}
+	return visible
+}
+
+// requestUser returns the username and admin flag of the authenticated user
+func requestUser(r *http.Request) (string, bool) {
+	claims, ok := middleware.GetUserClaims(r.Context())
+	if !ok {
+		return "", false
+	}
+	return claims.Username, claims.Admin
+}
+
 // toJobResponse converts a model.Job to JobResponse
 func (h *JobHandler) toJobResponse(job *model.Job) JobResponse {
 	resp := JobResponse{
-		ID:         job.ID,
-		Type:       string(job.Type),
-		State:      string(job.State),
-		Progress:   job.Progress,
-		SourcePath: job.SourcePath,
-		DestPath:   job.DestPath,
-		Error:      job.Error,
-		CreatedAt:  job.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ID:              job.ID,
+		Type:            string(job.Type),
+		State:           string(job.State),
+		Progress:        job.Progress,
+		SourcePath:      job.SourcePath,
+		DestPath:        job.DestPath,
+		Error:           job.Error,
+		ContinueOnError: job.ContinueOnError,
+		Verify:          job.Verify,
+		Items:           job.Items,
+		ErrorCount:      job.ErrorCount,
+		VerifiedCount:   job.VerifiedCount,
+		RetryOf:         job.RetryOf,
+		Sync:            job.Sync,
+		Fetch:           job.Fetch,
+		BytesDone:       job.BytesDone,
+		BytesTotal:      job.BytesTotal,
+		Owner:           job.Owner,
+		Priority:        string(job.Priority),
+		QueuePosition:   job.QueuePosition,
+		CreatedAt:       job.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 
 	if !job.StartedAt.IsZero() {
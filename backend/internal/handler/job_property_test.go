@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/middleware"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+)
+
+// TestJobOwnershipWithoutAdmins checks that with several users and no
+// admins configured, nobody can see or cancel another user's jobs
+func TestJobOwnershipWithoutAdmins(t *testing.T) {
+	fs := filesystem.NewMemMapFS()
+	fs.WriteFile("/data/media/a.txt", []byte("hello"), 0644)
+
+	authService := service.NewAuthService(service.AuthServiceConfig{
+		JWTSecret: "test-secret",
+		Users:     map[string]string{"alice": "alice-pw", "bob": "bob-pw"},
+	})
+	// The workers are not started, so jobs stay pending
+	jobService := service.NewJobService(fs, nil, service.JobServiceConfig{Workers: 1})
+	h := NewJobHandler(jobService)
+
+	r := chi.NewRouter()
+	r.Route("/api/v1/jobs", func(r chi.Router) {
+		r.Use(middleware.JWTAuth(authService))
+		h.RegisterRoutes(r)
+	})
+
+	token := func(username, password string) string {
+		tokens, err := authService.Login(context.Background(), username, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens.AccessToken
+	}
+	alice, bob := token("alice", "alice-pw"), token("bob", "bob-pw")
+	send := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("POST", "/api/v1/jobs", alice, CreateJobRequest{Type: "delete", SourcePath: "/data/media/a.txt"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var job JobResponse
+	json.Unmarshal(rec.Body.Bytes(), &job)
+
+	var list JobListResponse
+	json.Unmarshal(send("GET", "/api/v1/jobs", bob, nil).Body.Bytes(), &list)
+	if len(list.Jobs) != 0 {
+		t.Fatalf("expected bob to see no jobs, got %d", len(list.Jobs))
+	}
+	if rec := send("GET", "/api/v1/jobs/"+job.ID, bob, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected bob to be refused alice's job, got %d", rec.Code)
+	}
+	if rec := send("DELETE", "/api/v1/jobs/"+job.ID, bob, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected bob to be unable to cancel alice's job, got %d", rec.Code)
+	}
+	if rec := send("POST", "/api/v1/jobs", bob, CreateJobRequest{Type: "delete", SourcePath: "/data/media/a.txt", Priority: "high"}); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected bob to be refused high priority, got %d", rec.Code)
+	}
+
+	stored, err := jobService.Get(context.Background(), job.ID)
+	if err != nil || stored.State != model.JobStatePending {
+		t.Fatalf("expected alice's job to be untouched, got %v, %v", stored, err)
+	}
+	json.Unmarshal(send("GET", "/api/v1/jobs", alice, nil).Body.Bytes(), &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != job.ID {
+		t.Fatalf("expected alice to see the job, got %+v", list.Jobs)
+	}
+}
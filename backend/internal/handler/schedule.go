@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/service"
+)
+
+// ScheduleHandler handles recurring job schedule requests
+type ScheduleHandler struct {
+	scheduleService service.ScheduleService
+}
+
+// NewScheduleHandler creates a new schedule handler
+func NewScheduleHandler(scheduleService service.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleService: scheduleService,
+	}
+}
+
+// RegisterRoutes registers schedule routes on the given router
+func (h *ScheduleHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	r.Get("/{id}", h.Get)
+	r.Put("/{id}", h.Update)
+	r.Delete("/{id}", h.Delete)
+}
+
+// ScheduleRequest represents the create and update schedule request body
+type ScheduleRequest struct {
+	Name       string          `json:"name"`
+	Cron       string          `json:"cron,omitempty"`
+	EveryHours int             `json:"everyHours,omitempty"`
+	Job        model.JobParams `json:"job"`
+	Enabled    *bool           `json:"enabled,omitempty"` // Defaults to true
+}
+
+// ScheduleListResponse represents the list of schedules
+type ScheduleListResponse struct {
+	Schedules []*model.Schedule `json:"schedules"`
+}
+
+// List returns the user's schedules; admins see every schedule
+// GET /api/v1/schedules
+func (h *ScheduleHandler) List(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.scheduleService.List(r.Context())
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	username, admin := requestUser(r)
+	if !admin {
+		visible := make([]*model.Schedule, 0, len(schedules))
+		for _, schedule := range schedules {
+			if schedule.Owner == username {
+				visible = append(visible, schedule)
+			}
+		}
+		schedules = visible
+	}
+
+	writeJSON(w, ScheduleListResponse{Schedules: schedules}, http.StatusOK)
+}
+
+// Get returns a schedule with its run history
+// GET /api/v1/schedules/:id
+func (h *ScheduleHandler) Get(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.authorizeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, schedule, http.StatusOK)
+}
+
+// Create creates a new schedule
+// POST /api/v1/schedules
+func (h *ScheduleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeScheduleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.scheduleService.Create(r.Context(), params)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, schedule, http.StatusCreated)
+}
+
+// Update replaces a schedule's timetable and job template
+// PUT /api/v1/schedules/:id
+func (h *ScheduleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.authorizeSchedule(w, r)
+	if !ok {
+		return
+	}
+	params, ok := decodeScheduleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.scheduleService.Update(r.Context(), existing.ID, params)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, schedule, http.StatusOK)
+}
+
+// Delete removes a schedule
+// DELETE /api/v1/schedules/:id
+func (h *ScheduleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.authorizeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleService.Delete(r.Context(), schedule.ID); err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Schedule deleted successfully"}, http.StatusOK)
+}
+
+// authorizeSchedule returns the schedule named in the URL if the user owns
+// it or is an admin. Other users' schedules are reported as not found, so
+// their IDs cannot be probed.
+func (h *ScheduleHandler) authorizeSchedule(w http.ResponseWriter, r *http.Request) (*model.Schedule, bool) {
+	schedule, err := h.scheduleService.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		HandleServiceError(w, err)
+		return nil, false
+	}
+
+	username, admin := requestUser(r)
+	if !admin && schedule.Owner != username {
+		HandleServiceError(w, service.ErrScheduleNotFound)
+		return nil, false
+	}
+	return schedule, true
+}
+
+// decodeScheduleRequest parses a schedule request body, writing an error
+// response and returning false if it is malformed
+func decodeScheduleRequest(w http.ResponseWriter, r *http.Request) (model.ScheduleParams, bool) {
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", model.ErrCodeValidationError, http.StatusBadRequest)
+		return model.ScheduleParams{}, false
+	}
+
+	if (req.Cron == "") == (req.EveryHours <= 0) {
+		writeError(w, "Exactly one of cron and everyHours is required", model.ErrCodeValidationError, http.StatusBadRequest)
+		return model.ScheduleParams{}, false
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	// Scheduled jobs belong to the user who created the schedule
+	req.Job.Owner, _ = requestUser(r)
+
+	return model.ScheduleParams{
+		Name:       req.Name,
+		Cron:       req.Cron,
+		EveryHours: req.EveryHours,
+		Job:        req.Job,
+		Enabled:    enabled,
+	}, true
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/middleware"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+)
+
+// TestScheduleOwnership checks that users only see and change their own
+// schedules, and that an admin's edit leaves the jobs with the owner
+func TestScheduleOwnership(t *testing.T) {
+	fs := filesystem.NewMemMapFS()
+	jobService := service.NewJobService(fs, nil, service.JobServiceConfig{Workers: 1})
+	scheduleService := service.NewScheduleService(fs, jobService, service.ScheduleServiceConfig{DataDir: "/appdata"})
+	h := NewScheduleHandler(scheduleService)
+	r := chi.NewRouter()
+	r.Route("/api/v1/schedules", h.RegisterRoutes)
+
+	send := func(method, path, username string, admin bool, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		claims := &service.Claims{Username: username, Admin: admin}
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserClaimsKey, claims))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	request := ScheduleRequest{
+		Name:       "nightly mirror",
+		EveryHours: 24,
+		Job:        model.JobParams{Type: model.JobTypeSync, SourcePath: "/data/media", DestPath: "/data/backup"},
+	}
+
+	rec := send("POST", "/api/v1/schedules", "alice", false, request)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var sched model.Schedule
+	json.Unmarshal(rec.Body.Bytes(), &sched)
+	if sched.Owner != "alice" {
+		t.Fatalf("expected alice to own the schedule, got %q", sched.Owner)
+	}
+	path := "/api/v1/schedules/" + sched.ID
+
+	var list ScheduleListResponse
+	json.Unmarshal(send("GET", "/api/v1/schedules", "bob", false, nil).Body.Bytes(), &list)
+	if len(list.Schedules) != 0 {
+		t.Fatalf("expected bob to see no schedules, got %d", len(list.Schedules))
+	}
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		if rec := send(method, path, "bob", false, request); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected bob's %s of alice's schedule to be refused, got %d", method, rec.Code)
+		}
+	}
+
+	// An admin's edit keeps the schedule's jobs with alice
+	request.Name = "weekly mirror"
+	if rec := send("PUT", path, "root", true, request); rec.Code != http.StatusOK {
+		t.Fatalf("admin update: status %d: %s", rec.Code, rec.Body.String())
+	}
+	got, err := scheduleService.Get(context.Background(), sched.ID)
+	if err != nil || got.Name != "weekly mirror" || got.Owner != "alice" || got.Job.Owner != "alice" {
+		t.Fatalf("expected the schedule to stay alice's, got %+v, %v", got, err)
+	}
+
+	json.Unmarshal(send("GET", "/api/v1/schedules", "alice", false, nil).Body.Bytes(), &list)
+	if len(list.Schedules) != 1 {
+		t.Fatalf("expected alice to see the schedule, got %d", len(list.Schedules))
+	}
+	if rec := send("DELETE", path, "alice", false, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+}
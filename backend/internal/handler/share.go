@@ -0,0 +1,389 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/service"
+	ws "github.com/homelab/filemanager/internal/websocket"
+)
+
+// ShareHandler handles share link management and the public share link
+// routes, which serve files and receive drop uploads through the stream
+// handler
+type ShareHandler struct {
+	shareService service.ShareService
+	fileService  service.FileService
+	stream       *StreamHandler
+	hub          *ws.Hub
+}
+
+// NewShareHandler creates a new share handler. Owners of drop links are told
+// about uploads through the hub, if one is given.
+func NewShareHandler(shareService service.ShareService, fileService service.FileService, stream *StreamHandler, hub *ws.Hub) *ShareHandler {
+	return &ShareHandler{
+		shareService: shareService,
+		fileService:  fileService,
+		stream:       stream,
+		hub:          hub,
+	}
+}
+
+// RegisterRoutes registers the share management routes on the given router
+func (h *ShareHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	r.Get("/{id}", h.Get)
+	r.Delete("/{id}", h.Delete)
+}
+
+// RegisterPublicRoutes registers the routes visitors use to open share links.
+// They must not require authentication.
+func (h *ShareHandler) RegisterPublicRoutes(r chi.Router) {
+	r.Get("/{token}", h.Info)
+	r.Get("/{token}/list", h.ListShared)
+	r.Get("/{token}/list/*", h.ListShared)
+	r.Get("/{token}/download", h.DownloadShared)
+	r.Get("/{token}/download/*", h.DownloadShared)
+	r.Get("/{token}/preview", h.PreviewShared)
+	r.Get("/{token}/preview/*", h.PreviewShared)
+	r.Post("/{token}/upload/{name}", h.DropUpload)
+}
+
+// CreateShareRequest represents the request body for creating a share link
+type CreateShareRequest struct {
+	Path         string             `json:"path"`
+	Password     string             `json:"password,omitempty"`
+	ExpiresAt    *time.Time         `json:"expiresAt,omitempty"`
+	MaxDownloads int                `json:"maxDownloads,omitempty"` // 0 = unlimited
+	Drop         *model.DropOptions `json:"drop,omitempty"`         // Makes the link an upload-only drop folder
+}
+
+// ShareResponse represents a share link as seen by its owner
+type ShareResponse struct {
+	ID            string              `json:"id"`
+	Token         string              `json:"token"`
+	URL           string              `json:"url"` // Public API path of the link
+	Path          string              `json:"path"`
+	IsDir         bool                `json:"isDir"`
+	Owner         string              `json:"owner,omitempty"`
+	HasPassword   bool                `json:"hasPassword"`
+	ExpiresAt     *time.Time          `json:"expiresAt,omitempty"`
+	MaxDownloads  int                 `json:"maxDownloads,omitempty"`
+	Downloads     int                 `json:"downloads"`
+	Drop          *model.DropOptions  `json:"drop,omitempty"`
+	Uploads       int                 `json:"uploads,omitempty"`
+	UploadedBytes int64               `json:"uploadedBytes,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	Access        []model.ShareAccess `json:"access,omitempty"` // Only returned for a single share
+}
+
+// ShareListResponse represents the list of share links
+type ShareListResponse struct {
+	Shares []ShareResponse `json:"shares"`
+}
+
+// ShareInfoResponse describes a shared file or folder to a visitor
+type ShareInfoResponse struct {
+	Name          string     `json:"name"`
+	IsDir         bool       `json:"isDir"`
+	Size          int64      `json:"size"`
+	ModTime       time.Time  `json:"modTime"`
+	MimeType      string     `json:"mimeType,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	DownloadsLeft *int       `json:"downloadsLeft,omitempty"` // Omitted when unlimited
+	Upload        bool       `json:"upload,omitempty"`        // The link is a drop folder that only accepts uploads
+	UploadsLeft   *int       `json:"uploadsLeft,omitempty"`   // Omitted when unlimited
+	BytesLeft     *int64     `json:"bytesLeft,omitempty"`     // Omitted when unlimited
+	MaxFileBytes  int64      `json:"maxFileBytes,omitempty"`
+}
+
+// List returns the user's share links, or every link for admins
+// GET /api/v1/shares
+func (h *ShareHandler) List(w http.ResponseWriter, r *http.Request) {
+	owner, admin := requestUser(r)
+	if admin {
+		owner = ""
+	}
+
+	shares, err := h.shareService.List(r.Context(), owner)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	resp := ShareListResponse{Shares: make([]ShareResponse, len(shares))}
+	for i, share := range shares {
+		resp.Shares[i] = toShareResponse(share)
+		resp.Shares[i].Access = nil
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
+
+// Get returns a share link with its access log
+// GET /api/v1/shares/:id
+func (h *ShareHandler) Get(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.authorizeShare(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, toShareResponse(share), http.StatusOK)
+}
+
+// Create creates a share link for a file or folder
+// POST /api/v1/shares
+func (h *ShareHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		writeError(w, "Path is required", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	if req.MaxDownloads < 0 {
+		writeError(w, "maxDownloads must not be negative", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+	if req.Drop != nil && req.MaxDownloads != 0 {
+		writeError(w, "Drop links cannot have maxDownloads", model.ErrCodeValidationError, http.StatusBadRequest)
+		return
+	}
+
+	params := model.ShareParams{
+		Path:         req.Path,
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+		Drop:         req.Drop,
+	}
+	if req.ExpiresAt != nil {
+		params.ExpiresAt = *req.ExpiresAt
+	}
+	params.Owner, _ = requestUser(r)
+
+	share, err := h.shareService.Create(r.Context(), params)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, toShareResponse(share), http.StatusCreated)
+}
+
+// Delete revokes a share link
+// DELETE /api/v1/shares/:id
+func (h *ShareHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.authorizeShare(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.shareService.Delete(r.Context(), share.ID); err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Share revoked successfully"}, http.StatusOK)
+}
+
+// Info describes the shared file or folder
+// GET /api/v1/s/:token
+func (h *ShareHandler) Info(w http.ResponseWriter, r *http.Request) {
+	share, target, ok := h.openShare(w, r, model.ShareActionInfo, "", false)
+	if !ok {
+		return
+	}
+
+	info, err := h.fileService.GetInfo(r.Context(), target)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	resp := ShareInfoResponse{
+		Name:     info.Name,
+		IsDir:    info.IsDir,
+		Size:     info.Size,
+		ModTime:  info.ModTime,
+		MimeType: info.MimeType,
+	}
+	if !share.ExpiresAt.IsZero() {
+		resp.ExpiresAt = &share.ExpiresAt
+	}
+	if share.MaxDownloads > 0 {
+		left := share.MaxDownloads - share.Downloads
+		resp.DownloadsLeft = &left
+	}
+	if drop := share.Drop; drop != nil {
+		// The folder's contents stay private
+		resp.Upload = true
+		resp.Size = 0
+		resp.MaxFileBytes = drop.MaxFileBytes
+		if drop.MaxFiles > 0 {
+			left := drop.MaxFiles - share.Uploads
+			resp.UploadsLeft = &left
+		}
+		if drop.MaxBytes > 0 {
+			left := drop.MaxBytes - share.UploadedBytes
+			resp.BytesLeft = &left
+		}
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
+
+// ListShared lists a directory of a shared folder. Paths in the listing are
+// relative to the shared folder.
+// GET /api/v1/s/:token/list/*path
+func (h *ShareHandler) ListShared(w http.ResponseWriter, r *http.Request) {
+	share, target, ok := h.openShare(w, r, model.ShareActionList, chi.URLParam(r, "*"), false)
+	if !ok {
+		return
+	}
+	if !share.IsDir {
+		HandleServiceError(w, service.ErrNotDirectory)
+		return
+	}
+
+	list, err := h.fileService.List(r.Context(), target, parseListOptions(r))
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+
+	list.Path = sharedPath(share, list.Path)
+	for i := range list.Items {
+		list.Items[i].Path = sharedPath(share, list.Items[i].Path)
+	}
+	writeJSON(w, list, http.StatusOK)
+}
+
+// DownloadShared downloads the shared file, or a file of the shared folder
+// GET /api/v1/s/:token/download/*path
+func (h *ShareHandler) DownloadShared(w http.ResponseWriter, r *http.Request) {
+	_, target, ok := h.openShare(w, r, model.ShareActionDownload, chi.URLParam(r, "*"), true)
+	if !ok {
+		return
+	}
+
+	h.stream.serveDownload(w, r, target)
+}
+
+// PreviewShared streams the shared file, or a file of the shared folder, for
+// inline viewing
+// GET /api/v1/s/:token/preview/*path
+func (h *ShareHandler) PreviewShared(w http.ResponseWriter, r *http.Request) {
+	_, target, ok := h.openShare(w, r, model.ShareActionPreview, chi.URLParam(r, "*"), true)
+	if !ok {
+		return
+	}
+
+	h.stream.servePreview(w, r, target)
+}
+
+// openShare checks a visitor's request against the share link in the URL,
+// writing an error response and returning false if it is refused. The
+// password is only taken from the X-Share-Password header, so that it does
+// not end up in URLs and their logs.
+func (h *ShareHandler) openShare(w http.ResponseWriter, r *http.Request, action model.ShareAction, relPath string, counted bool) (*model.Share, string, bool) {
+	share, target, err := h.shareService.Open(r.Context(), model.ShareRequest{
+		Token:      chi.URLParam(r, "token"),
+		Password:   r.Header.Get("X-Share-Password"),
+		Path:       relPath,
+		Action:     action,
+		RemoteAddr: r.RemoteAddr,
+		Counted:    counted,
+		Resumed:    counted && resumesTransfer(r),
+	})
+	if err != nil {
+		HandleServiceError(w, err)
+		return nil, "", false
+	}
+	return share, target, true
+}
+
+// authorizeShare returns the share link named in the URL if the user owns it
+// or is an admin, writing an error response and returning false otherwise
+func (h *ShareHandler) authorizeShare(w http.ResponseWriter, r *http.Request) (*model.Share, bool) {
+	share, err := h.shareService.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		HandleServiceError(w, err)
+		return nil, false
+	}
+
+	username, admin := requestUser(r)
+	if !admin && share.Owner != username {
+		HandleServiceError(w, service.ErrShareNotFound)
+		return nil, false
+	}
+	return share, true
+}
+
+// resumesTransfer reports whether a request only reads past the start of
+// the file, as media seeking and resumed downloads do. Such requests use up
+// a download unless the visitor's earlier download covers them. A range
+// that http.ServeContent would ignore, or that might start at offset 0,
+// does not qualify.
+func resumesTransfer(r *http.Request) bool {
+	rangeHeader, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok || r.Header.Get("If-Range") != "" {
+		return false
+	}
+	ranges := 0
+	for _, ra := range strings.Split(rangeHeader, ",") {
+		ra = textproto.TrimString(ra)
+		if ra == "" {
+			continue
+		}
+		start, _, ok := strings.Cut(ra, "-")
+		if !ok {
+			return false
+		}
+		// A suffix range (no start) may cover the whole file
+		offset, err := strconv.ParseInt(textproto.TrimString(start), 10, 64)
+		if err != nil || offset <= 0 {
+			return false
+		}
+		ranges++
+	}
+	return ranges > 0
+}
+
+// sharedPath converts a virtual path below a shared folder to a path relative
+// to it
+func sharedPath(share *model.Share, virtualPath string) string {
+	rel := strings.TrimPrefix(strings.Trim(virtualPath, "/"), share.Path)
+	return strings.TrimPrefix(rel, "/")
+}
+
+// toShareResponse converts a model.Share to ShareResponse
+func toShareResponse(share *model.Share) ShareResponse {
+	resp := ShareResponse{
+		ID:            share.ID,
+		Token:         share.Token,
+		URL:           "/api/v1/s/" + share.Token,
+		Path:          share.Path,
+		IsDir:         share.IsDir,
+		Owner:         share.Owner,
+		HasPassword:   share.PasswordHash != "",
+		MaxDownloads:  share.MaxDownloads,
+		Downloads:     share.Downloads,
+		Drop:          share.Drop,
+		Uploads:       share.Uploads,
+		UploadedBytes: share.UploadedBytes,
+		CreatedAt:     share.CreatedAt,
+		Access:        share.Access,
+	}
+	if !share.ExpiresAt.IsZero() {
+		expiresAt := share.ExpiresAt
+		resp.ExpiresAt = &expiresAt
+	}
+	return resp
+}
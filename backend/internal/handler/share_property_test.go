@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/service"
+)
+
+// setupShareRouter creates a router with the share management routes and
+// the public share link routes over an in-memory filesystem
+func setupShareRouter(t *testing.T) http.Handler {
+	t.Helper()
+	streamHandler, fs, fileSvc := setupTestStreamHandler()
+	fs.MkdirAll("/data/media/album/sub", 0755)
+	fs.WriteFile("/data/media/album/a.txt", []byte("hello shared world"), 0644)
+	fs.WriteFile("/data/media/album/sub/b.txt", []byte("nested"), 0644)
+
+	shareSvc := service.NewShareService(fs, fileSvc, service.ShareServiceConfig{DataDir: "/appdata"})
+	h := NewShareHandler(shareSvc, fileSvc, streamHandler, nil)
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Route("/s", h.RegisterPublicRoutes)
+		r.Route("/shares", h.RegisterRoutes)
+	})
+	return r
+}
+
+// createShare creates a share link as the given user
+func createShare(t *testing.T, router http.Handler, username string, body CreateShareRequest) ShareResponse {
+	t.Helper()
+	payload, _ := json.Marshal(body)
+	req := asUser(httptest.NewRequest("POST", "/api/v1/shares", bytes.NewReader(payload)), username)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create share: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var share ShareResponse
+	json.Unmarshal(rec.Body.Bytes(), &share)
+	return share
+}
+
+// TestShareLinkRoutes checks that a shared folder can be browsed and
+// downloaded without authentication while its restrictions are enforced
+func TestShareLinkRoutes(t *testing.T) {
+	router := setupShareRouter(t)
+	share := createShare(t, router, "alice", CreateShareRequest{Path: "media/album", Password: "pw", MaxDownloads: 2})
+	if !share.HasPassword || share.URL != "/api/v1/s/"+share.Token {
+		t.Fatalf("unexpected share response: %+v", share)
+	}
+
+	get := func(path, password, rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if password != "" {
+			req.Header.Set("X-Share-Password", password)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	base := share.URL
+
+	if rec := get(base, "", ""); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), model.ErrCodePasswordRequired) {
+		t.Fatalf("expected password required, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := get(base, "wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected wrong password to be refused, got %d", rec.Code)
+	}
+	// The password is not accepted in the URL
+	if rec := get(base+"?password=pw", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a password in the query to be ignored, got %d", rec.Code)
+	}
+
+	rec := get(base+"/list/sub/../", "pw", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var list model.FileList
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	paths := map[string]bool{}
+	for _, item := range list.Items {
+		paths[item.Path] = true
+	}
+	if list.Path != "" || !paths["a.txt"] || !paths["sub"] {
+		t.Fatalf("expected paths relative to the shared folder, got %q %v", list.Path, paths)
+	}
+
+	if rec := get(base+"/download/a.txt", "pw", ""); rec.Code != http.StatusOK {
+		t.Fatalf("download: status %d", rec.Code)
+	}
+	// Continuing a transfer does not use up a download
+	if rec := get(base+"/preview/a.txt", "pw", "bytes=6-"); rec.Code != http.StatusPartialContent || rec.Body.String() != "shared world" {
+		t.Fatalf("range preview: status %d: %q", rec.Code, rec.Body.String())
+	}
+	if rec := get(base+"/download/sub/b.txt", "pw", ""); rec.Code != http.StatusOK || rec.Body.String() != "nested" {
+		t.Fatalf("second download: status %d: %q", rec.Code, rec.Body.String())
+	}
+	if rec := get(base+"/download/a.txt", "pw", ""); rec.Code != http.StatusGone {
+		t.Fatalf("expected the download limit to be enforced, got %d", rec.Code)
+	}
+
+	// Only the owner sees the link and its access log
+	req := asUser(httptest.NewRequest("GET", "/api/v1/shares/"+share.ID, nil), "bob")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected another user's share to be hidden, got %d", rec.Code)
+	}
+	req = asUser(httptest.NewRequest("GET", "/api/v1/shares/"+share.ID, nil), "alice")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var detail ShareResponse
+	json.Unmarshal(rec.Body.Bytes(), &detail)
+	if detail.Downloads != 2 || len(detail.Access) != 8 || strings.Contains(rec.Body.String(), "pbkdf2") {
+		t.Fatalf("unexpected share detail: %s", rec.Body.String())
+	}
+
+	req = asUser(httptest.NewRequest("DELETE", "/api/v1/shares/"+share.ID, nil), "alice")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d", rec.Code)
+	}
+	if rec := get(base, "pw", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected a revoked link to be gone, got %d", rec.Code)
+	}
+}
+
+// TestShareDownloadLimitRanges checks that range requests cannot be used to
+// download a file without using up one of the link's downloads
+func TestShareDownloadLimitRanges(t *testing.T) {
+	router := setupShareRouter(t)
+	get := func(url, visitor, rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		req.RemoteAddr = visitor + ":1234"
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Each of these starts a download, however the range is written
+	for _, rangeHeader := range []string{"bytes=00-", "bytes= 0-", "bytes=1-", "bytes=0-0", "bytes=-100", "bytes=5-6, 0-0", "bytes=0-0,1-"} {
+		share := createShare(t, router, "alice", CreateShareRequest{Path: "media/album/a.txt", MaxDownloads: 1})
+		if rec := get(share.URL+"/download", "192.0.2.1", rangeHeader); rec.Code >= 400 {
+			t.Fatalf("%q: status %d", rangeHeader, rec.Code)
+		}
+		if rec := get(share.URL+"/download", "192.0.2.1", ""); rec.Code != http.StatusGone {
+			t.Fatalf("%q: expected the download to be used up, got %d", rangeHeader, rec.Code)
+		}
+	}
+
+	// The rest of a visitor's download, in any number of pieces, is free,
+	// but not for other visitors
+	share := createShare(t, router, "alice", CreateShareRequest{Path: "media/album/a.txt", MaxDownloads: 2})
+	if rec := get(share.URL+"/download", "192.0.2.1", "bytes=0-0"); rec.Code != http.StatusPartialContent || rec.Body.String() != "h" {
+		t.Fatalf("first byte: status %d: %q", rec.Code, rec.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		if rec := get(share.URL+"/download", "192.0.2.1", "bytes=1-"); rec.Code != http.StatusPartialContent || rec.Body.String() != "ello shared world" {
+			t.Fatalf("rest: status %d: %q", rec.Code, rec.Body.String())
+		}
+	}
+	if rec := get(share.URL+"/download", "192.0.2.2", "bytes=1-"); rec.Code != http.StatusPartialContent {
+		t.Fatalf("other visitor: status %d", rec.Code)
+	}
+	if rec := get(share.URL+"/download", "192.0.2.1", "bytes=1-"); rec.Code != http.StatusGone {
+		t.Fatalf("expected the downloads to be used up, got %d", rec.Code)
+	}
+}
+
+// dropUpload sends a whole file as one chunk through a drop link
+func dropUpload(router http.Handler, token, uploadID, name, content string) *httptest.ResponseRecorder {
+	return dropUploadRequest(router, httptest.NewRequest("POST", "/api/v1/s/"+token+"/upload/"+name, strings.NewReader(content)), uploadID, content)
+}
+
+// dropUploadRequest sends a whole file as one chunk in the given request
+func dropUploadRequest(router http.Handler, req *http.Request, uploadID, content string) *httptest.ResponseRecorder {
+	req.Header.Set("X-Upload-ID", uploadID)
+	req.Header.Set("X-Chunk-Index", "0")
+	req.Header.Set("X-Total-Chunks", "1")
+	req.Header.Set("X-Chunk-Size", strconv.Itoa(len(content)))
+	req.Header.Set("X-Total-Size", strconv.Itoa(len(content)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestDropLinkRoutes checks that guests can upload into a drop folder
+// without overwriting files, but cannot see its contents
+func TestDropLinkRoutes(t *testing.T) {
+	router := setupShareRouter(t)
+	share := createShare(t, router, "alice", CreateShareRequest{
+		Path: "media/album",
+		Drop: &model.DropOptions{MaxFiles: 2, MaxFileBytes: 10},
+	})
+	base := share.URL
+
+	rec := dropUpload(router, share.Token, "drop-1", "a.txt", "guest")
+	var resp UploadResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusCreated || !resp.Complete || resp.Path != "a (1).txt" {
+		t.Fatalf("expected the upload to be stored under a new name, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := dropUpload(router, share.Token, "drop-2", "big.txt", "more than ten bytes"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected an oversized file to be refused, got %d", rec.Code)
+	}
+
+	for _, path := range []string{"/list", "/download/a.txt", "/preview/a (1).txt"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", base+strings.ReplaceAll(path, " ", "%20"), nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected %s to be refused, got %d", path, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", base, nil))
+	var info ShareInfoResponse
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if rec.Code != http.StatusOK || !info.Upload || info.UploadsLeft == nil || *info.UploadsLeft != 1 {
+		t.Fatalf("unexpected drop link info: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := dropUpload(router, share.Token, "drop-3", "b.txt", "second"); rec.Code != http.StatusCreated {
+		t.Fatalf("second upload: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := dropUpload(router, share.Token, "drop-4", "c.txt", "third"); rec.Code != http.StatusGone {
+		t.Fatalf("expected the file limit to be enforced, got %d", rec.Code)
+	}
+
+	// The password of a protected drop link is only accepted in the header
+	protected := createShare(t, router, "alice", CreateShareRequest{Path: "media/album", Password: "pw", Drop: &model.DropOptions{}})
+	url := "/api/v1/s/" + protected.Token + "/upload/p.txt"
+	if rec := dropUploadRequest(router, httptest.NewRequest("POST", url+"?password=pw", strings.NewReader("p")), "drop-6", "p"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a password in the query to be ignored, got %d", rec.Code)
+	}
+	req := httptest.NewRequest("POST", url, strings.NewReader("p"))
+	req.Header.Set("X-Share-Password", "pw")
+	if rec := dropUploadRequest(router, req, "drop-7", "p"); rec.Code != http.StatusCreated {
+		t.Fatalf("protected upload: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Uploads are refused through ordinary links
+	plain := createShare(t, router, "alice", CreateShareRequest{Path: "media/album"})
+	if rec := dropUpload(router, plain.Token, "drop-5", "x.txt", "x"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected an ordinary link to refuse uploads, got %d", rec.Code)
+	}
+}
+
+// startDropUpload sends the first of two chunks of a file through a drop
+// link, leaving the upload unfinished
+func startDropUpload(router http.Handler, token, uploadID, name string, size int) *httptest.ResponseRecorder {
+	chunk := strings.Repeat("x", size/2)
+	req := httptest.NewRequest("POST", "/api/v1/s/"+token+"/upload/"+name, strings.NewReader(chunk))
+	req.Header.Set("X-Upload-ID", uploadID)
+	req.Header.Set("X-Chunk-Index", "0")
+	req.Header.Set("X-Total-Chunks", "2")
+	req.Header.Set("X-Chunk-Size", strconv.Itoa(len(chunk)))
+	req.Header.Set("X-Total-Size", strconv.Itoa(size))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestDropLinkCountsUnfinishedUploads checks that a drop link's limits
+// cover the uploads through it that have not finished yet
+func TestDropLinkCountsUnfinishedUploads(t *testing.T) {
+	router := setupShareRouter(t)
+
+	files := createShare(t, router, "alice", CreateShareRequest{Path: "media/album", Drop: &model.DropOptions{MaxFiles: 2}})
+	for i, name := range []string{"a.bin", "b.bin"} {
+		if rec := startDropUpload(router, files.Token, "files-"+strconv.Itoa(i), name, 4); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := startDropUpload(router, files.Token, "files-2", "c.bin", 4); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a third unfinished upload to be refused, got %d", rec.Code)
+	}
+
+	bytes := createShare(t, router, "alice", CreateShareRequest{Path: "media/album", Drop: &model.DropOptions{MaxBytes: 10}})
+	if rec := startDropUpload(router, bytes.Token, "bytes-0", "d.bin", 6); rec.Code != http.StatusOK {
+		t.Fatalf("first upload: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := startDropUpload(router, bytes.Token, "bytes-1", "e.bin", 6); rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected the byte limit to cover unfinished uploads, got %d", rec.Code)
+	}
+	if rec := startDropUpload(router, bytes.Token, "bytes-2", "f.bin", 4); rec.Code != http.StatusOK {
+		t.Fatalf("upload within the limit: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -21,6 +22,7 @@ import (
 	"github.com/homelab/filemanager/internal/model"
 	"github.com/homelab/filemanager/internal/pkg/fileutil"
 	"github.com/homelab/filemanager/internal/service"
+	ws "github.com/homelab/filemanager/internal/websocket"
 )
 
 // StreamHandler handles streaming upload and download operations
@@ -28,17 +30,50 @@ type StreamHandler struct {
 	fileService   service.FileService
 	uploadManager *UploadManager
 	chunkSizeMB   int
+	maxUploadSize int64
+	hashes        service.HashIndex
 }
 
-// NewStreamHandler creates a new stream handler
-func NewStreamHandler(fileService service.FileService, chunkSizeMB int) *StreamHandler {
+// StreamHandlerConfig holds configuration for the stream handler
+type StreamHandlerConfig struct {
+	ChunkSizeMB   int
+	DataDir       string            // Upload sessions are persisted under it
+	MaxUploadMB   int               // Largest accepted file; 0 = unlimited
+	UploadQuotaMB int               // Every user's cap on their unfinished uploads; 0 = unlimited
+	UploadQuotas  map[string]int    // Per-user caps in MB, overriding UploadQuotaMB
+	HashIndex     service.HashIndex // Finds existing copies of uploaded content; nil disables instant uploads
+}
+
+// NewStreamHandler creates a new stream handler. Upload session changes are
+// sent to the uploader's other clients through the hub, if one is given.
+func NewStreamHandler(fileService service.FileService, hub *ws.Hub, cfg StreamHandlerConfig) *StreamHandler {
+	chunkSizeMB := cfg.ChunkSizeMB
 	if chunkSizeMB <= 0 {
 		chunkSizeMB = 10 // Default 10MB chunks
 	}
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = config.DefaultDataDir
+	}
+
+	limits := UploadLimits{
+		MaxSize: int64(cfg.MaxUploadMB) * config.BytesPerMB,
+		Quota:   int64(cfg.UploadQuotaMB) * config.BytesPerMB,
+		Quotas:  make(map[string]int64, len(cfg.UploadQuotas)),
+	}
+	for user, quota := range cfg.UploadQuotas {
+		limits.Quotas[user] = int64(quota) * config.BytesPerMB
+	}
+
+	uploadManager := NewUploadManager(fileService.GetFilesystem(), hub, filepath.Join(dataDir, config.UploadSessionsDirName), limits)
+	uploadManager.hashes = cfg.HashIndex
+
 	return &StreamHandler{
 		fileService:   fileService,
-		uploadManager: NewUploadManager(config.DefaultUploadTempDir),
+		uploadManager: uploadManager,
 		chunkSizeMB:   chunkSizeMB,
+		maxUploadSize: limits.MaxSize,
+		hashes:        cfg.HashIndex,
 	}
 }
 
@@ -48,6 +83,16 @@ func (h *StreamHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/preview/*", h.Preview)
 	r.Post("/upload/*", h.Upload)
 	r.Get("/upload/status/*", h.UploadStatus)
+	r.Get("/uploads", h.ListUploads)
+	r.Post("/instant/*", h.InstantUpload)
+	r.Route("/batches", h.registerBatchRoutes)
+	r.Route("/tus", h.registerTusRoutes)
+}
+
+// RestoreUploads rebuilds the upload sessions persisted before a restart and
+// returns how many were restored
+func (h *StreamHandler) RestoreUploads() (int, error) {
+	return h.uploadManager.Restore()
 }
 
 // StartCleanup starts the periodic cleanup of expired upload sessions
@@ -60,6 +105,12 @@ func (h *StreamHandler) StopCleanup() {
 	h.uploadManager.StopCleanup()
 }
 
+// UploadManager returns the manager of the handler's upload sessions, so
+// that other upload protocols share its limits and temp files
+func (h *StreamHandler) UploadManager() *UploadManager {
+	return h.uploadManager
+}
+
 // Download handles file download requests with Range header support
 // GET /api/v1/stream/download/*path
 func (h *StreamHandler) Download(w http.ResponseWriter, r *http.Request) {
@@ -69,6 +120,11 @@ func (h *StreamHandler) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.serveDownload(w, r, path)
+}
+
+// serveDownload streams the file at a virtual path as an attachment
+func (h *StreamHandler) serveDownload(w http.ResponseWriter, r *http.Request, path string) {
 	// Open the file using the file service (uses filesystem abstraction)
 	file, info, err := h.fileService.OpenFile(r.Context(), path)
 	if err != nil {
@@ -98,6 +154,11 @@ func (h *StreamHandler) Preview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.servePreview(w, r, path)
+}
+
+// servePreview streams the file at a virtual path for inline viewing
+func (h *StreamHandler) servePreview(w http.ResponseWriter, r *http.Request, path string) {
 	// Open the file using the file service (uses filesystem abstraction)
 	file, info, err := h.fileService.OpenFile(r.Context(), path)
 	if err != nil {
@@ -126,182 +187,16 @@ func (h *StreamHandler) Preview(w http.ResponseWriter, r *http.Request) {
 	http.ServeContent(w, r, info.Name, info.ModTime, file)
 }
 
-// UploadSession tracks the state of a chunked upload
-type UploadSession struct {
-	ID             string       `json:"id"`
-	Path           string       `json:"path"`
-	TotalChunks    int          `json:"totalChunks"`
-	ChunkSize      int64        `json:"chunkSize"`
-	TotalSize      int64        `json:"totalSize"`
-	ReceivedChunks map[int]bool `json:"-"`
-	TempDir        string       `json:"-"`
-	CreatedAt      time.Time    `json:"createdAt"`
-	LastActivity   time.Time    `json:"lastActivity"`
-	mu             sync.RWMutex
-}
-
-// UploadManager manages active upload sessions
-type UploadManager struct {
-	sessions map[string]*UploadSession
-	tempRoot string
-	mu       sync.RWMutex
-	stopCh   chan struct{}
-	wg       sync.WaitGroup
-}
-
-// NewUploadManager creates a new upload manager
-func NewUploadManager(tempRoot string) *UploadManager {
-	if tempRoot == "" {
-		tempRoot = os.TempDir()
-	}
-	return &UploadManager{
-		sessions: make(map[string]*UploadSession),
-		tempRoot: tempRoot,
-		stopCh:   make(chan struct{}),
-	}
-}
-
-// StartCleanup starts the periodic cleanup of expired sessions
-func (m *UploadManager) StartCleanup(ctx context.Context) {
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		ticker := time.NewTicker(config.SessionCleanupInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-m.stopCh:
-				return
-			case <-ticker.C:
-				m.cleanupExpiredSessions()
-			}
-		}
-	}()
-}
-
-// StopCleanup stops the cleanup goroutine
-func (m *UploadManager) StopCleanup() {
-	close(m.stopCh)
-	m.wg.Wait()
-}
-
-// cleanupExpiredSessions removes sessions that have been inactive for too long
-func (m *UploadManager) cleanupExpiredSessions() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	now := time.Now()
-	for id, session := range m.sessions {
-		if now.Sub(session.LastActivity) > config.SessionTimeout {
-			_ = os.RemoveAll(session.TempDir)
-			delete(m.sessions, id)
-		}
-	}
-}
-
-// CreateSession creates a new upload session
-func (m *UploadManager) CreateSession(id, path string, totalChunks int, chunkSize, totalSize int64) (*UploadSession, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Ensure upload temp root exists and create a per-upload temp directory.
-	if err := os.MkdirAll(m.tempRoot, 0o755); err != nil {
-		return nil, fmt.Errorf("failed to ensure upload temp root: %w", err)
-	}
-	tempDir, err := os.MkdirTemp(m.tempRoot, "upload-"+id+"-")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
-	}
-
-	session := &UploadSession{
-		ID:             id,
-		Path:           path,
-		TotalChunks:    totalChunks,
-		ChunkSize:      chunkSize,
-		TotalSize:      totalSize,
-		ReceivedChunks: make(map[int]bool),
-		TempDir:        tempDir,
-		CreatedAt:      time.Now(),
-		LastActivity:   time.Now(),
-	}
-
-	m.sessions[id] = session
-	return session, nil
-}
-
-// GetSession retrieves an upload session by ID
-func (m *UploadManager) GetSession(id string) (*UploadSession, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	session, ok := m.sessions[id]
-	return session, ok
-}
-
-// DeleteSession removes an upload session and cleans up temp files
-func (m *UploadManager) DeleteSession(id string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if session, ok := m.sessions[id]; ok {
-		_ = os.RemoveAll(session.TempDir)
-		delete(m.sessions, id)
-	}
-}
-
-// MarkChunkReceived marks a chunk as received
-func (s *UploadSession) MarkChunkReceived(index int) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.ReceivedChunks[index] = true
-	s.LastActivity = time.Now()
-}
-
-// IsChunkReceived checks if a chunk has been received
-func (s *UploadSession) IsChunkReceived(index int) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.ReceivedChunks[index]
-}
-
-// IsComplete checks if all chunks have been received
-func (s *UploadSession) IsComplete() bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.ReceivedChunks) == s.TotalChunks
-}
-
-// GetReceivedCount returns the number of received chunks
-func (s *UploadSession) GetReceivedCount() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.ReceivedChunks)
-}
-
-// GetMissingChunks returns a list of missing chunk indices
-func (s *UploadSession) GetMissingChunks() []int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	missing := make([]int, 0)
-	for i := 0; i < s.TotalChunks; i++ {
-		if !s.ReceivedChunks[i] {
-			missing = append(missing, i)
-		}
-	}
-	return missing
-}
-
 // UploadRequest represents the headers for a chunk upload
 type UploadRequest struct {
-	UploadID    string
-	ChunkIndex  int
-	TotalChunks int
-	ChunkSize   int64
-	TotalSize   int64
-	Checksum    string // SHA256 checksum for final verification
+	UploadID      string
+	ChunkIndex    int
+	TotalChunks   int
+	ChunkSize     int64
+	TotalSize     int64
+	Checksum      string // SHA256 checksum for final verification
+	ChunkChecksum string // SHA256 checksum of this chunk
+	BatchID       string // Folder upload batch of the file, if any
 }
 
 // UploadResponse represents the response for a chunk upload
@@ -312,6 +207,7 @@ type UploadResponse struct {
 	TotalChunks    int    `json:"totalChunks"`
 	Complete       bool   `json:"complete"`
 	Path           string `json:"path,omitempty"`
+	BatchID        string `json:"batchId,omitempty"`
 }
 
 // UploadStatusResponse represents the status of an upload session
@@ -326,6 +222,26 @@ type UploadStatusResponse struct {
 	LastActivity   time.Time `json:"lastActivity"`
 }
 
+// UploadSessionResponse summarizes an in-flight upload session
+type UploadSessionResponse struct {
+	UploadID       string    `json:"uploadId"`
+	Path           string    `json:"path"`
+	TotalSize      int64     `json:"totalSize"`
+	TotalChunks    int       `json:"totalChunks"`
+	ReceivedChunks int       `json:"receivedChunks"`
+	MissingCount   int       `json:"missingCount"`
+	ReceivedBytes  int64     `json:"receivedBytes"`
+	Tus            bool      `json:"tus,omitempty"`
+	BatchID        string    `json:"batchId,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastActivity   time.Time `json:"lastActivity"`
+}
+
+// UploadListResponse represents the list of in-flight upload sessions
+type UploadListResponse struct {
+	Uploads []UploadSessionResponse `json:"uploads"`
+}
+
 // Upload handles chunked file uploads
 // POST /api/v1/stream/upload/*path
 // Headers:
@@ -335,7 +251,9 @@ type UploadStatusResponse struct {
 //	X-Total-Chunks: total number of chunks
 //	X-Chunk-Size: size of each chunk in bytes
 //	X-Total-Size: total file size in bytes
+//	X-Chunk-Checksum: SHA256 checksum of the chunk (optional)
 //	X-Checksum: SHA256 checksum (only on final chunk)
+//	X-Batch-ID: batch the file belongs to (only for folder uploads)
 func (h *StreamHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "*")
 	if path == "" {
@@ -350,6 +268,28 @@ func (h *StreamHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	owner, _ := requestUser(r)
+	h.receiveChunk(w, r, uploadReq, uploadTarget{Path: path, Owner: owner})
+}
+
+// uploadTarget is the destination of a chunked upload. Place lets other
+// routes, such as drop links, reuse the upload protocol.
+type uploadTarget struct {
+	Path  string // Virtual destination path
+	Owner string
+	// Limit caps the owner's unfinished sessions when a new one is created
+	Limit SessionLimit
+	// Place, if set, moves a complete upload into place instead of Finish and
+	// returns the path reported to the client. Service errors it returns are
+	// sent to the client as they are.
+	Place func(session *UploadSession, fsPath, checksum string) (string, error)
+}
+
+// receiveChunk writes one chunk of an upload to target, creating the upload
+// session with the first chunk and moving the file into place with the last
+func (h *StreamHandler) receiveChunk(w http.ResponseWriter, r *http.Request, uploadReq *UploadRequest, target uploadTarget) {
+	path, owner := target.Path, target.Owner
+
 	// Validate path and check write permissions
 	mount, fsPath, err := h.fileService.ResolvePath(path)
 	if err != nil {
@@ -362,21 +302,43 @@ func (h *StreamHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get or create upload session
-	session, exists := h.uploadManager.GetSession(uploadReq.UploadID)
-	if !exists {
-		session, err = h.uploadManager.CreateSession(
+	// Get or create upload session. The sessions of a batch's files are
+	// created with the batch.
+	var session *UploadSession
+	var created bool
+	if uploadReq.BatchID != "" {
+		var ok bool
+		session, ok = h.uploadManager.GetSession(uploadReq.UploadID)
+		if !ok || session.BatchID != uploadReq.BatchID {
+			writeNotFound(w, "Upload batch file not found")
+			return
+		}
+	} else {
+		session, created, err = h.uploadManager.CreateLimitedSession(
+			target.Limit,
 			uploadReq.UploadID,
+			owner,
 			path,
+			fsPath,
 			uploadReq.TotalChunks,
 			uploadReq.ChunkSize,
 			uploadReq.TotalSize,
 		)
 		if err != nil {
-			writeError(w, "Failed to create upload session", model.ErrCodeInternalError, http.StatusInternalServerError)
+			writeUploadError(w, "Failed to create upload session", err)
 			return
 		}
 	}
+	if created {
+		h.uploadManager.notify(session, model.UploadEventCreated, "")
+	} else if session.Owner != owner || session.Tus || session.BatchID != uploadReq.BatchID {
+		writeConflict(w, "Upload ID is in use")
+		return
+	} else if session.Path != path || session.TotalChunks != uploadReq.TotalChunks ||
+		session.ChunkSize != uploadReq.ChunkSize || session.TotalSize != uploadReq.TotalSize {
+		writeBadRequest(w, "Upload headers do not match the upload session")
+		return
+	}
 
 	// Check if chunk was already received (for resumable uploads)
 	if session.IsChunkReceived(uploadReq.ChunkIndex) {
@@ -390,50 +352,106 @@ func (h *StreamHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Save chunk to temp file
-	chunkPath := filepath.Join(session.TempDir, fmt.Sprintf("chunk_%d", uploadReq.ChunkIndex))
-	chunkFile, err := os.OpenFile(chunkPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	// Every chunk but the last is exactly X-Chunk-Size bytes
+	length := session.ChunkLength(uploadReq.ChunkIndex)
+	sizeMismatch := fmt.Sprintf("Chunk %d must be %d bytes", uploadReq.ChunkIndex, length)
+	if r.ContentLength >= 0 && r.ContentLength != length {
+		writeBadRequest(w, sizeMismatch)
+		return
+	}
+
+	// Write the chunk at its offset in the upload file. A rejected chunk is
+	// not marked received, so its resend overwrites it.
+	dataFile, err := h.fileService.GetFilesystem().OpenFile(session.TempPath, os.O_RDWR, 0)
 	if err != nil {
-		writeError(w, "Failed to create chunk file", model.ErrCodeInternalError, http.StatusInternalServerError)
+		writeInternalError(w, "Failed to open upload file")
 		return
 	}
+	// Closed before the upload is moved into place, and only once, so that
+	// a late close cannot touch the finished file
+	closeDataFile := sync.OnceValue(dataFile.Close)
+	defer closeDataFile()
 
-	_, err = io.Copy(chunkFile, r.Body)
-	chunkFile.Close()
+	if _, err := dataFile.Seek(session.ChunkOffset(uploadReq.ChunkIndex), io.SeekStart); err != nil {
+		writeInternalError(w, "Failed to open upload file")
+		return
+	}
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dataFile, hasher), io.LimitReader(r.Body, length))
 	if err != nil {
-		_ = os.Remove(chunkPath)
-		writeError(w, "Failed to write chunk", model.ErrCodeInternalError, http.StatusInternalServerError)
+		writeUploadError(w, "Failed to write chunk", err)
+		return
+	}
+	if n, _ := r.Body.Read(make([]byte, 1)); written != length || n > 0 {
+		writeBadRequest(w, sizeMismatch)
+		return
+	}
+	if uploadReq.ChunkChecksum != "" && hex.EncodeToString(hasher.Sum(nil)) != uploadReq.ChunkChecksum {
+		writeError(w, fmt.Sprintf("Chunk %d checksum mismatch", uploadReq.ChunkIndex), model.ErrCodeChecksumMismatch, http.StatusUnprocessableEntity)
 		return
 	}
 
 	// Mark chunk as received
-	session.MarkChunkReceived(uploadReq.ChunkIndex)
+	session.MarkChunkReceived(uploadReq.ChunkIndex, written)
+	h.uploadManager.notify(session, model.UploadEventProgress, "")
+	if err := session.advanceHash(dataFile); err != nil {
+		writeInternalError(w, "Failed to hash chunk")
+		return
+	}
+	if err := closeDataFile(); err != nil {
+		writeUploadError(w, "Failed to write chunk", err)
+		return
+	}
+	if err := h.uploadManager.save(session); err != nil {
+		writeUploadError(w, "Failed to save upload session", err)
+		return
+	}
 
-	// Check if upload is complete
-	if session.IsComplete() {
-		// Assemble chunks into final file
-		err = h.assembleChunks(session, fsPath, uploadReq.Checksum)
+	// The request that completes the upload moves it into place, or for an
+	// atomic batch leaves it until the batch is complete
+	if session.claimFinish() {
+		checksum := strings.TrimPrefix(uploadReq.Checksum, "sha256:")
+		inPlace := true
+		placed := path
+		switch {
+		case session.BatchID != "":
+			inPlace, err = h.uploadManager.FinishBatchFile(session, fsPath, checksum)
+		case target.Place != nil:
+			placed, err = target.Place(session, fsPath, checksum)
+		default:
+			err = h.uploadManager.Finish(session, fsPath, checksum)
+		}
 		if err != nil {
-			h.uploadManager.DeleteSession(session.ID)
-			if strings.Contains(err.Error(), "checksum") {
+			if mapping, ok := lookupServiceError(err); ok {
+				h.uploadManager.notify(session, model.UploadEventFailed, err.Error())
+				writeError(w, mapping.Message, mapping.Code, mapping.StatusCode)
+			} else if strings.Contains(err.Error(), "checksum") {
+				h.uploadManager.notify(session, model.UploadEventChecksumFailed, err.Error())
 				writeError(w, err.Error(), model.ErrCodeChecksumMismatch, http.StatusUnprocessableEntity)
 			} else {
-				writeError(w, "Failed to assemble file: "+err.Error(), model.ErrCodeInternalError, http.StatusInternalServerError)
+				h.uploadManager.notify(session, model.UploadEventFailed, err.Error())
+				writeUploadError(w, "Failed to finalize file: "+err.Error(), err)
 			}
 			return
 		}
+		if session.BatchID == "" {
+			h.uploadManager.notify(session, model.UploadEventAssembled, "")
+		}
 
-		// Clean up session
-		h.uploadManager.DeleteSession(session.ID)
-
-		writeJSON(w, UploadResponse{
+		response := UploadResponse{
 			UploadID:       session.ID,
 			ChunkIndex:     uploadReq.ChunkIndex,
 			ReceivedChunks: session.TotalChunks,
 			TotalChunks:    session.TotalChunks,
 			Complete:       true,
-			Path:           path,
-		}, http.StatusCreated)
+			BatchID:        session.BatchID,
+		}
+		if !inPlace {
+			writeJSON(w, response, http.StatusAccepted)
+			return
+		}
+		response.Path = placed
+		writeJSON(w, response, http.StatusCreated)
 		return
 	}
 
@@ -452,6 +470,9 @@ func (h *StreamHandler) parseUploadHeaders(r *http.Request) (*UploadRequest, err
 	if uploadID == "" {
 		return nil, errors.New("X-Upload-ID header is required")
 	}
+	if !validUploadID(uploadID) {
+		return nil, errors.New("X-Upload-ID must be up to 128 letters, digits, '.', '_' or '-'")
+	}
 
 	chunkIndexStr := r.Header.Get("X-Chunk-Index")
 	if chunkIndexStr == "" {
@@ -493,83 +514,52 @@ func (h *StreamHandler) parseUploadHeaders(r *http.Request) (*UploadRequest, err
 		return nil, errors.New("X-Total-Size must be a positive integer")
 	}
 
-	// Checksum is optional but required on final chunk for verification
-	checksum := r.Header.Get("X-Checksum")
-
-	return &UploadRequest{
-		UploadID:    uploadID,
-		ChunkIndex:  chunkIndex,
-		TotalChunks: totalChunks,
-		ChunkSize:   chunkSize,
-		TotalSize:   totalSize,
-		Checksum:    checksum,
-	}, nil
-}
-
-// assembleChunks combines all chunks into the final file
-func (h *StreamHandler) assembleChunks(session *UploadSession, destPath string, expectedChecksum string) error {
-	// Get the filesystem from the file service
-	fs := h.fileService.GetFilesystem()
-
-	// Ensure parent directory exists
-	parentDir := filepath.Dir(destPath)
-	if err := fs.MkdirAll(parentDir, 0755); err != nil {
-		return fmt.Errorf("failed to create parent directory: %w", err)
+	// Every chunk but the last is exactly X-Chunk-Size bytes
+	if int64(totalChunks) != (totalSize+chunkSize-1)/chunkSize {
+		return nil, errors.New("X-Total-Chunks must be X-Total-Size divided by X-Chunk-Size, rounded up")
 	}
 
-	// Write into a temporary file in the destination directory, then rename atomically.
-	tempDestPath := destPath + ".uploading." + session.ID
-	destFile, err := fs.OpenFile(tempDestPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
-	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
-	}
-	cleanupTemp := true
-	defer func() {
-		_ = destFile.Close()
-		if cleanupTemp {
-			_ = fs.Remove(tempDestPath)
-		}
-	}()
+	// Checksum is optional but required on final chunk for verification
+	checksum := r.Header.Get("X-Checksum")
 
-	// Create hasher for checksum verification
-	hasher := sha256.New()
-	writer := io.MultiWriter(destFile, hasher)
-	copyBuf := make([]byte, config.FileCopyBufferSize)
+	// Files of a folder upload name their batch
+	batchID := r.Header.Get("X-Batch-ID")
 
-	// Assemble chunks in order
-	for i := 0; i < session.TotalChunks; i++ {
-		chunkPath := filepath.Join(session.TempDir, fmt.Sprintf("chunk_%d", i))
-		chunkFile, err := os.Open(chunkPath)
-		if err != nil {
-			return fmt.Errorf("failed to open chunk %d: %w", i, err)
-		}
-
-		_, err = io.CopyBuffer(writer, chunkFile, copyBuf)
-		chunkFile.Close()
-		if err != nil {
-			return fmt.Errorf("failed to copy chunk %d: %w", i, err)
+	// A chunk checksum lets a corrupt chunk be resent on its own
+	chunkChecksum := strings.ToLower(strings.TrimPrefix(r.Header.Get("X-Chunk-Checksum"), "sha256:"))
+	if chunkChecksum != "" {
+		if decoded, err := hex.DecodeString(chunkChecksum); err != nil || len(decoded) != sha256.Size {
+			return nil, errors.New("X-Chunk-Checksum must be a hex SHA256 digest")
 		}
 	}
 
-	// Verify checksum if provided
-	if expectedChecksum != "" {
-		actualChecksum := hex.EncodeToString(hasher.Sum(nil))
-		// Handle both with and without "sha256:" prefix
-		expected := strings.TrimPrefix(expectedChecksum, "sha256:")
-		if actualChecksum != expected {
-			return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actualChecksum)
-		}
-	}
+	return &UploadRequest{
+		UploadID:      uploadID,
+		ChunkIndex:    chunkIndex,
+		TotalChunks:   totalChunks,
+		ChunkSize:     chunkSize,
+		TotalSize:     totalSize,
+		Checksum:      checksum,
+		ChunkChecksum: chunkChecksum,
+		BatchID:       batchID,
+	}, nil
+}
 
-	if err := destFile.Close(); err != nil {
-		return fmt.Errorf("failed to finalize destination file: %w", err)
-	}
-	if err := fs.Rename(tempDestPath, destPath); err != nil {
-		return fmt.Errorf("failed to finalize uploaded file: %w", err)
+// writeUploadError writes an error response for a failed upload, reporting
+// uploads that are not admitted and a full disk with their own statuses
+func writeUploadError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, ErrUploadTooLarge):
+		writeError(w, err.Error(), model.ErrCodeValidationError, http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrUploadQuotaExceeded):
+		writeError(w, err.Error(), model.ErrCodeQuotaExceeded, http.StatusInsufficientStorage)
+	case errors.Is(err, ErrTooManyUploads):
+		writeError(w, err.Error(), model.ErrCodeQuotaExceeded, http.StatusTooManyRequests)
+	case errors.Is(err, ErrInsufficientStorage), errors.Is(err, syscall.ENOSPC):
+		writeError(w, "Insufficient storage", model.ErrCodeInsufficientStorage, http.StatusInsufficientStorage)
+	default:
+		writeInternalError(w, message)
 	}
-	cleanupTemp = false
-
-	return nil
 }
 
 func detectStreamMimeType(file io.ReadSeeker, filename string) string {
@@ -603,8 +593,10 @@ func (h *StreamHandler) UploadStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Other users' sessions are reported as not found
+	username, admin := requestUser(r)
 	session, exists := h.uploadManager.GetSession(uploadID)
-	if !exists {
+	if !exists || (!admin && session.Owner != username) {
 		writeError(w, "Upload session not found", model.ErrCodeNotFound, http.StatusNotFound)
 		return
 	}
@@ -617,6 +609,35 @@ func (h *StreamHandler) UploadStatus(w http.ResponseWriter, r *http.Request) {
 		MissingChunks:  session.GetMissingChunks(),
 		Complete:       session.IsComplete(),
 		CreatedAt:      session.CreatedAt,
-		LastActivity:   session.LastActivity,
+		LastActivity:   session.GetLastActivity(),
 	}, http.StatusOK)
 }
+
+// ListUploads returns the current user's in-flight upload sessions
+// GET /api/v1/stream/uploads
+func (h *StreamHandler) ListUploads(w http.ResponseWriter, r *http.Request) {
+	username, _ := requestUser(r)
+	sessions := h.uploadManager.ListSessions(username)
+
+	response := UploadListResponse{
+		Uploads: make([]UploadSessionResponse, len(sessions)),
+	}
+	for i, session := range sessions {
+		received := session.GetReceivedCount()
+		response.Uploads[i] = UploadSessionResponse{
+			UploadID:       session.ID,
+			Path:           session.Path,
+			TotalSize:      session.TotalSize,
+			TotalChunks:    session.TotalChunks,
+			ReceivedChunks: received,
+			MissingCount:   session.TotalChunks - received,
+			ReceivedBytes:  session.GetOffset(),
+			Tus:            session.Tus,
+			BatchID:        session.BatchID,
+			CreatedAt:      session.CreatedAt,
+			LastActivity:   session.GetLastActivity(),
+		}
+	}
+
+	writeJSON(w, response, http.StatusOK)
+}
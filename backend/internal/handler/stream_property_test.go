@@ -36,7 +36,7 @@ func setupTestStreamHandler() (*StreamHandler, *filesystem.AferoFS, service.File
 	}
 
 	fileSvc := service.NewFileService(fs, service.FileServiceConfig{MountPoints: mounts})
-	streamHandler := NewStreamHandler(fileSvc, 1) // 1MB chunk size for testing
+	streamHandler := NewStreamHandler(fileSvc, nil, StreamHandlerConfig{ChunkSizeMB: 1}) // 1MB chunk size for testing
 
 	return streamHandler, fs, fileSvc
 }
@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+)
+
+// tus 1.0 protocol constants
+const (
+	tusVersion            = "1.0.0"
+	tusExtensions         = "creation,termination,checksum,expiration"
+	tusChecksumAlgorithms = "sha1,sha256,md5"
+	tusContentType        = "application/offset+octet-stream"
+
+	// statusChecksumMismatch is the tus status for a PATCH body that does not
+	// match its Upload-Checksum
+	statusChecksumMismatch = 460
+)
+
+// registerTusRoutes registers the tus upload routes on the given router.
+// Uploads are created at the route itself and addressed by ID below it.
+func (h *StreamHandler) registerTusRoutes(r chi.Router) {
+	r.Use(tusResumable)
+	r.Options("/", h.TusOptions)
+	r.Post("/", h.TusCreate)
+	r.Head("/{id}", h.TusHead)
+	r.Patch("/{id}", h.TusPatch)
+	r.Delete("/{id}", h.TusDelete)
+}
+
+// tusResumable applies X-HTTP-Method-Override and rejects requests for
+// protocol versions other than tus 1.0
+func tusResumable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+
+		// Clients behind proxies that drop PATCH and DELETE send them as POST
+		if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && r.Method == http.MethodPost {
+			r.Method = strings.ToUpper(override)
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				rctx.RouteMethod = r.Method
+			}
+		}
+
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			writeError(w, "Unsupported tus version", model.ErrCodeValidationError, http.StatusPreconditionFailed)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TusOptions describes the supported tus version and extensions
+// OPTIONS /api/v1/stream/tus
+func (h *StreamHandler) TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", tusChecksumAlgorithms)
+	if h.maxUploadSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxUploadSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreate creates a tus upload. The destination directory and file name
+// are taken from the "destination" and "filename" (or "name") metadata.
+// POST /api/v1/stream/tus
+// Headers:
+//
+//	Upload-Length: total file size in bytes
+//	Upload-Metadata: comma-separated keys and base64 values
+func (h *StreamHandler) TusCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		writeBadRequest(w, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeBadRequest(w, "Upload-Length must be a non-negative integer")
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	metadata, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	name := metadata["filename"]
+	if name == "" {
+		name = metadata["name"]
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		writeBadRequest(w, "filename metadata must be a file name")
+		return
+	}
+	destination := strings.Trim(metadata["destination"], "/")
+	if destination == "" {
+		writeBadRequest(w, "destination metadata is required")
+		return
+	}
+	filePath := destination + "/" + name
+
+	// Validate path and check write permissions
+	mount, fsPath, err := h.fileService.ResolvePath(filePath)
+	if err != nil {
+		HandleServiceError(w, err)
+		return
+	}
+	if mount.ReadOnly {
+		writeError(w, "Mount point is read-only", model.ErrCodeReadOnly, http.StatusForbidden)
+		return
+	}
+
+	owner, _ := requestUser(r)
+	session, err := h.uploadManager.CreateTusSession(uuid.NewString(), owner, filePath, fsPath, length, rawMetadata)
+	if err != nil {
+		writeUploadError(w, "Failed to create upload session", err)
+		return
+	}
+	h.uploadManager.notify(session, model.UploadEventCreated, "")
+
+	// An empty file is complete as soon as it is created
+	if length == 0 && !h.finishTusUpload(w, session) {
+		return
+	}
+
+	w.Header().Set("Location", path.Join(r.URL.Path, session.ID))
+	if length > 0 {
+		w.Header().Set("Upload-Expires", tusExpires(session))
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusHead reports the offset of a tus upload
+// HEAD /api/v1/stream/tus/{id}
+func (h *StreamHandler) TusHead(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.tusSession(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.GetOffset(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.TotalSize, 10))
+	w.Header().Set("Upload-Expires", tusExpires(session))
+	if session.Metadata != "" {
+		w.Header().Set("Upload-Metadata", session.Metadata)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatch appends data to a tus upload at the given offset. The upload is
+// moved into place once all of its bytes have been received.
+// PATCH /api/v1/stream/tus/{id}
+// Headers:
+//
+//	Content-Type: application/offset+octet-stream
+//	Upload-Offset: current offset of the upload
+//	Upload-Checksum: algorithm and base64 digest of the body (optional)
+func (h *StreamHandler) TusPatch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != tusContentType {
+		writeError(w, "Content-Type must be "+tusContentType, model.ErrCodeValidationError, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	session, ok := h.tusSession(w, r)
+	if !ok {
+		return
+	}
+
+	// One request at a time may append to an upload
+	if !session.transfer.TryLock() {
+		writeConflict(w, "Upload is being written by another request")
+		return
+	}
+	defer session.transfer.Unlock()
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeBadRequest(w, "Upload-Offset must be a non-negative integer")
+		return
+	}
+	if offset != session.GetOffset() {
+		writeConflict(w, "Upload-Offset does not match the upload's offset")
+		return
+	}
+
+	var hasher hash.Hash
+	var expected []byte
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		hasher, expected, err = parseTusChecksum(header)
+		if err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+	}
+
+	dataFile, err := h.fileService.GetFilesystem().OpenFile(session.TempPath, os.O_WRONLY, 0)
+	if err != nil {
+		writeInternalError(w, "Failed to open upload data")
+		return
+	}
+	defer dataFile.Close()
+	if _, err := dataFile.Seek(offset, io.SeekStart); err != nil {
+		writeInternalError(w, "Failed to open upload data")
+		return
+	}
+
+	var writer io.Writer = dataFile
+	if hasher != nil {
+		writer = io.MultiWriter(dataFile, hasher)
+	}
+	remaining := session.TotalSize - offset
+	written, copyErr := io.Copy(writer, io.LimitReader(r.Body, remaining))
+
+	// Data past the upload's length is rejected as a whole. Rejected data
+	// stays in the preallocated file until overwritten, past the offset.
+	if copyErr == nil && written == remaining {
+		if n, _ := r.Body.Read(make([]byte, 1)); n > 0 {
+			writeError(w, "Body exceeds Upload-Length", model.ErrCodeValidationError, http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	if hasher != nil {
+		// A checksum covers the whole body, so partial bodies are discarded too
+		if copyErr != nil || string(hasher.Sum(nil)) != string(expected) {
+			if copyErr != nil {
+				writeUploadError(w, "Failed to write upload data", copyErr)
+			} else {
+				writeError(w, "Checksum mismatch", model.ErrCodeChecksumMismatch, statusChecksumMismatch)
+			}
+			return
+		}
+	}
+
+	// Keep whatever arrived before an interrupted request, so the client
+	// can resume from there
+	if written > 0 {
+		session.SetOffset(offset + written)
+		h.uploadManager.notify(session, model.UploadEventProgress, "")
+		if err := h.uploadManager.save(session); err != nil {
+			writeUploadError(w, "Failed to save upload session", err)
+			return
+		}
+	}
+	if copyErr != nil {
+		writeUploadError(w, "Failed to write upload data", copyErr)
+		return
+	}
+	if err := dataFile.Close(); err != nil {
+		writeUploadError(w, "Failed to write upload data", err)
+		return
+	}
+
+	if session.IsComplete() {
+		if !h.finishTusUpload(w, session) {
+			return
+		}
+	} else {
+		w.Header().Set("Upload-Expires", tusExpires(session))
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.GetOffset(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusDelete terminates a tus upload and discards its data
+// DELETE /api/v1/stream/tus/{id}
+func (h *StreamHandler) TusDelete(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.tusSession(w, r)
+	if !ok {
+		return
+	}
+
+	h.uploadManager.DeleteSession(session.ID)
+	h.uploadManager.notify(session, model.UploadEventCancelled, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusSession looks up the tus upload named in the URL. Other users' uploads
+// are reported as not found.
+func (h *StreamHandler) tusSession(w http.ResponseWriter, r *http.Request) (*UploadSession, bool) {
+	username, _ := requestUser(r)
+	session, ok := h.uploadManager.GetSession(chi.URLParam(r, "id"))
+	if !ok || !session.Tus || session.Owner != username {
+		writeNotFound(w, "Upload not found")
+		return nil, false
+	}
+	return session, true
+}
+
+// finishTusUpload moves a complete tus upload into place and removes its
+// session, writing an error response if that fails
+func (h *StreamHandler) finishTusUpload(w http.ResponseWriter, session *UploadSession) bool {
+	_, fsPath, err := h.fileService.ResolvePath(session.Path)
+	if err == nil {
+		err = h.uploadManager.Finish(session, fsPath, "")
+	} else {
+		h.uploadManager.DeleteSession(session.ID)
+	}
+	if err != nil {
+		h.uploadManager.notify(session, model.UploadEventFailed, err.Error())
+		writeUploadError(w, "Failed to finalize upload: "+err.Error(), err)
+		return false
+	}
+	h.uploadManager.notify(session, model.UploadEventAssembled, "")
+	return true
+}
+
+// tusExpires returns when an upload expires if no more data arrives
+func tusExpires(session *UploadSession) string {
+	return session.GetLastActivity().Add(config.SessionTimeout).UTC().Format(http.TimeFormat)
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated pairs
+// of a key and an optional base64 value
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("Upload-Metadata has an empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("Upload-Metadata value for " + key + " is not base64")
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// parseTusChecksum decodes an Upload-Checksum header into a hash for its
+// algorithm and the expected digest
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	algorithm, encoded, _ := strings.Cut(header, " ")
+	digest, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, errors.New("Upload-Checksum digest is not base64")
+	}
+	switch algorithm {
+	case "sha1":
+		return sha1.New(), digest, nil
+	case "sha256":
+		return sha256.New(), digest, nil
+	case "md5":
+		return md5.New(), digest, nil
+	default:
+		return nil, nil, errors.New("Upload-Checksum algorithm must be one of " + tusChecksumAlgorithms)
+	}
+}
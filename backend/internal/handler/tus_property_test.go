@@ -0,0 +1,146 @@
+// Package handler provides HTTP handlers for the file manager API.
+// This file contains property-based tests for tus uploads.
+package handler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// tusRequest builds a tus request made by the given user
+func tusRequest(method, target, username string, body []byte) *http.Request {
+	req := asUser(httptest.NewRequest(method, target, bytes.NewReader(body)), username)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	return req
+}
+
+// tusMetadata encodes Upload-Metadata for a destination and file name
+func tusMetadata(destination, filename string) string {
+	return "destination " + base64.StdEncoding.EncodeToString([]byte(destination)) +
+		",filename " + base64.StdEncoding.EncodeToString([]byte(filename))
+}
+
+// tusOffset returns the offset a HEAD request reports for an upload
+func tusOffset(router http.Handler, location, username string) (int64, int) {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, tusRequest(http.MethodHead, location, username, nil))
+	offset, _ := strconv.ParseInt(rec.Header().Get("Upload-Offset"), 10, 64)
+	return offset, rec.Code
+}
+
+// **Feature: homelab-file-manager, Property 32: tus Upload Integrity**
+//
+// Property: For any file sent as a tus upload in PATCH requests of any sizes, interleaved
+// with requests at stale offsets and requests whose checksum does not match, the stale and
+// corrupted requests SHALL be rejected without changing the upload's offset, HEAD SHALL
+// report the number of bytes accepted so far, and the finished file SHALL be identical to
+// the original.
+
+func TestProperty_TusUploadIntegrity(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 20
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("tus uploads survive stale and corrupted requests", prop.ForAll(
+		func(content []byte, sizes []int, faults []int) bool {
+			handler, fs, _ := setupTestStreamHandler()
+			router := createStreamTestRouter(handler)
+
+			create := tusRequest(http.MethodPost, "/api/v1/tus", "alice", nil)
+			create.Header.Set("Upload-Length", strconv.Itoa(len(content)))
+			create.Header.Set("Upload-Metadata", tusMetadata("media/incoming", "file.bin"))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, create)
+			if rec.Code != http.StatusCreated {
+				return false
+			}
+			location := rec.Header().Get("Location")
+
+			var offset int64
+			for step := 0; offset < int64(len(content)); step++ {
+				if len(content) > 0 {
+					// Other users cannot see the upload
+					if _, code := tusOffset(router, location, "bob"); code != http.StatusNotFound {
+						return false
+					}
+					if got, code := tusOffset(router, location, "alice"); code != http.StatusOK || got != offset {
+						return false
+					}
+				}
+
+				size := int64(sizes[step%len(sizes)])
+				if offset+size > int64(len(content)) {
+					size = int64(len(content)) - offset
+				}
+				body := content[offset : offset+size]
+				sum := sha1.Sum(body)
+
+				patch := func(at int64, checksum []byte) int {
+					req := tusRequest(http.MethodPatch, location, "alice", body)
+					req.Header.Set("Content-Type", tusContentType)
+					req.Header.Set("Upload-Offset", strconv.FormatInt(at, 10))
+					req.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(checksum))
+					rec := httptest.NewRecorder()
+					router.ServeHTTP(rec, req)
+					return rec.Code
+				}
+
+				switch faults[step%len(faults)] {
+				case 1:
+					if patch(offset+1, sum[:]) != http.StatusConflict {
+						return false
+					}
+				case 2:
+					if size > 0 {
+						bad := sha1.Sum(append([]byte{0}, body...))
+						if patch(offset, bad[:]) != statusChecksumMismatch {
+							return false
+						}
+					}
+				}
+
+				if patch(offset, sum[:]) != http.StatusNoContent {
+					return false
+				}
+				offset += size
+			}
+
+			// The upload is gone once finished, and the file is in place
+			if _, code := tusOffset(router, location, "alice"); code != http.StatusNotFound {
+				return false
+			}
+			data, err := fs.ReadFile("/data/media/incoming/file.bin")
+			return err == nil && bytes.Equal(data, content)
+		},
+		gen.SliceOf(gen.UInt8()),
+		gen.SliceOfN(4, gen.IntRange(1, 16)),
+		gen.SliceOfN(5, gen.IntRange(0, 2)),
+	))
+
+	properties.TestingRun(t)
+}
+
+func TestTusRejectsOtherVersions(t *testing.T) {
+	handler, _, _ := setupTestStreamHandler()
+	router := createStreamTestRouter(handler)
+
+	req := tusRequest(http.MethodPost, "/api/v1/tus", "alice", nil)
+	req.Header.Set("Tus-Resumable", "0.2.2")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("Tus-Version") != tusVersion {
+		t.Fatalf("expected 412 with Tus-Version, got %d %q", rec.Code, rec.Header().Get("Tus-Version"))
+	}
+}
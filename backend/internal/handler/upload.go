@@ -0,0 +1,786 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+	"github.com/homelab/filemanager/internal/service"
+	ws "github.com/homelab/filemanager/internal/websocket"
+	"github.com/spf13/afero"
+)
+
+// Errors returned when an upload session cannot be admitted
+var (
+	ErrUploadTooLarge      = errors.New("upload exceeds the maximum upload size")
+	ErrUploadQuotaExceeded = errors.New("upload exceeds the upload quota")
+	ErrInsufficientStorage = errors.New("not enough free space for the upload")
+	ErrTooManyUploads      = errors.New("too many unfinished uploads")
+)
+
+// uploadIDPattern matches the upload IDs clients may choose, which name the
+// session's temp and state files
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// uploadTempPath returns the temp file an upload to fsPath is written to
+func uploadTempPath(fsPath, id string) string {
+	return fileutil.UploadTempPath(fsPath, id)
+}
+
+// validUploadID reports whether an upload ID is safe to use in file names
+func validUploadID(id string) bool {
+	return uploadIDPattern.MatchString(id)
+}
+
+// UploadSession tracks the state of a chunked or tus upload. Data is written
+// straight into a preallocated temp file beside the destination, which is
+// renamed into place once complete. A tus upload has no chunks; its data is
+// appended at ReceivedBytes.
+type UploadSession struct {
+	ID             string       `json:"id"`
+	Owner          string       `json:"owner"`
+	Path           string       `json:"path"`
+	TotalChunks    int          `json:"totalChunks"`
+	ChunkSize      int64        `json:"chunkSize"`
+	TotalSize      int64        `json:"totalSize"`
+	ReceivedChunks map[int]bool `json:"-"`
+	ReceivedBytes  int64        `json:"receivedBytes"`
+	Tus            bool         `json:"tus"`
+	Metadata       string       `json:"-"` // tus Upload-Metadata, echoed on HEAD
+	BatchID        string       `json:"batchId,omitempty"`
+	TempPath       string       `json:"-"` // Filesystem path of the temp file
+	CreatedAt      time.Time    `json:"createdAt"`
+	LastActivity   time.Time    `json:"lastActivity"`
+	mu             sync.RWMutex
+	transfer       sync.Mutex // Held while a tus PATCH appends data
+
+	// SHA-256 of the chunks before index hashed, extended as the chunks
+	// following it arrive
+	hashMu sync.Mutex
+	hasher hash.Hash
+	hashed int
+
+	// Set once a request has started moving the upload into place
+	finishing bool
+
+	// Serializes writes of the session's state file; removed is set once
+	// the session is gone, so that late saves do not recreate it
+	saveMu  sync.Mutex
+	removed bool
+}
+
+// uploadRecord is the persisted state of an upload session, stored in the
+// state directory so that sessions survive restarts
+type uploadRecord struct {
+	ID            string    `json:"id"`
+	Owner         string    `json:"owner"`
+	Path          string    `json:"path"`
+	TempPath      string    `json:"tempPath"`
+	TotalChunks   int       `json:"totalChunks"`
+	ChunkSize     int64     `json:"chunkSize"`
+	TotalSize     int64     `json:"totalSize"`
+	Received      []byte    `json:"received"` // Bitmap of received chunks
+	ReceivedBytes int64     `json:"receivedBytes"`
+	Tus           bool      `json:"tus,omitempty"`
+	Metadata      string    `json:"metadata,omitempty"`
+	BatchID       string    `json:"batchId,omitempty"`
+	HashState     []byte    `json:"hashState,omitempty"` // Marshaled hasher after Hashed chunks
+	Hashed        int       `json:"hashed"`
+	CreatedAt     time.Time `json:"createdAt"`
+	LastActivity  time.Time `json:"lastActivity"`
+}
+
+// UploadLimits bounds the upload sessions a manager admits. Zero values are
+// unlimited.
+type UploadLimits struct {
+	MaxSize int64            // Largest file, in bytes
+	Quota   int64            // Every user's cap on the total size of their unfinished uploads
+	Quotas  map[string]int64 // Per-user caps overriding Quota
+}
+
+// quotaFor returns a user's cap on the total size of their unfinished uploads
+func (l UploadLimits) quotaFor(owner string) int64 {
+	if quota, ok := l.Quotas[owner]; ok {
+		return quota
+	}
+	return l.Quota
+}
+
+// SessionLimit caps the unfinished sessions of one owner on top of the
+// manager's limits. Zero values are unlimited.
+type SessionLimit struct {
+	MaxBytes int64 // Total size of the owner's unfinished sessions
+	MaxFiles int   // Number of the owner's unfinished sessions
+}
+
+// UploadManager manages active upload sessions
+type UploadManager struct {
+	sessions map[string]*UploadSession
+	batches  map[string]*UploadBatch
+	fs       filesystem.FS
+	stateDir string // Holds one record per session, and the batch records
+	limits   UploadLimits
+	hub      *ws.Hub           // Receives session changes (optional)
+	hashes   service.HashIndex // Records finished uploads for deduplication (optional)
+	mu       sync.RWMutex
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewUploadManager creates a new upload manager writing to the given
+// filesystem, which persists its sessions in stateDir and admits new ones
+// within limits
+func NewUploadManager(fs filesystem.FS, hub *ws.Hub, stateDir string, limits UploadLimits) *UploadManager {
+	return &UploadManager{
+		sessions: make(map[string]*UploadSession),
+		batches:  make(map[string]*UploadBatch),
+		fs:       fs,
+		stateDir: stateDir,
+		limits:   limits,
+		hub:      hub,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// StartCleanup starts the periodic cleanup of expired sessions
+func (m *UploadManager) StartCleanup(ctx context.Context) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(config.SessionCleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+				m.cleanupExpiredSessions()
+			}
+		}
+	}()
+}
+
+// StopCleanup stops the cleanup goroutine
+func (m *UploadManager) StopCleanup() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
+
+// cleanupExpiredSessions removes sessions that have been inactive for too long
+func (m *UploadManager) cleanupExpiredSessions() {
+	m.mu.Lock()
+	var expired []*UploadSession
+	now := time.Now()
+	for id, session := range m.sessions {
+		// Batch sessions expire with their batch
+		if session.BatchID == "" && now.Sub(session.GetLastActivity()) > config.SessionTimeout {
+			m.removeFiles(session)
+			delete(m.sessions, id)
+			expired = append(expired, session)
+		}
+	}
+	expired = append(expired, m.expireBatches(now)...)
+	m.mu.Unlock()
+
+	for _, session := range expired {
+		m.notify(session, model.UploadEventExpired, "")
+	}
+}
+
+// notify sends a change to an upload session to its owner's clients
+func (m *UploadManager) notify(session *UploadSession, event model.UploadEventType, errMsg string) {
+	if m.hub == nil {
+		return
+	}
+	update := session.Update(event)
+	update.Error = errMsg
+	m.hub.SendUploadUpdate(session.Owner, update)
+}
+
+// CreateSession creates a new chunked upload session owned by a user, whose
+// file will be moved to fsPath. If a session with the ID already exists it
+// is returned instead, and created is false.
+func (m *UploadManager) CreateSession(id, owner, path, fsPath string, totalChunks int, chunkSize, totalSize int64) (session *UploadSession, created bool, err error) {
+	return m.CreateLimitedSession(SessionLimit{}, id, owner, path, fsPath, totalChunks, chunkSize, totalSize)
+}
+
+// CreateLimitedSession is CreateSession for an owner whose unfinished
+// sessions, including the new one, must also stay within limit
+func (m *UploadManager) CreateLimitedSession(limit SessionLimit, id, owner, path, fsPath string, totalChunks int, chunkSize, totalSize int64) (session *UploadSession, created bool, err error) {
+	return m.addSession(&UploadSession{
+		ID:          id,
+		Owner:       owner,
+		Path:        path,
+		TotalChunks: totalChunks,
+		ChunkSize:   chunkSize,
+		TotalSize:   totalSize,
+	}, fsPath, limit)
+}
+
+// CreateTusSession creates a new tus upload session owned by a user, whose
+// file will be moved to fsPath
+func (m *UploadManager) CreateTusSession(id, owner, path, fsPath string, totalSize int64, metadata string) (*UploadSession, error) {
+	session, _, err := m.addSession(&UploadSession{
+		ID:        id,
+		Owner:     owner,
+		Path:      path,
+		TotalSize: totalSize,
+		Tus:       true,
+		Metadata:  metadata,
+	}, fsPath, SessionLimit{})
+	return session, err
+}
+
+// addSession admits and creates a new session whose file will be moved to
+// fsPath, unless one with the same ID already exists
+func (m *UploadManager) addSession(session *UploadSession, fsPath string, limit SessionLimit) (*UploadSession, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.sessions[session.ID]; ok {
+		return existing, false, nil
+	}
+	if err := m.admit(session.Owner, filepath.Dir(fsPath), session.TotalSize, session.TotalSize); err != nil {
+		return nil, false, err
+	}
+	if err := m.checkLimit(session.Owner, limit, session.TotalSize); err != nil {
+		return nil, false, err
+	}
+	if err := m.create(session, fsPath); err != nil {
+		return nil, false, err
+	}
+	return session, true, nil
+}
+
+// create persists a new session, then creates and preallocates its temp file
+// beside its destination and registers the session. Recording the session
+// first means a temp file is never left behind without a record pointing at
+// it. The caller must hold mu.
+func (m *UploadManager) create(session *UploadSession, fsPath string) error {
+	if err := m.fs.MkdirAll(filepath.Dir(fsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+	session.TempPath = uploadTempPath(fsPath, session.ID)
+	session.ReceivedChunks = make(map[int]bool)
+	session.hasher = sha256.New()
+	session.CreatedAt = time.Now()
+	session.LastActivity = session.CreatedAt
+
+	if err := m.save(session); err != nil {
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
+	f, err := m.fs.OpenFile(session.TempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		_ = m.fs.Remove(m.recordPath(session.ID))
+		return fmt.Errorf("failed to create upload file: %w", err)
+	}
+	err = preallocate(m.fs, f, session.TotalSize)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		m.removeFiles(session)
+		return fmt.Errorf("failed to allocate upload file: %w", err)
+	}
+
+	m.sessions[session.ID] = session
+	return nil
+}
+
+// admit checks new sessions of an owner, size bytes in total and none larger
+// than largest, against the maximum upload size, the owner's quota and the
+// free space in dir. The caller must hold mu.
+func (m *UploadManager) admit(owner, dir string, size, largest int64) error {
+	if m.limits.MaxSize > 0 && largest > m.limits.MaxSize {
+		return ErrUploadTooLarge
+	}
+
+	if quota := m.limits.quotaFor(owner); quota > 0 {
+		reserved := size
+		for _, other := range m.sessions {
+			if other.Owner == owner {
+				reserved += other.TotalSize
+			}
+		}
+		if reserved > quota {
+			return ErrUploadQuotaExceeded
+		}
+	}
+
+	// Space taken by preallocated uploads is already accounted for
+	if reporter, ok := m.fs.(filesystem.SpaceReporter); ok {
+		free, err := reporter.FreeSpace(dir)
+		if err == nil && free < size {
+			return ErrInsufficientStorage
+		}
+	}
+	return nil
+}
+
+// checkLimit checks a new session of an owner, size bytes large, together
+// with the owner's unfinished sessions against limit. The caller must hold mu.
+func (m *UploadManager) checkLimit(owner string, limit SessionLimit, size int64) error {
+	if limit.MaxBytes <= 0 && limit.MaxFiles <= 0 {
+		return nil
+	}
+	reserved, files := size, 1
+	for _, other := range m.sessions {
+		if other.Owner == owner {
+			reserved += other.TotalSize
+			files++
+		}
+	}
+	if limit.MaxBytes > 0 && reserved > limit.MaxBytes {
+		return ErrUploadQuotaExceeded
+	}
+	if limit.MaxFiles > 0 && files > limit.MaxFiles {
+		return ErrTooManyUploads
+	}
+	return nil
+}
+
+// preallocate extends a new file to its final size, reserving the disk space
+// where the filesystem supports it
+func preallocate(fs filesystem.FS, f afero.File, size int64) error {
+	if p, ok := fs.(filesystem.Preallocator); ok {
+		return p.Preallocate(f, size)
+	}
+	return f.Truncate(size)
+}
+
+// GetSession retrieves an upload session by ID
+func (m *UploadManager) GetSession(id string) (*UploadSession, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	return session, ok
+}
+
+// ListSessions returns the sessions owned by a user, oldest first
+func (m *UploadManager) ListSessions(owner string) []*UploadSession {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]*UploadSession, 0)
+	for _, session := range m.sessions {
+		if session.Owner == owner {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// DeleteSession removes an upload session and its temp file, if it has not
+// been moved into place
+func (m *UploadManager) DeleteSession(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropSession(id)
+}
+
+// dropSession removes an upload session and its files, returning it if it
+// existed. The caller must hold mu.
+func (m *UploadManager) dropSession(id string) *UploadSession {
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil
+	}
+	m.removeFiles(session)
+	delete(m.sessions, id)
+	return session
+}
+
+// recordPath returns the path of a session's state file
+func (m *UploadManager) recordPath(id string) string {
+	return filepath.Join(m.stateDir, id+".json")
+}
+
+// save writes the session's current state to its state file, replacing the
+// previous one atomically
+func (m *UploadManager) save(session *UploadSession) error {
+	session.saveMu.Lock()
+	defer session.saveMu.Unlock()
+	if session.removed {
+		return nil
+	}
+
+	data, err := json.Marshal(session.record())
+	if err != nil {
+		return err
+	}
+	if err := m.fs.MkdirAll(m.stateDir, 0755); err != nil {
+		return err
+	}
+	path := m.recordPath(session.ID)
+	if err := m.fs.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return m.fs.Rename(path+".tmp", path)
+}
+
+// removeFiles removes the session's temp file, if it has not been moved into
+// place, and then its state file
+func (m *UploadManager) removeFiles(session *UploadSession) {
+	session.saveMu.Lock()
+	defer session.saveMu.Unlock()
+	session.removed = true
+	_ = m.fs.Remove(session.TempPath)
+	_ = m.fs.Remove(m.recordPath(session.ID))
+}
+
+// Restore rebuilds the sessions recorded in the state directory by an
+// earlier run and returns how many were restored. Records that have expired
+// are removed with their temp files, as are records whose temp file is gone
+// or has the wrong size, and state files left by interrupted saves. Batches
+// are restored after their sessions.
+func (m *UploadManager) Restore() (int, error) {
+	entries, err := m.fs.ReadDir(m.stateDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload sessions: %w", err)
+	}
+
+	m.mu.Lock()
+	restored := 0
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() == batchesDirName {
+			continue
+		}
+		path := filepath.Join(m.stateDir, entry.Name())
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok || !validUploadID(id) {
+			_ = m.fs.Remove(path)
+			continue
+		}
+		if _, ok := m.sessions[id]; ok {
+			continue
+		}
+
+		session, err := m.load(path)
+		if err != nil || session.ID != id {
+			_ = m.fs.Remove(path)
+			continue
+		}
+		info, err := m.fs.Stat(session.TempPath)
+		if err != nil || info.Size() != session.TotalSize ||
+			time.Since(session.LastActivity) > config.SessionTimeout {
+			m.removeFiles(session)
+			continue
+		}
+
+		m.sessions[id] = session
+		restored++
+	}
+	m.mu.Unlock()
+
+	if err := m.restoreBatches(); err != nil {
+		return restored, err
+	}
+	return restored, nil
+}
+
+// load reads a session from its state file
+func (m *UploadManager) load(path string) (*UploadSession, error) {
+	data, err := m.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record uploadRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if record.TempPath == "" {
+		return nil, fmt.Errorf("upload session %s has no temp file", record.ID)
+	}
+
+	session := &UploadSession{
+		ID:             record.ID,
+		Owner:          record.Owner,
+		Path:           record.Path,
+		TotalChunks:    record.TotalChunks,
+		ChunkSize:      record.ChunkSize,
+		TotalSize:      record.TotalSize,
+		ReceivedChunks: make(map[int]bool),
+		ReceivedBytes:  record.ReceivedBytes,
+		Tus:            record.Tus,
+		Metadata:       record.Metadata,
+		BatchID:        record.BatchID,
+		TempPath:       record.TempPath,
+		CreatedAt:      record.CreatedAt,
+		LastActivity:   record.LastActivity,
+		hasher:         sha256.New(),
+	}
+	for i := 0; i < record.TotalChunks; i++ {
+		if i/8 < len(record.Received) && record.Received[i/8]&(1<<(i%8)) != 0 {
+			session.ReceivedChunks[i] = true
+		}
+	}
+
+	// Without a usable hash state, the chunks are hashed again from the file
+	if u, ok := session.hasher.(encoding.BinaryUnmarshaler); ok && record.HashState != nil &&
+		u.UnmarshalBinary(record.HashState) == nil {
+		session.hashed = record.Hashed
+	} else {
+		session.hasher.Reset()
+	}
+	return session, nil
+}
+
+// Finish moves a complete upload into place: it flushes the temp file to
+// disk and renames it to fsPath. A non-empty expected checksum is compared
+// with the SHA-256 of the chunks first. The session is removed either way.
+// Chunked uploads are recorded in the hash index, if there is one.
+func (m *UploadManager) Finish(session *UploadSession, fsPath, expectedChecksum string) error {
+	defer m.DeleteSession(session.ID)
+
+	checksum, err := m.seal(session, expectedChecksum)
+	if err != nil {
+		return err
+	}
+	return m.moveIntoPlace(session.TempPath, fsPath, checksum)
+}
+
+// moveIntoPlace renames a sealed upload's temp file to fsPath and records its
+// checksum, if known, in the hash index
+func (m *UploadManager) moveIntoPlace(tempPath, fsPath, checksum string) error {
+	if err := m.fs.Rename(tempPath, fsPath); err != nil {
+		return fmt.Errorf("failed to finalize uploaded file: %w", err)
+	}
+	if m.hashes != nil && checksum != "" {
+		m.hashes.Record(fsPath, checksum)
+	}
+	return nil
+}
+
+// seal verifies a complete upload's temp file against a non-empty expected
+// checksum and flushes it to disk. It returns the upload's SHA-256 when it
+// was computed.
+func (m *UploadManager) seal(session *UploadSession, expectedChecksum string) (string, error) {
+	f, err := m.fs.OpenFile(session.TempPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer f.Close()
+
+	// tus uploads are not hashed as they arrive
+	var actual string
+	if expectedChecksum != "" || (m.hashes != nil && !session.Tus) {
+		actual, err = session.checksum(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash upload: %w", err)
+		}
+	}
+	if expectedChecksum != "" && actual != strings.ToLower(expectedChecksum) {
+		return "", fmt.Errorf("checksum mismatch: expected %s, got %s", expectedChecksum, actual)
+	}
+
+	if err := f.Sync(); err != nil {
+		return "", fmt.Errorf("failed to flush upload file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to finalize upload file: %w", err)
+	}
+	return actual, nil
+}
+
+// record returns the session's state for its state file
+func (s *UploadSession) record() uploadRecord {
+	s.hashMu.Lock()
+	defer s.hashMu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record := uploadRecord{
+		ID:            s.ID,
+		Owner:         s.Owner,
+		Path:          s.Path,
+		TempPath:      s.TempPath,
+		TotalChunks:   s.TotalChunks,
+		ChunkSize:     s.ChunkSize,
+		TotalSize:     s.TotalSize,
+		Received:      make([]byte, (s.TotalChunks+7)/8),
+		ReceivedBytes: s.ReceivedBytes,
+		Tus:           s.Tus,
+		Metadata:      s.Metadata,
+		BatchID:       s.BatchID,
+		CreatedAt:     s.CreatedAt,
+		LastActivity:  s.LastActivity,
+	}
+	for i := range s.ReceivedChunks {
+		record.Received[i/8] |= 1 << (i % 8)
+	}
+	if m, ok := s.hasher.(encoding.BinaryMarshaler); ok {
+		if state, err := m.MarshalBinary(); err == nil {
+			record.HashState = state
+			record.Hashed = s.hashed
+		}
+	}
+	return record
+}
+
+// ChunkOffset returns the offset of a chunk in the file
+func (s *UploadSession) ChunkOffset(index int) int64 {
+	return int64(index) * s.ChunkSize
+}
+
+// ChunkLength returns the size of a chunk; only the last one may be short
+func (s *UploadSession) ChunkLength(index int) int64 {
+	return min(s.ChunkSize, s.TotalSize-s.ChunkOffset(index))
+}
+
+// MarkChunkReceived marks a chunk of the given size as received
+func (s *UploadSession) MarkChunkReceived(index int, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ReceivedChunks[index] = true
+	s.ReceivedBytes += size
+	s.LastActivity = time.Now()
+}
+
+// advanceHash extends the running hash over the received chunks that follow
+// the hashed ones, reading them back from the temp file. Chunks that arrive
+// in order are hashed right after they are written, while still cached.
+func (s *UploadSession) advanceHash(f io.ReaderAt) error {
+	s.hashMu.Lock()
+	defer s.hashMu.Unlock()
+
+	for s.IsChunkReceived(s.hashed) {
+		section := io.NewSectionReader(f, s.ChunkOffset(s.hashed), s.ChunkLength(s.hashed))
+		if _, err := io.Copy(s.hasher, section); err != nil {
+			return err
+		}
+		s.hashed++
+	}
+	return nil
+}
+
+// checksum returns the hex SHA-256 of a complete chunked upload
+func (s *UploadSession) checksum(f io.ReaderAt) (string, error) {
+	if err := s.advanceHash(f); err != nil {
+		return "", err
+	}
+	s.hashMu.Lock()
+	defer s.hashMu.Unlock()
+	if s.hashed != s.TotalChunks {
+		return "", fmt.Errorf("%d of %d chunks hashed", s.hashed, s.TotalChunks)
+	}
+	return hex.EncodeToString(s.hasher.Sum(nil)), nil
+}
+
+// claimFinish reports whether the upload is complete and the caller is the
+// first to move it into place
+func (s *UploadSession) claimFinish() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finishing || !s.isComplete() {
+		return false
+	}
+	s.finishing = true
+	return true
+}
+
+// GetOffset returns the number of bytes received
+func (s *UploadSession) GetOffset() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ReceivedBytes
+}
+
+// SetOffset records the number of bytes of a tus upload received
+func (s *UploadSession) SetOffset(offset int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ReceivedBytes = offset
+	s.LastActivity = time.Now()
+}
+
+// IsChunkReceived checks if a chunk has been received
+func (s *UploadSession) IsChunkReceived(index int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ReceivedChunks[index]
+}
+
+// IsComplete checks if all chunks, or all bytes of a tus upload, have been received
+func (s *UploadSession) IsComplete() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.isComplete()
+}
+
+// isComplete is IsComplete for callers holding mu
+func (s *UploadSession) isComplete() bool {
+	if s.Tus {
+		return s.ReceivedBytes == s.TotalSize
+	}
+	return len(s.ReceivedChunks) == s.TotalChunks
+}
+
+// GetReceivedCount returns the number of received chunks
+func (s *UploadSession) GetReceivedCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.ReceivedChunks)
+}
+
+// GetLastActivity returns when the last chunk was received
+func (s *UploadSession) GetLastActivity() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LastActivity
+}
+
+// Update describes the session's current state as an upload update
+func (s *UploadSession) Update(event model.UploadEventType) model.UploadUpdate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return model.UploadUpdate{
+		UploadID:       s.ID,
+		Event:          event,
+		Path:           s.Path,
+		ReceivedChunks: len(s.ReceivedChunks),
+		TotalChunks:    s.TotalChunks,
+		ReceivedBytes:  s.ReceivedBytes,
+		TotalSize:      s.TotalSize,
+		BatchID:        s.BatchID,
+	}
+}
+
+// GetMissingChunks returns a list of missing chunk indices
+func (s *UploadSession) GetMissingChunks() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	missing := make([]int, 0)
+	for i := 0; i < s.TotalChunks; i++ {
+		if !s.ReceivedChunks[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,591 @@
+// Package handler provides HTTP handlers for the file manager API.
+// This file contains property-based tests for upload sessions.
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homelab/filemanager/internal/middleware"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+	ws "github.com/homelab/filemanager/internal/websocket"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// asUser returns a request made by the given user
+func asUser(r *http.Request, username string) *http.Request {
+	claims := &service.Claims{Username: username}
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserClaimsKey, claims))
+}
+
+// uploadChunk sends one 1-byte chunk of an upload and returns the status code
+func uploadChunk(router http.Handler, username, uploadID string, index, total int, checksum string) int {
+	req := httptest.NewRequest("POST", "/api/v1/upload/media/"+uploadID+".bin", bytes.NewReader([]byte{'x'}))
+	req.Header.Set("X-Upload-ID", uploadID)
+	req.Header.Set("X-Chunk-Index", strconv.Itoa(index))
+	req.Header.Set("X-Total-Chunks", strconv.Itoa(total))
+	req.Header.Set("X-Chunk-Size", "1")
+	req.Header.Set("X-Total-Size", strconv.Itoa(total))
+	if checksum != "" {
+		req.Header.Set("X-Checksum", checksum)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, asUser(req, username))
+	return rec.Code
+}
+
+// listUploads returns the upload sessions listed for a user
+func listUploads(router http.Handler, username string) []UploadSessionResponse {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, asUser(httptest.NewRequest("GET", "/api/v1/uploads", nil), username))
+	var resp UploadListResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return resp.Uploads
+}
+
+// uploadUpdates drains a hub client and returns the upload updates it received
+func uploadUpdates(hub *ws.Hub, client *ws.Client) []model.UploadUpdate {
+	var buf bytes.Buffer
+	hub.Unregister(client)
+	client.WriteEvents(context.Background(), &buf, func() {})
+
+	var updates []model.UploadUpdate
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var msg struct {
+			Type    ws.MessageType     `json:"type"`
+			Payload model.UploadUpdate `json:"payload"`
+		}
+		if json.Unmarshal([]byte(data), &msg) == nil && msg.Type == ws.MessageTypeUpload {
+			updates = append(updates, msg.Payload)
+		}
+	}
+	return updates
+}
+
+// **Feature: homelab-file-manager, Property 31: Upload Session Events**
+//
+// Property: For any set of chunked uploads by several users, every client of the uploader
+// SHALL receive the session's created event, one progress event per new chunk with the
+// received count, and a final assembled or checksum_failed event, and no other user's
+// client SHALL receive any of them. While an upload is in flight, it SHALL be listed for
+// its owner only, with its received and missing chunk counts.
+
+func TestProperty_UploadSessionEvents(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 50
+	parameters.MaxSize = 6
+
+	properties := gopter.NewProperties(parameters)
+
+	users := []string{"alice", "bob"}
+
+	properties.Property("upload events reach only the uploader's clients", prop.ForAll(
+		func(owners []int, chunks []int, corrupt []bool) bool {
+			fs := filesystem.NewMemMapFS()
+			fs.MkdirAll("/data/media", 0755)
+			fileSvc := service.NewFileService(fs, service.FileServiceConfig{
+				MountPoints: []model.MountPoint{{Name: "media", Path: "/data/media"}},
+			})
+
+			hub := ws.NewHub()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go hub.Run(ctx)
+
+			clients := make(map[string]*ws.Client)
+			for _, user := range users {
+				clients[user] = ws.NewStreamClient(hub, user, false)
+				hub.Register(clients[user])
+			}
+			for hub.ClientCount() < len(users) {
+				time.Sleep(time.Millisecond)
+			}
+
+			handler := NewStreamHandler(fileSvc, hub, StreamHandlerConfig{ChunkSizeMB: 1})
+			router := createStreamTestRouter(handler)
+
+			type upload struct {
+				id, owner string
+				total     int
+				corrupt   bool
+			}
+			uploads := make([]upload, len(owners))
+			for i, n := range owners {
+				uploads[i] = upload{
+					id:      fmt.Sprintf("upload-%d", i),
+					owner:   users[n],
+					total:   chunks[i%len(chunks)],
+					corrupt: corrupt[i%len(corrupt)],
+				}
+			}
+			expected := make(map[string][]model.UploadUpdate)
+
+			// Send all but the last chunk of every upload
+			for _, u := range uploads {
+				for c := 0; c < u.total-1; c++ {
+					if uploadChunk(router, u.owner, u.id, c, u.total, "") != http.StatusOK {
+						return false
+					}
+					if c == 0 {
+						expected[u.owner] = append(expected[u.owner], model.UploadUpdate{
+							UploadID: u.id, Event: model.UploadEventCreated, TotalChunks: u.total,
+						})
+					}
+					expected[u.owner] = append(expected[u.owner], model.UploadUpdate{
+						UploadID: u.id, Event: model.UploadEventProgress, ReceivedChunks: c + 1, TotalChunks: u.total,
+					})
+				}
+			}
+
+			// In-flight uploads are listed for their owners only
+			for _, user := range users {
+				listed := make(map[string]UploadSessionResponse)
+				for _, s := range listUploads(router, user) {
+					listed[s.UploadID] = s
+				}
+				want := 0
+				for _, u := range uploads {
+					if u.owner != user || u.total < 2 {
+						continue
+					}
+					want++
+					s, ok := listed[u.id]
+					if !ok || s.ReceivedChunks != u.total-1 || s.MissingCount != 1 {
+						return false
+					}
+				}
+				if len(listed) != want {
+					return false
+				}
+			}
+
+			// Finish every upload
+			for _, u := range uploads {
+				checksum := ""
+				if u.corrupt {
+					checksum = strings.Repeat("0", 64)
+				}
+				status := uploadChunk(router, u.owner, u.id, u.total-1, u.total, checksum)
+				if u.total == 1 {
+					expected[u.owner] = append(expected[u.owner], model.UploadUpdate{
+						UploadID: u.id, Event: model.UploadEventCreated, TotalChunks: u.total,
+					})
+				}
+				expected[u.owner] = append(expected[u.owner], model.UploadUpdate{
+					UploadID: u.id, Event: model.UploadEventProgress, ReceivedChunks: u.total, TotalChunks: u.total,
+				})
+				final := model.UploadEventAssembled
+				if u.corrupt {
+					final = model.UploadEventChecksumFailed
+					if status != http.StatusUnprocessableEntity {
+						return false
+					}
+				} else if status != http.StatusCreated {
+					return false
+				}
+				expected[u.owner] = append(expected[u.owner], model.UploadUpdate{
+					UploadID: u.id, Event: final, ReceivedChunks: u.total, TotalChunks: u.total,
+				})
+			}
+
+			for _, user := range users {
+				got := uploadUpdates(hub, clients[user])
+				if len(got) != len(expected[user]) {
+					return false
+				}
+				for i, want := range expected[user] {
+					if got[i].UploadID != want.UploadID || got[i].Event != want.Event ||
+						got[i].ReceivedChunks != want.ReceivedChunks || got[i].TotalChunks != want.TotalChunks {
+						return false
+					}
+				}
+			}
+			return len(listUploads(router, "alice")) == 0 && len(listUploads(router, "bob")) == 0
+		},
+		gen.SliceOf(gen.IntRange(0, len(users)-1)),
+		gen.SliceOfN(3, gen.IntRange(1, 4)),
+		gen.SliceOfN(3, gen.Bool()),
+	))
+
+	properties.TestingRun(t)
+}
+
+// **Feature: homelab-file-manager, Property 33: Out-of-Order Chunk Assembly**
+//
+// Property: For any file split into chunks of any size and sent in any order, with some
+// chunks repeated and some sent with the wrong size, the wrong-sized chunks SHALL be
+// rejected, the upload's temp file SHALL have the file's full size from the first chunk
+// on, the finished file SHALL be identical to the original with its checksum verified,
+// and no temp file SHALL remain beside it.
+
+func TestProperty_OutOfOrderChunkAssembly(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 64
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("chunks sent in any order assemble the original file", prop.ForAll(
+		func(content []byte, chunkSize int, seed int64, faults []int) bool {
+			if len(content) == 0 {
+				return true
+			}
+
+			handler, fs, _ := setupTestStreamHandler()
+			router := createStreamTestRouter(handler)
+
+			totalChunks := (len(content) + chunkSize - 1) / chunkSize
+			sum := sha256.Sum256(content)
+			send := func(index int, data []byte) int {
+				req := httptest.NewRequest("POST", "/api/v1/upload/media/in/file.bin", bytes.NewReader(data))
+				req.Header.Set("X-Upload-ID", "upload")
+				req.Header.Set("X-Chunk-Index", strconv.Itoa(index))
+				req.Header.Set("X-Total-Chunks", strconv.Itoa(totalChunks))
+				req.Header.Set("X-Chunk-Size", strconv.Itoa(chunkSize))
+				req.Header.Set("X-Total-Size", strconv.Itoa(len(content)))
+				req.Header.Set("X-Checksum", "sha256:"+hex.EncodeToString(sum[:]))
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, asUser(req, "alice"))
+				return rec.Code
+			}
+
+			order := rand.New(rand.NewSource(seed)).Perm(totalChunks)
+			for step, index := range order {
+				chunk := content[index*chunkSize : min((index+1)*chunkSize, len(content))]
+				last := step == len(order)-1
+
+				switch faults[step%len(faults)] {
+				case 1:
+					if send(index, append(chunk[:len(chunk):len(chunk)], 0)) != http.StatusBadRequest {
+						return false
+					}
+				case 2:
+					if send(index, chunk[:len(chunk)-1]) != http.StatusBadRequest {
+						return false
+					}
+				}
+
+				want := http.StatusOK
+				if last {
+					want = http.StatusCreated
+				}
+				if send(index, chunk) != want {
+					return false
+				}
+
+				if !last {
+					// Repeated chunks are acknowledged without being written again
+					if faults[step%len(faults)] == 3 && send(index, chunk) != http.StatusOK {
+						return false
+					}
+					info, err := fs.Stat("/data/media/in/file.bin.uploading.upload")
+					if err != nil || info.Size() != int64(len(content)) {
+						return false
+					}
+				}
+			}
+
+			data, err := fs.ReadFile("/data/media/in/file.bin")
+			if err != nil || !bytes.Equal(data, content) {
+				return false
+			}
+			entries, err := fs.ReadDir("/data/media/in")
+			return err == nil && len(entries) == 1
+		},
+		gen.SliceOf(gen.UInt8()),
+		gen.IntRange(1, 16),
+		gen.Int64(),
+		gen.SliceOfN(5, gen.IntRange(0, 3)),
+	))
+
+	properties.TestingRun(t)
+}
+
+// **Feature: homelab-file-manager, Property 34: Upload Session Persistence**
+//
+// Property: For any chunked upload interrupted by a server restart after some but not
+// all of its chunks, the restarted server SHALL restore the session with the same owner and
+// missing chunks, accept the remaining chunks, and produce a file identical to the
+// original with its checksum verified, leaving no session state behind.
+
+func TestProperty_UploadSessionPersistence(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 64
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("uploads resume after a restart", prop.ForAll(
+		func(content []byte, chunkSize int, seed int64, cut int) bool {
+			totalChunks := (len(content) + chunkSize - 1) / chunkSize
+			if totalChunks < 2 {
+				return true // Nothing to interrupt
+			}
+
+			first, fs, fileSvc := setupTestStreamHandler()
+			router := createStreamTestRouter(first)
+
+			sum := sha256.Sum256(content)
+			send := func(router http.Handler, index int) int {
+				chunk := content[index*chunkSize : min((index+1)*chunkSize, len(content))]
+				req := httptest.NewRequest("POST", "/api/v1/upload/media/in/file.bin", bytes.NewReader(chunk))
+				req.Header.Set("X-Upload-ID", "upload")
+				req.Header.Set("X-Chunk-Index", strconv.Itoa(index))
+				req.Header.Set("X-Total-Chunks", strconv.Itoa(totalChunks))
+				req.Header.Set("X-Chunk-Size", strconv.Itoa(chunkSize))
+				req.Header.Set("X-Total-Size", strconv.Itoa(len(content)))
+				req.Header.Set("X-Checksum", hex.EncodeToString(sum[:]))
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, asUser(req, "alice"))
+				return rec.Code
+			}
+
+			order := rand.New(rand.NewSource(seed)).Perm(totalChunks)
+			cut = 1 + cut%(totalChunks-1)
+			for _, index := range order[:cut] {
+				if send(router, index) != http.StatusOK {
+					return false
+				}
+			}
+
+			// Restart with a new handler on the same filesystem
+			second := NewStreamHandler(fileSvc, nil, StreamHandlerConfig{ChunkSizeMB: 1})
+			router = createStreamTestRouter(second)
+			if restored, err := second.RestoreUploads(); err != nil || restored != 1 {
+				return false
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, asUser(httptest.NewRequest("GET", "/api/v1/upload/status/media/in/file.bin?uploadId=upload", nil), "alice"))
+			var status UploadStatusResponse
+			if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&status) != nil {
+				return false
+			}
+			missing := append([]int{}, order[cut:]...)
+			sort.Ints(missing)
+			if status.ReceivedChunks != cut || fmt.Sprint(status.MissingChunks) != fmt.Sprint(missing) {
+				return false
+			}
+			if len(listUploads(router, "alice")) != 1 || len(listUploads(router, "bob")) != 0 {
+				return false
+			}
+
+			for step, index := range order[cut:] {
+				want := http.StatusOK
+				if step == len(order)-cut-1 {
+					want = http.StatusCreated
+				}
+				if send(router, index) != want {
+					return false
+				}
+			}
+
+			data, err := fs.ReadFile("/data/media/in/file.bin")
+			if err != nil || !bytes.Equal(data, content) {
+				return false
+			}
+			records, err := fs.ReadDir("/data/uploads")
+			return err == nil && len(records) == 0
+		},
+		gen.SliceOf(gen.UInt8()),
+		gen.IntRange(1, 16),
+		gen.Int64(),
+		gen.IntRange(0, 64),
+	))
+
+	properties.TestingRun(t)
+}
+
+func TestRestoreUploadsSweepsOrphans(t *testing.T) {
+	handler, fs, fileSvc := setupTestStreamHandler()
+	router := createStreamTestRouter(handler)
+
+	// Three sessions with one of two chunks received
+	for _, id := range []string{"kept", "expired", "truncated"} {
+		if code := uploadChunk(router, "alice", id, 0, 2, ""); code != http.StatusOK {
+			t.Fatalf("chunk of %s: got %d", id, code)
+		}
+	}
+
+	// One expired while the server was down, one lost its temp data
+	data, _ := fs.ReadFile("/data/uploads/expired.json")
+	var record map[string]any
+	json.Unmarshal(data, &record)
+	record["lastActivity"] = time.Now().Add(-48 * time.Hour)
+	data, _ = json.Marshal(record)
+	fs.WriteFile("/data/uploads/expired.json", data, 0644)
+	fs.Remove("/data/media/truncated.bin.uploading.truncated")
+
+	// A save interrupted by the restart
+	fs.WriteFile("/data/uploads/kept.json.tmp", []byte("{"), 0644)
+
+	restarted := NewStreamHandler(fileSvc, nil, StreamHandlerConfig{ChunkSizeMB: 1})
+	restored, err := restarted.RestoreUploads()
+	if err != nil || restored != 1 {
+		t.Fatalf("expected 1 restored session, got %d (%v)", restored, err)
+	}
+	if _, ok := restarted.uploadManager.GetSession("kept"); !ok {
+		t.Fatal("expected the kept session to be restored")
+	}
+
+	records, _ := fs.ReadDir("/data/uploads")
+	if len(records) != 1 || records[0].Name() != "kept.json" {
+		t.Fatalf("expected only kept.json to remain, got %v", records)
+	}
+	if exists, _ := fs.Exists("/data/media/expired.bin.uploading.expired"); exists {
+		t.Fatal("expected the expired session's temp file to be removed")
+	}
+}
+
+// limitedFS reports a fixed amount of free space
+type limitedFS struct {
+	*filesystem.AferoFS
+	free int64
+}
+
+func (f limitedFS) FreeSpace(path string) (int64, error) {
+	return f.free, nil
+}
+
+// **Feature: homelab-file-manager, Property 35: Upload Admission and Chunk Integrity**
+//
+// Property: For any sequence of uploads by several users, a session SHALL be created only
+// if the file fits the maximum upload size, its owner's quota for unfinished uploads and
+// the free space at the destination, and is otherwise rejected with 413 or 507 leaving
+// nothing behind. A chunk that does not match its X-Chunk-Checksum SHALL be rejected with
+// 422 without being counted, and resending it SHALL complete the upload intact.
+
+func TestProperty_UploadAdmissionAndChunkIntegrity(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 12
+
+	properties := gopter.NewProperties(parameters)
+
+	users := []string{"alice", "bob"}
+
+	properties.Property("uploads are admitted within limits and chunks verified", prop.ForAll(
+		func(sizes []int, owners []int, corrupt []bool, maxSize, quota, free int) bool {
+			fs := limitedFS{filesystem.NewMemMapFS(), int64(free)}
+			fs.MkdirAll("/data/media", 0755)
+			fileSvc := service.NewFileService(fs, service.FileServiceConfig{
+				MountPoints: []model.MountPoint{{Name: "media", Path: "/data/media"}},
+			})
+			handler := NewStreamHandler(fileSvc, nil, StreamHandlerConfig{ChunkSizeMB: 1})
+			handler.uploadManager.limits = UploadLimits{
+				MaxSize: int64(maxSize),
+				Quota:   int64(quota),
+				Quotas:  map[string]int64{"bob": int64(quota) / 2},
+			}
+			router := createStreamTestRouter(handler)
+
+			send := func(owner, id string, content []byte, index int, corrupt bool) int {
+				chunkSize := (len(content) + 1) / 2
+				chunk := content[index*chunkSize : min((index+1)*chunkSize, len(content))]
+				sum := sha256.Sum256(chunk)
+				if corrupt {
+					sum[0]++
+				}
+				req := httptest.NewRequest("POST", "/api/v1/upload/media/"+id+".bin", bytes.NewReader(chunk))
+				req.Header.Set("X-Upload-ID", id)
+				req.Header.Set("X-Chunk-Index", strconv.Itoa(index))
+				req.Header.Set("X-Total-Chunks", "2")
+				req.Header.Set("X-Chunk-Size", strconv.Itoa(chunkSize))
+				req.Header.Set("X-Total-Size", strconv.Itoa(len(content)))
+				req.Header.Set("X-Chunk-Checksum", "sha256:"+hex.EncodeToString(sum[:]))
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, asUser(req, owner))
+				return rec.Code
+			}
+
+			type upload struct {
+				id, owner string
+				content   []byte
+			}
+			var admitted []upload
+			reserved := map[string]int{}
+			for i, size := range sizes {
+				owner := users[owners[i%len(owners)]]
+				id := fmt.Sprintf("upload-%d", i)
+				content := bytes.Repeat([]byte{byte(i)}, size)
+				content[0] = byte(size)
+
+				limit := quota
+				if owner == "bob" {
+					limit = quota / 2
+				}
+				want := http.StatusOK
+				switch {
+				case size > maxSize:
+					want = http.StatusRequestEntityTooLarge
+				case reserved[owner]+size > limit, size > free:
+					want = http.StatusInsufficientStorage
+				}
+
+				if corrupt[i%len(corrupt)] && want == http.StatusOK {
+					if send(owner, id, content, 0, true) != http.StatusUnprocessableEntity {
+						return false
+					}
+					if session, ok := handler.uploadManager.GetSession(id); !ok || session.GetReceivedCount() != 0 {
+						return false
+					}
+				}
+				if send(owner, id, content, 0, false) != want {
+					return false
+				}
+				if want != http.StatusOK {
+					if _, ok := handler.uploadManager.GetSession(id); ok {
+						return false
+					}
+					if exists, _ := fs.Exists("/data/media/" + id + ".bin.uploading." + id); exists {
+						return false
+					}
+					continue
+				}
+				reserved[owner] += size
+				admitted = append(admitted, upload{id, owner, content})
+			}
+
+			for _, u := range admitted {
+				if send(u.owner, u.id, u.content, 1, false) != http.StatusCreated {
+					return false
+				}
+				data, err := fs.ReadFile("/data/media/" + u.id + ".bin")
+				if err != nil || !bytes.Equal(data, u.content) {
+					return false
+				}
+			}
+			return true
+		},
+		gen.SliceOf(gen.IntRange(2, 40)),
+		gen.SliceOfN(3, gen.IntRange(0, len(users)-1)),
+		gen.SliceOfN(3, gen.Bool()),
+		gen.IntRange(2, 40),
+		gen.IntRange(2, 100),
+		gen.IntRange(2, 40),
+	))
+
+	properties.TestingRun(t)
+}
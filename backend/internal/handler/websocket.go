@@ -115,8 +115,12 @@ func (h *WebSocketHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create a new client and register with the hub
-	client := ws.NewClient(h.hub, conn, claims.UserID)
+	// Create a new client and register with the hub. A reconnecting client
+	// passes the resume token of the last event it saw as "since".
+	client := ws.NewClient(h.hub, conn, claims.Username, claims.Admin)
+	if epoch, since, ok := ws.ParseResumeToken(r.URL.Query().Get("since")); ok {
+		client.ResumeAfter(epoch, since)
+	}
 	h.hub.Register(client)
 
 	// Start the client's read and write pumps in separate goroutines
@@ -60,6 +60,40 @@ func JWTAuth(authService service.AuthService) func(next http.Handler) http.Handl
 	}
 }
 
+// BasicAuth creates a middleware that checks HTTP Basic credentials against
+// the configured users, for clients such as WebDAV drives that cannot send
+// tokens. Only failed attempts count towards the per-IP rate limit, since
+// these clients send credentials with every request.
+func BasicAuth(authService service.AuthService, realm string, rps float64) func(next http.Handler) http.Handler {
+	limiter := NewRateLimiter(rps)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if ok {
+				ip := getClientIP(r)
+				// Refuse before checking, so guesses past the limit reveal nothing
+				if limiter.Blocked(ip) {
+					w.Header().Set("Retry-After", "1")
+					writeAuthError(w, "Too many failed attempts", http.StatusTooManyRequests)
+					return
+				}
+
+				claims, err := authService.Authenticate(r.Context(), username, password)
+				if err == nil {
+					ctx := context.WithValue(r.Context(), UserClaimsKey, claims)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+				limiter.Allow(ip)
+			}
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+			writeAuthError(w, "Invalid credentials", http.StatusUnauthorized)
+		})
+	}
+}
+
 // GetUserClaims retrieves user claims from the request context
 func GetUserClaims(ctx context.Context) (*service.Claims, bool) {
 	claims, ok := ctx.Value(UserClaimsKey).(*service.Claims)
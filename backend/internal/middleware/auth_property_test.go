@@ -34,6 +34,14 @@ func (s *testAuthService) Login(ctx context.Context, username, password string)
 	return nil, nil
 }
 
+func (s *testAuthService) Authenticate(ctx context.Context, username, password string) (*service.Claims, error) {
+	return nil, service.ErrInvalidCredentials
+}
+
+func (s *testAuthService) AuthenticateKey(ctx context.Context, username string, key []byte) (*service.Claims, error) {
+	return nil, service.ErrInvalidCredentials
+}
+
 func (s *testAuthService) Refresh(ctx context.Context, refreshToken string) (*service.TokenPair, error) {
 	return nil, nil
 }
@@ -42,6 +50,10 @@ func (s *testAuthService) Logout(ctx context.Context, refreshToken string) error
 	return nil
 }
 
+func (s *testAuthService) IsAdmin(username string) bool {
+	return false
+}
+
 func (s *testAuthService) ValidateToken(tokenString string) (*service.Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &service.Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
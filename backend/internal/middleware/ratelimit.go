@@ -66,6 +66,12 @@ func (rl *RateLimiter) Allow(ip string) bool {
 	return rl.getLimiter(ip).Allow()
 }
 
+// Blocked reports whether the given IP has used up its requests, without
+// using one. Callers that only count failures check it before each attempt.
+func (rl *RateLimiter) Blocked(ip string) bool {
+	return rl.getLimiter(ip).Tokens() < 1
+}
+
 // RateLimit returns a middleware that limits requests per IP address.
 // Requests that exceed the rate limit receive a 429 Too Many Requests response.
 func RateLimit(rps float64) func(http.Handler) http.Handler {
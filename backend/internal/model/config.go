@@ -1,13 +1,48 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
 
 // MountPoint represents a configured filesystem location accessible through the file manager
 type MountPoint struct {
-	Name         string `json:"name" mapstructure:"name"`
-	Path         string `json:"path" mapstructure:"path"`
-	ReadOnly     bool   `json:"readOnly" mapstructure:"read_only"`
-	AutoDiscover bool   `json:"autoDiscover" mapstructure:"auto_discover"`
+	Name         string            `json:"name" mapstructure:"name"`
+	Path         string            `json:"path" mapstructure:"path"`
+	ReadOnly     bool              `json:"readOnly" mapstructure:"read_only"`
+	AutoDiscover bool              `json:"autoDiscover" mapstructure:"auto_discover"`
+	Type         MountType         `json:"type,omitempty" mapstructure:"type"` // Storage backend; empty = local
+	Options      map[string]string `json:"-" mapstructure:"options"`           // Backend settings such as host and credentials
+}
+
+// IsRemote reports whether the mount point is served by a remote backend
+func (m MountPoint) IsRemote() bool {
+	return m.Type != "" && m.Type != MountTypeLocal
+}
+
+// MountType is the storage backend of a mount point
+type MountType string
+
+const (
+	MountTypeLocal  MountType = "local"  // A folder on the server
+	MountTypeSFTP   MountType = "sftp"   // A folder on an SFTP server
+	MountTypeS3     MountType = "s3"     // An S3 or MinIO bucket
+	MountTypeWebDAV MountType = "webdav" // A folder on a WebDAV server
+)
+
+// requiredMountOptions lists the options each remote backend needs
+var requiredMountOptions = map[MountType][]string{
+	MountTypeSFTP:   {"host", "user", "host_key"},
+	MountTypeS3:     {"bucket", "access_key", "secret_key"},
+	MountTypeWebDAV: {"url"},
+}
+
+// S3Key is an access key for the S3 gateway, signing requests as a user
+type S3Key struct {
+	User      string `mapstructure:"user"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
 }
 
 // ServerConfig contains all server configuration options
@@ -19,10 +54,32 @@ type ServerConfig struct {
 	MaxUploadMB int          `mapstructure:"max_upload_mb"`
 	ChunkSizeMB int          `mapstructure:"chunk_size_mb"`
 
+	// Upload quotas: caps on the total size of a user's unfinished uploads
+	UploadQuotaMB int            `mapstructure:"upload_quota_mb"` // Every user's cap; 0 = unlimited
+	UploadQuotas  map[string]int `mapstructure:"upload_quotas"`   // username -> cap in MB, overriding upload_quota_mb
+
+	// Fetch jobs: downloads of HTTP(S) URLs by the server
+	FetchMaxMB      int      `mapstructure:"fetch_max_mb"`      // Largest download in MB; 0 = max_upload_mb
+	FetchAllowHosts []string `mapstructure:"fetch_allow_hosts"` // Hosts downloads may come from; empty = any public host
+	FetchDenyHosts  []string `mapstructure:"fetch_deny_hosts"`  // Hosts downloads never come from
+
+	// WebDAV drive at /dav for the configured users
+	WebDAV bool `mapstructure:"webdav"`
+
+	// SFTP server for the configured users
+	SFTPPort       int                 `mapstructure:"sftp_port"`       // 0 = disabled
+	SFTPHostKey    string              `mapstructure:"sftp_host_key"`   // Private key file; empty = generated in the data directory
+	AuthorizedKeys map[string][]string `mapstructure:"authorized_keys"` // username -> authorized_keys lines for SFTP key logins
+
+	// S3-compatible gateway serving each mount point as a bucket
+	S3Port int     `mapstructure:"s3_port"` // 0 = disabled
+	S3Keys []S3Key `mapstructure:"s3_keys"` // Access keys of the configured users
+
 	// Security settings
 	Users          map[string]string `mapstructure:"users"`           // username -> password
+	Admins         []string          `mapstructure:"admins"`          // Usernames with admin rights; empty = only a sole user
 	AllowedOrigins []string          `mapstructure:"allowed_origins"` // WebSocket/CORS allowed origins
-	RateLimitRPS   float64           `mapstructure:"rate_limit_rps"`  // Auth endpoint rate limit (requests per second)
+	RateLimitRPS   float64           `mapstructure:"rate_limit_rps"`  // Auth, share link and failed WebDAV/SFTP/S3 login rate limit (requests per second)
 }
 
 // DefaultServerConfig returns sensible defaults for server configuration
@@ -58,12 +115,57 @@ func (c *ServerConfig) Validate() error {
 		if mp.Path == "" {
 			return fmt.Errorf("mount_point[%d].path is required", i)
 		}
+		if !mp.IsRemote() {
+			continue
+		}
+		required, ok := requiredMountOptions[mp.Type]
+		if !ok {
+			return fmt.Errorf("mount_point[%d].type must be local, sftp, s3 or webdav", i)
+		}
+		for _, option := range required {
+			if mp.Options[option] == "" {
+				return fmt.Errorf("mount_point[%d].options.%s is required for %s mounts", i, option, mp.Type)
+			}
+		}
+		if mp.Type == MountTypeSFTP && mp.Options["password"] == "" && mp.Options["key_file"] == "" {
+			return fmt.Errorf("mount_point[%d] needs options.password or options.key_file", i)
+		}
+		if mp.AutoDiscover {
+			return fmt.Errorf("mount_point[%d].auto_discover is only supported for local mounts", i)
+		}
 	}
 
 	if c.Port < 1 || c.Port > 65535 {
 		return fmt.Errorf("port must be between 1 and 65535")
 	}
 
+	if c.SFTPPort < 0 || c.SFTPPort > 65535 {
+		return fmt.Errorf("sftp_port must be between 0 and 65535")
+	}
+
+	if c.SFTPPort != 0 && c.SFTPPort == c.Port {
+		return fmt.Errorf("sftp_port must differ from port")
+	}
+
+	if c.S3Port < 0 || c.S3Port > 65535 {
+		return fmt.Errorf("s3_port must be between 0 and 65535")
+	}
+
+	if c.S3Port != 0 && (c.S3Port == c.Port || c.S3Port == c.SFTPPort) {
+		return fmt.Errorf("s3_port must differ from port and sftp_port")
+	}
+
+	accessKeys := make(map[string]bool, len(c.S3Keys))
+	for i, key := range c.S3Keys {
+		if key.User == "" || key.AccessKey == "" || key.SecretKey == "" {
+			return fmt.Errorf("s3_keys[%d] needs user, access_key and secret_key", i)
+		}
+		if accessKeys[key.AccessKey] {
+			return fmt.Errorf("s3_keys[%d].access_key is used twice", i)
+		}
+		accessKeys[key.AccessKey] = true
+	}
+
 	if c.MaxUploadMB < 1 {
 		return fmt.Errorf("max_upload_mb must be at least 1")
 	}
@@ -72,6 +174,28 @@ func (c *ServerConfig) Validate() error {
 		return fmt.Errorf("chunk_size_mb must be at least 1")
 	}
 
+	if c.UploadQuotaMB < 0 {
+		return fmt.Errorf("upload_quota_mb must not be negative")
+	}
+
+	for user, quota := range c.UploadQuotas {
+		if quota < 0 {
+			return fmt.Errorf("upload_quotas.%s must not be negative", user)
+		}
+	}
+
+	if c.FetchMaxMB < 0 {
+		return fmt.Errorf("fetch_max_mb must not be negative")
+	}
+
+	for _, host := range append(append([]string(nil), c.FetchAllowHosts...), c.FetchDenyHosts...) {
+		if strings.Contains(host, "/") {
+			if _, err := netip.ParsePrefix(host); err != nil {
+				return fmt.Errorf("invalid fetch host range %q", host)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -9,19 +9,24 @@ type ErrorResponse struct {
 
 // Error codes for API responses
 const (
-	ErrCodeNotFound         = "NOT_FOUND"
-	ErrCodeAccessDenied     = "ACCESS_DENIED"
-	ErrCodeReadOnly         = "READ_ONLY"
-	ErrCodeInvalidPath      = "INVALID_PATH"
-	ErrCodeUnauthorized     = "UNAUTHORIZED"
-	ErrCodeTokenInvalid     = "TOKEN_INVALID"
-	ErrCodePermissionDenied = "PERMISSION_DENIED"
-	ErrCodeConflict         = "CONFLICT"
-	ErrCodeValidationError  = "VALIDATION_ERROR"
-	ErrCodeJobNotFound      = "JOB_NOT_FOUND"
-	ErrCodeChunkMissing     = "CHUNK_MISSING"
-	ErrCodeChecksumMismatch = "CHECKSUM_MISMATCH"
-	ErrCodeInternalError    = "INTERNAL_ERROR"
+	ErrCodeNotFound            = "NOT_FOUND"
+	ErrCodeAccessDenied        = "ACCESS_DENIED"
+	ErrCodeReadOnly            = "READ_ONLY"
+	ErrCodeInvalidPath         = "INVALID_PATH"
+	ErrCodeUnauthorized        = "UNAUTHORIZED"
+	ErrCodeTokenInvalid        = "TOKEN_INVALID"
+	ErrCodePermissionDenied    = "PERMISSION_DENIED"
+	ErrCodeConflict            = "CONFLICT"
+	ErrCodeValidationError     = "VALIDATION_ERROR"
+	ErrCodeJobNotFound         = "JOB_NOT_FOUND"
+	ErrCodeChunkMissing        = "CHUNK_MISSING"
+	ErrCodeChecksumMismatch    = "CHECKSUM_MISMATCH"
+	ErrCodeIOError             = "IO_ERROR"
+	ErrCodeInsufficientStorage = "INSUFFICIENT_STORAGE"
+	ErrCodeQuotaExceeded       = "QUOTA_EXCEEDED"
+	ErrCodePasswordRequired    = "PASSWORD_REQUIRED"
+	ErrCodeShareUnavailable    = "SHARE_UNAVAILABLE"
+	ErrCodeInternalError       = "INTERNAL_ERROR"
 )
 
 // NewErrorResponse creates a new error response
@@ -0,0 +1,9 @@
+package model
+
+// FetchOptions configures a fetch job, which downloads the http or https URL
+// in SourcePath to the file DestPath, or into the directory DestPath under the
+// last segment of the URL path
+type FetchOptions struct {
+	Checksum string `json:"checksum,omitempty"` // Expected SHA-256 of the download, hex with optional "sha256:" prefix
+	MaxBytes int64  `json:"maxBytes,omitempty"` // Largest download accepted, below the server's own limit
+}
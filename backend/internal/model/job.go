@@ -9,6 +9,17 @@ const (
 	JobTypeCopy   JobType = "copy"
 	JobTypeMove   JobType = "move"
 	JobTypeDelete JobType = "delete"
+	JobTypeSync   JobType = "sync"
+	JobTypeFetch  JobType = "fetch" // Download the URL in SourcePath to DestPath
+)
+
+// JobPriority represents the scheduling priority of a queued job
+type JobPriority string
+
+const (
+	JobPriorityLow    JobPriority = "low"
+	JobPriorityNormal JobPriority = "normal"
+	JobPriorityHigh   JobPriority = "high"
 )
 
 // JobState represents the current state of a job
@@ -20,38 +31,65 @@ const (
 	JobStateCompleted JobState = "completed"
 	JobStateFailed    JobState = "failed"
 	JobStateCancelled JobState = "cancelled"
+
+	// JobStateCompletedWithErrors is reached by continue-on-error jobs that
+	// finished but skipped one or more items
+	JobStateCompletedWithErrors JobState = "completed_with_errors"
 )
 
 // Job represents a background job for file operations
 type Job struct {
-	ID          string    `json:"id"`
-	Type        JobType   `json:"type"`
-	State       JobState  `json:"state"`
-	Progress    int       `json:"progress"` // 0-100
-	SourcePath  string    `json:"sourcePath"`
-	DestPath    string    `json:"destPath,omitempty"`
-	Error       string    `json:"error,omitempty"`
-	CreatedAt   time.Time `json:"createdAt"`
-	StartedAt   time.Time `json:"startedAt,omitempty"`
-	CompletedAt time.Time `json:"completedAt,omitempty"`
+	ID              string        `json:"id"`
+	Type            JobType       `json:"type"`
+	State           JobState      `json:"state"`
+	Progress        int           `json:"progress"` // 0-100
+	SourcePath      string        `json:"sourcePath"`
+	DestPath        string        `json:"destPath,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	ContinueOnError bool          `json:"continueOnError,omitempty"` // Record per-item failures instead of aborting
+	Verify          bool          `json:"verify,omitempty"`          // Hash-verify copied files before completing
+	Items           []string      `json:"items,omitempty"`           // Paths relative to SourcePath to restrict the job to
+	ErrorCount      int           `json:"errorCount,omitempty"`      // Number of items that failed
+	VerifiedCount   int           `json:"verifiedCount,omitempty"`   // Number of files whose copy was verified
+	RetryOf         string        `json:"retryOf,omitempty"`         // ID of the job this job retries
+	Sync            *SyncOptions  `json:"sync,omitempty"`            // Options for sync jobs
+	Fetch           *FetchOptions `json:"fetch,omitempty"`           // Options for fetch jobs
+	BytesDone       int64         `json:"bytesDone,omitempty"`       // Bytes downloaded so far by a fetch job
+	BytesTotal      int64         `json:"bytesTotal,omitempty"`      // Size of a fetch job's download, 0 while unknown
+	Owner           string        `json:"owner,omitempty"`           // Username of the user who created the job
+	Priority        JobPriority   `json:"priority"`
+	QueuePosition   int           `json:"queuePosition,omitempty"` // 1-based position while pending
+	CreatedAt       time.Time     `json:"createdAt"`
+	StartedAt       time.Time     `json:"startedAt,omitempty"`
+	CompletedAt     time.Time     `json:"completedAt,omitempty"`
 }
 
 // JobUpdate represents a progress update for a job sent via WebSocket
 type JobUpdate struct {
-	JobID    string   `json:"jobId"`
-	State    JobState `json:"state"`
-	Progress int      `json:"progress"`
-	Error    string   `json:"error,omitempty"`
+	JobID      string   `json:"jobId"`
+	State      JobState `json:"state"`
+	Progress   int      `json:"progress"`
+	Error      string   `json:"error,omitempty"`
+	ErrorCount int      `json:"errorCount,omitempty"`
+	BytesDone  int64    `json:"bytesDone,omitempty"`
+	BytesTotal int64    `json:"bytesTotal,omitempty"`
 }
 
 // JobParams contains parameters for creating a new job
 type JobParams struct {
-	Type       JobType `json:"type"`
-	SourcePath string  `json:"sourcePath"`
-	DestPath   string  `json:"destPath,omitempty"`
+	Type            JobType       `json:"type"`
+	SourcePath      string        `json:"sourcePath"`
+	DestPath        string        `json:"destPath,omitempty"`
+	ContinueOnError bool          `json:"continueOnError,omitempty"`
+	Verify          bool          `json:"verify,omitempty"`
+	Items           []string      `json:"items,omitempty"`
+	Sync            *SyncOptions  `json:"sync,omitempty"`
+	Fetch           *FetchOptions `json:"fetch,omitempty"`
+	Owner           string        `json:"owner,omitempty"`
+	Priority        JobPriority   `json:"priority,omitempty"` // Defaults to normal
 }
 
-// JobError represents detailed error information for a failed job
+// JobError represents detailed error information for a failed job item
 type JobError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
@@ -59,12 +97,45 @@ type JobError struct {
 	Cause   string `json:"cause,omitempty"`
 }
 
+// ChecksumSHA256 is the algorithm used for copy verification
+const ChecksumSHA256 = "sha256"
+
+// FileChecksum records the verified hash of a copied file
+type FileChecksum struct {
+	Path      string `json:"path"`
+	DestPath  string `json:"destPath"`
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+}
+
 // IsTerminal returns true if the job state is a terminal state
 func (s JobState) IsTerminal() bool {
-	return s == JobStateCompleted || s == JobStateFailed || s == JobStateCancelled
+	return s == JobStateCompleted || s == JobStateFailed || s == JobStateCancelled || s == JobStateCompletedWithErrors
 }
 
 // IsValid returns true if the job type is valid
 func (t JobType) IsValid() bool {
-	return t == JobTypeCopy || t == JobTypeMove || t == JobTypeDelete
+	return t == JobTypeCopy || t == JobTypeMove || t == JobTypeDelete || t == JobTypeSync || t == JobTypeFetch
+}
+
+// NeedsDestination returns true if jobs of this type require a destination path
+func (t JobType) NeedsDestination() bool {
+	return t == JobTypeCopy || t == JobTypeMove || t == JobTypeSync || t == JobTypeFetch
+}
+
+// IsValid returns true if the priority is valid (empty means normal)
+func (p JobPriority) IsValid() bool {
+	return p == "" || p == JobPriorityLow || p == JobPriorityNormal || p == JobPriorityHigh
+}
+
+// Rank orders priorities; jobs with a higher rank are dispatched first
+func (p JobPriority) Rank() int {
+	switch p {
+	case JobPriorityLow:
+		return 0
+	case JobPriorityHigh:
+		return 2
+	default:
+		return 1
+	}
 }
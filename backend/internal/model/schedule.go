@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// Schedule is a job template that is run on a recurring timetable
+type Schedule struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Owner      string        `json:"owner,omitempty"`      // User who created the schedule and owns its jobs
+	Cron       string        `json:"cron,omitempty"`       // Five-field cron expression
+	EveryHours int           `json:"everyHours,omitempty"` // Fixed interval, used instead of Cron
+	Job        JobParams     `json:"job"`                  // Template for the jobs the schedule creates
+	Enabled    bool          `json:"enabled"`
+	NextRun    time.Time     `json:"nextRun,omitempty"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	Runs       []ScheduleRun `json:"runs"` // Most recent runs, oldest first
+}
+
+// ScheduleParams contains parameters for creating or updating a schedule
+type ScheduleParams struct {
+	Name       string    `json:"name"`
+	Cron       string    `json:"cron,omitempty"`
+	EveryHours int       `json:"everyHours,omitempty"`
+	Job        JobParams `json:"job"`
+	Enabled    bool      `json:"enabled"`
+}
+
+// ScheduleRunOutcome represents the result of a scheduled run
+type ScheduleRunOutcome string
+
+const (
+	ScheduleRunRunning             ScheduleRunOutcome = "running"
+	ScheduleRunCompleted           ScheduleRunOutcome = "completed"
+	ScheduleRunCompletedWithErrors ScheduleRunOutcome = "completed_with_errors"
+	ScheduleRunFailed              ScheduleRunOutcome = "failed"
+	ScheduleRunCancelled           ScheduleRunOutcome = "cancelled"
+	ScheduleRunSkipped             ScheduleRunOutcome = "skipped" // The previous run was still in progress
+)
+
+// ScheduleRun records one firing of a schedule
+type ScheduleRun struct {
+	ScheduledAt time.Time          `json:"scheduledAt"`
+	JobID       string             `json:"jobId,omitempty"`
+	Outcome     ScheduleRunOutcome `json:"outcome"`
+	Error       string             `json:"error,omitempty"`
+	CompletedAt time.Time          `json:"completedAt,omitempty"`
+}
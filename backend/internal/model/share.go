@@ -0,0 +1,81 @@
+package model
+
+import "time"
+
+// Share is a public link to a file or folder that can be opened without an
+// account. A link with Drop set is an upload-only drop folder instead.
+type Share struct {
+	ID            string        `json:"id"`
+	Token         string        `json:"token"` // Secret part of the link URL
+	Path          string        `json:"path"`  // Virtual path of the shared file or folder
+	IsDir         bool          `json:"isDir"` // Folders can be browsed read-only
+	Owner         string        `json:"owner,omitempty"`
+	PasswordHash  string        `json:"passwordHash,omitempty"` // Empty when the link has no password
+	ExpiresAt     time.Time     `json:"expiresAt,omitempty"`    // Zero means the link never expires
+	MaxDownloads  int           `json:"maxDownloads,omitempty"` // 0 = unlimited
+	Downloads     int           `json:"downloads"`
+	Drop          *DropOptions  `json:"drop,omitempty"`
+	Uploads       int           `json:"uploads,omitempty"`       // Files received through a drop link
+	UploadedBytes int64         `json:"uploadedBytes,omitempty"` // Their total size
+	CreatedAt     time.Time     `json:"createdAt"`
+	Access        []ShareAccess `json:"access"` // Most recent accesses, oldest first
+}
+
+// ShareParams contains parameters for creating a share link
+type ShareParams struct {
+	Path         string       `json:"path"`
+	Password     string       `json:"password,omitempty"`
+	ExpiresAt    time.Time    `json:"expiresAt,omitempty"`
+	MaxDownloads int          `json:"maxDownloads,omitempty"`
+	Drop         *DropOptions `json:"drop,omitempty"`
+	Owner        string       `json:"-"`
+}
+
+// DropOptions makes a share link of a folder an upload-only drop folder:
+// guests can upload files into it but not list or download anything
+type DropOptions struct {
+	MaxFiles     int   `json:"maxFiles,omitempty"`     // 0 = unlimited
+	MaxFileBytes int64 `json:"maxFileBytes,omitempty"` // Largest accepted file; 0 = unlimited
+	MaxBytes     int64 `json:"maxBytes,omitempty"`     // Cap on all uploads together; 0 = unlimited
+}
+
+// ShareAction is what a visitor did with a share link
+type ShareAction string
+
+const (
+	ShareActionInfo     ShareAction = "info"
+	ShareActionList     ShareAction = "list"
+	ShareActionDownload ShareAction = "download"
+	ShareActionPreview  ShareAction = "preview"
+	ShareActionUpload   ShareAction = "upload"
+)
+
+// ShareAccess records one use of a share link
+type ShareAccess struct {
+	Time       time.Time   `json:"time"`
+	Action     ShareAction `json:"action"`
+	Path       string      `json:"path,omitempty"` // Relative to the shared folder
+	RemoteAddr string      `json:"remoteAddr,omitempty"`
+	Error      string      `json:"error,omitempty"` // Why access was refused
+}
+
+// ShareRequest is a visitor's attempt to use a share link
+type ShareRequest struct {
+	Token      string
+	Password   string
+	Path       string // Relative to the shared folder; empty for the shared item itself
+	Action     ShareAction
+	RemoteAddr string
+	Counted    bool  // Whether the request uses up one of the link's downloads
+	Resumed    bool  // Whether a counted request only reads past the start of the file
+	Size       int64 // Size of an upload
+}
+
+// ShareUploadEvent tells the owner of a drop link that a guest uploaded a file
+type ShareUploadEvent struct {
+	ShareID    string    `json:"shareId"`
+	Path       string    `json:"path"` // Virtual path the file was stored at
+	Size       int64     `json:"size"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Time       time.Time `json:"time"`
+}
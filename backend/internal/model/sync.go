@@ -0,0 +1,52 @@
+package model
+
+// SyncCompare selects how a sync job decides whether a file changed
+type SyncCompare string
+
+const (
+	// SyncCompareSizeMtime treats files with equal size and modification time as unchanged
+	SyncCompareSizeMtime SyncCompare = "sizeMtime"
+	// SyncCompareChecksum compares file contents by SHA-256
+	SyncCompareChecksum SyncCompare = "checksum"
+)
+
+// IsValid returns true if the compare mode is valid (empty means the default)
+func (c SyncCompare) IsValid() bool {
+	return c == "" || c == SyncCompareSizeMtime || c == SyncCompareChecksum
+}
+
+// SyncOptions configures a one-way sync from SourcePath to DestPath
+type SyncOptions struct {
+	Compare SyncCompare `json:"compare,omitempty"` // Defaults to sizeMtime
+	Delete  bool        `json:"delete,omitempty"`  // Delete destination entries missing from the source
+	Exclude []string    `json:"exclude,omitempty"` // Glob patterns matched against relative paths and names
+	DryRun  bool        `json:"dryRun,omitempty"`  // Plan the changes without touching anything
+}
+
+// SyncActionType represents a change made by a sync job
+type SyncActionType string
+
+const (
+	SyncActionMkdir  SyncActionType = "mkdir"  // Create a directory missing from the destination
+	SyncActionCopy   SyncActionType = "copy"   // Copy a file missing from the destination
+	SyncActionUpdate SyncActionType = "update" // Overwrite a changed file
+	SyncActionDelete SyncActionType = "delete" // Remove an extraneous or conflicting destination entry
+)
+
+// SyncAction is a single planned change, with Path relative to the sync roots
+type SyncAction struct {
+	Action SyncActionType `json:"action"`
+	Path   string         `json:"path"`
+	IsDir  bool           `json:"isDir,omitempty"`
+	Size   int64          `json:"size,omitempty"`
+}
+
+// SyncReport lists the changes a sync job planned (dry run) or applied
+type SyncReport struct {
+	DryRun      bool         `json:"dryRun"`
+	Actions     []SyncAction `json:"actions"`
+	CopyCount   int          `json:"copyCount"`
+	UpdateCount int          `json:"updateCount"`
+	DeleteCount int          `json:"deleteCount"`
+	Bytes       int64        `json:"bytes"` // Bytes to transfer
+}
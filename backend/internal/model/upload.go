@@ -0,0 +1,38 @@
+package model
+
+// UploadEventType represents a step in the life of a chunked upload session
+type UploadEventType string
+
+const (
+	UploadEventCreated        UploadEventType = "created"         // The first chunk opened the session
+	UploadEventProgress       UploadEventType = "progress"        // A chunk was received
+	UploadEventAssembled      UploadEventType = "assembled"       // All chunks were written to the destination
+	UploadEventChecksumFailed UploadEventType = "checksum_failed" // The assembled file did not match its checksum
+	UploadEventFailed         UploadEventType = "failed"          // Assembly failed for another reason
+	UploadEventExpired        UploadEventType = "expired"         // The session was inactive too long and was removed
+	UploadEventCancelled      UploadEventType = "cancelled"       // The client terminated the upload
+	UploadEventReady          UploadEventType = "ready"           // The file is complete and waits for the rest of its all-or-nothing batch
+)
+
+// UploadBatchState represents the state of a folder upload batch
+type UploadBatchState string
+
+const (
+	UploadBatchUploading  UploadBatchState = "uploading"  // Files are still being uploaded
+	UploadBatchCommitting UploadBatchState = "committing" // Every file is complete and being moved into place
+	UploadBatchComplete   UploadBatchState = "complete"   // Every file is in place
+	UploadBatchFailed     UploadBatchState = "failed"     // A file could not be finished and the rest were abandoned
+)
+
+// UploadUpdate represents a change to an upload session sent via WebSocket
+type UploadUpdate struct {
+	UploadID       string          `json:"uploadId"`
+	Event          UploadEventType `json:"event"`
+	Path           string          `json:"path"`
+	ReceivedChunks int             `json:"receivedChunks"`
+	TotalChunks    int             `json:"totalChunks"`
+	ReceivedBytes  int64           `json:"receivedBytes"`
+	TotalSize      int64           `json:"totalSize"`
+	BatchID        string          `json:"batchId,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
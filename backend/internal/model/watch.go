@@ -0,0 +1,25 @@
+package model
+
+// FileEventType represents a change to an entry of a watched directory
+type FileEventType string
+
+const (
+	FileEventCreated  FileEventType = "created"  // The entry appeared
+	FileEventModified FileEventType = "modified" // The entry's contents or attributes changed, or it was replaced
+	FileEventDeleted  FileEventType = "deleted"  // The entry disappeared
+	FileEventRenamed  FileEventType = "renamed"  // The entry OldName is now called Name
+)
+
+// FileEvent is a change to one entry of a watched directory
+type FileEvent struct {
+	Type    FileEventType `json:"type"`
+	Name    string        `json:"name"`
+	OldName string        `json:"oldName,omitempty"`
+	IsDir   bool          `json:"isDir,omitempty"`
+}
+
+// DirChanges is a batch of changes to the entries of a watched directory
+type DirChanges struct {
+	Path   string      `json:"path"`
+	Events []FileEvent `json:"events"`
+}
@@ -0,0 +1,95 @@
+// Package cron parses standard five-field cron expressions.
+// This file contains property-based tests for next run computation.
+package cron
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// **Feature: homelab-file-manager, Property 23: Cron Next Run**
+//
+// Property: For any cron expression and start time, Next SHALL return a later time
+// at which the expression fires, and the expression SHALL NOT fire in any minute
+// between the start time and that result.
+
+func TestProperty_CronNextRun(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 20
+
+	properties := gopter.NewProperties(parameters)
+
+	minuteGen := gen.OneGenOf(
+		gen.Const("*"),
+		gen.IntRange(0, 59).Map(func(v int) string { return fmt.Sprint(v) }),
+		gen.IntRange(1, 30).Map(func(v int) string { return fmt.Sprintf("*/%d", v) }),
+		gen.IntRange(0, 29).Map(func(v int) string { return fmt.Sprintf("%d-%d/7", v, v+30) }),
+	)
+	hourGen := gen.OneGenOf(
+		gen.Const("*"),
+		gen.IntRange(0, 23).Map(func(v int) string { return fmt.Sprint(v) }),
+		gen.IntRange(0, 11).Map(func(v int) string { return fmt.Sprintf("%d,%d", v, v+12) }),
+	)
+	domGen := gen.OneConstOf("*", "1", "15", "1-7", "31")
+	dowGen := gen.OneConstOf("*", "0", "7", "mon-fri", "sat,sun", "*/2")
+
+	properties.Property("next run fires and nothing is skipped", prop.ForAll(
+		func(minute, hour, dom, dow string, offsetMinutes int) bool {
+			expr := fmt.Sprintf("%s %s %s * %s", minute, hour, dom, dow)
+			sched, err := Parse(expr)
+			if err != nil {
+				t.Logf("parse %q: %v", expr, err)
+				return false
+			}
+
+			start := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC).Add(time.Duration(offsetMinutes) * time.Minute)
+			next := sched.Next(start)
+			if !next.After(start) || !sched.matches(next) || next.Second() != 0 {
+				return false
+			}
+
+			for m := start.Truncate(time.Minute).Add(time.Minute); m.Before(next); m = m.Add(time.Minute) {
+				if sched.matches(m) {
+					return false
+				}
+			}
+			return true
+		},
+		minuteGen,
+		hourGen,
+		domGen,
+		dowGen,
+		gen.IntRange(0, 60*24*365),
+	))
+
+	properties.TestingRun(t)
+}
+
+// TestParseRejectsInvalidExpressions verifies malformed expressions are rejected
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@sometimes",
+	}
+	for _, expr := range invalid {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
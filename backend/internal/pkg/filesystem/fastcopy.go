@@ -0,0 +1,72 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// fastCopyChunk is how much data is copied between progress reports and
+// cancellation checks on the fast copy paths
+const fastCopyChunk = 8 * 1024 * 1024
+
+// FastCopier is implemented by filesystems that can copy file contents
+// without streaming them through a userspace buffer
+type FastCopier interface {
+	// FastCopy copies the contents of src into the empty file dst, reporting
+	// the bytes copied so far to onProgress when it is set. It returns false
+	// without touching either file when no fast path applies, in which case
+	// the caller should copy the bytes itself.
+	FastCopy(ctx context.Context, dst, src afero.File, onProgress func(copied int64)) (bool, error)
+}
+
+// FastCopy copies file contents in the kernel when backed by the OS
+// filesystem. It tries a reflink (instant on btrfs and XFS), then a
+// hole-preserving copy for sparse files, then copy_file_range. It returns
+// false for other backends.
+func (a *AferoFS) FastCopy(ctx context.Context, dst, src afero.File, onProgress func(copied int64)) (bool, error) {
+	if !a.isOs() {
+		return false, nil
+	}
+	srcFile, ok := src.(*os.File)
+	if !ok {
+		return false, nil
+	}
+	dstFile, ok := dst.(*os.File)
+	if !ok {
+		return false, nil
+	}
+	return fastCopy(ctx, dstFile, srcFile, onProgress)
+}
+
+// copyRange copies n bytes from the current offset of src to the current
+// offset of dst. Between *os.File values io.CopyN uses copy_file_range
+// where the kernel supports it and falls back to splice or a plain copy.
+// onProgress receives base plus the bytes copied so far.
+func copyRange(ctx context.Context, dst, src *os.File, n, base int64, onProgress func(copied int64)) error {
+	var copied int64
+	for copied < n {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk := n - copied
+		if chunk > fastCopyChunk {
+			chunk = fastCopyChunk
+		}
+		written, err := io.CopyN(dst, src, chunk)
+		copied += written
+		if onProgress != nil && written > 0 {
+			onProgress(base + copied)
+		}
+		if err == io.EOF {
+			// The source shrank while being copied
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	// ficlone is the FICLONE ioctl, _IOW(0x94, 9, int), which shares the
+	// source's extents with the destination on copy-on-write filesystems
+	ficlone = 0x40049409
+
+	// seekData and seekHole are the lseek whence values that find the next
+	// data region and the next hole of a sparse file
+	seekData = 3
+	seekHole = 4
+)
+
+// fastCopy copies src into dst using the fastest method the filesystem
+// supports
+func fastCopy(ctx context.Context, dst, src *os.File, onProgress func(copied int64)) (bool, error) {
+	info, err := src.Stat()
+	if err != nil {
+		return false, nil
+	}
+	size := info.Size()
+
+	if reflink(dst, src) == nil {
+		if onProgress != nil {
+			onProgress(size)
+		}
+		return true, nil
+	}
+
+	if isSparse(info) {
+		copied, err := copySparse(ctx, dst, src, size, onProgress)
+		if copied || err != nil {
+			return true, err
+		}
+	}
+
+	return true, copyRange(ctx, dst, src, size, 0, onProgress)
+}
+
+// reflink clones src into dst with the FICLONE ioctl
+func reflink(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isSparse reports whether a file has fewer blocks allocated than its size
+// needs, i.e. it contains holes
+func isSparse(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return false
+	}
+	return st.Blocks*512 < st.Size
+}
+
+// copySparse copies only the data regions of src, leaving holes in dst.
+// It returns false without writing anything when the filesystem cannot
+// report holes.
+func copySparse(ctx context.Context, dst, src *os.File, size int64, onProgress func(copied int64)) (bool, error) {
+	var offset int64
+	for offset < size {
+		data, err := src.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// Only a hole remains
+			break
+		}
+		if err != nil {
+			if offset == 0 && errors.Is(err, syscall.EINVAL) {
+				return false, nil
+			}
+			return true, err
+		}
+		hole, err := src.Seek(data, seekHole)
+		if err != nil {
+			return true, err
+		}
+
+		if _, err := src.Seek(data, io.SeekStart); err != nil {
+			return true, err
+		}
+		if _, err := dst.Seek(data, io.SeekStart); err != nil {
+			return true, err
+		}
+		if err := copyRange(ctx, dst, src, hole-data, data, onProgress); err != nil {
+			return true, err
+		}
+		offset = hole
+	}
+
+	// Extend dst over a trailing hole
+	if err := dst.Truncate(size); err != nil {
+		return true, err
+	}
+	if onProgress != nil {
+		onProgress(size)
+	}
+	return true, nil
+}
@@ -0,0 +1,134 @@
+//go:build linux
+
+// Package filesystem provides a filesystem abstraction layer wrapping afero.
+// This file contains property-based tests for the fast copy path.
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// allocated returns the number of bytes allocated on disk for a file
+func allocated(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+// **Feature: homelab-file-manager, Property 27: Fast Copy Fidelity**
+//
+// Property: For any file made of data regions and holes, a fast copy on the OS
+// filesystem SHALL produce identical contents, SHALL report non-decreasing progress
+// ending at the file size, and SHALL keep a sparse source sparse.
+
+func TestProperty_FastCopyFidelity(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 50
+	parameters.MaxSize = 8
+
+	properties := gopter.NewProperties(parameters)
+
+	const region = 64 * 1024
+
+	properties.Property("fast copies match the source and keep holes", prop.ForAll(
+		func(layout []bool, seed byte) bool {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src.img")
+			dst := filepath.Join(dir, "dst.img")
+
+			// Each entry is one region: data when true, a hole when false
+			f, err := os.Create(src)
+			if err != nil {
+				return false
+			}
+			for i, isData := range layout {
+				if isData {
+					data := bytes.Repeat([]byte{seed + byte(i) + 1}, region)
+					if _, err := f.WriteAt(data, int64(i)*region); err != nil {
+						f.Close()
+						return false
+					}
+				}
+			}
+			size := int64(len(layout)) * region
+			if err := f.Truncate(size); err != nil {
+				f.Close()
+				return false
+			}
+			f.Close()
+
+			fsys := NewOsFS()
+			in, err := fsys.Open(src)
+			if err != nil {
+				return false
+			}
+			defer in.Close()
+			out, err := fsys.Create(dst)
+			if err != nil {
+				return false
+			}
+			defer out.Close()
+
+			var reported []int64
+			copied, err := fsys.FastCopy(context.Background(), out, in, func(n int64) {
+				reported = append(reported, n)
+			})
+			if !copied || err != nil || out.Close() != nil {
+				return false
+			}
+
+			want, _ := os.ReadFile(src)
+			got, _ := os.ReadFile(dst)
+			if !bytes.Equal(want, got) {
+				return false
+			}
+
+			if size > 0 && (len(reported) == 0 || reported[len(reported)-1] != size) {
+				return false
+			}
+			for i := 1; i < len(reported); i++ {
+				if reported[i] < reported[i-1] {
+					return false
+				}
+			}
+
+			if allocated(t, src) < size {
+				return allocated(t, dst) < size
+			}
+			return true
+		},
+		gen.SliceOf(gen.Bool()),
+		gen.UInt8(),
+	))
+
+	properties.TestingRun(t)
+}
+
+func TestCopyFileUsesFastCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	content := bytes.Repeat([]byte("homelab"), 100000)
+	if err := os.WriteFile(src, content, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewOsFS().CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("copied contents differ")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package filesystem
+
+import (
+	"context"
+	"os"
+)
+
+// fastCopy copies src into dst with copy_file_range or splice where Go's
+// os package supports them. Reflinks and hole detection are Linux only.
+func fastCopy(ctx context.Context, dst, src *os.File, onProgress func(copied int64)) (bool, error) {
+	info, err := src.Stat()
+	if err != nil {
+		return false, nil
+	}
+	return true, copyRange(ctx, dst, src, info.Size(), 0, onProgress)
+}
@@ -4,6 +4,7 @@
 package filesystem
 
 import (
+	"context"
 	"io"
 	"io/fs"
 	"os"
@@ -53,6 +54,15 @@ type FS interface {
 
 	// ReadFile reads the entire contents of a file.
 	ReadFile(name string) ([]byte, error)
+
+	// Chtimes changes the access and modification times of the named file.
+	Chtimes(name string, atime, mtime time.Time) error
+
+	// Chmod changes the mode of the named file.
+	Chmod(name string, mode os.FileMode) error
+
+	// Chown changes the numeric uid and gid of the named file.
+	Chown(name string, uid, gid int) error
 }
 
 // AferoFS implements FS using afero.Fs
@@ -76,6 +86,12 @@ func NewMemMapFS() *AferoFS {
 	return &AferoFS{fs: afero.NewMemMapFs()}
 }
 
+// isOs reports whether this filesystem is backed by the real OS filesystem
+func (a *AferoFS) isOs() bool {
+	_, ok := a.fs.(*afero.OsFs)
+	return ok
+}
+
 // Underlying returns the underlying afero.Fs
 func (a *AferoFS) Underlying() afero.Fs {
 	return a.fs
@@ -155,6 +171,21 @@ func (a *AferoFS) ReadFile(name string) ([]byte, error) {
 	return afero.ReadFile(a.fs, name)
 }
 
+// Chtimes changes the access and modification times of the named file.
+func (a *AferoFS) Chtimes(name string, atime, mtime time.Time) error {
+	return a.fs.Chtimes(name, atime, mtime)
+}
+
+// Chmod changes the mode of the named file.
+func (a *AferoFS) Chmod(name string, mode os.FileMode) error {
+	return a.fs.Chmod(name, mode)
+}
+
+// Chown changes the numeric uid and gid of the named file.
+func (a *AferoFS) Chown(name string, uid, gid int) error {
+	return a.fs.Chown(name, uid, gid)
+}
+
 // dirEntry wraps fs.FileInfo to implement fs.DirEntry
 type dirEntry struct {
 	info fs.FileInfo
@@ -203,7 +234,7 @@ func (f *FileInfo) ModTime() time.Time { return f.modTime }
 func (f *FileInfo) IsDir() bool        { return f.isDir }
 func (f *FileInfo) Sys() interface{}   { return nil }
 
-// CopyFile copies a file from src to dst
+// CopyFile copies a file from src to dst, using FastCopy where possible
 func (a *AferoFS) CopyFile(src, dst string) error {
 	srcFile, err := a.fs.Open(src)
 	if err != nil {
@@ -222,10 +253,18 @@ func (a *AferoFS) CopyFile(src, dst string) error {
 	}
 	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
+	copied, err := a.FastCopy(context.Background(), dstFile, srcFile, nil)
 	if err != nil {
 		return err
 	}
+	if !copied {
+		if _, err := io.Copy(dstFile, srcFile); err != nil {
+			return err
+		}
+	}
+	if err := dstFile.Close(); err != nil {
+		return err
+	}
 
-	return a.fs.Chmod(dst, srcInfo.Mode())
+	return ApplyMetadata(a, dst, MetadataOf(srcInfo), false)
 }
@@ -0,0 +1,90 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// FileMetadata holds the attributes of a file that are preserved on copy
+type FileMetadata struct {
+	Mode       fs.FileMode
+	ModTime    time.Time
+	AccessTime time.Time
+	UID        int
+	GID        int
+	HasOwner   bool // UID and GID are only known for files on the OS filesystem
+}
+
+// XattrFS is implemented by filesystems that can copy extended attributes
+type XattrFS interface {
+	// CopyXattrs copies the extended attributes of src onto dst.
+	CopyXattrs(src, dst string) error
+}
+
+// preservedModeBits are the mode bits copied along with a file: the
+// permissions and the setuid, setgid and sticky bits
+const preservedModeBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// MetadataOf extracts the preservable attributes from a FileInfo.
+// The access time falls back to the modification time when the platform
+// does not expose it.
+func MetadataOf(info fs.FileInfo) FileMetadata {
+	meta := FileMetadata{
+		Mode:       info.Mode() & preservedModeBits,
+		ModTime:    info.ModTime(),
+		AccessTime: info.ModTime(),
+	}
+	if st, ok := statOf(info); ok {
+		meta.AccessTime = st.atime
+		meta.UID = st.uid
+		meta.GID = st.gid
+		meta.HasOwner = true
+	}
+	return meta
+}
+
+// ApplyMetadata applies preserved attributes to the named file. Ownership is
+// only applied when withOwner is set, which requires running as root.
+// Errors for attributes the destination filesystem cannot store (unsupported
+// errors, e.g. on FAT or some network mounts) are ignored; being refused
+// permission to set one is reported.
+func ApplyMetadata(fsys FS, name string, meta FileMetadata, withOwner bool) error {
+	// Ownership first: chown may clear setuid/setgid bits set by chmod
+	if withOwner && meta.HasOwner {
+		if err := fsys.Chown(name, meta.UID, meta.GID); err != nil && !IsUnsupported(err) {
+			return err
+		}
+	}
+	if err := fsys.Chmod(name, meta.Mode); err != nil && !IsUnsupported(err) {
+		return err
+	}
+	// Times last, as the other changes may touch them
+	if err := fsys.Chtimes(name, meta.AccessTime, meta.ModTime); err != nil && !IsUnsupported(err) {
+		return err
+	}
+	return nil
+}
+
+// IsUnsupported reports whether err means the filesystem cannot store an
+// attribute. ENOTSUP, EOPNOTSUPP and ENOSYS match errors.ErrUnsupported;
+// EPERM does not, as it means the attribute was refused.
+func IsUnsupported(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported)
+}
+
+// CopyXattrs copies extended attributes when backed by the OS filesystem.
+// It is a no-op for other backends.
+func (a *AferoFS) CopyXattrs(src, dst string) error {
+	if !a.isOs() {
+		return nil
+	}
+	return copyXattrs(src, dst)
+}
+
+// statDetails holds platform-specific stat fields
+type statDetails struct {
+	atime time.Time
+	uid   int
+	gid   int
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// statOf reads the access time and ownership from a FileInfo's underlying stat
+func statOf(info fs.FileInfo) (statDetails, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return statDetails{}, false
+	}
+	return statDetails{
+		atime: time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec)),
+		uid:   int(st.Uid),
+		gid:   int(st.Gid),
+	}, true
+}
+
+// copyXattrs copies all extended attributes from src to dst. It does
+// nothing when either filesystem does not support them; an attribute the
+// destination refuses is reported.
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		if IsUnsupported(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, name := range names {
+		value, err := getXattr(src, name)
+		if err != nil {
+			if IsUnsupported(err) || errors.Is(err, syscall.ENODATA) {
+				continue
+			}
+			return err
+		}
+		if err := syscall.Setxattr(dst, name, value, 0); err != nil && !IsUnsupported(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// listXattrs returns the extended attribute names of a file
+func listXattrs(path string) ([]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// getXattr returns the value of one extended attribute
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+// Package filesystem provides a filesystem abstraction layer wrapping afero.
+// This file contains tests for preserving file metadata.
+package filesystem
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestApplyMetadataKeepsSpecialModeBits(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	for _, name := range []string{src, dst} {
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// setgid is cleared for files whose group the user is not a member of,
+	// so only setuid and sticky are checked
+	want := fs.FileMode(0750) | fs.ModeSetuid | fs.ModeSticky
+	if err := os.Chmod(src, want); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyMetadata(NewOsFS(), dst, MetadataOf(info), false); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSticky); got != want {
+		t.Fatalf("expected mode %v, got %v", want, got)
+	}
+}
+
+func TestIsUnsupportedReportsPermissionErrors(t *testing.T) {
+	unsupported := []error{syscall.ENOTSUP, syscall.EOPNOTSUPP, fmt.Errorf("chmod: %w", syscall.ENOTSUP)}
+	for _, err := range unsupported {
+		if !IsUnsupported(err) {
+			t.Errorf("expected %v to be unsupported", err)
+		}
+	}
+	refused := []error{syscall.EPERM, &fs.PathError{Op: "chmod", Path: "f", Err: syscall.EPERM}, fs.ErrPermission}
+	for _, err := range refused {
+		if IsUnsupported(err) {
+			t.Errorf("expected %v to be reported", err)
+		}
+	}
+}
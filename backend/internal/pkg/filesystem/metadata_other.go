@@ -0,0 +1,16 @@
+//go:build !linux
+
+package filesystem
+
+import "io/fs"
+
+// statOf is a stub for non-Linux platforms, where access time and
+// ownership are not preserved
+func statOf(info fs.FileInfo) (statDetails, bool) {
+	return statDetails{}, false
+}
+
+// copyXattrs is a stub for non-Linux platforms
+func copyXattrs(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,216 @@
+package filesystem
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// MountFS serves the paths below the roots of mounted filesystems from them,
+// and every other path from a base filesystem. A mounted filesystem sees
+// the paths below its root as absolute paths, its root being "/".
+type MountFS struct {
+	base   FS
+	mounts []mounted // Longest root first, so nested roots win
+}
+
+// mounted is a filesystem mounted at a root
+type mounted struct {
+	root string
+	fs   FS
+}
+
+// NewMountFS creates a filesystem serving every path from base until other
+// filesystems are mounted
+func NewMountFS(base FS) *MountFS {
+	return &MountFS{base: base}
+}
+
+// Mount serves the paths at and below root from fsys. Mounts are set up
+// before the filesystem is used; Mount is not safe for concurrent use.
+func (m *MountFS) Mount(root string, fsys FS) {
+	m.mounts = append(m.mounts, mounted{root: filepath.Clean(root), fs: fsys})
+	sort.SliceStable(m.mounts, func(i, j int) bool { return len(m.mounts[i].root) > len(m.mounts[j].root) })
+}
+
+// route returns the filesystem serving a path and the path within it
+func (m *MountFS) route(name string) (FS, string) {
+	name = filepath.Clean(name)
+	for _, mount := range m.mounts {
+		if name == mount.root {
+			return mount.fs, "/"
+		}
+		if rest, ok := strings.CutPrefix(name, mount.root+string(filepath.Separator)); ok {
+			return mount.fs, "/" + filepath.ToSlash(rest)
+		}
+	}
+	return m.base, name
+}
+
+// ReadDir reads the directory named by dirname and returns a list of directory entries.
+func (m *MountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, rel := m.route(name)
+	return fsys.ReadDir(rel)
+}
+
+// Stat returns a FileInfo describing the named file.
+func (m *MountFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, rel := m.route(name)
+	return fsys.Stat(rel)
+}
+
+// Open opens the named file for reading.
+func (m *MountFS) Open(name string) (afero.File, error) {
+	fsys, rel := m.route(name)
+	return fsys.Open(rel)
+}
+
+// Create creates or truncates the named file.
+func (m *MountFS) Create(name string) (afero.File, error) {
+	fsys, rel := m.route(name)
+	return fsys.Create(rel)
+}
+
+// Remove removes the named file or empty directory.
+func (m *MountFS) Remove(name string) error {
+	fsys, rel := m.route(name)
+	return fsys.Remove(rel)
+}
+
+// RemoveAll removes path and any children it contains.
+func (m *MountFS) RemoveAll(path string) error {
+	fsys, rel := m.route(path)
+	return fsys.RemoveAll(rel)
+}
+
+// Rename renames (moves) oldpath to newpath. Moves between filesystems fail
+// like moves between devices, so callers fall back to copying.
+func (m *MountFS) Rename(oldpath, newpath string) error {
+	oldFS, oldRel := m.route(oldpath)
+	newFS, newRel := m.route(newpath)
+	if oldFS != newFS {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	return oldFS.Rename(oldRel, newRel)
+}
+
+// MkdirAll creates a directory named path, along with any necessary parents.
+func (m *MountFS) MkdirAll(path string, perm os.FileMode) error {
+	fsys, rel := m.route(path)
+	return fsys.MkdirAll(rel, perm)
+}
+
+// Exists checks if a file or directory exists at the given path.
+func (m *MountFS) Exists(path string) (bool, error) {
+	fsys, rel := m.route(path)
+	return fsys.Exists(rel)
+}
+
+// IsDir checks if the path is a directory.
+func (m *MountFS) IsDir(path string) (bool, error) {
+	fsys, rel := m.route(path)
+	return fsys.IsDir(rel)
+}
+
+// OpenFile opens a file using the given flags and permissions.
+func (m *MountFS) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	fsys, rel := m.route(name)
+	return fsys.OpenFile(rel, flag, perm)
+}
+
+// WriteFile writes data to a file, creating it if necessary.
+func (m *MountFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	fsys, rel := m.route(name)
+	return fsys.WriteFile(rel, data, perm)
+}
+
+// ReadFile reads the entire contents of a file.
+func (m *MountFS) ReadFile(name string) ([]byte, error) {
+	fsys, rel := m.route(name)
+	return fsys.ReadFile(rel)
+}
+
+// Chtimes changes the access and modification times of the named file.
+func (m *MountFS) Chtimes(name string, atime, mtime time.Time) error {
+	fsys, rel := m.route(name)
+	return fsys.Chtimes(rel, atime, mtime)
+}
+
+// Chmod changes the mode of the named file.
+func (m *MountFS) Chmod(name string, mode os.FileMode) error {
+	fsys, rel := m.route(name)
+	return fsys.Chmod(rel, mode)
+}
+
+// Chown changes the numeric uid and gid of the named file.
+func (m *MountFS) Chown(name string, uid, gid int) error {
+	fsys, rel := m.route(name)
+	return fsys.Chown(rel, uid, gid)
+}
+
+// FreeSpace returns the bytes available on the filesystem holding path, if
+// it can report them
+func (m *MountFS) FreeSpace(path string) (int64, error) {
+	fsys, rel := m.route(path)
+	if reporter, ok := fsys.(SpaceReporter); ok {
+		return reporter.FreeSpace(rel)
+	}
+	return 0, ErrFreeSpaceUnsupported
+}
+
+// Preallocate extends f to size bytes, reserving the disk space where the
+// base filesystem supports it. Files of mounted filesystems are extended.
+func (m *MountFS) Preallocate(f afero.File, size int64) error {
+	if p, ok := m.base.(Preallocator); ok {
+		return p.Preallocate(f, size)
+	}
+	return f.Truncate(size)
+}
+
+// SupportsNotify reports whether changes below path are notified
+func (m *MountFS) SupportsNotify(path string) bool {
+	fsys, rel := m.route(path)
+	nfs, ok := fsys.(NotifyFS)
+	return ok && nfs.SupportsNotify(rel)
+}
+
+// Reflink clones oldname into the new file newname when both are on the
+// same filesystem and it supports reflinks
+func (m *MountFS) Reflink(oldname, newname string) error {
+	oldFS, oldRel := m.route(oldname)
+	newFS, newRel := m.route(newname)
+	rf, ok := oldFS.(Reflinker)
+	if !ok || oldFS != newFS {
+		return ErrReflinkUnsupported
+	}
+	return rf.Reflink(oldRel, newRel)
+}
+
+// FastCopy copies file contents in the kernel where the base filesystem
+// can. Files of mounted filesystems are never OS files, so it returns false
+// for them.
+func (m *MountFS) FastCopy(ctx context.Context, dst, src afero.File, onProgress func(copied int64)) (bool, error) {
+	if fc, ok := m.base.(FastCopier); ok {
+		return fc.FastCopy(ctx, dst, src, onProgress)
+	}
+	return false, nil
+}
+
+// CopyXattrs copies extended attributes between files of the same
+// filesystem where it supports them. It is a no-op otherwise.
+func (m *MountFS) CopyXattrs(src, dst string) error {
+	srcFS, srcRel := m.route(src)
+	dstFS, dstRel := m.route(dst)
+	xfs, ok := srcFS.(XattrFS)
+	if !ok || srcFS != dstFS {
+		return nil
+	}
+	return xfs.CopyXattrs(srcRel, dstRel)
+}
@@ -0,0 +1,15 @@
+package filesystem
+
+// NotifyFS is implemented by filesystems that can report whether the OS
+// delivers change notifications (inotify, kqueue, ...) for a directory
+type NotifyFS interface {
+	// SupportsNotify reports whether changes below path are notified.
+	SupportsNotify(path string) bool
+}
+
+// SupportsNotify reports whether the OS notifies changes to the directory.
+// Only the OS filesystem is notified, and not for network or FUSE mounts,
+// where changes made by other hosts are never seen.
+func (a *AferoFS) SupportsNotify(path string) bool {
+	return a.isOs() && !isRemoteFS(path)
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package filesystem
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2) whose changes may come from other
+// hosts and are therefore not reliably reported by inotify
+var remoteFSMagic = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xff534d42: true, // CIFS
+	0xfe534d42: true, // SMB2
+	0x65735546: true, // FUSE (sshfs, rclone, ...)
+	0x01021997: true, // 9P
+	0x00c36400: true, // Ceph
+}
+
+// isRemoteFS reports whether path is on a network or FUSE filesystem
+func isRemoteFS(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return remoteFSMagic[uint32(st.Type)]
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package filesystem
+
+// isRemoteFS is a stub for non-Linux platforms, where all filesystems are
+// assumed to deliver change notifications
+func isRemoteFS(path string) bool {
+	return false
+}
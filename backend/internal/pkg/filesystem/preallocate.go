@@ -0,0 +1,34 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// errPreallocateUnsupported is returned by fallocate when the platform or
+// filesystem cannot reserve blocks
+var errPreallocateUnsupported = errors.New("preallocation not supported")
+
+// Preallocator is implemented by filesystems that can reserve disk space
+// for a file before its contents are written
+type Preallocator interface {
+	// Preallocate extends the empty file f to size bytes, reserving the
+	// disk space where the filesystem supports it.
+	Preallocate(f afero.File, size int64) error
+}
+
+// Preallocate extends f to size bytes. On the OS filesystem it reserves the
+// blocks with fallocate where supported, so that a full disk is reported
+// before any data is written; otherwise the file is extended without
+// allocating blocks.
+func (a *AferoFS) Preallocate(f afero.File, size int64) error {
+	if osFile, ok := f.(*os.File); ok && a.isOs() && size > 0 {
+		err := fallocate(osFile, size)
+		if !errors.Is(err, errPreallocateUnsupported) {
+			return err
+		}
+	}
+	return f.Truncate(size)
+}
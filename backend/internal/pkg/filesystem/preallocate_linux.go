@@ -0,0 +1,26 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fallocate reserves size bytes for f, extending it
+func fallocate(f *os.File, size int64) error {
+	for {
+		err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EOPNOTSUPP), errors.Is(err, syscall.ENOSYS):
+			return errPreallocateUnsupported
+		default:
+			return &os.PathError{Op: "fallocate", Path: f.Name(), Err: err}
+		}
+	}
+}
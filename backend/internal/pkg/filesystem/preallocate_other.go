@@ -0,0 +1,11 @@
+//go:build !linux
+
+package filesystem
+
+import "os"
+
+// fallocate is a stub for non-Linux platforms, where files are extended
+// without reserving blocks
+func fallocate(f *os.File, size int64) error {
+	return errPreallocateUnsupported
+}
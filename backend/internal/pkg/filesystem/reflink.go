@@ -0,0 +1,54 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrReflinkUnsupported is returned by Reflink when the backend or the
+// underlying filesystem cannot clone files
+var ErrReflinkUnsupported = errors.New("reflinks not supported")
+
+// Reflinker is implemented by filesystems that can clone a file without
+// copying its contents
+type Reflinker interface {
+	// Reflink creates newname as a copy-on-write clone of oldname. The two
+	// files share blocks until either is modified, so unlike a hard link a
+	// write to one is never visible through the other.
+	Reflink(oldname, newname string) error
+}
+
+// Reflink clones oldname into the new file newname. It returns
+// ErrReflinkUnsupported for non-OS backends and for filesystems without
+// copy-on-write support, in which case newname is not left behind.
+func (a *AferoFS) Reflink(oldname, newname string) error {
+	if !a.isOs() {
+		return ErrReflinkUnsupported
+	}
+	src, err := os.Open(oldname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(newname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = reflink(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(newname)
+		if isReflinkUnsupported(err) {
+			return ErrReflinkUnsupported
+		}
+		return &os.LinkError{Op: "reflink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isReflinkUnsupported reports whether a FICLONE error means the files cannot
+// be cloned at all, as opposed to a failure of this particular request.
+// EXDEV is included because clones cannot cross filesystems.
+func isReflinkUnsupported(err error) bool {
+	return errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, syscall.ENOTTY) ||
+		errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.EXDEV) ||
+		errors.Is(err, syscall.ENOSYS)
+}
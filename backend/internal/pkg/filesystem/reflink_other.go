@@ -0,0 +1,19 @@
+//go:build !linux
+
+package filesystem
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is a stub for non-Linux platforms, which have no clone ioctl
+func reflink(dst, src *os.File) error {
+	return ErrReflinkUnsupported
+}
+
+// isReflinkUnsupported reports whether a reflink error means the files
+// cannot be cloned at all
+func isReflinkUnsupported(err error) bool {
+	return errors.Is(err, ErrReflinkUnsupported)
+}
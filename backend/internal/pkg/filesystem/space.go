@@ -0,0 +1,39 @@
+package filesystem
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// ErrFreeSpaceUnsupported is returned by FreeSpace when the filesystem
+// cannot report its free space
+var ErrFreeSpaceUnsupported = errors.New("free space not supported")
+
+// SpaceReporter is implemented by filesystems that can report how much
+// space is left for new data
+type SpaceReporter interface {
+	// FreeSpace returns the number of bytes available to unprivileged users
+	// on the filesystem holding path, or its nearest existing parent.
+	FreeSpace(path string) (int64, error)
+}
+
+// FreeSpace returns the bytes available on the filesystem holding path. Only
+// the OS filesystem can report it; others return ErrFreeSpaceUnsupported.
+func (a *AferoFS) FreeSpace(path string) (int64, error) {
+	if !a.isOs() {
+		return 0, ErrFreeSpaceUnsupported
+	}
+
+	// The path may not have been created yet
+	for {
+		if exists, _ := a.Exists(path); exists {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	return statfsAvailable(path)
+}
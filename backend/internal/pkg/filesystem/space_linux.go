@@ -0,0 +1,18 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// statfsAvailable returns the bytes available to unprivileged users on the
+// filesystem holding path
+func statfsAvailable(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return int64(stat.Bavail) * stat.Bsize, nil
+}
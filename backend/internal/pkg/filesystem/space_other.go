@@ -0,0 +1,8 @@
+//go:build !linux
+
+package filesystem
+
+// statfsAvailable is a stub for non-Linux platforms
+func statfsAvailable(path string) (int64, error) {
+	return 0, ErrFreeSpaceUnsupported
+}
@@ -47,6 +47,22 @@ func detectMimeTypeByExtension(ext string) string {
 	return extensionMimeFallbacks[normalizedExt]
 }
 
+// uploadTempMarker separates a file's name from the upload ID in the name of
+// the temp file an upload to it is written to
+const uploadTempMarker = ".uploading."
+
+// UploadTempPath returns the temp file an upload to fsPath is written to
+// before it is moved into place
+func UploadTempPath(fsPath, id string) string {
+	return fsPath + uploadTempMarker + id
+}
+
+// IsUploadTemp reports whether a file name is that of an upload's temp file.
+// They hold unfinished data, so listings, searches, copies and syncs skip them.
+func IsUploadTemp(name string) bool {
+	return strings.Contains(name, uploadTempMarker)
+}
+
 // ToFileInfo converts fs.FileInfo to model.FileInfo
 // This is a centralized utility function used by file service and search service
 func ToFileInfo(name, path string, info fs.FileInfo) model.FileInfo {
@@ -0,0 +1,883 @@
+package remotefs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/spf13/afero"
+)
+
+// store is a remote that holds whole files, such as an S3 bucket or a
+// WebDAV server: files are read in ranges but written at once. Names are
+// slash-separated paths below the mount's root, "/" being the root itself.
+// Errors for missing files, existing files and refused access are
+// fs.ErrNotExist, fs.ErrExist and fs.ErrPermission.
+type store interface {
+	// stat describes a file or folder
+	stat(name string) (*fileInfo, error)
+
+	// list describes the entries of a folder
+	list(name string) ([]*fileInfo, error)
+
+	// read streams length bytes of a file from offset, or the rest of the
+	// file when length is negative
+	read(name string, offset, length int64) (io.ReadCloser, error)
+
+	// write replaces a file's contents with the first size bytes of r
+	write(name string, r io.ReaderAt, size int64) error
+
+	// mkdir creates a folder in an existing folder
+	mkdir(name string) error
+
+	// remove removes a file or an empty folder
+	remove(name string, isDir bool) error
+
+	// removeAll removes a folder and everything in it
+	removeAll(name string) error
+
+	// rename moves a file or folder, replacing a file at newname
+	rename(oldname, newname string, isDir bool) error
+}
+
+// fileInfo describes a file or folder of a store
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.isDir }
+func (i *fileInfo) Sys() any           { return nil }
+
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// objectFs implements afero.Fs over a store. Reads are streamed from the
+// store. Files opened for writing are copied to a local spool file, and
+// written back to the store when their last handle has been closed for
+// config.RemoteWriteBackDelay, when they are synced, or on Close.
+type objectFs struct {
+	store store
+
+	mu     sync.Mutex
+	spools map[string]*spool // Files being written, by name
+}
+
+// spool is the local copy of a file being written
+type spool struct {
+	name      string // Name in the store
+	file      string // Local file holding the contents
+	refs      int    // Open handles
+	dirty     bool   // Changed since it was last written back
+	discarded bool   // Removed or replaced; never written back again
+	timer     *time.Timer
+	upload    sync.Mutex // Held while writing back
+}
+
+func newObjectFs(s store) *objectFs {
+	return &objectFs{store: s, spools: make(map[string]*spool)}
+}
+
+// clean returns the store name of a path
+func clean(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+// below reports whether name is dir or inside it
+func below(name, dir string) bool {
+	return name == dir || dir == "/" || strings.HasPrefix(name, dir+"/")
+}
+
+// Name returns the name of the filesystem
+func (o *objectFs) Name() string {
+	return "objectFs"
+}
+
+// Create creates or truncates the named file
+func (o *objectFs) Create(name string) (afero.File, error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+// Open opens the named file or folder for reading
+func (o *objectFs) Open(name string) (afero.File, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file. Files opened for reading only are streamed from
+// the store unless they are being written; other files are spooled.
+func (o *objectFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	name = clean(name)
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	excl := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+
+	o.mu.Lock()
+	if sp := o.spools[name]; sp != nil {
+		if excl {
+			o.mu.Unlock()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		o.acquire(sp)
+		o.mu.Unlock()
+		return o.openSpool(sp, name, flag)
+	}
+	o.mu.Unlock()
+
+	info, err := o.store.stat(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	switch {
+	case !write && !exists:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !write && info.isDir:
+		return &dirFile{name: name, info: info, list: func() ([]os.FileInfo, error) { return o.readDir(name) }}, nil
+	case !write:
+		return &objectFile{fs: o, name: name, info: info}, nil
+	case exists && info.isDir:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case exists && excl:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !exists:
+		if err := o.checkParent("open", name); err != nil {
+			return nil, err
+		}
+	}
+
+	// Copy the current contents unless they are about to be truncated
+	var size int64
+	if exists && flag&os.O_TRUNC == 0 {
+		size = info.size
+	}
+	file, err := o.download(name, size)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	o.mu.Lock()
+	sp := o.spools[name]
+	if sp != nil {
+		// Another handle was opened meanwhile; share its copy
+		os.Remove(file)
+		if excl {
+			o.mu.Unlock()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+	} else {
+		sp = &spool{name: name, file: file, dirty: !exists}
+		o.spools[name] = sp
+	}
+	o.acquire(sp)
+	o.mu.Unlock()
+	return o.openSpool(sp, name, flag)
+}
+
+// download copies the first size bytes of a file into a new spool file
+func (o *objectFs) download(name string, size int64) (string, error) {
+	f, err := os.CreateTemp("", "remotefs-*")
+	if err != nil {
+		return "", err
+	}
+	if size > 0 {
+		var body io.ReadCloser
+		body, err = o.store.read(name, 0, size)
+		if err == nil {
+			_, err = io.CopyN(f, body, size)
+			body.Close()
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// openSpool opens a handle on an acquired spool
+func (o *objectFs) openSpool(sp *spool, name string, flag int) (afero.File, error) {
+	f, err := os.OpenFile(sp.file, flag&^(os.O_CREATE|os.O_EXCL), 0)
+	if err != nil {
+		o.release(sp)
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if flag&os.O_TRUNC != 0 {
+		o.touch(sp)
+	}
+	return &spoolFile{fs: o, spool: sp, name: name, file: f}, nil
+}
+
+// acquire counts a new handle on a spool. The caller must hold mu.
+func (o *objectFs) acquire(sp *spool) {
+	sp.refs++
+	if sp.timer != nil {
+		sp.timer.Stop()
+		sp.timer = nil
+	}
+}
+
+// release counts a closed handle on a spool. Once the last handle is
+// closed, a changed file is written back after the delay and an unchanged
+// one is forgotten.
+func (o *objectFs) release(sp *spool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	sp.refs--
+	if sp.refs == 0 {
+		o.settle(sp)
+	}
+}
+
+// settle schedules the write back of a spool without handles, or forgets
+// it once written back. The caller must hold mu.
+func (o *objectFs) settle(sp *spool) {
+	if sp.discarded || !sp.dirty {
+		o.forget(sp)
+		return
+	}
+
+	// Failed write backs are retried after another delay
+	var timer *time.Timer
+	timer = time.AfterFunc(config.RemoteWriteBackDelay, func() {
+		o.mu.Lock()
+		due := sp.timer == timer
+		o.mu.Unlock()
+		if !due {
+			return
+		}
+		o.flush(sp)
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if sp.timer == timer {
+			sp.timer = nil
+			o.settle(sp)
+		}
+	})
+	sp.timer = timer
+}
+
+// forget drops a spool, removing its local copy once its last handle is
+// closed. The caller must hold mu.
+func (o *objectFs) forget(sp *spool) {
+	if o.spools[sp.name] == sp {
+		delete(o.spools, sp.name)
+	}
+	sp.discarded = true
+	if sp.timer != nil {
+		sp.timer.Stop()
+		sp.timer = nil
+	}
+	if sp.refs == 0 {
+		os.Remove(sp.file)
+	}
+}
+
+// touch marks a spool as changed
+func (o *objectFs) touch(sp *spool) {
+	o.mu.Lock()
+	sp.dirty = true
+	o.mu.Unlock()
+}
+
+// flush writes a changed spool back to the store
+func (o *objectFs) flush(sp *spool) error {
+	sp.upload.Lock()
+	defer sp.upload.Unlock()
+
+	o.mu.Lock()
+	if !sp.dirty || sp.discarded {
+		o.mu.Unlock()
+		return nil
+	}
+	// Writes from now on mark it changed again
+	sp.dirty = false
+	name := sp.name
+	o.mu.Unlock()
+
+	err := o.upload(name, sp.file)
+	if err != nil {
+		o.touch(sp)
+	}
+	return err
+}
+
+// upload writes a local file to the store
+func (o *objectFs) upload(name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return o.store.write(name, f, info.Size())
+}
+
+// spoolsBelow returns the spools of files at or inside name
+func (o *objectFs) spoolsBelow(name string) []*spool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var spools []*spool
+	for spoolName, sp := range o.spools {
+		if below(spoolName, name) {
+			spools = append(spools, sp)
+		}
+	}
+	return spools
+}
+
+// discard forgets the spools of files at or inside name, waiting for
+// write backs in progress. It reports whether there were any.
+func (o *objectFs) discard(name string) bool {
+	o.mu.Lock()
+	var spools []*spool
+	for spoolName, sp := range o.spools {
+		if below(spoolName, name) {
+			o.forget(sp)
+			spools = append(spools, sp)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, sp := range spools {
+		sp.upload.Lock()
+		sp.upload.Unlock()
+	}
+	return len(spools) > 0
+}
+
+// spoolInfo describes the local copy of a file
+func spoolInfo(sp *spool, name string) (*fileInfo, error) {
+	info, err := os.Stat(sp.file)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// Stat describes the named file or folder
+func (o *objectFs) Stat(name string) (os.FileInfo, error) {
+	name = clean(name)
+	o.mu.Lock()
+	sp := o.spools[name]
+	o.mu.Unlock()
+	if sp != nil {
+		if info, err := spoolInfo(sp, name); err == nil {
+			return info, nil
+		}
+	}
+
+	info, err := o.store.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// readDir lists a folder, including files being written that are not in
+// the store yet
+func (o *objectFs) readDir(name string) ([]os.FileInfo, error) {
+	infos, err := o.store.list(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make(map[string]os.FileInfo, len(infos))
+	for _, info := range infos {
+		entries[info.name] = info
+	}
+	o.mu.Lock()
+	var spools []*spool
+	for spoolName, sp := range o.spools {
+		if path.Dir(spoolName) == name {
+			spools = append(spools, sp)
+		}
+	}
+	o.mu.Unlock()
+	for _, sp := range spools {
+		if info, err := spoolInfo(sp, sp.name); err == nil {
+			entries[info.name] = info
+		}
+	}
+
+	list := make([]os.FileInfo, 0, len(entries))
+	for _, info := range entries {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// checkParent fails with a missing file unless name's parent is a folder
+func (o *objectFs) checkParent(op, name string) error {
+	parent, err := o.Stat(path.Dir(name))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// Mkdir creates a folder
+func (o *objectFs) Mkdir(name string, perm os.FileMode) error {
+	name = clean(name)
+	if _, err := o.Stat(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := o.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	if err := o.store.mkdir(name); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// MkdirAll creates a folder and any missing parents
+func (o *objectFs) MkdirAll(name string, perm os.FileMode) error {
+	name = clean(name)
+	dir := "/"
+	for _, part := range strings.Split(strings.Trim(name, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		dir = path.Join(dir, part)
+		info, err := o.Stat(dir)
+		switch {
+		case err == nil && !info.IsDir():
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		case err == nil:
+			continue
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+		if err := o.store.mkdir(dir); err != nil && !errors.Is(err, fs.ErrExist) {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: err}
+		}
+	}
+	return nil
+}
+
+// Remove removes a file or an empty folder
+func (o *objectFs) Remove(name string) error {
+	name = clean(name)
+	if name == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	info, err := o.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := o.readDir(name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	// A file that was never written back is only in its spool
+	spooled := o.discard(name)
+	err = o.store.remove(name, info.IsDir())
+	if err != nil && !(spooled && errors.Is(err, fs.ErrNotExist)) {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// RemoveAll removes a file or a folder with everything in it. A missing
+// file is not an error.
+func (o *objectFs) RemoveAll(name string) error {
+	name = clean(name)
+	o.discard(name)
+	if name == "/" {
+		entries, err := o.store.list(name)
+		if err != nil {
+			return &fs.PathError{Op: "removeall", Path: name, Err: err}
+		}
+		for _, entry := range entries {
+			if err := o.RemoveAll(path.Join(name, entry.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	info, err := o.store.stat(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+	case info.isDir:
+		err = o.store.removeAll(name)
+	default:
+		err = o.store.remove(name, false)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Rename moves a file or folder, replacing a file at newname. Files being
+// written are written back first.
+func (o *objectFs) Rename(oldname, newname string) error {
+	oldname, newname = clean(oldname), clean(newname)
+	if oldname == newname {
+		return nil
+	}
+	if oldname == "/" || below(newname, oldname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EINVAL}
+	}
+	info, err := o.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	if target, err := o.Stat(newname); err == nil && target.IsDir() != info.IsDir() {
+		errno := syscall.EISDIR
+		if !target.IsDir() {
+			errno = syscall.ENOTDIR
+		}
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errno}
+	}
+	if err := o.checkParent("rename", newname); err != nil {
+		return err
+	}
+
+	for _, sp := range o.spoolsBelow(oldname) {
+		if err := o.flush(sp); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+	}
+	o.discard(newname)
+	if err := o.store.rename(oldname, newname, info.IsDir()); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	// Handles still open write to the new name from now on
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for spoolName, sp := range o.spools {
+		if !below(spoolName, oldname) {
+			continue
+		}
+		if sp.refs == 0 && !sp.dirty {
+			o.forget(sp)
+			continue
+		}
+		delete(o.spools, spoolName)
+		sp.name = newname + strings.TrimPrefix(spoolName, oldname)
+		o.spools[sp.name] = sp
+	}
+	return nil
+}
+
+// Chmod is not supported: stores have no permissions
+func (o *objectFs) Chmod(name string, mode os.FileMode) error {
+	return &fs.PathError{Op: "chmod", Path: name, Err: errors.ErrUnsupported}
+}
+
+// Chown is not supported: stores have no owners
+func (o *objectFs) Chown(name string, uid, gid int) error {
+	return &fs.PathError{Op: "chown", Path: name, Err: errors.ErrUnsupported}
+}
+
+// Chtimes is not supported: stores set the modification time on writes
+func (o *objectFs) Chtimes(name string, atime, mtime time.Time) error {
+	return &fs.PathError{Op: "chtimes", Path: name, Err: errors.ErrUnsupported}
+}
+
+// Close writes back every changed file and forgets the spools
+func (o *objectFs) Close() error {
+	o.mu.Lock()
+	spools := make([]*spool, 0, len(o.spools))
+	for _, sp := range o.spools {
+		if sp.timer != nil {
+			sp.timer.Stop()
+			sp.timer = nil
+		}
+		spools = append(spools, sp)
+	}
+	o.mu.Unlock()
+
+	var errs []error
+	for _, sp := range spools {
+		if err := o.flush(sp); err != nil {
+			errs = append(errs, &fs.PathError{Op: "close", Path: sp.name, Err: err})
+		}
+	}
+	o.discard("/")
+	return errors.Join(errs...)
+}
+
+// spoolFile is a handle on the local copy of a file
+type spoolFile struct {
+	fs    *objectFs
+	spool *spool
+	name  string
+	file  *os.File
+	once  sync.Once
+}
+
+func (f *spoolFile) Name() string                              { return f.name }
+func (f *spoolFile) Read(p []byte) (int, error)                { return f.file.Read(p) }
+func (f *spoolFile) ReadAt(p []byte, off int64) (int, error)   { return f.file.ReadAt(p, off) }
+func (f *spoolFile) Seek(off int64, whence int) (int64, error) { return f.file.Seek(off, whence) }
+
+func (f *spoolFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	f.fs.touch(f.spool)
+	return n, err
+}
+
+func (f *spoolFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.file.WriteAt(p, off)
+	f.fs.touch(f.spool)
+	return n, err
+}
+
+func (f *spoolFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *spoolFile) Truncate(size int64) error {
+	err := f.file.Truncate(size)
+	f.fs.touch(f.spool)
+	return err
+}
+
+func (f *spoolFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *spoolFile) Readdirnames(n int) ([]string, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *spoolFile) Stat() (os.FileInfo, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(f.name), size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// Sync writes the file back to the store now
+func (f *spoolFile) Sync() error {
+	if err := f.fs.flush(f.spool); err != nil {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+func (f *spoolFile) Close() error {
+	err := os.ErrClosed
+	f.once.Do(func() {
+		err = f.file.Close()
+		f.fs.release(f.spool)
+	})
+	return err
+}
+
+// objectFile is a handle reading a file from the store. Sequential reads
+// share one response; seeking starts another.
+type objectFile struct {
+	fs     *objectFs
+	name   string
+	info   *fileInfo
+	offset int64
+
+	body       io.ReadCloser
+	bodyOffset int64
+}
+
+func (f *objectFile) Name() string               { return f.name }
+func (f *objectFile) Stat() (os.FileInfo, error) { return f.info, nil }
+func (f *objectFile) Sync() error                { return nil }
+
+func (f *objectFile) Read(p []byte) (int, error) {
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.body != nil && f.bodyOffset != f.offset {
+		f.body.Close()
+		f.body = nil
+	}
+	if f.body == nil {
+		body, err := f.fs.store.read(f.name, f.offset, -1)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.body, f.bodyOffset = body, f.offset
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyOffset += int64(n)
+	if err == io.EOF && f.offset < f.info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (f *objectFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.info.size {
+		return 0, io.EOF
+	}
+	length := min(int64(len(p)), f.info.size-off)
+	body, err := f.fs.store.read(f.name, off, length)
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:length])
+	if err == nil && length < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *objectFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *objectFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *objectFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *objectFile) WriteString(s string) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *objectFile) Truncate(size int64) error {
+	return &fs.PathError{Op: "truncate", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *objectFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *objectFile) Readdirnames(n int) ([]string, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *objectFile) Close() error {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	return nil
+}
+
+// dirFile is a handle listing a folder
+type dirFile struct {
+	name    string
+	info    os.FileInfo
+	list    func() ([]os.FileInfo, error)
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (f *dirFile) Name() string               { return f.name }
+func (f *dirFile) Stat() (os.FileInfo, error) { return f.info, nil }
+func (f *dirFile) Sync() error                { return nil }
+func (f *dirFile) Close() error               { return nil }
+
+// Readdir returns the next count entries, or all remaining ones when count
+// is not positive
+func (f *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.listed {
+		entries, err := f.list()
+		if err != nil {
+			return nil, err
+		}
+		f.entries, f.listed = entries, true
+	}
+	if count <= 0 || count > len(f.entries) {
+		if count > 0 && len(f.entries) == 0 {
+			return nil, io.EOF
+		}
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *dirFile) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, err
+}
+
+func (f *dirFile) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dirFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dirFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *dirFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *dirFile) WriteString(s string) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *dirFile) Truncate(size int64) error {
+	return &fs.PathError{Op: "truncate", Path: f.name, Err: syscall.EBADF}
+}
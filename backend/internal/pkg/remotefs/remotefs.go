@@ -0,0 +1,104 @@
+// Package remotefs provides the filesystems of mount points whose files live
+// on another server: an SFTP server, an S3 or MinIO bucket, or a WebDAV
+// server. Each sees the mount point's path on the remote as its root "/",
+// and is meant to be mounted into a filesystem.MountFS.
+package remotefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/spf13/afero"
+)
+
+// Remote filesystem errors
+var (
+	ErrUnknownType    = errors.New("unknown mount point type")
+	ErrMissingOption  = errors.New("missing mount point option")
+	ErrInvalidOption  = errors.New("invalid mount point option")
+	ErrInvalidHostKey = errors.New("invalid sftp host key")
+)
+
+// Filesystem is the filesystem of a remote mount point
+type Filesystem struct {
+	*filesystem.AferoFS
+	backend io.Closer
+}
+
+// New creates the filesystem of a remote mount point from its options. It
+// does not connect: connections are made when the filesystem is first
+// used, and made again after they fail.
+func New(mount model.MountPoint) (*Filesystem, error) {
+	var backend interface {
+		afero.Fs
+		io.Closer
+	}
+	var err error
+	switch mount.Type {
+	case model.MountTypeSFTP:
+		backend, err = newSFTPFs(mount.Path, mount.Options)
+	case model.MountTypeS3:
+		var store *s3Store
+		store, err = newS3Store(mount.Path, mount.Options)
+		if err == nil {
+			backend = newObjectFs(store)
+		}
+	case model.MountTypeWebDAV:
+		var store *davStore
+		store, err = newDAVStore(mount.Path, mount.Options)
+		if err == nil {
+			backend = newObjectFs(store)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, mount.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mount point %s: %w", mount.Name, err)
+	}
+	return &Filesystem{AferoFS: filesystem.New(backend), backend: backend}, nil
+}
+
+// Close uploads the files still waiting to be written back and closes the
+// connection to the remote
+func (f *Filesystem) Close() error {
+	return f.backend.Close()
+}
+
+// option returns a required option
+func option(options map[string]string, name string) (string, error) {
+	value := options[name]
+	if value == "" {
+		return "", fmt.Errorf("%w: %s", ErrMissingOption, name)
+	}
+	return value, nil
+}
+
+// boolOption returns an optional boolean option, false when unset
+func boolOption(options map[string]string, name string) (bool, error) {
+	value := options[name]
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s must be true or false", ErrInvalidOption, name)
+	}
+	return b, nil
+}
+
+// httpClient returns a client for S3 and WebDAV servers. Transfers take as
+// long as they need, but connecting and waiting for a response time out.
+func httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: config.RemoteTimeout, KeepAlive: config.RemoteTimeout}).DialContext
+	transport.TLSHandshakeTimeout = config.RemoteTimeout
+	transport.ResponseHeaderTimeout = config.RemoteTimeout
+	return &http.Client{Transport: transport}
+}
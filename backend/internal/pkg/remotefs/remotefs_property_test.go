@@ -0,0 +1,547 @@
+package remotefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/handler"
+	"github.com/homelab/filemanager/internal/middleware"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	s3gateway "github.com/homelab/filemanager/internal/s3"
+	"github.com/homelab/filemanager/internal/service"
+	sftpserver "github.com/homelab/filemanager/internal/sftp"
+	davserver "github.com/homelab/filemanager/internal/webdav"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"golang.org/x/crypto/ssh"
+)
+
+// serverFS creates the in-memory filesystem of a stand-in server, with a
+// "media" mount holding the folder remote mounts are rooted at
+func serverFS() (*filesystem.AferoFS, service.FileService, service.AuthService) {
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media/remote", 0755)
+
+	files := service.NewFileService(fs, service.FileServiceConfig{MountPoints: []model.MountPoint{
+		{Name: "media", Path: "/data/media"},
+	}})
+	authService := service.NewAuthService(service.AuthServiceConfig{
+		JWTSecret: "test-secret",
+		Users:     map[string]string{"alice": "secret"},
+	})
+	return fs, files, authService
+}
+
+// startSFTP serves a stand-in over SFTP and returns a mount point of it
+func startSFTP(t *testing.T) model.MountPoint {
+	t.Helper()
+	fs, files, authService := serverFS()
+	server, err := sftpserver.NewServer(files, authService, sftpserver.Config{HostKeyPath: "/appdata/sftp-host-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	hostKey, err := fs.ReadFile("/appdata/sftp-host-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.MountPoint{Name: "remote", Type: model.MountTypeSFTP, Path: "/media/remote", Options: map[string]string{
+		"host":     listener.Addr().String(),
+		"user":     "alice",
+		"password": "secret",
+		"host_key": string(ssh.MarshalAuthorizedKey(signer.PublicKey())),
+	}}
+}
+
+// startS3 serves a stand-in through the S3 gateway and returns a mount
+// point of it
+func startS3(t *testing.T) model.MountPoint {
+	t.Helper()
+	fs, files, _ := serverFS()
+	uploads := handler.NewUploadManager(fs, nil, "/appdata/uploads", handler.UploadLimits{})
+	gateway := s3gateway.NewGateway(files, uploads, s3gateway.Config{
+		Keys:    map[string]s3gateway.Key{"ALICEKEY": {User: "alice", Secret: "alice-secret"}},
+		DataDir: "/appdata",
+	})
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+
+	return model.MountPoint{Name: "remote", Type: model.MountTypeS3, Path: "/remote", Options: map[string]string{
+		"bucket":     "media",
+		"endpoint":   server.URL,
+		"access_key": "ALICEKEY",
+		"secret_key": "alice-secret",
+		"path_style": "true",
+	}}
+}
+
+// startWebDAV serves a stand-in over WebDAV and returns a mount point of
+// it, and the number of files written to it
+func startWebDAV(t *testing.T) (model.MountPoint, *atomic.Int32) {
+	t.Helper()
+	_, files, authService := serverFS()
+	h := davserver.NewHandler(files, davserver.Config{Prefix: "/dav", DataDir: "/appdata"})
+
+	puts := &atomic.Int32{}
+	r := chi.NewRouter()
+	r.Route("/dav", func(r chi.Router) {
+		r.Use(middleware.BasicAuth(authService, "test", 0))
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					puts.Add(1)
+				}
+				next.ServeHTTP(w, r)
+			})
+		})
+		h.RegisterRoutes(r)
+	})
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return model.MountPoint{Name: "remote", Type: model.MountTypeWebDAV, Path: "/remote", Options: map[string]string{
+		"url":      server.URL + "/dav/media",
+		"user":     "alice",
+		"password": "secret",
+	}}, puts
+}
+
+// standIns are the servers remote mounts are tested against
+var standIns = []struct {
+	name  string
+	start func(t *testing.T) model.MountPoint
+}{
+	{"sftp", startSFTP},
+	{"s3", startS3},
+	{"webdav", func(t *testing.T) model.MountPoint {
+		mount, _ := startWebDAV(t)
+		return mount
+	}},
+}
+
+// open creates the filesystem of a mount point, closed with the test
+func open(t *testing.T, mount model.MountPoint) *Filesystem {
+	t.Helper()
+	fsys, err := New(mount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return fsys
+}
+
+// readTree returns the contents of the files below dir by path, and "/"
+// for folders
+func readTree(fsys filesystem.FS, dir string) (map[string]string, error) {
+	tree := make(map[string]string)
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		p := path.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			data, err := fsys.ReadFile(p)
+			if err != nil {
+				return nil, err
+			}
+			tree[p] = string(data)
+			continue
+		}
+		tree[p] = "/"
+		sub, err := readTree(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range sub {
+			tree[k] = v
+		}
+	}
+	return tree, nil
+}
+
+// TestRemoteMountOperations checks the filesystem operations the services
+// rely on against each kind of server
+func TestRemoteMountOperations(t *testing.T) {
+	for _, standIn := range standIns {
+		t.Run(standIn.name, func(t *testing.T) {
+			mount := standIn.start(t)
+			fsys := open(t, mount)
+
+			if err := fsys.MkdirAll("/docs/sub", 0755); err != nil {
+				t.Fatalf("mkdir: %v", err)
+			}
+			if err := fsys.WriteFile("/docs/a.txt", []byte("hello"), 0644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := fsys.WriteFile("/docs/sub/b.txt", []byte("world"), 0644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if info, err := fsys.Stat("/docs/a.txt"); err != nil || info.Size() != 5 || info.IsDir() || info.Name() != "a.txt" {
+				t.Fatalf("expected a.txt of 5 bytes, got %v, %v", info, err)
+			}
+			if isDir, err := fsys.IsDir("/docs/sub"); err != nil || !isDir {
+				t.Fatalf("expected sub to be a folder, got %v, %v", isDir, err)
+			}
+			if _, err := fsys.Stat("/docs/missing"); !os.IsNotExist(err) {
+				t.Fatalf("expected a missing file to not exist, got %v", err)
+			}
+
+			// Updating a file in place keeps the rest of it
+			f, err := fsys.OpenFile("/docs/a.txt", os.O_RDWR, 0)
+			if err != nil {
+				t.Fatalf("open for update: %v", err)
+			}
+			if _, err := f.WriteAt([]byte("EL"), 1); err != nil {
+				t.Fatalf("write at: %v", err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+
+			// Reads stream from any offset
+			f, err = fsys.Open("/docs/a.txt")
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			if _, err := f.Seek(2, io.SeekStart); err != nil {
+				t.Fatalf("seek: %v", err)
+			}
+			rest, err := io.ReadAll(f)
+			f.Close()
+			if err != nil || string(rest) != "Llo" {
+				t.Fatalf("expected Llo after seeking, got %q, %v", rest, err)
+			}
+
+			// The in-memory stand-in of the SFTP server leaves checking
+			// folders are empty to the real filesystem
+			if standIn.name != "sftp" {
+				if err := fsys.Remove("/docs/sub"); err == nil {
+					t.Fatal("expected removing a non-empty folder to fail")
+				}
+			}
+			if err := fsys.Rename("/docs/sub/b.txt", "/docs/a.txt"); err != nil {
+				t.Fatalf("rename over a file: %v", err)
+			}
+			if err := fsys.Rename("/docs", "/moved"); err != nil {
+				t.Fatalf("rename folder: %v", err)
+			}
+
+			// Everything reached the server
+			if err := fsys.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			tree, err := readTree(open(t, mount), "/")
+			if err != nil {
+				t.Fatalf("read tree: %v", err)
+			}
+			want := map[string]string{"/moved": "/", "/moved/a.txt": "world", "/moved/sub": "/"}
+			if fmt.Sprint(tree) != fmt.Sprint(want) {
+				t.Fatalf("expected %v on the server, got %v", want, tree)
+			}
+
+			fresh := open(t, mount)
+			if err := fresh.RemoveAll("/moved"); err != nil {
+				t.Fatalf("remove all: %v", err)
+			}
+			if err := fresh.RemoveAll("/moved"); err != nil {
+				t.Fatalf("expected removing a missing folder to succeed, got %v", err)
+			}
+			if exists, _ := fresh.Exists("/moved"); exists {
+				t.Fatal("expected the folder to be removed")
+			}
+		})
+	}
+}
+
+// TestRemoteWriteBack checks that a file written in several passes, as
+// the chunks of an upload are, is sent to an S3 or WebDAV server once
+func TestRemoteWriteBack(t *testing.T) {
+	mount, puts := startWebDAV(t)
+	fsys := open(t, mount)
+
+	f, err := fsys.OpenFile("/upload.bin", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(9); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	for i, chunk := range []string{"aaa", "bbb", "ccc"} {
+		f, err := fsys.OpenFile("/upload.bin", os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		if _, err := f.WriteAt([]byte(chunk), int64(i*3)); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		f.Close()
+	}
+
+	// Not sent yet, but visible
+	if n := puts.Load(); n != 0 {
+		t.Fatalf("expected nothing sent before the write back, got %d uploads", n)
+	}
+	entries, err := fsys.ReadDir("/")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "upload.bin" {
+		t.Fatalf("expected the file to be listed, got %v, %v", entries, err)
+	}
+
+	f, err = fsys.OpenFile("/upload.bin", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	f.Close()
+	if n := puts.Load(); n != 1 {
+		t.Fatalf("expected one upload after syncing, got %d", n)
+	}
+	if data, err := open(t, mount).ReadFile("/upload.bin"); err != nil || string(data) != "aaabbbccc" {
+		t.Fatalf("expected the chunks on the server, got %q, %v", data, err)
+	}
+
+	// Closing the filesystem writes back what is pending
+	if err := fsys.WriteFile("/late.txt", []byte("late"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if data, err := open(t, mount).ReadFile("/late.txt"); err != nil || string(data) != "late" {
+		t.Fatalf("expected the pending file on the server, got %q, %v", data, err)
+	}
+}
+
+// TestRemoteMountJobs checks that a move job from a local folder to a
+// remote mount point falls back to copying across the filesystems
+func TestRemoteMountJobs(t *testing.T) {
+	mount := startS3(t)
+	local := filesystem.NewMemMapFS()
+	local.WriteFile("/data/local/album/one.jpg", []byte("one"), 0644)
+	local.WriteFile("/data/local/album/two.jpg", []byte("two"), 0644)
+	fsys := filesystem.NewMountFS(local)
+	fsys.Mount("/remote-mounts/remote", open(t, mount))
+
+	svc := service.NewJobService(fsys, nil, service.JobServiceConfig{Workers: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	svc.Start(ctx)
+	defer svc.Stop()
+
+	job, err := svc.Create(ctx, model.JobParams{
+		Type:       model.JobTypeMove,
+		SourcePath: "/data/local/album",
+		DestPath:   "/remote-mounts/remote/album",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := job.ID; ; time.Sleep(20 * time.Millisecond) {
+		if job, err = svc.Get(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if job.State.IsTerminal() {
+			break
+		}
+	}
+	if job.State != model.JobStateCompleted {
+		t.Fatalf("expected the move to complete, got %s: %s", job.State, job.Error)
+	}
+
+	if exists, _ := local.Exists("/data/local/album"); exists {
+		t.Fatal("expected the local folder to be moved away")
+	}
+	tree, err := readTree(fsys, "/remote-mounts/remote")
+	want := map[string]string{
+		"/remote-mounts/remote/album":         "/",
+		"/remote-mounts/remote/album/one.jpg": "one",
+		"/remote-mounts/remote/album/two.jpg": "two",
+	}
+	if err != nil || fmt.Sprint(tree) != fmt.Sprint(want) {
+		t.Fatalf("expected %v on the remote mount, got %v, %v", want, tree, err)
+	}
+}
+
+// remoteOp is a change applied to a remote mount and a local reference
+type remoteOp struct {
+	Kind int // 0 write, 1 append, 2 rename, 3 remove, 4 remove folder
+	From int
+	To   int
+	Data string
+}
+
+// remoteFiles are the files the operations pick from
+var remoteFiles = []string{"/a.txt", "/b.txt", "/d0/c.txt", "/d0/d.txt", "/d1/e.txt"}
+
+// apply applies an operation, skipping those that do not apply to the
+// reference's current files
+func (op remoteOp) apply(fsys, reference filesystem.FS) error {
+	from, to := remoteFiles[op.From], remoteFiles[op.To]
+	fromExists, _ := reference.Exists(from)
+	switch op.Kind {
+	case 0:
+		if err := fsys.MkdirAll(path.Dir(from), 0755); err != nil {
+			return err
+		}
+		return fsys.WriteFile(from, []byte(op.Data), 0644)
+	case 1:
+		if !fromExists {
+			return nil
+		}
+		f, err := fsys.OpenFile(from, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte(op.Data))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	case 2:
+		toExists, _ := reference.Exists(to)
+		parentExists, _ := reference.Exists(path.Dir(to))
+		if !fromExists || toExists || !parentExists {
+			return nil
+		}
+		return fsys.Rename(from, to)
+	case 3:
+		if !fromExists {
+			return nil
+		}
+		return fsys.Remove(from)
+	default:
+		if path.Dir(from) == "/" {
+			return nil
+		}
+		return fsys.RemoveAll(path.Dir(from))
+	}
+}
+
+// **Feature: homelab-file-manager, Property 44: Remote Mount Round Trip**
+//
+// Property: For any sequence of writes, appends, renames and removals
+// applied to a remote mount point, the files on the server after the
+// filesystem is closed SHALL be those the same sequence leaves on a local
+// filesystem.
+func TestProperty_RemoteMountRoundTrip(t *testing.T) {
+	for _, standIn := range standIns {
+		t.Run(standIn.name, func(t *testing.T) {
+			mount := standIn.start(t)
+
+			parameters := gopter.DefaultTestParameters()
+			parameters.MinSuccessfulTests = 10
+			properties := gopter.NewProperties(parameters)
+
+			genOp := gopter.CombineGens(
+				gen.IntRange(0, 4),
+				gen.IntRange(0, len(remoteFiles)-1),
+				gen.IntRange(0, len(remoteFiles)-1),
+				gen.AlphaString(),
+			).Map(func(values []interface{}) remoteOp {
+				return remoteOp{Kind: values[0].(int), From: values[1].(int), To: values[2].(int), Data: values[3].(string)}
+			})
+
+			properties.Property("the server holds what a local filesystem would", prop.ForAll(
+				func(ops []remoteOp) bool {
+					fsys, err := New(mount)
+					if err != nil {
+						return false
+					}
+					reference := filesystem.NewMemMapFS()
+					for _, op := range ops {
+						if err := op.apply(fsys, reference); err != nil {
+							t.Logf("%+v: %v", op, err)
+							fsys.Close()
+							return false
+						}
+						if err := op.apply(reference, reference); err != nil {
+							fsys.Close()
+							return false
+						}
+					}
+					if err := fsys.Close(); err != nil {
+						return false
+					}
+
+					fresh, err := New(mount)
+					if err != nil {
+						return false
+					}
+					defer fresh.Close()
+					got, err := readTree(fresh, "/")
+					want, wantErr := readTree(reference, "/")
+					if err != nil || wantErr != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+						t.Logf("got %v, %v; want %v", got, err, want)
+						return false
+					}
+
+					// Start the next sequence from an empty folder
+					return fresh.RemoveAll("/d0") == nil && fresh.RemoveAll("/d1") == nil &&
+						fresh.RemoveAll("/a.txt") == nil && fresh.RemoveAll("/b.txt") == nil
+				},
+				gen.SliceOfN(8, genOp),
+			))
+
+			properties.TestingRun(t)
+		})
+	}
+}
+
+// TestRemoteMountErrors checks that bad options are refused and that an
+// unreachable server reports errors rather than hanging
+func TestRemoteMountErrors(t *testing.T) {
+	if _, err := New(model.MountPoint{Name: "x", Type: "ftp", Path: "/"}); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected an unknown type to be refused, got %v", err)
+	}
+	if _, err := New(model.MountPoint{Name: "x", Type: model.MountTypeS3, Path: "/", Options: map[string]string{"bucket": "b"}}); !errors.Is(err, ErrMissingOption) {
+		t.Fatalf("expected missing credentials to be refused, got %v", err)
+	}
+	if _, err := New(model.MountPoint{Name: "x", Type: model.MountTypeSFTP, Path: "/", Options: map[string]string{
+		"host": "localhost", "user": "alice", "password": "secret", "host_key": "not a key",
+	}}); !errors.Is(err, ErrInvalidHostKey) {
+		t.Fatalf("expected an invalid host key to be refused, got %v", err)
+	}
+
+	// Nothing listens on a port just closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	fsys := open(t, model.MountPoint{Name: "x", Type: model.MountTypeWebDAV, Path: "/", Options: map[string]string{"url": "http://" + addr}})
+	if _, err := fsys.Stat("/file"); err == nil || os.IsNotExist(err) {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+	if err := fsys.Rename("/a", "/a/b"); !errors.Is(err, syscall.EINVAL) && err == nil {
+		t.Fatal("expected renaming a folder into itself to fail")
+	}
+}
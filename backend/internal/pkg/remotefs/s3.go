@@ -0,0 +1,417 @@
+package remotefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/homelab/filemanager/internal/config"
+)
+
+// s3MaxCopySize is the largest object S3 copies in one request
+const s3MaxCopySize = 5 * 1024 * 1024 * 1024
+
+// s3Store is a store in an S3 bucket. Folders are key prefixes, and empty
+// folders are kept as objects whose key ends in a slash, as the AWS
+// console creates them.
+type s3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string // Key prefix of the root, empty or ending in a slash
+}
+
+// newS3Store creates the store of a mount point's folder in a bucket, from
+// the options bucket, access_key, secret_key and the optional endpoint
+// (for MinIO and other S3-compatible servers), region and path_style
+func newS3Store(root string, options map[string]string) (*s3Store, error) {
+	bucket, err := option(options, "bucket")
+	if err != nil {
+		return nil, err
+	}
+	accessKey, err := option(options, "access_key")
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := option(options, "secret_key")
+	if err != nil {
+		return nil, err
+	}
+	pathStyle, err := boolOption(options, "path_style")
+	if err != nil {
+		return nil, err
+	}
+	region := options["region"]
+	if region == "" {
+		region = config.S3Region
+	}
+
+	s3Options := s3.Options{
+		Region:       region,
+		Credentials:  credentials.NewStaticCredentialsProvider(accessKey, secretKey, ""),
+		UsePathStyle: pathStyle,
+		HTTPClient:   httpClient(),
+		// Checksums beyond Content-MD5 are not understood by every
+		// S3-compatible server
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	}
+	if endpoint := options["endpoint"]; endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: endpoint must be an http or https URL", ErrInvalidOption)
+		}
+		s3Options.BaseEndpoint = aws.String(endpoint)
+	}
+
+	prefix := strings.Trim(path.Clean("/"+root), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Store{client: s3.New(s3Options), bucket: bucket, prefix: prefix}, nil
+}
+
+// key returns the object key of a file
+func (s *s3Store) key(name string) string {
+	return s.prefix + strings.TrimPrefix(name, "/")
+}
+
+// dirKey returns the key prefix of the entries of a folder
+func (s *s3Store) dirKey(name string) string {
+	if name == "/" {
+		return s.prefix
+	}
+	return s.key(name) + "/"
+}
+
+// s3Error maps the errors for missing keys and refused access to their
+// fs counterparts
+func s3Error(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey":
+			return fs.ErrNotExist
+		case "AccessDenied", "Forbidden":
+			return fs.ErrPermission
+		}
+	}
+	return err
+}
+
+func (s *s3Store) stat(name string) (*fileInfo, error) {
+	if name == "/" {
+		return &fileInfo{name: "/", isDir: true}, nil
+	}
+	ctx := context.Background()
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &s.bucket, Key: aws.String(s.key(name))})
+	if err == nil {
+		return &fileInfo{name: path.Base(name), size: aws.ToInt64(head.ContentLength), modTime: aws.ToTime(head.LastModified)}, nil
+	}
+	if err = s3Error(err); !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// A folder is its marker, or any prefix with keys below it
+	head, err = s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &s.bucket, Key: aws.String(s.dirKey(name))})
+	if err == nil {
+		return &fileInfo{name: path.Base(name), isDir: true, modTime: aws.ToTime(head.LastModified)}, nil
+	}
+	if err = s3Error(err); !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	list, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  &s.bucket,
+		Prefix:  aws.String(s.dirKey(name)),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	if len(list.Contents) == 0 {
+		return nil, fs.ErrNotExist
+	}
+	return &fileInfo{name: path.Base(name), isDir: true}, nil
+}
+
+func (s *s3Store) list(name string) ([]*fileInfo, error) {
+	prefix := s.dirKey(name)
+	var infos []*fileInfo
+	found := name == "/"
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    &s.bucket,
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, s3Error(err)
+		}
+		for _, object := range page.Contents {
+			found = true
+			key := aws.ToString(object.Key)
+			if key == prefix {
+				continue // The folder's own marker
+			}
+			infos = append(infos, &fileInfo{
+				name:    strings.TrimPrefix(key, prefix),
+				size:    aws.ToInt64(object.Size),
+				modTime: aws.ToTime(object.LastModified),
+			})
+		}
+		for _, common := range page.CommonPrefixes {
+			found = true
+			dir := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(common.Prefix), prefix), "/")
+			if dir != "" {
+				infos = append(infos, &fileInfo{name: dir, isDir: true})
+			}
+		}
+	}
+	if !found {
+		// An empty folder is only its marker, which some servers leave
+		// out of listings of its own prefix
+		info, err := s.stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.isDir {
+			return nil, fs.ErrNotExist
+		}
+	}
+	return infos, nil
+}
+
+func (s *s3Store) read(name string, offset, length int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{Bucket: &s.bucket, Key: aws.String(s.key(name))}
+	switch {
+	case length > 0:
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	out, err := s.client.GetObject(context.Background(), input)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return out.Body, nil
+}
+
+func (s *s3Store) write(name string, r io.ReaderAt, size int64) error {
+	return s.upload(s.key(name), r, size)
+}
+
+// upload writes an object in one request, or in parts of
+// config.RemotePartSize or more when it is larger
+func (s *s3Store) upload(key string, r io.ReaderAt, size int64) error {
+	ctx := context.Background()
+	if size <= config.RemotePartSize {
+		_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        &s.bucket,
+			Key:           &key,
+			Body:          io.NewSectionReader(r, 0, size),
+			ContentLength: aws.Int64(size),
+		})
+		return s3Error(err)
+	}
+
+	partSize := max(int64(config.RemotePartSize), (size+config.S3MaxPartNumber-1)/config.S3MaxPartNumber)
+	upload, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: &s.bucket, Key: &key})
+	if err != nil {
+		return s3Error(err)
+	}
+	var parts []types.CompletedPart
+	for number, offset := int32(1), int64(0); offset < size; number, offset = number+1, offset+partSize {
+		length := min(partSize, size-offset)
+		part, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        &s.bucket,
+			Key:           &key,
+			UploadId:      upload.UploadId,
+			PartNumber:    aws.Int32(number),
+			Body:          io.NewSectionReader(r, offset, length),
+			ContentLength: aws.Int64(length),
+		})
+		if err != nil {
+			s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &s.bucket, Key: &key, UploadId: upload.UploadId})
+			return s3Error(err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(number)})
+	}
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.bucket,
+		Key:             &key,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &s.bucket, Key: &key, UploadId: upload.UploadId})
+	}
+	return s3Error(err)
+}
+
+func (s *s3Store) mkdir(name string) error {
+	_, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        &s.bucket,
+		Key:           aws.String(s.dirKey(name)),
+		Body:          strings.NewReader(""),
+		ContentLength: aws.Int64(0),
+	})
+	return s3Error(err)
+}
+
+// keepParent creates the marker of a folder that may have lost its last
+// entry, which would make it disappear
+func (s *s3Store) keepParent(name string) error {
+	if parent := path.Dir(name); parent != "/" {
+		return s.mkdir(parent)
+	}
+	return nil
+}
+
+func (s *s3Store) remove(name string, isDir bool) error {
+	key := s.key(name)
+	if isDir {
+		key = s.dirKey(name)
+	}
+	if _, err := s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: &s.bucket, Key: &key}); err != nil {
+		return s3Error(err)
+	}
+	return s.keepParent(name)
+}
+
+// keysBelow lists the keys of a folder and everything in it
+func (s *s3Store) keysBelow(name string) ([]types.Object, error) {
+	var objects []types.Object
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: aws.String(s.dirKey(name)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, s3Error(err)
+		}
+		objects = append(objects, page.Contents...)
+	}
+	return objects, nil
+}
+
+func (s *s3Store) removeAll(name string) error {
+	objects, err := s.keysBelow(name)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteKeys(objects); err != nil {
+		return err
+	}
+	// Servers that leave the marker out of listings of its own prefix
+	// still delete it by key
+	return s.remove(name, true)
+}
+
+// deleteKeys deletes objects, up to the listing size at a time
+func (s *s3Store) deleteKeys(objects []types.Object) error {
+	for len(objects) > 0 {
+		batch := objects[:min(len(objects), config.S3MaxKeys)]
+		objects = objects[len(batch):]
+		ids := make([]types.ObjectIdentifier, len(batch))
+		for i, object := range batch {
+			ids[i] = types.ObjectIdentifier{Key: object.Key}
+		}
+		out, err := s.client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: &s.bucket,
+			Delete: &types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return s3Error(err)
+		}
+		if len(out.Errors) > 0 {
+			failed := out.Errors[0]
+			return fmt.Errorf("delete %s: %s", aws.ToString(failed.Key), aws.ToString(failed.Message))
+		}
+	}
+	return nil
+}
+
+// rename copies the keys of a file, or of a folder and everything in it,
+// and then deletes the originals
+func (s *s3Store) rename(oldname, newname string, isDir bool) error {
+	if !isDir {
+		head, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: &s.bucket, Key: aws.String(s.key(oldname))})
+		if err != nil {
+			return s3Error(err)
+		}
+		if err := s.copy(s.key(oldname), s.key(newname), aws.ToInt64(head.ContentLength)); err != nil {
+			return err
+		}
+		return s.remove(oldname, false)
+	}
+
+	objects, err := s.keysBelow(oldname)
+	if err != nil {
+		return err
+	}
+	oldPrefix, newPrefix := s.dirKey(oldname), s.dirKey(newname)
+	for _, object := range objects {
+		key := aws.ToString(object.Key)
+		if err := s.copy(key, newPrefix+strings.TrimPrefix(key, oldPrefix), aws.ToInt64(object.Size)); err != nil {
+			return err
+		}
+	}
+	if err := s.deleteKeys(objects); err != nil {
+		return err
+	}
+	return s.keepParent(oldname)
+}
+
+// copy copies an object within the bucket. Objects too large for a copy
+// request, and those on servers that cannot copy, are downloaded and
+// uploaded again.
+func (s *s3Store) copy(src, dst string, size int64) error {
+	if size <= s3MaxCopySize {
+		_, err := s.client.CopyObject(context.Background(), &s3.CopyObjectInput{
+			Bucket:     &s.bucket,
+			Key:        &dst,
+			CopySource: aws.String(url.PathEscape(s.bucket) + "/" + escapeKey(src)),
+		})
+		var apiErr smithy.APIError
+		if err == nil || !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NotImplemented" {
+			return s3Error(err)
+		}
+	}
+
+	f, err := os.CreateTemp("", "remotefs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: &s.bucket, Key: &src})
+	if err != nil {
+		return s3Error(err)
+	}
+	n, err := io.Copy(f, out.Body)
+	out.Body.Close()
+	if err != nil {
+		return err
+	}
+	return s.upload(dst, f, n)
+}
+
+// escapeKey percent-encodes the segments of a key
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,336 @@
+package remotefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpFs implements afero.Fs over SFTP. It connects on first use, and
+// again after the connection is lost.
+type sftpFs struct {
+	root string
+	addr string
+	ssh  *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *sftp.Client
+	closed bool
+}
+
+// newSFTPFs creates the filesystem of a mount point's folder on an SFTP
+// server, from the options host (with an optional port), user, host_key
+// (the server's public key as in known_hosts, without the host name), and
+// password or key_file (a private key without passphrase)
+func newSFTPFs(root string, options map[string]string) (*sftpFs, error) {
+	host, err := option(options, "host")
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	user, err := option(options, "user")
+	if err != nil {
+		return nil, err
+	}
+	hostKeyLine, err := option(options, "host_key")
+	if err != nil {
+		return nil, err
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKeyLine))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHostKey, err)
+	}
+
+	var auth []ssh.AuthMethod
+	if keyFile := options["key_file"]; keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key_file: %v", ErrInvalidOption, err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key_file: %v", ErrInvalidOption, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password := options["password"]; password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("%w: password or key_file", ErrMissingOption)
+	}
+
+	return &sftpFs{
+		root: path.Clean(filepath.ToSlash(root)),
+		addr: host,
+		ssh: &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: ssh.FixedHostKey(hostKey),
+			Timeout:         config.RemoteTimeout,
+		},
+	}, nil
+}
+
+// connect returns the SFTP session, logging in if there is none
+func (s *sftpFs) connect() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, net.ErrClosed
+	}
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	conn, err := ssh.Dial("tcp", s.addr, s.ssh)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.client = client
+
+	// Forget the session once the connection is lost
+	go func() {
+		client.Wait()
+		conn.Close()
+		s.mu.Lock()
+		if s.client == client {
+			s.client = nil
+		}
+		s.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// path returns the path of a file on the server
+func (s *sftpFs) path(name string) string {
+	return path.Join(s.root, filepath.ToSlash(name))
+}
+
+// Name returns the name of the filesystem
+func (s *sftpFs) Name() string {
+	return "sftpFs"
+}
+
+// Create creates or truncates the named file
+func (s *sftpFs) Create(name string) (afero.File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+// Open opens the named file or folder for reading
+func (s *sftpFs) Open(name string) (afero.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file. Folders can only be opened for reading, to list
+// them.
+func (s *sftpFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	p := s.path(name)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		info, err := client.Stat(p)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		if info.IsDir() {
+			return &dirFile{name: name, info: info, list: func() ([]os.FileInfo, error) { return client.ReadDir(p) }}, nil
+		}
+	}
+	f, err := client.OpenFile(p, flag)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	// Servers may ignore the append flag, so start writing at the end
+	if flag&os.O_APPEND != 0 {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return &sftpFile{File: f, client: client, name: name}, nil
+}
+
+// Stat describes the named file or folder
+func (s *sftpFs) Stat(name string) (os.FileInfo, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return client.Stat(s.path(name))
+}
+
+// Mkdir creates a folder
+func (s *sftpFs) Mkdir(name string, perm os.FileMode) error {
+	client, err := s.connect()
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return client.Mkdir(s.path(name))
+}
+
+// MkdirAll creates a folder and any missing parents
+func (s *sftpFs) MkdirAll(name string, perm os.FileMode) error {
+	client, err := s.connect()
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return client.MkdirAll(s.path(name))
+}
+
+// Remove removes a file or an empty folder
+func (s *sftpFs) Remove(name string) error {
+	client, err := s.connect()
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return client.Remove(s.path(name))
+}
+
+// RemoveAll removes a file or a folder with everything in it. Symbolic
+// links are removed, not followed. A missing file is not an error.
+func (s *sftpFs) RemoveAll(name string) error {
+	client, err := s.connect()
+	if err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	err = removeAll(client, s.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// removeAll removes a file or folder depth first
+func removeAll(client *sftp.Client, p string) error {
+	info, err := client.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return client.Remove(p)
+	}
+	entries, err := client.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := removeAll(client, path.Join(p, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return client.RemoveDirectory(p)
+}
+
+// Rename moves a file or folder, replacing a file at newname
+func (s *sftpFs) Rename(oldname, newname string) error {
+	client, err := s.connect()
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	oldpath, newpath := s.path(oldname), s.path(newname)
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(oldpath, newpath)
+	}
+	// Plain SFTP renames never replace files
+	if info, err := client.Lstat(newpath); err == nil && !info.IsDir() {
+		if err := client.Remove(newpath); err != nil {
+			return err
+		}
+	}
+	return client.Rename(oldpath, newpath)
+}
+
+// Chmod changes the mode of the named file
+func (s *sftpFs) Chmod(name string, mode os.FileMode) error {
+	client, err := s.connect()
+	if err != nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	return client.Chmod(s.path(name), mode)
+}
+
+// Chown changes the numeric uid and gid of the named file
+func (s *sftpFs) Chown(name string, uid, gid int) error {
+	client, err := s.connect()
+	if err != nil {
+		return &fs.PathError{Op: "chown", Path: name, Err: err}
+	}
+	return client.Chown(s.path(name), uid, gid)
+}
+
+// Chtimes changes the access and modification times of the named file
+func (s *sftpFs) Chtimes(name string, atime, mtime time.Time) error {
+	client, err := s.connect()
+	if err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	return client.Chtimes(s.path(name), atime, mtime)
+}
+
+// Close closes the connection. The filesystem cannot be used afterwards.
+func (s *sftpFs) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
+
+// sftpFile is a file open on the server
+type sftpFile struct {
+	*sftp.File
+	client *sftp.Client
+	name   string
+}
+
+func (f *sftpFile) Name() string {
+	return f.name
+}
+
+func (f *sftpFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *sftpFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *sftpFile) Readdirnames(n int) ([]string, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+// Sync flushes the file to disk on servers that support it, and is a
+// no-op on others
+func (f *sftpFile) Sync() error {
+	if _, ok := f.client.HasExtension("fsync@openssh.com"); ok {
+		return f.File.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package remotefs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// propfindBody asks for the properties a store describes files with
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+// davStore is a store in a folder of a WebDAV server
+type davStore struct {
+	client   *http.Client
+	base     url.URL // The root folder, its path ending in a slash
+	user     string
+	password string
+}
+
+// newDAVStore creates the store of a mount point's folder on a WebDAV
+// server, from the options url and the optional user and password
+func newDAVStore(root string, options map[string]string) (*davStore, error) {
+	rawURL, err := option(options, "url")
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(rawURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an http or https URL", ErrInvalidOption)
+	}
+	base.Path = strings.TrimSuffix(path.Join("/", base.Path, root), "/") + "/"
+	base.RawPath, base.RawQuery, base.Fragment = "", "", ""
+
+	client := httpClient()
+	// Redirects of WebDAV methods cannot be followed as GET
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &davStore{client: client, base: *base, user: options["user"], password: options["password"]}, nil
+}
+
+// url returns the URL of a file, or of a folder with a trailing slash
+func (d *davStore) url(name string, dir bool) string {
+	u := d.base
+	u.Path += strings.TrimPrefix(name, "/")
+	if dir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+// do sends a request; headers are given as name, value pairs
+func (d *davStore) do(method, target string, body io.Reader, size int64, headers ...string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if d.user != "" {
+		req.SetBasicAuth(d.user, d.password)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return d.client.Do(req)
+}
+
+// check closes a response and returns its error unless its status is one
+// of ok
+func check(resp *http.Response, ok ...int) error {
+	defer resp.Body.Close()
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return statusError(resp)
+}
+
+// statusError maps an unexpected response status to an error
+func statusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusConflict:
+		return fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fs.ErrPermission
+	case http.StatusMethodNotAllowed, http.StatusPreconditionFailed:
+		return fs.ErrExist
+	}
+	return fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status)
+}
+
+// multistatus is the response to PROPFIND
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind describes a file or folder, and the entries of a folder when
+// depth is 1. The entries are keyed by their unescaped path.
+func (d *davStore) propfind(name string, dir bool, depth string) (map[string]*fileInfo, error) {
+	resp, err := d.do("PROPFIND", d.url(name, dir), strings.NewReader(propfindBody), int64(len(propfindBody)),
+		"Depth", depth, "Content-Type", "application/xml; charset=utf-8")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusMultiStatus:
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		// Servers redirect folders named without a trailing slash
+		if !dir {
+			return d.propfind(name, true, depth)
+		}
+		return nil, statusError(resp)
+	default:
+		return nil, statusError(resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: %w", name, err)
+	}
+	infos := make(map[string]*fileInfo, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		p := path.Clean("/" + href.Path)
+		for _, propstat := range r.Propstats {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			prop := propstat.Prop
+			info := &fileInfo{name: path.Base(p), isDir: prop.ResourceType.Collection != nil}
+			info.size, _ = strconv.ParseInt(prop.ContentLength, 10, 64)
+			info.modTime, _ = time.Parse(http.TimeFormat, prop.LastModified)
+			infos[p] = info
+		}
+	}
+	return infos, nil
+}
+
+// path returns the unescaped path of a file on the server
+func (d *davStore) path(name string) string {
+	return path.Clean(d.base.Path + strings.TrimPrefix(name, "/"))
+}
+
+func (d *davStore) stat(name string) (*fileInfo, error) {
+	infos, err := d.propfind(name, name == "/", "0")
+	if err != nil {
+		return nil, err
+	}
+	info := infos[d.path(name)]
+	if info == nil {
+		return nil, fs.ErrNotExist
+	}
+	info.name = path.Base(name)
+	return info, nil
+}
+
+func (d *davStore) list(name string) ([]*fileInfo, error) {
+	infos, err := d.propfind(name, true, "1")
+	if err != nil {
+		return nil, err
+	}
+	self := d.path(name)
+	list := make([]*fileInfo, 0, len(infos))
+	for p, info := range infos {
+		if p != self && path.Dir(p) == self {
+			list = append(list, info)
+		}
+	}
+	return list, nil
+}
+
+func (d *davStore) read(name string, offset, length int64) (io.ReadCloser, error) {
+	var headers []string
+	switch {
+	case length > 0:
+		headers = []string{"Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}
+	case offset > 0:
+		headers = []string{"Range", fmt.Sprintf("bytes=%d-", offset)}
+	}
+	resp, err := d.do(http.MethodGet, d.url(name, false), nil, 0, headers...)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// The server ignored the range
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if length > 0 {
+			return struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(resp.Body, length), resp.Body}, nil
+		}
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+	return nil, statusError(resp)
+}
+
+func (d *davStore) write(name string, r io.ReaderAt, size int64) error {
+	resp, err := d.do(http.MethodPut, d.url(name, false), io.NewSectionReader(r, 0, size), size)
+	if err != nil {
+		return err
+	}
+	return check(resp, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+func (d *davStore) mkdir(name string) error {
+	resp, err := d.do("MKCOL", d.url(name, true), nil, 0)
+	if err != nil {
+		return err
+	}
+	return check(resp, http.StatusCreated)
+}
+
+func (d *davStore) remove(name string, isDir bool) error {
+	resp, err := d.do(http.MethodDelete, d.url(name, isDir), nil, 0)
+	if err != nil {
+		return err
+	}
+	return check(resp, http.StatusOK, http.StatusNoContent)
+}
+
+func (d *davStore) removeAll(name string) error {
+	return d.remove(name, true)
+}
+
+func (d *davStore) rename(oldname, newname string, isDir bool) error {
+	resp, err := d.do("MOVE", d.url(oldname, isDir), nil, 0,
+		"Destination", d.url(newname, isDir), "Overwrite", "T")
+	if err != nil {
+		return err
+	}
+	return check(resp, http.StatusCreated, http.StatusNoContent)
+}
@@ -0,0 +1,438 @@
+package s3
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+)
+
+// Signature Version 4 constants
+const (
+	signAlgorithm      = "AWS4-HMAC-SHA256"
+	chunkSignAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	amzDateFormat      = "20060102T150405Z"
+	emptySHA256        = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// Values of x-amz-content-sha256 other than the body's hash
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingPayloadTrailer  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	// maxChunkHeader is the longest chunk header line of a streamed body
+	maxChunkHeader = 4096
+)
+
+// Key is an access key's secret and the user it signs requests as
+type Key struct {
+	User   string
+	Secret string
+}
+
+// signature is a verified request signature. The signatures of a streamed
+// body's chunks are chained to it.
+type signature struct {
+	user       string
+	signingKey []byte
+	amzDate    string
+	scope      string
+	seed       string // Hex signature of the request
+	payload    string // x-amz-content-sha256, or UNSIGNED-PAYLOAD for presigned URLs
+}
+
+// authenticate verifies a request signed in the Authorization header or
+// presigned in the query string. Failed signatures count towards the
+// per-IP rate limit.
+func (g *Gateway) authenticate(r *http.Request) (*signature, error) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	// Refuse before checking, so guesses past the limit reveal nothing
+	if g.limiter.Blocked(ip) {
+		return nil, errSlowDown
+	}
+
+	query := r.URL.Query()
+	var sig *signature
+	switch {
+	case r.Header.Get("Authorization") != "":
+		sig, err = g.verifyHeader(r)
+	case query.Has("X-Amz-Signature"):
+		sig, err = g.verifyQuery(r, query)
+	case query.Has("Signature") || query.Has("AWSAccessKeyId"):
+		return nil, errUnsupportedSignature
+	default:
+		return nil, errAnonymous
+	}
+	if err == errInvalidAccessKeyID || err == errSignatureMismatch {
+		g.limiter.Allow(ip)
+	}
+	return sig, err
+}
+
+// verifyHeader verifies a request signed in its Authorization header
+func (g *Gateway) verifyHeader(r *http.Request) (*signature, error) {
+	algorithm, fields, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if algorithm != signAlgorithm {
+		return nil, errUnsupportedSignature
+	}
+	params := make(map[string]string)
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		params[name] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		date, err := http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			return nil, errMissingDate
+		}
+		amzDate = date.UTC().Format(amzDateFormat)
+	}
+	signed, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return nil, errMissingDate
+	}
+	if skew := time.Since(signed); skew > config.S3MaxClockSkew || skew < -config.S3MaxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		return nil, errMissingContentSHA256
+	}
+	return g.verify(r, params["Credential"], params["SignedHeaders"], params["Signature"], amzDate, payload, false)
+}
+
+// verifyQuery verifies a presigned URL
+func (g *Gateway) verifyQuery(r *http.Request, query url.Values) (*signature, error) {
+	if query.Get("X-Amz-Algorithm") != signAlgorithm {
+		return nil, errUnsupportedSignature
+	}
+	amzDate := query.Get("X-Amz-Date")
+	signed, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return nil, errMissingDate
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || time.Duration(expires)*time.Second > config.S3MaxPresignExpiry {
+		return nil, errInvalidExpires
+	}
+	if time.Since(signed) < -config.S3MaxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+	if time.Since(signed) > time.Duration(expires)*time.Second {
+		return nil, errPresignExpired
+	}
+
+	return g.verify(r, query.Get("X-Amz-Credential"), query.Get("X-Amz-SignedHeaders"), query.Get("X-Amz-Signature"), amzDate, unsignedPayload, true)
+}
+
+// verify checks a request's signature against the one computed with the
+// secret of the credential's access key
+func (g *Gateway) verify(r *http.Request, credential, signedHeaders, provided, amzDate, payload string, presigned bool) (*signature, error) {
+	// Credential is the access key and the scope: date/region/service/aws4_request
+	accessKey, scope, _ := strings.Cut(credential, "/")
+	scopeParts := strings.Split(scope, "/")
+	if len(scopeParts) != 4 || scopeParts[0] != amzDate[:8] || scopeParts[2] != "s3" || scopeParts[3] != "aws4_request" {
+		return nil, errAuthorizationMalformed
+	}
+	headers := strings.Split(signedHeaders, ";")
+	if provided == "" || !slices.Contains(headers, "host") {
+		return nil, errAuthorizationMalformed
+	}
+	key, ok := g.keys[accessKey]
+	if !ok {
+		return nil, errInvalidAccessKeyID
+	}
+
+	signingKey := []byte("AWS4" + key.Secret)
+	for _, part := range scopeParts {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	canonical := canonicalRequest(r, headers, payload, presigned)
+	stringToSign := strings.Join([]string{signAlgorithm, amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(provided)) {
+		return nil, errSignatureMismatch
+	}
+
+	return &signature{
+		user:       key.User,
+		signingKey: signingKey,
+		amzDate:    amzDate,
+		scope:      scope,
+		seed:       expected,
+		payload:    payload,
+	}, nil
+}
+
+// canonicalRequest builds the canonical form of a request that is signed
+func canonicalRequest(r *http.Request, signedHeaders []string, payload string, presigned bool) string {
+	query := r.URL.Query()
+	if presigned {
+		query.Del("X-Amz-Signature")
+	}
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, escape(name, false)+"="+escape(value, false))
+		}
+	}
+	sort.Strings(params)
+
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = r.Header.Get("Content-Length")
+			if value == "" && r.ContentLength >= 0 {
+				value = strconv.FormatInt(r.ContentLength, 10)
+			}
+		default:
+			values := r.Header.Values(name)
+			for i, v := range values {
+				values[i] = strings.Join(strings.Fields(v), " ")
+			}
+			value = strings.Join(values, ",")
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		escape(r.URL.Path, true),
+		strings.Join(params, "&"),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payload,
+	}, "\n")
+}
+
+// escape percent-encodes everything but the unreserved characters, and the
+// slashes of a path if keepSlash is set, as Signature Version 4 requires
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return b.String()
+}
+
+// body returns a request's body, checked against its signed payload hash,
+// and the size of the content it carries. Streamed bodies are decoded.
+func (sig *signature) body(r *http.Request) (io.Reader, int64, error) {
+	switch sig.payload {
+	case streamingPayload, streamingPayloadTrailer, streamingUnsignedTrailer:
+		size, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil || size < 0 {
+			return nil, 0, errMissingContentLength
+		}
+		reader := &chunkedReader{
+			r:        bufio.NewReader(r.Body),
+			trailer:  sig.payload != streamingPayload,
+			previous: sig.seed,
+			hash:     sha256.New(),
+		}
+		if sig.payload != streamingUnsignedTrailer {
+			reader.sig = sig
+		}
+		return reader, size, nil
+	}
+
+	if r.ContentLength < 0 {
+		return nil, 0, errMissingContentLength
+	}
+	if sig.payload == unsignedPayload {
+		return r.Body, r.ContentLength, nil
+	}
+	return &hashingReader{r: r.Body, hash: sha256.New(), want: sig.payload}, r.ContentLength, nil
+}
+
+// hashingReader fails at the end of a body whose SHA-256 is not the signed
+// one
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	want string
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != h.want {
+		return n, errContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes an aws-chunked body, verifying the signature of
+// each chunk when they are signed. Trailing checksums are read but not
+// checked.
+type chunkedReader struct {
+	r         *bufio.Reader
+	sig       *signature // nil for unsigned chunks
+	trailer   bool
+	previous  string // Signature of the previous chunk
+	chunkSig  string
+	remaining int64
+	hash      hash.Hash
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+		if c.remaining == 0 {
+			c.err = io.EOF
+			return 0, io.EOF
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	c.remaining -= int64(n)
+	if err == io.EOF {
+		err = errIncompleteBody
+	}
+	if err == nil && c.remaining == 0 {
+		err = c.endChunk()
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads the header of the next chunk. The final, empty chunk is
+// verified and followed by the trailer, if any.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, extension, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 {
+		return errIncompleteBody
+	}
+	if c.sig != nil {
+		chunkSig, ok := strings.CutPrefix(extension, "chunk-signature=")
+		if !ok {
+			return errSignatureMismatch
+		}
+		c.chunkSig = chunkSig
+	}
+	c.remaining = size
+	c.hash.Reset()
+	if size > 0 {
+		return nil
+	}
+
+	if err := c.verifyChunk(); err != nil {
+		return err
+	}
+	// The trailer ends with an empty line, as does a body without one
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil
+		}
+		if !c.trailer {
+			return errIncompleteBody
+		}
+	}
+}
+
+// endChunk reads the line break after a chunk's data and verifies it
+func (c *chunkedReader) endChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return errIncompleteBody
+	}
+	return c.verifyChunk()
+}
+
+// verifyChunk checks the signature of the chunk just read, which is chained
+// to the previous chunk's
+func (c *chunkedReader) verifyChunk() error {
+	if c.sig == nil {
+		return nil
+	}
+	stringToSign := strings.Join([]string{
+		chunkSignAlgorithm, c.sig.amzDate, c.sig.scope, c.previous, emptySHA256, hex.EncodeToString(c.hash.Sum(nil)),
+	}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(c.sig.signingKey, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(c.chunkSig)) {
+		return errSignatureMismatch
+	}
+	c.previous = expected
+	return nil
+}
+
+// readLine reads a line ending in CRLF, without the line break
+func (c *chunkedReader) readLine() (string, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := c.r.ReadLine()
+		if err != nil {
+			return "", errIncompleteBody
+		}
+		line = append(line, part...)
+		if len(line) > maxChunkHeader {
+			return "", errIncompleteBody
+		}
+		if !isPrefix {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+	}
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sha256Hex returns the hex SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,479 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+)
+
+// multipartUpload is an unfinished multipart upload. Its parts are stored
+// in the uploads directory until it is completed or aborted.
+type multipartUpload struct {
+	ID           string       `json:"id"`
+	Bucket       string       `json:"bucket"`
+	Key          string       `json:"key"`
+	Owner        string       `json:"owner"`
+	Parts        map[int]part `json:"parts"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	LastActivity time.Time    `json:"lastActivity"`
+
+	// Set while the upload is being completed, which refuses new parts
+	completing bool
+}
+
+// part is an uploaded part of a multipart upload
+type part struct {
+	ETag string `json:"etag"` // Hex MD5 of the part
+	Size int64  `json:"size"`
+}
+
+// size returns the total size of the upload's parts
+func (u *multipartUpload) size() int64 {
+	var total int64
+	for _, p := range u.Parts {
+		total += p.Size
+	}
+	return total
+}
+
+// multipartStore keeps the unfinished multipart uploads, one record and one
+// folder of parts per upload, so that uploads survive restarts. Uploads
+// inactive for longer than an upload session are removed.
+type multipartStore struct {
+	fs      filesystem.FS
+	dir     string
+	mu      sync.Mutex
+	loaded  bool
+	uploads map[string]*multipartUpload
+}
+
+// newMultipartStore creates a multipart upload store persisted in dir
+func newMultipartStore(fsys filesystem.FS, dir string) *multipartStore {
+	return &multipartStore{
+		fs:      fsys,
+		dir:     dir,
+		uploads: make(map[string]*multipartUpload),
+	}
+}
+
+// create starts a multipart upload of a key owned by a user. Expired
+// uploads are removed first.
+func (s *multipartStore) create(bucket, key, owner string) (*multipartUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.sweep()
+
+	now := time.Now()
+	upload := &multipartUpload{
+		ID:           uuid.New().String(),
+		Bucket:       bucket,
+		Key:          key,
+		Owner:        owner,
+		Parts:        make(map[int]part),
+		CreatedAt:    now,
+		LastActivity: now,
+	}
+	if err := s.fs.MkdirAll(s.partsDir(upload.ID), 0755); err != nil {
+		return nil, err
+	}
+	if err := s.save(upload); err != nil {
+		s.fs.RemoveAll(s.partsDir(upload.ID))
+		return nil, err
+	}
+	s.uploads[upload.ID] = upload
+	return upload, nil
+}
+
+// get returns an upload of the key owned by the user. Other users' uploads
+// do not exist for them.
+func (s *multipartStore) get(id, bucket, key, owner string) (*multipartUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	upload, ok := s.uploads[id]
+	if !ok || upload.Bucket != bucket || upload.Key != key || upload.Owner != owner {
+		return nil, errNoSuchUpload
+	}
+	return upload, nil
+}
+
+// addPart records a part whose data was written to tempPath, replacing a
+// part with the same number
+func (s *multipartStore) addPart(upload *multipartUpload, number int, tempPath string, p part) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.uploads[upload.ID] != upload {
+		return errNoSuchUpload
+	}
+	if upload.completing {
+		return errConflict
+	}
+	if err := s.fs.Rename(tempPath, s.partPath(upload.ID, number)); err != nil {
+		return err
+	}
+	upload.Parts[number] = p
+	upload.LastActivity = time.Now()
+	return s.save(upload)
+}
+
+// claim marks an upload as being completed or aborted, which only one
+// request may do
+func (s *multipartStore) claim(upload *multipartUpload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.uploads[upload.ID] != upload {
+		return errNoSuchUpload
+	}
+	if upload.completing {
+		return errConflict
+	}
+	upload.completing = true
+	return nil
+}
+
+// release undoes a claim whose completion failed
+func (s *multipartStore) release(upload *multipartUpload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload.completing = false
+}
+
+// remove deletes an upload and its parts
+func (s *multipartStore) remove(upload *multipartUpload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(upload.ID)
+}
+
+// removeLocked deletes an upload and its parts. The caller must hold mu.
+func (s *multipartStore) removeLocked(id string) {
+	delete(s.uploads, id)
+	s.fs.RemoveAll(s.partsDir(id))
+	s.fs.Remove(s.recordPath(id))
+}
+
+// sweep removes the uploads inactive for longer than an upload session. The
+// caller must hold mu.
+func (s *multipartStore) sweep() {
+	for id, upload := range s.uploads {
+		if !upload.completing && time.Since(upload.LastActivity) > config.SessionTimeout {
+			s.removeLocked(id)
+		}
+	}
+}
+
+// partsDir returns the folder holding an upload's parts
+func (s *multipartStore) partsDir(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+// partPath returns the file holding a part
+func (s *multipartStore) partPath(id string, number int) string {
+	return filepath.Join(s.dir, id, strconv.Itoa(number))
+}
+
+// recordPath returns the file recording an upload
+func (s *multipartStore) recordPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// load reads the upload records on first use. The caller must hold mu.
+func (s *multipartStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	exists, err := s.fs.Exists(s.dir)
+	if err != nil {
+		return err
+	}
+	if exists {
+		entries, err := s.fs.ReadDir(s.dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+				continue
+			}
+			data, err := s.fs.ReadFile(filepath.Join(s.dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+			var upload multipartUpload
+			if err := json.Unmarshal(data, &upload); err != nil || upload.ID+".json" != entry.Name() {
+				continue
+			}
+			if upload.Parts == nil {
+				upload.Parts = make(map[int]part)
+			}
+			s.uploads[upload.ID] = &upload
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// save writes an upload's record. The caller must hold mu.
+func (s *multipartStore) save(upload *multipartUpload) error {
+	data, err := json.MarshalIndent(upload, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(s.recordPath(upload.ID), data, 0644)
+}
+
+// createMultipartUpload starts a multipart upload
+func (g *Gateway) createMultipartUpload(w http.ResponseWriter, r *request) {
+	if err := writable(r); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	if _, err := g.resolve(r, r.key); err != nil || strings.HasSuffix(r.key, "/") {
+		writeError(w, r.Request, errInvalidKey)
+		return
+	}
+
+	upload, err := g.multipart.create(r.bucket, r.key, r.user)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Bucket:   r.bucket,
+		Key:      r.key,
+		UploadID: upload.ID,
+	})
+}
+
+// uploadPart stores a part of a multipart upload. The parts of an upload
+// together may not exceed the maximum upload size.
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *request, id, partNumber string) {
+	number, err := strconv.Atoi(partNumber)
+	if err != nil || number < 1 || number > config.S3MaxPartNumber {
+		writeError(w, r.Request, errInvalidArgument)
+		return
+	}
+	upload, err := g.multipart.get(id, r.bucket, r.key, r.user)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	body, size, err := r.sig.body(r.Request)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	if g.maxUpload > 0 && g.partsSize(upload, number)+size > g.maxUpload {
+		writeError(w, r.Request, errEntityTooLarge)
+		return
+	}
+	wantMD5, err := contentMD5(r.Request)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+
+	// Parts are written beside their final name, so that a failed upload
+	// leaves the previous part with the same number intact
+	tempPath := g.multipart.partPath(upload.ID, number) + ".uploading." + uuid.New().String()
+	f, err := g.fs.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	f.Close()
+	hash := md5.New()
+	if err := g.copyExactly(tempPath, io.TeeReader(body, hash), size); err != nil {
+		g.fs.Remove(tempPath)
+		writeError(w, r.Request, err)
+		return
+	}
+	sum := hash.Sum(nil)
+	if wantMD5 != nil && !bytes.Equal(sum, wantMD5) {
+		g.fs.Remove(tempPath)
+		writeError(w, r.Request, errBadDigest)
+		return
+	}
+
+	if err := g.multipart.addPart(upload, number, tempPath, part{ETag: hex.EncodeToString(sum), Size: size}); err != nil {
+		g.fs.Remove(tempPath)
+		writeError(w, r.Request, err)
+		return
+	}
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum)+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// partsSize returns the total size of an upload's parts other than number
+func (g *Gateway) partsSize(upload *multipartUpload, number int) int64 {
+	g.multipart.mu.Lock()
+	defer g.multipart.mu.Unlock()
+
+	return upload.size() - upload.Parts[number].Size
+}
+
+// completeMultipartUpload joins the listed parts into the object. Every
+// part but the last must be at least 5 MiB. The object's ETag is the MD5 of
+// the parts' MD5s followed by the number of parts, as in S3.
+func (g *Gateway) completeMultipartUpload(w http.ResponseWriter, r *request, id string) {
+	if err := writable(r); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	fsPath, err := g.resolve(r, r.key)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	upload, err := g.multipart.get(id, r.bucket, r.key, r.user)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	body, _, err := r.sig.body(r.Request)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	var complete completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(body, config.S3MaxXMLBody)).Decode(&complete); err != nil || len(complete.Parts) == 0 {
+		writeError(w, r.Request, errMalformedXML)
+		return
+	}
+
+	if err := g.multipart.claim(upload); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	sum, err := g.joinParts(r, upload, complete.Parts, fsPath)
+	if err != nil {
+		g.multipart.release(upload)
+		writeError(w, r.Request, err)
+		return
+	}
+	g.multipart.remove(upload)
+
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Location: "/" + r.bucket + "/" + r.key,
+		Bucket:   r.bucket,
+		Key:      r.key,
+		ETag:     fmt.Sprintf(`"%x-%d"`, sum, len(complete.Parts)),
+	})
+}
+
+// joinParts checks the listed parts against the uploaded ones and writes
+// them to fsPath through the upload manager. It returns the MD5 of the
+// parts' MD5s. The caller must have claimed the upload.
+func (g *Gateway) joinParts(r *request, upload *multipartUpload, listed []completedPart, fsPath string) ([]byte, error) {
+	var total int64
+	var readers []io.Reader
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+
+	for i := 1; i < len(listed); i++ {
+		if listed[i].PartNumber <= listed[i-1].PartNumber {
+			return nil, errInvalidPartOrder
+		}
+	}
+
+	etags := md5.New()
+	for i, listedPart := range listed {
+		p, ok := upload.Parts[listedPart.PartNumber]
+		if !ok || strings.Trim(listedPart.ETag, `"`) != p.ETag {
+			return nil, errInvalidPart
+		}
+		if i < len(listed)-1 && p.Size < config.S3MinPartSize {
+			return nil, errEntityTooSmall
+		}
+		sum, _ := hex.DecodeString(p.ETag)
+		etags.Write(sum)
+
+		f, err := g.fs.Open(g.multipart.partPath(upload.ID, listedPart.PartNumber))
+		if err != nil {
+			return nil, errInvalidPart
+		}
+		closers = append(closers, f)
+		readers = append(readers, f)
+		total += p.Size
+	}
+
+	if _, err := g.writeObject(r, fsPath, io.MultiReader(readers...), total, nil); err != nil {
+		return nil, err
+	}
+	return etags.Sum(nil), nil
+}
+
+// abortMultipartUpload discards a multipart upload and its parts
+func (g *Gateway) abortMultipartUpload(w http.ResponseWriter, r *request, id string) {
+	upload, err := g.multipart.get(id, r.bucket, r.key, r.user)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	if err := g.multipart.claim(upload); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	g.multipart.remove(upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// initiateMultipartUploadResult is the response to CreateMultipartUpload
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// completedPart is a part listed to complete a multipart upload
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// completeMultipartUpload is the body of CompleteMultipartUpload
+type completeMultipartUpload struct {
+	Parts []completedPart `xml:"Part"`
+}
+
+// completeMultipartUploadResult is the response to CompleteMultipartUpload
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
@@ -0,0 +1,581 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/handler"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+)
+
+// responseOverrides maps the query parameters of GetObject to the response
+// headers they set
+var responseOverrides = map[string]string{
+	"response-content-type":        "Content-Type",
+	"response-content-language":    "Content-Language",
+	"response-expires":             "Expires",
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+}
+
+// putObject writes an object through the upload manager. A key ending in a
+// slash creates a folder.
+func (g *Gateway) putObject(w http.ResponseWriter, r *request) {
+	if err := writable(r); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	fsPath, err := g.resolve(r, r.key)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	body, size, err := r.sig.body(r.Request)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+
+	if strings.HasSuffix(r.key, "/") {
+		if size != 0 {
+			writeError(w, r.Request, errInvalidKey)
+			return
+		}
+		if err := g.fs.MkdirAll(fsPath, 0755); err != nil {
+			writeError(w, r.Request, errInvalidKey)
+			return
+		}
+		w.Header().Set("ETag", `"`+hex.EncodeToString(md5.New().Sum(nil))+`"`)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	wantMD5, err := contentMD5(r.Request)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	sum, err := g.writeObject(r, fsPath, body, size, wantMD5)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum)+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeObject writes size bytes from body to fsPath as a single chunk
+// upload session, and returns the MD5 of the data. A non-nil wantMD5 must
+// match it. Folders are created as needed.
+func (g *Gateway) writeObject(r *request, fsPath string, body io.Reader, size int64, wantMD5 []byte) ([]byte, error) {
+	if isDir, _ := g.fs.IsDir(fsPath); isDir {
+		return nil, errInvalidKey
+	}
+	session, _, err := g.uploads.CreateSession(uuid.New().String(), r.user, r.bucket+"/"+r.key, fsPath, 1, size, size)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+
+	hash := md5.New()
+	if err := g.copyExactly(session.TempPath, io.TeeReader(body, hash), size); err != nil {
+		g.uploads.DeleteSession(session.ID)
+		return nil, err
+	}
+	sum := hash.Sum(nil)
+	if wantMD5 != nil && !bytes.Equal(sum, wantMD5) {
+		g.uploads.DeleteSession(session.ID)
+		return nil, errBadDigest
+	}
+
+	session.MarkChunkReceived(0, size)
+	if err := g.uploads.Finish(session, fsPath, ""); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// copyExactly writes a body of exactly size bytes to an existing file. The
+// body is read to its end, so that its signature is checked.
+func (g *Gateway) copyExactly(fsPath string, body io.Reader, size int64) error {
+	f, err := g.fs.OpenFile(fsPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.CopyN(f, body, size); err != nil {
+		if err == io.EOF {
+			return errIncompleteBody
+		}
+		return err
+	}
+	if n, err := io.Copy(io.Discard, io.LimitReader(body, 1)); err != nil {
+		return err
+	} else if n > 0 {
+		return errIncompleteBody
+	}
+	return f.Close()
+}
+
+// uploadError maps the upload manager's admission errors to S3 errors
+func uploadError(err error) error {
+	switch {
+	case errors.Is(err, handler.ErrUploadTooLarge):
+		return errEntityTooLarge
+	case errors.Is(err, handler.ErrUploadQuotaExceeded):
+		return errQuotaExceeded
+	case errors.Is(err, handler.ErrInsufficientStorage):
+		return errInsufficientStorage
+	}
+	return err
+}
+
+// contentMD5 returns the decoded Content-MD5 header, or nil without one
+func contentMD5(r *http.Request) ([]byte, error) {
+	header := r.Header.Get("Content-MD5")
+	if header == "" {
+		return nil, nil
+	}
+	sum, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(sum) != md5.Size {
+		return nil, errInvalidDigest
+	}
+	return sum, nil
+}
+
+// getObject serves a file's content, or its headers for HEAD, with support
+// for ranges and conditional requests. A key ending in a slash names a
+// folder, which reads as an empty object.
+func (g *Gateway) getObject(w http.ResponseWriter, r *request) {
+	fsPath, err := g.resolve(r, r.key)
+	if err != nil {
+		writeError(w, r.Request, errNoSuchKey)
+		return
+	}
+	info, err := g.fs.Stat(fsPath)
+	if err != nil || info.IsDir() != strings.HasSuffix(r.key, "/") {
+		writeError(w, r.Request, errNoSuchKey)
+		return
+	}
+
+	header := w.Header()
+	header.Set("ETag", etag(info))
+	if info.IsDir() {
+		header.Set("Content-Type", "application/x-directory")
+		header.Set("Content-Length", "0")
+		header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	file, err := g.fs.Open(fsPath)
+	if err != nil {
+		writeError(w, r.Request, errNoSuchKey)
+		return
+	}
+	defer file.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(r.key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	query := r.URL.Query()
+	for param, name := range responseOverrides {
+		if value := query.Get(param); value != "" {
+			header.Set(name, value)
+		}
+	}
+	http.ServeContent(w, r.Request, path.Base(r.key), info.ModTime(), file)
+}
+
+// etag returns the entity tag of a file. Computing the MD5 of every file
+// read would be too slow, so it changes with the modification time and size
+// instead.
+func etag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// deleteObject deletes an object. Deleting a missing object succeeds, as in
+// S3.
+func (g *Gateway) deleteObject(w http.ResponseWriter, r *request) {
+	if err := g.deleteKey(r, r.key); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteKey deletes the file a key names, or the folder if the key ends in
+// a slash and the folder is empty. Folders left empty are removed up to the
+// mount point, since S3 has no folders of its own.
+func (g *Gateway) deleteKey(r *request, key string) error {
+	if err := writable(r); err != nil {
+		return err
+	}
+	fsPath, err := g.resolve(r, key)
+	if err != nil {
+		return err
+	}
+	info, err := g.fs.Stat(fsPath)
+	if err != nil || info.IsDir() != strings.HasSuffix(key, "/") {
+		return nil
+	}
+	if info.IsDir() {
+		if entries, err := g.fs.ReadDir(fsPath); err != nil || len(entries) > 0 {
+			return nil
+		}
+	}
+	if err := g.fs.Remove(fsPath); err != nil {
+		return err
+	}
+
+	root := filepath.Clean(r.mount.Path)
+	for dir := filepath.Dir(fsPath); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		entries, err := g.fs.ReadDir(dir)
+		if err != nil || len(entries) > 0 || g.fs.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// deleteObjects deletes the objects listed in the request body
+func (g *Gateway) deleteObjects(w http.ResponseWriter, r *request) {
+	body, _, err := r.sig.body(r.Request)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	var del deleteRequest
+	if err := xml.NewDecoder(io.LimitReader(body, config.S3MaxXMLBody)).Decode(&del); err != nil {
+		writeError(w, r.Request, errMalformedXML)
+		return
+	}
+	if len(del.Objects) == 0 || len(del.Objects) > config.S3MaxKeys {
+		writeError(w, r.Request, errMalformedXML)
+		return
+	}
+
+	var result deleteResult
+	for _, object := range del.Objects {
+		if err := g.deleteKey(r, object.Key); err != nil {
+			apiErr, ok := err.(*apiError)
+			if !ok {
+				apiErr = errInternal
+			}
+			result.Errors = append(result.Errors, deleteError{Key: object.Key, Code: apiErr.code, Message: apiErr.message})
+			continue
+		}
+		if !del.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: object.Key})
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// listEntry is an object or common prefix of a listing
+type listEntry struct {
+	key    string
+	info   fs.FileInfo // nil for a common prefix
+	prefix bool
+}
+
+// listObjects lists a bucket's objects in key order, as ListObjectsV2 with
+// list-type=2 and as ListObjects otherwise. Files are objects; empty folders
+// are listed as objects whose key ends in a slash.
+func (g *Gateway) listObjects(w http.ResponseWriter, r *request, query url.Values) {
+	v2 := query.Get("list-type") == "2"
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	urlEncoded := query.Get("encoding-type") == "url"
+	if encoding := query.Get("encoding-type"); encoding != "" && encoding != "url" {
+		writeError(w, r.Request, errInvalidArgument)
+		return
+	}
+
+	maxKeys := config.S3MaxKeys
+	if value := query.Get("max-keys"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, r.Request, errInvalidArgument)
+			return
+		}
+		maxKeys = min(n, config.S3MaxKeys)
+	}
+
+	after := query.Get("marker")
+	if v2 {
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				writeError(w, r.Request, errInvalidArgument)
+				return
+			}
+			after = string(decoded)
+		}
+	}
+
+	// Collect one entry more than requested to tell whether there are more
+	var entries []listEntry
+	lastPrefix := ""
+	emit := func(e listEntry) bool {
+		if delimiter != "" && !e.prefix {
+			if i := strings.Index(e.key[len(prefix):], delimiter); i >= 0 {
+				e = listEntry{key: e.key[:len(prefix)+i+len(delimiter)], prefix: true}
+			}
+		}
+		if e.key <= after || (e.prefix && e.key == lastPrefix) {
+			return true
+		}
+		if e.prefix {
+			lastPrefix = e.key
+		}
+		entries = append(entries, e)
+		return len(entries) <= maxKeys
+	}
+
+	base := prefix[:strings.LastIndex(prefix, "/")+1]
+	if fsDir, err := g.resolveDir(r, base); err == nil {
+		if _, err := g.walk(fsDir, base, prefix, delimiter, after, emit); err != nil {
+			writeError(w, r.Request, err)
+			return
+		}
+	}
+
+	truncated := len(entries) > maxKeys
+	if truncated {
+		entries = entries[:maxKeys]
+	}
+
+	encode := func(s string) string {
+		if urlEncoded {
+			return escape(s, true)
+		}
+		return s
+	}
+	result := listBucketResult{
+		Name:        r.bucket,
+		Prefix:      encode(prefix),
+		Delimiter:   encode(delimiter),
+		MaxKeys:     maxKeys,
+		IsTruncated: truncated,
+	}
+	if urlEncoded {
+		result.EncodingType = "url"
+	}
+	for _, e := range entries {
+		if e.prefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(e.key)})
+			continue
+		}
+		object := object{
+			Key:          encode(e.key),
+			LastModified: e.info.ModTime().UTC().Format(time.RFC3339),
+			ETag:         etag(e.info),
+			Size:         e.info.Size(),
+			StorageClass: "STANDARD",
+		}
+		if !v2 || query.Get("fetch-owner") == "true" {
+			object.Owner = &owner{ID: r.user, DisplayName: r.user}
+		}
+		result.Contents = append(result.Contents, object)
+	}
+
+	var next string
+	if truncated {
+		next = entries[len(entries)-1].key
+	}
+	if v2 {
+		result.KeyCount = len(entries)
+		result.ContinuationToken = query.Get("continuation-token")
+		result.StartAfter = encode(query.Get("start-after"))
+		if truncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(next))
+		}
+	} else {
+		result.Marker = encode(query.Get("marker"))
+		if truncated && delimiter != "" {
+			result.NextMarker = encode(next)
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// resolveDir maps a key prefix ending in a slash, or the empty prefix, to
+// an existing folder
+func (g *Gateway) resolveDir(r *request, base string) (string, error) {
+	fsPath := filepath.Clean(r.mount.Path)
+	if base != "" {
+		var err error
+		if fsPath, err = g.resolve(r, base); err != nil {
+			return "", err
+		}
+	}
+	if isDir, err := g.fs.IsDir(fsPath); err != nil || !isDir {
+		return "", errNoSuchKey
+	}
+	return fsPath, nil
+}
+
+// walk passes the entries below a folder whose keys start with keyBase to
+// emit in key order, until emit returns false. Folders sort by their name
+// and a slash. Subtrees that sort before after or do not match the prefix
+// are skipped, and with the slash delimiter folders are not descended into.
+// walk reports whether emit asked to stop.
+func (g *Gateway) walk(fsDir, keyBase, prefix, delimiter, after string, emit func(listEntry) bool) (bool, error) {
+	dirEntries, err := g.fs.ReadDir(fsDir)
+	if err != nil {
+		return false, err
+	}
+	type child struct {
+		key string
+		fs.DirEntry
+	}
+	children := make([]child, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if fileutil.IsUploadTemp(entry.Name()) {
+			continue
+		}
+		key := keyBase + entry.Name()
+		if entry.IsDir() {
+			key += "/"
+		}
+		children = append(children, child{key: key, DirEntry: entry})
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].key < children[j].key })
+
+	for _, c := range children {
+		if !c.IsDir() {
+			if !strings.HasPrefix(c.key, prefix) {
+				continue
+			}
+			info, err := c.Info()
+			if err != nil {
+				continue
+			}
+			if !emit(listEntry{key: c.key, info: info}) {
+				return true, nil
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(c.key, prefix) && !strings.HasPrefix(prefix, c.key) {
+			continue
+		}
+		if c.key < after && !strings.HasPrefix(after, c.key) {
+			continue
+		}
+		if delimiter == "/" && strings.HasPrefix(c.key, prefix) && c.key != prefix {
+			if !emit(listEntry{key: c.key, prefix: true}) {
+				return true, nil
+			}
+			continue
+		}
+
+		fsPath := filepath.Join(fsDir, c.Name())
+		entries, err := g.fs.ReadDir(fsPath)
+		if err != nil {
+			continue
+		}
+		if len(entries) == 0 {
+			if !strings.HasPrefix(c.key, prefix) {
+				continue
+			}
+			info, err := c.Info()
+			if err != nil {
+				continue
+			}
+			if !emit(listEntry{key: c.key, info: info}) {
+				return true, nil
+			}
+			continue
+		}
+		if stop, err := g.walk(fsPath, c.key, prefix, delimiter, after, emit); err != nil || stop {
+			return stop, err
+		}
+	}
+	return false, nil
+}
+
+// object is an entry of a listing
+type object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+	Owner        *owner `xml:"Owner,omitempty"`
+}
+
+// commonPrefix is a group of keys rolled up by the delimiter
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listBucketResult is the response to ListObjects and ListObjectsV2
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	KeyCount              int            `xml:"KeyCount,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []object       `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// deleteRequest is the body of DeleteObjects
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+// deletedObject is a key DeleteObjects deleted
+type deletedObject struct {
+	Key string `xml:"Key"`
+}
+
+// deleteError is a key DeleteObjects failed to delete
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// deleteResult is the response to DeleteObjects
+type deleteResult struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
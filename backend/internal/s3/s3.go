@@ -0,0 +1,337 @@
+// Package s3 serves each mount point as a bucket through a subset of the
+// Amazon S3 API: listing, object reads and writes, and multipart uploads,
+// signed with Signature Version 4 by per-user access keys.
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/gateway"
+	"github.com/homelab/filemanager/internal/handler"
+	"github.com/homelab/filemanager/internal/middleware"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+	"github.com/homelab/filemanager/internal/service"
+)
+
+// apiError is an S3 error response
+type apiError struct {
+	code    string
+	message string
+	status  int
+}
+
+func (e *apiError) Error() string { return e.message }
+
+// S3 error responses
+var (
+	errAccessDenied           = &apiError{"AccessDenied", "Access Denied", http.StatusForbidden}
+	errAnonymous              = &apiError{"AccessDenied", "Anonymous requests are not allowed", http.StatusForbidden}
+	errInvalidAccessKeyID     = &apiError{"InvalidAccessKeyId", "The access key does not exist", http.StatusForbidden}
+	errSignatureMismatch      = &apiError{"SignatureDoesNotMatch", "The request signature does not match", http.StatusForbidden}
+	errUnsupportedSignature   = &apiError{"InvalidRequest", "Only AWS4-HMAC-SHA256 signatures are supported", http.StatusBadRequest}
+	errAuthorizationMalformed = &apiError{"AuthorizationHeaderMalformed", "The authorization is malformed", http.StatusBadRequest}
+	errMissingDate            = &apiError{"AccessDenied", "The request has no valid date", http.StatusForbidden}
+	errRequestTimeTooSkewed   = &apiError{"RequestTimeTooSkewed", "The request time is too far from the server time", http.StatusForbidden}
+	errInvalidExpires         = &apiError{"AuthorizationQueryParametersError", "X-Amz-Expires must be between 1 second and 7 days", http.StatusBadRequest}
+	errPresignExpired         = &apiError{"AccessDenied", "Request has expired", http.StatusForbidden}
+	errMissingContentSHA256   = &apiError{"InvalidRequest", "Missing required header x-amz-content-sha256", http.StatusBadRequest}
+	errContentSHA256Mismatch  = &apiError{"XAmzContentSHA256Mismatch", "The content SHA-256 does not match", http.StatusBadRequest}
+	errMissingContentLength   = &apiError{"MissingContentLength", "The request has no content length", http.StatusLengthRequired}
+	errIncompleteBody         = &apiError{"IncompleteBody", "The request body is incomplete", http.StatusBadRequest}
+	errSlowDown               = &apiError{"SlowDown", "Too many failed requests", http.StatusServiceUnavailable}
+	errNoSuchBucket           = &apiError{"NoSuchBucket", "The bucket does not exist", http.StatusNotFound}
+	errNoSuchKey              = &apiError{"NoSuchKey", "The key does not exist", http.StatusNotFound}
+	errNoSuchUpload           = &apiError{"NoSuchUpload", "The upload does not exist", http.StatusNotFound}
+	errBucketExists           = &apiError{"BucketAlreadyOwnedByYou", "Buckets are the configured mount points", http.StatusConflict}
+	errInvalidKey             = &apiError{"InvalidArgument", "The key is not a valid path", http.StatusBadRequest}
+	errInvalidArgument        = &apiError{"InvalidArgument", "Invalid argument", http.StatusBadRequest}
+	errInvalidPart            = &apiError{"InvalidPart", "A part is missing or its ETag does not match", http.StatusBadRequest}
+	errInvalidPartOrder       = &apiError{"InvalidPartOrder", "Parts must be listed in ascending order", http.StatusBadRequest}
+	errEntityTooSmall         = &apiError{"EntityTooSmall", "A part other than the last is smaller than 5 MiB", http.StatusBadRequest}
+	errEntityTooLarge         = &apiError{"EntityTooLarge", "The upload exceeds the maximum upload size", http.StatusBadRequest}
+	errQuotaExceeded          = &apiError{"QuotaExceeded", "The upload exceeds the upload quota", http.StatusInsufficientStorage}
+	errInsufficientStorage    = &apiError{"InsufficientStorage", "Not enough free space for the upload", http.StatusInsufficientStorage}
+	errBadDigest              = &apiError{"BadDigest", "The Content-MD5 does not match the body", http.StatusBadRequest}
+	errInvalidDigest          = &apiError{"InvalidDigest", "The Content-MD5 is not valid", http.StatusBadRequest}
+	errMalformedXML           = &apiError{"MalformedXML", "The XML is not well-formed", http.StatusBadRequest}
+	errConflict               = &apiError{"OperationAborted", "A conflicting operation is in progress", http.StatusConflict}
+	errNotImplemented         = &apiError{"NotImplemented", "The operation is not supported", http.StatusNotImplemented}
+	errMethodNotAllowed       = &apiError{"MethodNotAllowed", "The method is not allowed", http.StatusMethodNotAllowed}
+	errInternal               = &apiError{"InternalError", "Internal error", http.StatusInternalServerError}
+)
+
+// Gateway serves the S3 API for the file service's mount points
+type Gateway struct {
+	mounts    *gateway.Mounts
+	fs        filesystem.FS
+	uploads   *handler.UploadManager
+	keys      map[string]Key
+	limiter   *middleware.RateLimiter
+	multipart *multipartStore
+	maxUpload int64
+}
+
+// Config holds configuration for the S3 gateway
+type Config struct {
+	Keys           map[string]Key // Access key ID -> secret and user
+	DataDir        string         // Where unfinished multipart uploads are kept
+	MaxUploadBytes int64          // Largest object, in bytes; 0 is unlimited
+	RateLimitRPS   float64        // Failed signatures per second and IP
+}
+
+// NewGateway creates an S3 gateway. Objects are written through the upload
+// manager, so they count towards the same size limits and quotas as other
+// uploads.
+func NewGateway(fileService service.FileService, uploads *handler.UploadManager, cfg Config) *Gateway {
+	fsys := fileService.GetFilesystem()
+	return &Gateway{
+		mounts:    gateway.NewMounts(fileService, errAccessDenied),
+		fs:        fsys,
+		uploads:   uploads,
+		keys:      cfg.Keys,
+		limiter:   middleware.NewRateLimiter(cfg.RateLimitRPS),
+		multipart: newMultipartStore(fsys, filepath.Join(cfg.DataDir, config.S3UploadsDirName)),
+		maxUpload: cfg.MaxUploadBytes,
+	}
+}
+
+// request is an authenticated request resolved to a bucket and key
+type request struct {
+	*http.Request
+	user   string
+	sig    *signature
+	bucket string
+	key    string
+	mount  *model.MountPoint
+}
+
+// ServeHTTP authenticates a path-style request and dispatches it to the
+// bucket or object operation it names
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sig, err := g.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	req := &request{Request: r, user: sig.user, sig: sig, bucket: bucket, key: key}
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		g.listBuckets(w, req)
+		return
+	}
+
+	req.mount = g.mounts.Mount(bucket)
+	if req.mount == nil {
+		// Buckets cannot be created
+		if key == "" && r.Method == http.MethodPut {
+			writeError(w, r, errAccessDenied)
+			return
+		}
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	if key == "" {
+		g.serveBucket(w, req)
+	} else {
+		g.serveObject(w, req)
+	}
+}
+
+// serveBucket dispatches a request on a bucket
+func (g *Gateway) serveBucket(w http.ResponseWriter, r *request) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		switch {
+		case query.Has("location"):
+			writeXML(w, http.StatusOK, locationConstraint{Region: config.S3Region})
+		case hasSubresource(query, listParams):
+			writeError(w, r.Request, errNotImplemented)
+		default:
+			g.listObjects(w, r, query)
+		}
+	case http.MethodHead:
+		w.Header().Set("X-Amz-Bucket-Region", config.S3Region)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPut:
+		writeError(w, r.Request, errBucketExists)
+	case http.MethodPost:
+		if !query.Has("delete") {
+			writeError(w, r.Request, errNotImplemented)
+			return
+		}
+		g.deleteObjects(w, r)
+	case http.MethodDelete:
+		writeError(w, r.Request, errAccessDenied)
+	default:
+		writeError(w, r.Request, errMethodNotAllowed)
+	}
+}
+
+// serveObject dispatches a request on an object
+func (g *Gateway) serveObject(w http.ResponseWriter, r *request) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if query.Has("uploadId") || hasSubresource(query, nil) {
+			writeError(w, r.Request, errNotImplemented)
+			return
+		}
+		g.getObject(w, r)
+	case http.MethodPut:
+		switch {
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			writeError(w, r.Request, errNotImplemented)
+		case query.Has("uploadId"):
+			g.uploadPart(w, r, query.Get("uploadId"), query.Get("partNumber"))
+		default:
+			g.putObject(w, r)
+		}
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			g.abortMultipartUpload(w, r, query.Get("uploadId"))
+			return
+		}
+		g.deleteObject(w, r)
+	case http.MethodPost:
+		switch {
+		case query.Has("uploads"):
+			g.createMultipartUpload(w, r)
+		case query.Has("uploadId"):
+			g.completeMultipartUpload(w, r, query.Get("uploadId"))
+		default:
+			writeError(w, r.Request, errNotImplemented)
+		}
+	default:
+		writeError(w, r.Request, errMethodNotAllowed)
+	}
+}
+
+// listParams are the query parameters of bucket listings
+var listParams = []string{
+	"list-type", "prefix", "delimiter", "marker", "max-keys", "encoding-type",
+	"continuation-token", "start-after", "fetch-owner",
+}
+
+// hasSubresource reports whether a query names a subresource, such as ?acl
+// or ?tagging, rather than only parameters of the plain operation. Presign
+// parameters, response header overrides and the operation name SDKs add as
+// x-id are parameters.
+func hasSubresource(query url.Values, params []string) bool {
+	for name := range query {
+		if !slices.Contains(params, name) && name != "x-id" &&
+			!strings.HasPrefix(name, "X-Amz-") && !strings.HasPrefix(name, "response-") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve maps an object key to a filesystem path. Keys must be clean
+// relative paths; a trailing slash names a folder.
+func (g *Gateway) resolve(r *request, key string) (string, error) {
+	name := strings.TrimSuffix(key, "/")
+	// Upload temp files are hidden from listings, so keys cannot name them
+	if name == "" || path.Clean("/"+name) != "/"+name || strings.Contains(name, "\\") || fileutil.IsUploadTemp(name) {
+		return "", errInvalidKey
+	}
+	t, err := g.mounts.Resolve("resolve", r.bucket+"/"+name, false)
+	if err != nil {
+		return "", errInvalidKey
+	}
+	return t.FsPath, nil
+}
+
+// writable returns an error unless the request's bucket accepts writes
+func writable(r *request) error {
+	if r.mount.ReadOnly {
+		return errAccessDenied
+	}
+	return nil
+}
+
+// listBuckets lists the mount points whose folders exist
+func (g *Gateway) listBuckets(w http.ResponseWriter, r *request) {
+	result := listAllMyBucketsResult{Owner: owner{ID: r.user, DisplayName: r.user}}
+	for _, info := range g.mounts.List() {
+		result.Buckets = append(result.Buckets, bucket{
+			Name:         info.Name(),
+			CreationDate: info.ModTime().UTC().Format(time.RFC3339),
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// writeXML writes an XML response body
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an S3 error response. Errors other than S3 errors are
+// reported as internal errors; HEAD responses carry no body.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		apiErr = errInternal
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(apiErr.status)
+		return
+	}
+	writeXML(w, apiErr.status, errorResponse{
+		Code:     apiErr.code,
+		Message:  apiErr.message,
+		Resource: r.URL.Path,
+	})
+}
+
+// errorResponse is the body of an error response
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+// locationConstraint is the response to GetBucketLocation
+type locationConstraint struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Region  string   `xml:",chardata"`
+}
+
+// owner identifies the user owning buckets and objects
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// bucket is an entry of ListBuckets
+type bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+// listAllMyBucketsResult is the response to ListBuckets
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   owner    `xml:"Owner"`
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
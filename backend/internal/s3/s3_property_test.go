@@ -0,0 +1,492 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/handler"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// setupS3FS creates an in-memory filesystem with a writable and a
+// read-only mount
+func setupS3FS() (*filesystem.AferoFS, service.FileService) {
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media", 0755)
+	fs.MkdirAll("/data/archive", 0755)
+	fs.WriteFile("/data/archive/old.txt", []byte("old"), 0644)
+
+	files := service.NewFileService(fs, service.FileServiceConfig{MountPoints: []model.MountPoint{
+		{Name: "media", Path: "/data/media"},
+		{Name: "archive", Path: "/data/archive", ReadOnly: true},
+	}})
+	return fs, files
+}
+
+// startGateway serves the file service through the S3 gateway, with an
+// access key for alice, and returns the gateway's URL
+func startGateway(t *testing.T, fs filesystem.FS, files service.FileService, rps float64) string {
+	t.Helper()
+	uploads := handler.NewUploadManager(fs, nil, "/appdata/uploads", handler.UploadLimits{})
+	gateway := NewGateway(files, uploads, Config{
+		Keys:         map[string]Key{"ALICEKEY": {User: "alice", Secret: "alice-secret"}},
+		DataDir:      "/appdata",
+		RateLimitRPS: rps,
+	})
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// newClient returns an SDK client signing with the given credentials
+func newClient(endpoint, accessKey, secret string) *awss3.Client {
+	return awss3.New(awss3.Options{
+		Region:           config.S3Region,
+		BaseEndpoint:     aws.String(endpoint),
+		UsePathStyle:     true,
+		Credentials:      credentials.NewStaticCredentialsProvider(accessKey, secret, ""),
+		RetryMaxAttempts: 1,
+	})
+}
+
+// errorCode returns the S3 error code of an SDK error
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// md5ETag returns the quoted MD5 of data, the ETag of a simple upload
+func md5ETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// TestS3ObjectLifecycle checks that objects written through the gateway
+// are files on the mount, and can be read back and deleted
+func TestS3ObjectLifecycle(t *testing.T) {
+	ctx := context.Background()
+	fs, files := setupS3FS()
+	client := newClient(startGateway(t, fs, files, 10), "ALICEKEY", "alice-secret")
+
+	buckets, err := client.ListBuckets(ctx, &awss3.ListBucketsInput{})
+	if err != nil {
+		t.Fatalf("list buckets: %v", err)
+	}
+	var names []string
+	for _, b := range buckets.Buckets {
+		names = append(names, aws.ToString(b.Name))
+	}
+	if strings.Join(names, ",") != "media,archive" {
+		t.Fatalf("expected the mounts as buckets, got %v", names)
+	}
+
+	content := []byte("hello, s3")
+	put, err := client.PutObject(ctx, &awss3.PutObjectInput{
+		Bucket: aws.String("media"),
+		Key:    aws.String("docs/notes/a.txt"),
+		Body:   bytes.NewReader(content),
+	})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if aws.ToString(put.ETag) != md5ETag(content) {
+		t.Errorf("expected ETag %s, got %s", md5ETag(content), aws.ToString(put.ETag))
+	}
+	if data, err := fs.ReadFile("/data/media/docs/notes/a.txt"); err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("expected the object on the mount, got %q, %v", data, err)
+	}
+
+	head, err := client.HeadObject(ctx, &awss3.HeadObjectInput{Bucket: aws.String("media"), Key: aws.String("docs/notes/a.txt")})
+	if err != nil {
+		t.Fatalf("head: %v", err)
+	}
+	if aws.ToInt64(head.ContentLength) != int64(len(content)) || aws.ToString(head.ContentType) != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected head: length %d, type %s", aws.ToInt64(head.ContentLength), aws.ToString(head.ContentType))
+	}
+
+	get, err := client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String("media"),
+		Key:    aws.String("docs/notes/a.txt"),
+		Range:  aws.String("bytes=7-8"),
+	})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+	if string(data) != "s3" {
+		t.Errorf("expected the range's content, got %q", data)
+	}
+
+	if _, err := client.GetObject(ctx, &awss3.GetObjectInput{Bucket: aws.String("media"), Key: aws.String("missing")}); errorCode(err) != "NoSuchKey" {
+		t.Errorf("expected NoSuchKey, got %v", err)
+	}
+	if _, err := client.PutObject(ctx, &awss3.PutObjectInput{
+		Bucket: aws.String("media"),
+		Key:    aws.String("../escape.txt"),
+		Body:   bytes.NewReader(content),
+	}); err == nil {
+		t.Error("expected a key outside the mount to be refused")
+	}
+
+	if _, err := client.DeleteObject(ctx, &awss3.DeleteObjectInput{Bucket: aws.String("media"), Key: aws.String("docs/notes/a.txt")}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if exists, _ := fs.Exists("/data/media/docs"); exists {
+		t.Error("expected the folders left empty to be removed")
+	}
+	if exists, _ := fs.Exists("/data/media"); !exists {
+		t.Error("expected the mount's folder to be kept")
+	}
+}
+
+// TestS3ReadOnlyBucket checks that read-only mounts can be read but not
+// changed
+func TestS3ReadOnlyBucket(t *testing.T) {
+	ctx := context.Background()
+	fs, files := setupS3FS()
+	client := newClient(startGateway(t, fs, files, 10), "ALICEKEY", "alice-secret")
+
+	get, err := client.GetObject(ctx, &awss3.GetObjectInput{Bucket: aws.String("archive"), Key: aws.String("old.txt")})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+	if string(data) != "old" {
+		t.Errorf("expected the file's content, got %q", data)
+	}
+
+	if _, err := client.PutObject(ctx, &awss3.PutObjectInput{
+		Bucket: aws.String("archive"),
+		Key:    aws.String("new.txt"),
+		Body:   strings.NewReader("new"),
+	}); errorCode(err) != "AccessDenied" {
+		t.Errorf("expected AccessDenied for a put, got %v", err)
+	}
+	if _, err := client.DeleteObject(ctx, &awss3.DeleteObjectInput{Bucket: aws.String("archive"), Key: aws.String("old.txt")}); errorCode(err) != "AccessDenied" {
+		t.Errorf("expected AccessDenied for a delete, got %v", err)
+	}
+	if _, err := client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{Bucket: aws.String("archive"), Key: aws.String("big.bin")}); errorCode(err) != "AccessDenied" {
+		t.Errorf("expected AccessDenied for a multipart upload, got %v", err)
+	}
+	if exists, _ := fs.Exists("/data/archive/old.txt"); !exists {
+		t.Error("expected the read-only file to be kept")
+	}
+}
+
+// TestS3Authentication checks that only requests signed with a configured
+// secret are served, and that failures are rate limited
+func TestS3Authentication(t *testing.T) {
+	ctx := context.Background()
+	fs, files := setupS3FS()
+	endpoint := startGateway(t, fs, files, 1)
+
+	resp, err := http.Get(endpoint + "/archive/old.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected anonymous requests to be refused, got %d", resp.StatusCode)
+	}
+
+	input := &awss3.HeadObjectInput{Bucket: aws.String("archive"), Key: aws.String("old.txt")}
+	if _, err := newClient(endpoint, "ALICEKEY", "alice-secret").HeadObject(ctx, input); err != nil {
+		t.Fatalf("expected a signed request to be served: %v", err)
+	}
+	list := &awss3.ListBucketsInput{}
+	if _, err := newClient(endpoint, "UNKNOWN", "alice-secret").ListBuckets(ctx, list); errorCode(err) != "InvalidAccessKeyId" {
+		t.Errorf("expected InvalidAccessKeyId, got %v", err)
+	}
+	if _, err := newClient(endpoint, "ALICEKEY", "guess").ListBuckets(ctx, list); errorCode(err) != "SignatureDoesNotMatch" {
+		t.Errorf("expected SignatureDoesNotMatch, got %v", err)
+	}
+	if _, err := newClient(endpoint, "ALICEKEY", "alice-secret").ListBuckets(ctx, list); errorCode(err) != "SlowDown" {
+		t.Errorf("expected repeated failures to be rate limited, got %v", err)
+	}
+}
+
+// TestS3PresignedURL checks that presigned URLs can be fetched without
+// credentials until they expire
+func TestS3PresignedURL(t *testing.T) {
+	ctx := context.Background()
+	fs, files := setupS3FS()
+	endpoint := startGateway(t, fs, files, 10)
+	presigner := awss3.NewPresignClient(newClient(endpoint, "ALICEKEY", "alice-secret"))
+
+	input := &awss3.GetObjectInput{Bucket: aws.String("archive"), Key: aws.String("old.txt")}
+	signed, err := presigner.PresignGetObject(ctx, input, awss3.WithPresignExpires(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(signed.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != "old" {
+		t.Errorf("expected the file through the presigned URL, got %d %q", resp.StatusCode, data)
+	}
+
+	resp, err = http.Get(strings.Replace(signed.URL, "old.txt", "other.txt", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a changed presigned URL to be refused, got %d", resp.StatusCode)
+	}
+}
+
+// TestS3MultipartUpload checks that multipart uploads are joined into one
+// file, and that aborted uploads leave nothing behind
+func TestS3MultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	fs, files := setupS3FS()
+	client := newClient(startGateway(t, fs, files, 10), "ALICEKEY", "alice-secret")
+
+	bucket, key := aws.String("media"), aws.String("videos/big.bin")
+	first := bytes.Repeat([]byte("a"), config.S3MinPartSize)
+	last := []byte("the end")
+
+	create, err := client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{Bucket: bucket, Key: key})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var parts []types.CompletedPart
+	var etags []byte
+	for i, data := range [][]byte{first, last} {
+		part, err := client.UploadPart(ctx, &awss3.UploadPartInput{
+			Bucket:     bucket,
+			Key:        key,
+			UploadId:   create.UploadId,
+			PartNumber: aws.Int32(int32(i + 1)),
+			Body:       bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatalf("part %d: %v", i+1, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(int32(i + 1))})
+		sum := md5.Sum(data)
+		etags = append(etags, sum[:]...)
+	}
+
+	if _, err := client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          bucket,
+		Key:             key,
+		UploadId:        create.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: []types.CompletedPart{parts[1], parts[0]}},
+	}); errorCode(err) != "InvalidPartOrder" {
+		t.Fatalf("expected InvalidPartOrder, got %v", err)
+	}
+	complete, err := client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          bucket,
+		Key:             key,
+		UploadId:        create.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	sum := md5.Sum(etags)
+	if want := fmt.Sprintf(`"%x-2"`, sum); aws.ToString(complete.ETag) != want {
+		t.Errorf("expected ETag %s, got %s", want, aws.ToString(complete.ETag))
+	}
+	data, err := fs.ReadFile("/data/media/videos/big.bin")
+	if err != nil || !bytes.Equal(data, append(first, last...)) {
+		t.Fatalf("expected the joined parts on the mount, got %d bytes, %v", len(data), err)
+	}
+	if exists, _ := fs.Exists("/appdata/" + config.S3UploadsDirName + "/" + aws.ToString(create.UploadId)); exists {
+		t.Error("expected the parts to be removed")
+	}
+
+	// Parts other than the last must be at least 5 MiB
+	small, err := client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{Bucket: bucket, Key: key})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	parts = nil
+	for i := 1; i <= 2; i++ {
+		part, err := client.UploadPart(ctx, &awss3.UploadPartInput{
+			Bucket:     bucket,
+			Key:        key,
+			UploadId:   small.UploadId,
+			PartNumber: aws.Int32(int32(i)),
+			Body:       bytes.NewReader(last),
+		})
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(int32(i))})
+	}
+	if _, err := client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          bucket,
+		Key:             key,
+		UploadId:        small.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}); errorCode(err) != "EntityTooSmall" {
+		t.Fatalf("expected EntityTooSmall, got %v", err)
+	}
+
+	if _, err := client.AbortMultipartUpload(ctx, &awss3.AbortMultipartUploadInput{Bucket: bucket, Key: key, UploadId: small.UploadId}); err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+	if _, err := client.UploadPart(ctx, &awss3.UploadPartInput{
+		Bucket:     bucket,
+		Key:        key,
+		UploadId:   small.UploadId,
+		PartNumber: aws.Int32(3),
+		Body:       bytes.NewReader(last),
+	}); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("expected NoSuchUpload after the abort, got %v", err)
+	}
+	if data, _ := fs.ReadFile("/data/media/videos/big.bin"); !bytes.Equal(data, append(first, last...)) {
+		t.Error("expected the aborted upload to leave the object unchanged")
+	}
+}
+
+// expectedListing lists keys the way S3 does: the keys starting with prefix
+// in byte order, with the keys containing the delimiter after the prefix
+// rolled up into common prefixes
+func expectedListing(keys []string, prefix, delimiter string) (contents, prefixes []string) {
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			common := key[:len(prefix)+i+len(delimiter)]
+			if !seen[common] {
+				seen[common] = true
+				prefixes = append(prefixes, common)
+			}
+			continue
+		}
+		contents = append(contents, key)
+	}
+	sort.Strings(contents)
+	sort.Strings(prefixes)
+	return contents, prefixes
+}
+
+// **Feature: homelab-file-manager, Property 43: S3 Listing Order**
+//
+// Property: For any set of files on a mount and any prefix, delimiter and page size, the
+// pages of ListObjectsV2 SHALL together return every matching key exactly once, in byte
+// order, with the keys that contain the delimiter after the prefix rolled up into common
+// prefixes, as Amazon S3 lists them.
+
+func TestProperty_S3ListingOrder(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 50
+
+	properties := gopter.NewProperties(parameters)
+
+	segment := gen.OneConstOf("a", "b", "a-b", "a.b", "ab", "b0")
+	path := gen.SliceOfN(3, segment).Map(func(segments []string) string {
+		return strings.Join(segments, "/")
+	})
+	depth := gen.IntRange(1, 3)
+
+	properties.Property("listings match S3's order and roll-up", prop.ForAll(
+		func(paths []string, depths []int, prefix, delimiter string, pageSize int) bool {
+			ctx := context.Background()
+			fs, files := setupS3FS()
+			gateway := NewGateway(files, handler.NewUploadManager(fs, nil, "/appdata/uploads", handler.UploadLimits{}), Config{
+				Keys:         map[string]Key{"ALICEKEY": {User: "alice", Secret: "alice-secret"}},
+				DataDir:      "/appdata",
+				RateLimitRPS: 10,
+			})
+			server := httptest.NewServer(gateway)
+			defer server.Close()
+			client := newClient(server.URL, "ALICEKEY", "alice-secret")
+
+			// Files whose path is taken by a folder, or the other way round,
+			// are skipped
+			var keys []string
+			for i, p := range paths {
+				key := strings.Join(strings.Split(p, "/")[:depths[i%len(depths)]], "/")
+				conflict := false
+				for _, other := range keys {
+					if key == other || strings.HasPrefix(key, other+"/") || strings.HasPrefix(other, key+"/") {
+						conflict = true
+					}
+				}
+				if conflict {
+					continue
+				}
+				fs.MkdirAll("/data/media/"+key[:strings.LastIndex("/"+key, "/")], 0755)
+				fs.WriteFile("/data/media/"+key, []byte(key), 0644)
+				keys = append(keys, key)
+			}
+
+			var contents, prefixes []string
+			paginator := awss3.NewListObjectsV2Paginator(client, &awss3.ListObjectsV2Input{
+				Bucket:    aws.String("media"),
+				Prefix:    aws.String(prefix),
+				Delimiter: aws.String(delimiter),
+				MaxKeys:   aws.Int32(int32(pageSize)),
+			})
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				if err != nil {
+					t.Logf("list: %v", err)
+					return false
+				}
+				if len(page.Contents)+len(page.CommonPrefixes) > pageSize {
+					t.Logf("page of %d entries for max-keys %d", len(page.Contents)+len(page.CommonPrefixes), pageSize)
+					return false
+				}
+				for _, object := range page.Contents {
+					contents = append(contents, aws.ToString(object.Key))
+				}
+				for _, common := range page.CommonPrefixes {
+					prefixes = append(prefixes, aws.ToString(common.Prefix))
+				}
+			}
+
+			wantContents, wantPrefixes := expectedListing(keys, prefix, delimiter)
+			if strings.Join(contents, "|") != strings.Join(wantContents, "|") ||
+				strings.Join(prefixes, "|") != strings.Join(wantPrefixes, "|") {
+				t.Logf("prefix %q, delimiter %q, page size %d:\n got %v %v\nwant %v %v",
+					prefix, delimiter, pageSize, contents, prefixes, wantContents, wantPrefixes)
+				return false
+			}
+			return true
+		},
+		gen.SliceOfN(8, path),
+		gen.SliceOfN(8, depth),
+		gen.OneConstOf("", "a", "a/", "a-", "b0/a"),
+		gen.OneConstOf("", "/", "-"),
+		gen.IntRange(1, 4),
+	))
+
+	properties.TestingRun(t)
+}
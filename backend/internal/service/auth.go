@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"sync"
@@ -24,6 +25,7 @@ var (
 type Claims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	Admin    bool   `json:"admin,omitempty"` // May manage other users' jobs and the job queue
 	jwt.RegisteredClaims
 }
 
@@ -43,9 +45,17 @@ type UserCredentials struct {
 // AuthService defines the authentication service interface
 type AuthService interface {
 	Login(ctx context.Context, username, password string) (*TokenPair, error)
+	// Authenticate checks a username and password without issuing tokens,
+	// for protocols that send credentials with every request
+	Authenticate(ctx context.Context, username, password string) (*Claims, error)
+	// AuthenticateKey checks a public key (in SSH wire format) against the
+	// user's authorized keys
+	AuthenticateKey(ctx context.Context, username string, key []byte) (*Claims, error)
 	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
 	ValidateToken(tokenString string) (*Claims, error)
 	Logout(ctx context.Context, refreshToken string) error
+	// IsAdmin reports whether a user has admin rights
+	IsAdmin(username string) bool
 	StartCleanup(ctx context.Context)
 	StopCleanup()
 }
@@ -57,6 +67,8 @@ type authService struct {
 	accessTokenExpiry  time.Duration
 	refreshTokenExpiry time.Duration
 	users              map[string]string // username -> password (in production, use proper storage)
+	admins             map[string]bool   // usernames with admin rights
+	authorizedKeys     map[string][][]byte
 	revokedTokens      map[string]time.Time
 	mu                 sync.RWMutex
 	stopCh             chan struct{}
@@ -68,7 +80,9 @@ type AuthServiceConfig struct {
 	JWTSecret          string
 	AccessTokenExpiry  time.Duration
 	RefreshTokenExpiry time.Duration
-	Users              map[string]string // username -> password
+	Users              map[string]string   // username -> password
+	Admins             []string            // Usernames with admin rights; empty means only a sole user
+	AuthorizedKeys     map[string][][]byte // username -> public keys in SSH wire format
 }
 
 // NewAuthService creates a new authentication service
@@ -83,11 +97,25 @@ func NewAuthService(cfg AuthServiceConfig) AuthService {
 		cfg.Users = make(map[string]string)
 	}
 
+	admins := make(map[string]bool, len(cfg.Admins))
+	for _, username := range cfg.Admins {
+		admins[username] = true
+	}
+	// A single-user setup needs no admins list; with several users admin
+	// rights must be granted explicitly
+	if len(admins) == 0 && len(cfg.Users) == 1 {
+		for username := range cfg.Users {
+			admins[username] = true
+		}
+	}
+
 	return &authService{
 		jwtSecret:          []byte(cfg.JWTSecret),
 		accessTokenExpiry:  cfg.AccessTokenExpiry,
 		refreshTokenExpiry: cfg.RefreshTokenExpiry,
 		users:              cfg.Users,
+		admins:             admins,
+		authorizedKeys:     cfg.AuthorizedKeys,
 		revokedTokens:      make(map[string]time.Time),
 		stopCh:             make(chan struct{}),
 	}
@@ -96,12 +124,43 @@ func NewAuthService(cfg AuthServiceConfig) AuthService {
 // Login authenticates a user and returns a token pair
 func (s *authService) Login(ctx context.Context, username, password string) (*TokenPair, error) {
 	// Validate credentials
+	if _, err := s.Authenticate(ctx, username, password); err != nil {
+		return nil, err
+	}
+
+	return s.generateTokenPair(username)
+}
+
+// Authenticate checks a user's credentials and returns their claims
+func (s *authService) Authenticate(ctx context.Context, username, password string) (*Claims, error) {
 	storedPassword, exists := s.users[username]
-	if !exists || storedPassword != password {
+	if !exists || subtle.ConstantTimeCompare([]byte(storedPassword), []byte(password)) != 1 {
 		return nil, ErrInvalidCredentials
 	}
 
-	return s.generateTokenPair(username)
+	return s.claims(username), nil
+}
+
+// AuthenticateKey checks a user's public key and returns their claims. Keys
+// only count for users that are configured.
+func (s *authService) AuthenticateKey(ctx context.Context, username string, key []byte) (*Claims, error) {
+	if _, exists := s.users[username]; exists {
+		for _, authorized := range s.authorizedKeys[username] {
+			if subtle.ConstantTimeCompare(authorized, key) == 1 {
+				return s.claims(username), nil
+			}
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// claims returns the claims of an authenticated user
+func (s *authService) claims(username string) *Claims {
+	return &Claims{
+		UserID:   generateUserID(username),
+		Username: username,
+		Admin:    s.IsAdmin(username),
+	}
 }
 
 // Refresh generates a new token pair from a valid refresh token
@@ -167,12 +226,14 @@ func (s *authService) Logout(ctx context.Context, refreshToken string) error {
 func (s *authService) generateTokenPair(username string) (*TokenPair, error) {
 	now := time.Now()
 	userID := generateUserID(username)
+	admin := s.IsAdmin(username)
 
 	// Create access token
 	accessExpiry := now.Add(s.accessTokenExpiry)
 	accessClaims := &Claims{
 		UserID:   userID,
 		Username: username,
+		Admin:    admin,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(accessExpiry),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -193,6 +254,7 @@ func (s *authService) generateTokenPair(username string) (*TokenPair, error) {
 	refreshClaims := &Claims{
 		UserID:   userID,
 		Username: username,
+		Admin:    admin,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(refreshExpiry),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -215,6 +277,11 @@ func (s *authService) generateTokenPair(username string) (*TokenPair, error) {
 	}, nil
 }
 
+// IsAdmin reports whether a user has admin rights
+func (s *authService) IsAdmin(username string) bool {
+	return s.admins[username]
+}
+
 // generateUserID creates a deterministic user ID from username
 func generateUserID(username string) string {
 	b := make([]byte, 8)
@@ -0,0 +1,612 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/spf13/afero"
+)
+
+// Fetch job errors
+var (
+	ErrFetchNotAllowed   = errors.New("downloads from this host are not allowed")
+	ErrFetchTooLarge     = errors.New("download exceeds the size limit")
+	ErrFetchFailed       = errors.New("download failed")
+	ErrInsufficientSpace = errors.New("not enough free space")
+)
+
+// fetchFallbackName names downloads into a directory whose URL has no file name
+const fetchFallbackName = "download"
+
+// nonPublicPrefixes are address ranges that are not reachable on the public
+// internet beyond those the netip predicates cover
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"),  // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // Reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which can reach private IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local-use NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4, which embeds an IPv4 address
+	netip.MustParsePrefix("2001::/32"),      // Teredo, which embeds an IPv4 address
+	netip.MustParsePrefix("2001:db8::/32"),  // Documentation
+}
+
+// FetchConfig limits what fetch jobs may download
+type FetchConfig struct {
+	MaxBytes   int64    // Largest download; 0 = unlimited
+	AllowHosts []string // When set, the only hosts downloads may come from
+	DenyHosts  []string // Hosts downloads never come from, even when allowed
+}
+
+// hostPattern is one entry of a fetch allow or deny list: a host name, a
+// "*.domain" wildcard for its subdomains, an IP address or a CIDR range
+type hostPattern struct {
+	name   string
+	prefix netip.Prefix
+}
+
+// parseHostPatterns parses allow or deny list entries, skipping invalid ones
+func parseHostPatterns(entries []string) []hostPattern {
+	patterns := make([]hostPattern, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			patterns = append(patterns, hostPattern{prefix: prefix.Masked()})
+		} else if addr, err := netip.ParseAddr(strings.Trim(entry, "[]")); err == nil {
+			patterns = append(patterns, hostPattern{prefix: netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())})
+		} else if entry != "" && !strings.Contains(entry, "/") {
+			patterns = append(patterns, hostPattern{name: strings.TrimSuffix(entry, ".")})
+		}
+	}
+	return patterns
+}
+
+// matchName reports whether a lower-case host name matches the pattern
+func (p hostPattern) matchName(host string) bool {
+	if p.name == "" {
+		return false
+	}
+	if domain, ok := strings.CutPrefix(p.name, "*."); ok {
+		return strings.HasSuffix(host, "."+domain)
+	}
+	return host == p.name
+}
+
+// matchAddr reports whether an address lies in the pattern's range
+func (p hostPattern) matchAddr(addr netip.Addr) bool {
+	return p.prefix.IsValid() && p.prefix.Contains(addr.Unmap())
+}
+
+// fetchPolicy decides which hosts and addresses fetch jobs may connect to.
+// Without an allow list, any host is allowed as long as every address it is
+// reached at is public; hosts on the allow list may also be private. The deny
+// list wins over both.
+type fetchPolicy struct {
+	allow []hostPattern
+	deny  []hostPattern
+}
+
+// newFetchPolicy builds a policy from the configured host lists
+func newFetchPolicy(cfg FetchConfig) *fetchPolicy {
+	return &fetchPolicy{
+		allow: parseHostPatterns(cfg.AllowHosts),
+		deny:  parseHostPatterns(cfg.DenyHosts),
+	}
+}
+
+// checkHost applies the host lists to the host of a URL
+func (p *fetchPolicy) checkHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	addr, err := netip.ParseAddr(host)
+	isAddr := err == nil
+
+	matches := func(patterns []hostPattern) bool {
+		for _, pattern := range patterns {
+			if pattern.matchName(host) || (isAddr && pattern.matchAddr(addr)) {
+				return true
+			}
+		}
+		return false
+	}
+	if host == "" || matches(p.deny) || (len(p.allow) > 0 && !matches(p.allow)) {
+		return fmt.Errorf("%w: %s", ErrFetchNotAllowed, host)
+	}
+	return nil
+}
+
+// checkAddr decides whether a host that passed checkHost may be connected to
+// at addr
+func (p *fetchPolicy) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, pattern := range p.deny {
+		if pattern.matchAddr(addr) {
+			return fmt.Errorf("%w: %s", ErrFetchNotAllowed, addr)
+		}
+	}
+	if len(p.allow) == 0 && !isPublicAddr(addr) {
+		return fmt.Errorf("%w: %s is not a public address", ErrFetchNotAllowed, addr)
+	}
+	return nil
+}
+
+// isPublicAddr reports whether addr is a unicast address on the internet
+func isPublicAddr(addr netip.Addr) bool {
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialContext connects to an address the policy allows. The host is
+// resolved here and the checked address is dialled, so a DNS answer that
+// changes between the check and the connection cannot redirect it.
+func (p *fetchPolicy) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkHost(host); err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: 30 * time.Second}
+	err = fmt.Errorf("%w: %s has no addresses", ErrFetchNotAllowed, host)
+	for _, addr := range addrs {
+		if checkErr := p.checkAddr(addr); checkErr != nil {
+			err = checkErr
+			continue
+		}
+		conn, dialErr := dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+		if dialErr == nil {
+			return conn, nil
+		}
+		err = dialErr
+	}
+	return nil, err
+}
+
+// client returns an HTTP client that only connects where the policy allows,
+// including after redirects, and never through a proxy
+func (p *fetchPolicy) client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         p.dialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= config.FetchMaxRedirects {
+				return fmt.Errorf("%w: too many redirects", ErrFetchFailed)
+			}
+			if !isFetchURL(req.URL) {
+				return fmt.Errorf("%w: redirected to a non-HTTP URL", ErrFetchNotAllowed)
+			}
+			return p.checkHost(req.URL.Hostname())
+		},
+	}
+}
+
+// isFetchURL reports whether u is an absolute http or https URL
+func isFetchURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != ""
+}
+
+// validateFetchParams checks the URL and options of a fetch job, returning
+// the options with the checksum normalized to lower-case hex
+func validateFetchParams(params model.JobParams) (*model.FetchOptions, error) {
+	u, err := url.Parse(params.SourcePath)
+	if err != nil || !isFetchURL(u) || len(params.Items) > 0 {
+		return nil, ErrInvalidJobParams
+	}
+
+	var result model.FetchOptions
+	if params.Fetch != nil {
+		result = *params.Fetch
+	}
+	if result.MaxBytes < 0 {
+		return nil, ErrInvalidJobParams
+	}
+	if result.Checksum != "" {
+		sum := strings.ToLower(strings.TrimPrefix(result.Checksum, "sha256:"))
+		if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+			return nil, ErrInvalidJobParams
+		}
+		result.Checksum = sum
+	}
+	return &result, nil
+}
+
+// checkFetchJob applies the host policy to a new fetch job and checks that
+// it downloads into a writable mount point
+func (s *jobService) checkFetchJob(params model.JobParams) error {
+	u, _ := url.Parse(params.SourcePath)
+	if err := s.fetchPolicy.checkHost(u.Hostname()); err != nil {
+		return err
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if err := s.fetchPolicy.checkAddr(addr); err != nil {
+			return err
+		}
+	}
+	return s.checkWritableDest(params.DestPath)
+}
+
+// fetchPartial is the data a failed fetch job left for a retry to resume
+type fetchPartial struct {
+	path      string // Temp file beside the destination
+	validator string // ETag or Last-Modified of the response the data came from
+}
+
+// fetchTransfer is the state of a download while its requests are made
+type fetchTransfer struct {
+	run       *jobRun
+	url       string
+	file      afero.File
+	validator string
+	done      int64
+	total     int64 // 0 while unknown
+	limit     int64 // 0 = unlimited
+	reported  int64 // Bytes done at the last broadcast
+}
+
+// executeFetch downloads the job's URL into a temp file beside the
+// destination and renames it into place. Failed requests are retried,
+// resuming with a range request when the server supports them; a job that
+// fails anyway leaves its data for a retry of the job to resume.
+func (s *jobService) executeFetch(ctx context.Context, run *jobRun) error {
+	job := run.job
+	dst, err := s.fetchDestination(job)
+	if err != nil {
+		return err
+	}
+	s.jobsMu.Lock()
+	job.DestPath = dst
+	s.jobsMu.Unlock()
+
+	tmpPath := dst + ".fetching." + job.ID
+	var validator string
+	if partial := s.takeFetchPartial(job.RetryOf); partial != nil {
+		tmpPath, validator = partial.path, partial.validator
+	}
+
+	file, err := s.fs.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	ft := &fetchTransfer{run: run, url: job.SourcePath, file: file, validator: validator, limit: s.fetchMaxBytes}
+	if job.Fetch.MaxBytes > 0 && (ft.limit == 0 || job.Fetch.MaxBytes < ft.limit) {
+		ft.limit = job.Fetch.MaxBytes
+	}
+	if info, err := file.Stat(); err == nil && validator != "" {
+		ft.done = info.Size()
+	}
+	if err := ft.reset(ft.done); err != nil {
+		file.Close()
+		s.fs.Remove(tmpPath)
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = s.fetchAttempt(ctx, ft)
+		if err == nil || !retry || attempt == config.FetchAttempts || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.fetchRetryDelay * time.Duration(attempt)):
+		}
+	}
+
+	if ctx.Err() != nil {
+		file.Close()
+		s.fs.Remove(tmpPath)
+		return ctx.Err()
+	}
+	if err != nil {
+		file.Close()
+		if ft.validator != "" && ft.done > 0 {
+			s.resultsMu.Lock()
+			s.result(job.ID).fetchPartial = &fetchPartial{path: tmpPath, validator: ft.validator}
+			s.resultsMu.Unlock()
+		} else {
+			s.fs.Remove(tmpPath)
+		}
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		s.fs.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		s.fs.Remove(tmpPath)
+		return err
+	}
+	return s.finishFetch(ctx, run, tmpPath, dst)
+}
+
+// fetchDestination returns the file a fetch job writes: DestPath, or the
+// file named after the URL inside it when DestPath is a directory
+func (s *jobService) fetchDestination(job *model.Job) (string, error) {
+	info, err := s.fs.Stat(job.DestPath)
+	if err == nil && info.IsDir() {
+		name := fetchFallbackName
+		if u, err := url.Parse(job.SourcePath); err == nil {
+			if base := path.Base(u.Path); base != "/" && base != "." && base != ".." && !strings.ContainsRune(base, filepath.Separator) {
+				name = base
+			}
+		}
+		return filepath.Join(job.DestPath, name), nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err := s.fs.MkdirAll(filepath.Dir(job.DestPath), 0755); err != nil {
+		return "", err
+	}
+	return job.DestPath, nil
+}
+
+// fetchAttempt makes one request for the rest of a download and writes what
+// arrives. It reports whether a failure is worth another request.
+func (s *jobService) fetchAttempt(ctx context.Context, ft *fetchTransfer) (bool, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stall := time.AfterFunc(s.fetchStallTimeout, cancel)
+	defer stall.Stop()
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, ft.url, nil)
+	if err != nil {
+		return false, err
+	}
+	// Byte ranges refer to the encoded body, so the transfer must not be
+	// transparently decompressed
+	req.Header.Set("Accept-Encoding", "identity")
+	resuming := ft.done > 0 && ft.validator != ""
+	if resuming {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", ft.done))
+		req.Header.Set("If-Range", ft.validator)
+	}
+
+	resp, err := s.fetchClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if errors.Is(err, ErrFetchNotAllowed) || errors.Is(err, ErrFetchFailed) {
+			return false, err
+		}
+		return true, fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && resuming:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != ft.done {
+			// Start over rather than guess where the data belongs
+			ft.validator = ""
+			return true, errors.Join(ft.reset(0), fmt.Errorf("%w: unexpected range in response", ErrFetchFailed))
+		}
+		ft.total = total
+	case resp.StatusCode == http.StatusOK:
+		// The whole file: nothing was received yet, the server cannot
+		// resume, or the file changed since the data was received
+		if err := ft.reset(0); err != nil {
+			return false, err
+		}
+		ft.total = max(resp.ContentLength, 0)
+		ft.validator = fetchValidator(resp.Header)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The file shrank since the data was received
+		ft.validator = ""
+		return true, errors.Join(ft.reset(0), fmt.Errorf("%w: %s", ErrFetchFailed, resp.Status))
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout:
+		return true, fmt.Errorf("%w: %s", ErrFetchFailed, resp.Status)
+	default:
+		return false, fmt.Errorf("%w: %s", ErrFetchFailed, resp.Status)
+	}
+
+	if ft.limit > 0 && ft.total > ft.limit {
+		return false, ErrFetchTooLarge
+	}
+	if reporter, ok := s.fs.(filesystem.SpaceReporter); ok && ft.total > 0 {
+		free, err := reporter.FreeSpace(filepath.Dir(ft.run.job.DestPath))
+		if err == nil && free < ft.total-ft.done {
+			return false, ErrInsufficientSpace
+		}
+	}
+	s.fetchProgress(ft, true)
+
+	buf := make([]byte, config.FileCopyBufferSize)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			stall.Reset(s.fetchStallTimeout)
+			if ft.limit > 0 && ft.done+int64(n) > ft.limit {
+				return false, ErrFetchTooLarge
+			}
+			if _, err := ft.file.Write(buf[:n]); err != nil {
+				return false, err
+			}
+			ft.done += int64(n)
+			s.fetchProgress(ft, false)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			if attemptCtx.Err() != nil {
+				return true, fmt.Errorf("%w: no data received for %s", ErrFetchFailed, s.fetchStallTimeout)
+			}
+			return true, fmt.Errorf("%w: %v", ErrFetchFailed, readErr)
+		}
+	}
+
+	if ft.total > 0 && ft.done != ft.total {
+		return true, fmt.Errorf("%w: connection closed after %d of %d bytes", ErrFetchFailed, ft.done, ft.total)
+	}
+	return false, nil
+}
+
+// reset truncates the download to its first n bytes
+func (ft *fetchTransfer) reset(n int64) error {
+	if err := ft.file.Truncate(n); err != nil {
+		return err
+	}
+	if _, err := ft.file.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+	ft.done = n
+	return nil
+}
+
+// fetchProgress updates a fetch job's byte counts and broadcasts them when
+// the percentage changed, every buffer's worth of data while the size is
+// unknown, or when forced
+func (s *jobService) fetchProgress(ft *fetchTransfer, force bool) {
+	job := ft.run.job
+	s.jobsMu.Lock()
+	job.BytesDone = ft.done
+	job.BytesTotal = ft.total
+
+	progress := job.Progress
+	if ft.total > 0 {
+		progress = int(ft.done * 100 / ft.total)
+	}
+	changed := force || progress != job.Progress || (ft.total == 0 && ft.done-ft.reported >= config.FileCopyBufferSize)
+	if changed {
+		job.Progress = progress
+		ft.reported = ft.done
+	}
+	s.jobsMu.Unlock()
+	if changed {
+		s.broadcastUpdate(job)
+	}
+}
+
+// finishFetch checks a complete download against the expected checksum and
+// moves it into place
+func (s *jobService) finishFetch(ctx context.Context, run *jobRun, tmpPath, dst string) error {
+	job := run.job
+	actual, err := s.hashFile(ctx, tmpPath)
+	if err != nil {
+		s.fs.Remove(tmpPath)
+		return err
+	}
+	if job.Fetch.Checksum != "" && actual != job.Fetch.Checksum {
+		s.fs.Remove(tmpPath)
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, job.SourcePath)
+	}
+	if err := s.fs.Rename(tmpPath, dst); err != nil {
+		s.fs.Remove(tmpPath)
+		return err
+	}
+
+	s.resultsMu.Lock()
+	res := s.result(job.ID)
+	res.checksums = append(res.checksums, model.FileChecksum{
+		Path:      job.SourcePath,
+		DestPath:  dst,
+		Algorithm: model.ChecksumSHA256,
+		Hash:      actual,
+	})
+	s.resultsMu.Unlock()
+	if job.Fetch.Checksum != "" {
+		s.jobsMu.Lock()
+		job.VerifiedCount++
+		s.jobsMu.Unlock()
+	}
+	s.recordHash(dst, actual)
+	return nil
+}
+
+// takeFetchPartial hands the data a failed fetch job left over to the job
+// retrying it
+func (s *jobService) takeFetchPartial(jobID string) *fetchPartial {
+	if jobID == "" {
+		return nil
+	}
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	res, ok := s.results[jobID]
+	if !ok || res.fetchPartial == nil {
+		return nil
+	}
+	partial := res.fetchPartial
+	res.fetchPartial = nil
+	return partial
+}
+
+// fetchValidator returns the validator a range request can be made under:
+// a strong ETag, or else the modification time
+func fetchValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// parseContentRange parses a "bytes start-end/total" header, returning a
+// total of 0 when it is unknown
+func parseContentRange(value string) (start, total int64, ok bool) {
+	spec, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rangePart, totalPart, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startPart, _, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, total, true
+}
@@ -0,0 +1,351 @@
+// Package service provides business logic for the file manager.
+// This file contains property-based tests for fetch jobs.
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// flakyServer serves content with range support, cutting the connection of
+// successive requests short after the given percentages of their bodies
+type flakyServer struct {
+	content []byte
+	cuts    []int
+
+	mu       sync.Mutex
+	ranges   []string // Range header of every request
+	received int64    // Bytes the client holds after the last request
+	mismatch bool     // A request did not resume where the last one stopped
+}
+
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	n := len(f.ranges)
+	f.ranges = append(f.ranges, r.Header.Get("Range"))
+	expected := ""
+	if f.received > 0 {
+		expected = fmt.Sprintf("bytes=%d-", f.received)
+	}
+	if r.Header.Get("Range") != expected {
+		f.mismatch = true
+	}
+	start := f.received
+	if r.Header.Get("Range") == "" {
+		start = 0
+	}
+	f.received = start
+	limit := int64(-1)
+	if n < len(f.cuts) {
+		limit = (int64(len(f.content)) - start) * int64(f.cuts[n]) / 100
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("ETag", `"v1"`)
+	http.ServeContent(&cuttingWriter{ResponseWriter: w, server: f, limit: limit}, r, "", time.Time{}, bytes.NewReader(f.content))
+}
+
+// cuttingWriter aborts the response once limit body bytes were written,
+// unless limit is negative
+type cuttingWriter struct {
+	http.ResponseWriter
+	server  *flakyServer
+	limit   int64
+	written int64
+}
+
+func (c *cuttingWriter) Write(p []byte) (int, error) {
+	if c.limit >= 0 && c.written+int64(len(p)) > c.limit {
+		p = p[:c.limit-c.written]
+		c.ResponseWriter.Write(p)
+		c.count(len(p))
+		c.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	n, err := c.ResponseWriter.Write(p)
+	c.count(n)
+	return n, err
+}
+
+func (c *cuttingWriter) count(n int) {
+	c.written += int64(n)
+	c.server.mu.Lock()
+	c.server.received += int64(n)
+	c.server.mu.Unlock()
+}
+
+// setupFetchJobService creates a started job service that may fetch from
+// the loopback addresses httptest servers listen on unless told otherwise
+func setupFetchJobService(t *testing.T, cfg FetchConfig) (JobService, *filesystem.AferoFS) {
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media", 0755)
+	fs.MkdirAll("/data/readonly", 0755)
+
+	svc := NewJobService(fs, nil, JobServiceConfig{
+		Workers: 2,
+		MountPoints: []model.MountPoint{
+			{Name: "media", Path: "/data/media"},
+			{Name: "readonly", Path: "/data/readonly", ReadOnly: true},
+		},
+		Fetch: cfg,
+	})
+	svc.(*jobService).fetchRetryDelay = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svc.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		svc.Stop()
+	})
+	return svc, fs
+}
+
+// leftovers lists the temp files of fetch jobs in a directory
+func leftovers(fs *filesystem.AferoFS, dir string) []string {
+	var names []string
+	entries, _ := fs.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".fetching.") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// **Feature: homelab-file-manager, Property 38: Resumable Fetch Jobs**
+//
+// Property: For any content and any sequence of connections cut short, fewer than the number
+// of attempts, a fetch job SHALL complete with the destination holding exactly the content,
+// report every byte in its progress, and resume each request after the bytes already received.
+// A fetch with a wrong expected checksum SHALL fail and leave nothing at the destination.
+
+func TestProperty_ResumableFetchJobs(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 50
+	parameters.MaxSize = 4
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("interrupted downloads resume and complete", prop.ForAll(
+		func(size int, cuts []int, checksumMode int, intoDir bool) bool {
+			svc, fs := setupFetchJobService(t, FetchConfig{AllowHosts: []string{"127.0.0.1"}})
+
+			content := make([]byte, size)
+			for i := range content {
+				content[i] = byte(i*7 + size)
+			}
+			server := &flakyServer{content: content, cuts: cuts}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			sum := sha256.Sum256(content)
+			opts := &model.FetchOptions{}
+			switch checksumMode {
+			case 1:
+				opts.Checksum = "sha256:" + hex.EncodeToString(sum[:])
+			case 2:
+				sum[0]++
+				opts.Checksum = hex.EncodeToString(sum[:])
+			}
+			dest, expectedPath := "/data/media/downloads/file.iso", "/data/media/downloads/file.iso"
+			if intoDir {
+				dest, expectedPath = "/data/media", "/data/media/file.iso"
+			}
+
+			ctx := context.Background()
+			job, err := svc.Create(ctx, model.JobParams{
+				Type:       model.JobTypeFetch,
+				SourcePath: ts.URL + "/images/file.iso",
+				DestPath:   dest,
+				Fetch:      opts,
+			})
+			if err != nil {
+				return false
+			}
+			final := waitForTerminal(ctx, svc, job.ID)
+			if final == nil || len(leftovers(fs, "/data/media")) > 0 || len(leftovers(fs, "/data/media/downloads")) > 0 {
+				return false
+			}
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if server.mismatch || len(server.ranges) != len(cuts)+1 {
+				return false
+			}
+
+			if checksumMode == 2 {
+				exists, _ := fs.Exists(expectedPath)
+				return final.State == model.JobStateFailed && !exists
+			}
+			data, err := fs.ReadFile(expectedPath)
+			return final.State == model.JobStateCompleted && err == nil && bytes.Equal(data, content) &&
+				final.DestPath == expectedPath && final.BytesDone == int64(size) && final.Progress == 100
+		},
+		gen.IntRange(1, 300000),
+		gen.SliceOfN(3, gen.IntRange(0, 99)).Map(func(cuts []int) []int { return cuts[:len(cuts)%4] }),
+		gen.IntRange(0, 2),
+		gen.Bool(),
+	))
+
+	properties.TestingRun(t)
+}
+
+func TestFetchHostPolicy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			u, _ := url.Parse("http://" + r.Host)
+			http.Redirect(w, r, "http://localhost:"+u.Port()+"/file", http.StatusFound)
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	ctx := context.Background()
+
+	fetch := func(svc JobService, source, dest string) (*model.Job, error) {
+		job, err := svc.Create(ctx, model.JobParams{Type: model.JobTypeFetch, SourcePath: source, DestPath: dest})
+		if err != nil {
+			return nil, err
+		}
+		return waitForTerminal(ctx, svc, job.ID), nil
+	}
+
+	// Without an allow list, only public addresses may be reached
+	svc, fs := setupFetchJobService(t, FetchConfig{})
+	if _, err := fetch(svc, ts.URL+"/file", "/data/media/a"); !errors.Is(err, ErrFetchNotAllowed) {
+		t.Fatalf("expected a loopback address to be refused, got %v", err)
+	}
+	job, err := fetch(svc, "http://localhost:"+u.Port()+"/file", "/data/media/a")
+	if err != nil || job.State != model.JobStateFailed || !strings.Contains(job.Error, ErrFetchNotAllowed.Error()) {
+		t.Fatalf("expected a name resolving to loopback to fail, got %+v (%v)", job, err)
+	}
+	if exists, _ := fs.Exists("/data/media/a"); exists {
+		t.Fatal("expected nothing to be written")
+	}
+
+	for _, tc := range []struct {
+		source, dest string
+		expected     error
+	}{
+		{"file:///etc/passwd", "/data/media/a", ErrInvalidJobParams},
+		{"ftp://127.0.0.1/file", "/data/media/a", ErrInvalidJobParams},
+		{ts.URL + "/file", "/data/other/a", ErrMountPointNotFound},
+		{ts.URL + "/file", "/data/readonly/a", ErrPermissionDenied},
+	} {
+		svc, _ := setupFetchJobService(t, FetchConfig{AllowHosts: []string{"127.0.0.1"}})
+		if _, err := fetch(svc, tc.source, tc.dest); !errors.Is(err, tc.expected) {
+			t.Errorf("fetch %s to %s: expected %v, got %v", tc.source, tc.dest, tc.expected, err)
+		}
+	}
+
+	// Deny wins over allow
+	svc, _ = setupFetchJobService(t, FetchConfig{AllowHosts: []string{"127.0.0.1"}, DenyHosts: []string{"127.0.0.0/8"}})
+	if _, err := fetch(svc, ts.URL+"/file", "/data/media/a"); !errors.Is(err, ErrFetchNotAllowed) {
+		t.Fatalf("expected a denied range to be refused, got %v", err)
+	}
+
+	// Redirects must stay on allowed hosts
+	svc, fs = setupFetchJobService(t, FetchConfig{AllowHosts: []string{"127.0.0.1"}})
+	job, err = fetch(svc, ts.URL+"/redirect", "/data/media/a")
+	if err != nil || job.State != model.JobStateFailed {
+		t.Fatalf("expected a redirect to another host to fail, got %+v (%v)", job, err)
+	}
+	job, err = fetch(svc, ts.URL+"/file", "/data/media/b")
+	if data, _ := fs.ReadFile("/data/media/b"); err != nil || job.State != model.JobStateCompleted || string(data) != "content" {
+		t.Fatalf("expected an allowed host to be fetched, got %+v (%v)", job, err)
+	}
+}
+
+func TestFetchSizeLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	for _, chunked := range []bool{false, true} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if chunked {
+				// No Content-Length, so the limit is only noticed while reading
+				w.Write(content[:2048])
+				w.(http.Flusher).Flush()
+				w.Write(content[2048:])
+				return
+			}
+			w.Write(content)
+		}))
+
+		svc, fs := setupFetchJobService(t, FetchConfig{AllowHosts: []string{"127.0.0.1"}, MaxBytes: 8192})
+		job, _ := svc.Create(context.Background(), model.JobParams{
+			Type:       model.JobTypeFetch,
+			SourcePath: ts.URL + "/big.bin",
+			DestPath:   "/data/media",
+			Fetch:      &model.FetchOptions{MaxBytes: 3000},
+		})
+		final := waitForTerminal(context.Background(), svc, job.ID)
+		ts.Close()
+
+		if final == nil || final.State != model.JobStateFailed || final.Error != ErrFetchTooLarge.Error() {
+			t.Fatalf("chunked=%v: expected the download to be refused, got %+v", chunked, final)
+		}
+		if exists, _ := fs.Exists("/data/media/big.bin"); exists || len(leftovers(fs, "/data/media")) > 0 {
+			t.Fatalf("chunked=%v: expected nothing to be left behind", chunked)
+		}
+	}
+}
+
+func TestFetchRetryResumesPartialDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	// Every attempt of the first job is cut short
+	server := &flakyServer{content: content, cuts: []int{30, 30, 30, 30, 30}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	svc, fs := setupFetchJobService(t, FetchConfig{AllowHosts: []string{"127.0.0.1"}})
+	ctx := context.Background()
+	job, err := svc.Create(ctx, model.JobParams{Type: model.JobTypeFetch, SourcePath: ts.URL + "/data.txt", DestPath: "/data/media/data.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := waitForTerminal(ctx, svc, job.ID)
+	if failed == nil || failed.State != model.JobStateFailed || len(leftovers(fs, "/data/media")) != 1 {
+		t.Fatalf("expected a failed job with its partial data kept, got %+v", failed)
+	}
+
+	server.mu.Lock()
+	received := server.received
+	server.mu.Unlock()
+
+	retry, err := svc.Retry(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := waitForTerminal(ctx, svc, retry.ID)
+	if done == nil || done.State != model.JobStateCompleted {
+		t.Fatalf("expected the retry to complete, got %+v", done)
+	}
+	if data, _ := fs.ReadFile("/data/media/data.txt"); !bytes.Equal(data, content) {
+		t.Fatal("expected the retry to assemble the whole file")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if last := server.ranges[len(server.ranges)-1]; last != fmt.Sprintf("bytes=%d-", received) || server.mismatch {
+		t.Fatalf("expected the retry to resume at %d, got %q", received, last)
+	}
+	if len(leftovers(fs, "/data/media")) > 0 {
+		t.Fatal("expected the partial data to be moved into place")
+	}
+}
@@ -90,7 +90,7 @@ func (s *fileService) ListMountPoints() []model.MountPoint {
 	return s.mountPoints
 }
 
-// GetDriveStats returns disk usage statistics for all mount points
+// GetDriveStats returns disk usage statistics for all local mount points
 // Mount points with auto_discover enabled are expanded to their discovered sub-mounts
 func (s *fileService) GetDriveStats(ctx context.Context) (*model.DriveStatsResponse, error) {
 	// Expand auto-discover mount points
@@ -98,6 +98,10 @@ func (s *fileService) GetDriveStats(ctx context.Context) (*model.DriveStatsRespo
 	drives := make([]model.DriveStats, 0, len(effectiveMounts))
 
 	for _, mount := range effectiveMounts {
+		// Remote mount points have no local disk to report
+		if mount.IsRemote() {
+			continue
+		}
 		stats, err := getDiskUsage(mount.Path)
 		if err != nil {
 			// Skip mounts we can't stat, but continue with others
@@ -184,6 +188,9 @@ func (s *fileService) List(ctx context.Context, path string, opts model.ListOpti
 	var filtered []fs.DirEntry
 	filterLower := strings.ToLower(opts.Filter)
 	for _, entry := range entries {
+		if fileutil.IsUploadTemp(entry.Name()) {
+			continue
+		}
 		if opts.Filter == "" || strings.Contains(strings.ToLower(entry.Name()), filterLower) {
 			filtered = append(filtered, entry)
 		}
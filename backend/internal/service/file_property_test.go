@@ -826,3 +826,19 @@ func TestProperty_FileDeletionCorrectness(t *testing.T) {
 
 	properties.TestingRun(t)
 }
+
+// TestListSkipsUploadTempFiles checks that the temp files of unfinished
+// uploads are left out of listings
+func TestListSkipsUploadTempFiles(t *testing.T) {
+	svc, fs := setupTestFileService()
+	fs.WriteFile("/data/media/a.txt", []byte("a"), 0644)
+	fs.WriteFile("/data/media/b.txt.uploading.1234", []byte("partial"), 0644)
+
+	list, err := svc.List(context.Background(), "media", model.DefaultListOptions())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if list.TotalCount != 1 || len(list.Items) != 1 || list.Items[0].Name != "a.txt" {
+		t.Fatalf("expected only a.txt to be listed, got %+v", list.Items)
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+)
+
+// hashIndexCompactMin is the number of superseded log lines tolerated before
+// the hash index file is rewritten
+const hashIndexCompactMin = 1024
+
+// HashIndex maps content hashes to files that hold that content so that an
+// upload of a file the server already has can be satisfied without the
+// transfer. Entries are trusted only while the file's size and modification
+// time are unchanged; stale entries are dropped when they are looked up.
+type HashIndex interface {
+	// Record notes that path currently holds content with the given SHA-256
+	// hex digest
+	Record(path, hash string) error
+	// Lookup returns a file of the given size whose content has the given
+	// hash. Candidates for which allow returns false are never examined, so
+	// callers can restrict the answer to files the requester may read.
+	Lookup(hash string, size int64, allow func(path string) bool) (string, bool)
+	// Rename moves the entries for oldPath, and for anything below it when
+	// it is a directory, to newPath
+	Rename(oldPath, newPath string) error
+	// Forget drops the entries for path and for anything below it
+	Forget(path string) error
+}
+
+// hashEntry is one line of the hash index file. An entry without a hash
+// removes the path from the index.
+type hashEntry struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	ModTime int64  `json:"mtime,omitempty"`
+}
+
+// hashIndex implements HashIndex on top of an append-only JSON lines file
+type hashIndex struct {
+	fs       filesystem.FS
+	filePath string
+	mu       sync.Mutex
+	loaded   bool
+	lines    int
+	byPath   map[string]hashEntry
+	byHash   map[string]map[string]struct{}
+}
+
+// HashIndexConfig holds configuration for the hash index
+type HashIndexConfig struct {
+	DataDir string
+}
+
+// NewHashIndex creates a hash index persisted in the data directory
+func NewHashIndex(fsys filesystem.FS, cfg HashIndexConfig) HashIndex {
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = config.DefaultDataDir
+	}
+	return &hashIndex{
+		fs:       fsys,
+		filePath: filepath.Join(dataDir, config.HashIndexFileName),
+		byPath:   make(map[string]hashEntry),
+		byHash:   make(map[string]map[string]struct{}),
+	}
+}
+
+// Record notes that path currently holds content with the given hash
+func (h *hashIndex) Record(path, hash string) error {
+	info, err := h.fs.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	entry := hashEntry{
+		Path:    filepath.Clean(path),
+		Hash:    strings.ToLower(hash),
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return err
+	}
+	if current, ok := h.byPath[entry.Path]; ok && current == entry {
+		return nil
+	}
+	h.apply(entry)
+	return h.append(entry)
+}
+
+// Lookup returns a file of the given size whose content has the given hash
+func (h *hashIndex) Lookup(hash string, size int64, allow func(path string) bool) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return "", false
+	}
+
+	candidates := make([]string, 0, len(h.byHash[strings.ToLower(hash)]))
+	for path := range h.byHash[strings.ToLower(hash)] {
+		candidates = append(candidates, path)
+	}
+	sort.Strings(candidates)
+
+	var stale []hashEntry
+	defer func() {
+		for _, entry := range stale {
+			h.apply(entry)
+		}
+		if len(stale) > 0 {
+			h.append(stale...)
+		}
+	}()
+
+	for _, path := range candidates {
+		entry := h.byPath[path]
+		if entry.Size != size || (allow != nil && !allow(path)) {
+			continue
+		}
+		info, err := h.fs.Stat(path)
+		if err != nil || info.IsDir() || info.Size() != entry.Size || info.ModTime().UnixNano() != entry.ModTime {
+			stale = append(stale, hashEntry{Path: path})
+			continue
+		}
+		return path, true
+	}
+	return "", false
+}
+
+// Rename moves the entries at or below oldPath to newPath
+func (h *hashIndex) Rename(oldPath, newPath string) error {
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	if oldPath == newPath {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return err
+	}
+
+	var changes []hashEntry
+	for _, entry := range h.below(newPath) {
+		// Whatever the destination held has been replaced
+		changes = append(changes, hashEntry{Path: entry.Path})
+	}
+	for _, entry := range h.below(oldPath) {
+		changes = append(changes, hashEntry{Path: entry.Path})
+		entry.Path = newPath + strings.TrimPrefix(entry.Path, oldPath)
+		changes = append(changes, entry)
+	}
+	for _, entry := range changes {
+		h.apply(entry)
+	}
+	return h.append(changes...)
+}
+
+// Forget drops the entries at or below path
+func (h *hashIndex) Forget(path string) error {
+	path = filepath.Clean(path)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return err
+	}
+
+	var changes []hashEntry
+	for _, entry := range h.below(path) {
+		changes = append(changes, hashEntry{Path: entry.Path})
+		h.apply(hashEntry{Path: entry.Path})
+	}
+	return h.append(changes...)
+}
+
+// below returns the entries for path and for anything inside it, ordered by
+// path. The caller must hold mu.
+func (h *hashIndex) below(path string) []hashEntry {
+	prefix := path + string(filepath.Separator)
+	if path == string(filepath.Separator) {
+		prefix = path
+	}
+	var result []hashEntry
+	for p, entry := range h.byPath {
+		if p == path || strings.HasPrefix(p, prefix) {
+			result = append(result, entry)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// apply updates the in-memory maps with one log entry. The caller must hold mu.
+func (h *hashIndex) apply(entry hashEntry) {
+	if old, ok := h.byPath[entry.Path]; ok {
+		delete(h.byHash[old.Hash], entry.Path)
+		if len(h.byHash[old.Hash]) == 0 {
+			delete(h.byHash, old.Hash)
+		}
+		delete(h.byPath, entry.Path)
+	}
+	if entry.Hash == "" {
+		return
+	}
+	h.byPath[entry.Path] = entry
+	if h.byHash[entry.Hash] == nil {
+		h.byHash[entry.Hash] = make(map[string]struct{})
+	}
+	h.byHash[entry.Hash][entry.Path] = struct{}{}
+}
+
+// load reads the index file on first use. Lines that cannot be parsed, such
+// as one cut short by a crash, are skipped. The caller must hold mu.
+func (h *hashIndex) load() error {
+	if h.loaded {
+		return nil
+	}
+
+	exists, err := h.fs.Exists(h.filePath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		data, err := h.fs.ReadFile(h.filePath)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry hashEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Path == "" {
+				continue
+			}
+			h.apply(entry)
+			h.lines++
+		}
+	}
+
+	h.loaded = true
+	return nil
+}
+
+// append writes entries to the end of the index file, rewriting the file
+// instead once superseded lines outnumber live ones. The caller must hold mu.
+func (h *hashIndex) append(entries ...hashEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	h.lines += len(entries)
+	if h.lines-len(h.byPath) > hashIndexCompactMin && h.lines > 2*len(h.byPath) {
+		return h.compact()
+	}
+
+	if err := h.fs.MkdirAll(filepath.Dir(h.filePath), 0755); err != nil {
+		return err
+	}
+	f, err := h.fs.OpenFile(h.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(encodeHashEntries(entries))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// compact rewrites the index file with only the live entries. The caller
+// must hold mu.
+func (h *hashIndex) compact() error {
+	entries := make([]hashEntry, 0, len(h.byPath))
+	for _, entry := range h.byPath {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	if err := h.fs.MkdirAll(filepath.Dir(h.filePath), 0755); err != nil {
+		return err
+	}
+	tmpPath := h.filePath + ".tmp"
+	if err := h.fs.WriteFile(tmpPath, encodeHashEntries(entries), 0644); err != nil {
+		return err
+	}
+	if err := h.fs.Rename(tmpPath, h.filePath); err != nil {
+		return err
+	}
+	h.lines = len(entries)
+	return nil
+}
+
+// encodeHashEntries renders entries as JSON lines
+func encodeHashEntries(entries []hashEntry) []byte {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
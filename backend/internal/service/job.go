@@ -3,9 +3,17 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,6 +21,8 @@ import (
 	"github.com/homelab/filemanager/internal/config"
 	"github.com/homelab/filemanager/internal/model"
 	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+	"github.com/homelab/filemanager/internal/pkg/validator"
 	"github.com/homelab/filemanager/internal/websocket"
 )
 
@@ -22,18 +32,36 @@ var (
 	ErrJobNotCancellable = errors.New("job cannot be cancelled")
 	ErrInvalidJobType  = errors.New("invalid job type")
 	ErrInvalidJobParams = errors.New("invalid job parameters")
+	ErrJobNotRetryable  = errors.New("job cannot be retried")
+	ErrChecksumMismatch = errors.New("checksum mismatch after copy")
+	ErrJobNotQueued     = errors.New("job is not queued")
 )
 
-// JobService defines the job operations service interface
+// JobService defines the job operations service interface. The jobs it
+// returns are snapshots; poll Get to follow a running job.
 type JobService interface {
 	// Create creates a new background job
 	Create(ctx context.Context, params model.JobParams) (*model.Job, error)
+	// Validate checks job parameters the way Create does, without creating a job
+	Validate(params model.JobParams) error
 	// Get returns a job by ID
 	Get(ctx context.Context, jobID string) (*model.Job, error)
 	// List returns all jobs
 	List(ctx context.Context) ([]*model.Job, error)
 	// Cancel cancels a running job
 	Cancel(ctx context.Context, jobID string) error
+	// Errors returns the per-item errors recorded for a job
+	Errors(ctx context.Context, jobID string) ([]model.JobError, error)
+	// Checksums returns the verified file hashes recorded for a job
+	Checksums(ctx context.Context, jobID string) ([]model.FileChecksum, error)
+	// Retry creates a new job that re-runs the failed items of a finished job
+	Retry(ctx context.Context, jobID string) (*model.Job, error)
+	// SyncReport returns the changes a sync job planned or applied
+	SyncReport(ctx context.Context, jobID string) (*model.SyncReport, error)
+	// Queue returns the pending jobs in the order they will run
+	Queue(ctx context.Context) ([]*model.Job, error)
+	// Move places a pending job at a 1-based position in the queue
+	Move(ctx context.Context, jobID string, position int) (*model.Job, error)
 	// Start starts the job executor
 	Start(ctx context.Context)
 	// Stop stops the job executor
@@ -51,13 +79,33 @@ type runningJob struct {
 type jobService struct {
 	fs          filesystem.FS
 	hub         *websocket.Hub
-	jobs        sync.Map // map[string]*runningJob
-	allJobs     sync.Map // map[string]*model.Job - stores all jobs including completed
-	workQueue   chan *model.Job
+	jobs        sync.Map     // map[string]*runningJob
+	allJobs     sync.Map     // map[string]*model.Job - stores all jobs including completed
+	jobsMu      sync.RWMutex // guards the fields of stored jobs that change while they run
+	queue       *jobQueue
 	workers     int
 	wg          sync.WaitGroup
 	stopCh      chan struct{}
 	mountPoints []model.MountPoint
+	resultsMu   sync.RWMutex
+	results     map[string]*jobResult // per-item results keyed by job ID
+	asRoot      bool                  // ownership and xattrs are preserved only as root
+	hashes      HashIndex             // optional, fed with the hashes of verified copies
+
+	fetchPolicy       *fetchPolicy
+	fetchClient       *http.Client
+	fetchMaxBytes     int64
+	fetchRetryDelay   time.Duration
+	fetchStallTimeout time.Duration
+}
+
+// jobResult holds the per-item outcomes recorded while a job runs
+type jobResult struct {
+	errors     []model.JobError
+	checksums  []model.FileChecksum
+	syncReport *model.SyncReport
+
+	fetchPartial *fetchPartial // Left by a failed fetch job for its retry
 }
 
 
@@ -65,6 +113,8 @@ type jobService struct {
 type JobServiceConfig struct {
 	Workers     int
 	MountPoints []model.MountPoint
+	HashIndex   HashIndex // Records verified copies for upload deduplication, optional
+	Fetch       FetchConfig
 }
 
 // NewJobService creates a new job service
@@ -74,13 +124,23 @@ func NewJobService(fsys filesystem.FS, hub *websocket.Hub, cfg JobServiceConfig)
 		workers = 4 // default worker count
 	}
 
+	policy := newFetchPolicy(cfg.Fetch)
 	return &jobService{
 		fs:          fsys,
 		hub:         hub,
-		workQueue:   make(chan *model.Job, 100),
+		queue:       newJobQueue(),
 		workers:     workers,
 		stopCh:      make(chan struct{}),
 		mountPoints: cfg.MountPoints,
+		results:     make(map[string]*jobResult),
+		asRoot:      os.Geteuid() == 0,
+		hashes:      cfg.HashIndex,
+
+		fetchPolicy:       policy,
+		fetchClient:       policy.client(),
+		fetchMaxBytes:     cfg.Fetch.MaxBytes,
+		fetchRetryDelay:   config.FetchRetryDelay,
+		fetchStallTimeout: config.FetchStallTimeout,
 	}
 }
 
@@ -107,14 +167,11 @@ func (s *jobService) worker(ctx context.Context) {
 	defer s.wg.Done()
 
 	for {
-		select {
-		case <-ctx.Done():
+		job := s.queue.next(ctx, s.stopCh)
+		if job == nil {
 			return
-		case <-s.stopCh:
-			return
-		case job := <-s.workQueue:
-			s.execute(ctx, job)
 		}
+		s.execute(ctx, job)
 	}
 }
 
@@ -140,9 +197,16 @@ func (s *jobService) cleanupLoop(ctx context.Context) {
 func (s *jobService) cleanupHistory() {
 	cutoff := time.Now().Add(-config.JobRetentionPeriod)
 	s.allJobs.Range(func(key, value interface{}) bool {
-		job := value.(*model.Job)
-		if (job.State == model.JobStateCompleted || job.State == model.JobStateFailed || job.State == model.JobStateCancelled) && job.CompletedAt.Before(cutoff) {
+		job := s.snapshot(value.(*model.Job))
+		if job.State.IsTerminal() && job.CompletedAt.Before(cutoff) {
 			s.allJobs.Delete(key)
+			s.resultsMu.Lock()
+			if res, ok := s.results[job.ID]; ok && res.fetchPartial != nil {
+				// Nobody retried the fetch in time
+				s.fs.Remove(res.fetchPartial.path)
+			}
+			delete(s.results, job.ID)
+			s.resultsMu.Unlock()
 		}
 		return true
 	})
@@ -150,64 +214,159 @@ func (s *jobService) cleanupHistory() {
 
 // Create creates a new background job
 func (s *jobService) Create(ctx context.Context, params model.JobParams) (*model.Job, error) {
+	job, err := s.newJob(params)
+	if err != nil {
+		return nil, err
+	}
+	return s.submit(job), nil
+}
+
+// Validate checks job parameters the way Create does, without creating a job
+func (s *jobService) Validate(params model.JobParams) error {
+	_, err := s.newJob(params)
+	return err
+}
+
+// newJob validates job parameters and builds a pending job
+func (s *jobService) newJob(params model.JobParams) (*model.Job, error) {
+	syncOpts, err := validateJobParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var fetchOpts *model.FetchOptions
+	if params.Type == model.JobTypeFetch {
+		if fetchOpts, err = validateFetchParams(params); err != nil {
+			return nil, err
+		}
+		if err := s.checkFetchJob(params); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create job
+	job := &model.Job{
+		ID:              uuid.New().String(),
+		Type:            params.Type,
+		State:           model.JobStatePending,
+		Progress:        0,
+		SourcePath:      params.SourcePath,
+		DestPath:        params.DestPath,
+		ContinueOnError: params.ContinueOnError,
+		Verify:          params.Verify,
+		Items:           params.Items,
+		Sync:            syncOpts,
+		Fetch:           fetchOpts,
+		Owner:           params.Owner,
+		Priority:        params.Priority,
+		CreatedAt:       time.Now(),
+	}
+
+	if job.Priority == "" {
+		job.Priority = model.JobPriorityNormal
+	}
+
+	return job, nil
+}
+
+// checkWritableDest checks that a job's destination is on a mount point
+// that is not read-only
+func (s *jobService) checkWritableDest(dest string) error {
+	dest = filepath.Clean(dest)
+	for _, mount := range s.mountPoints {
+		root := filepath.Clean(mount.Path)
+		if dest == root || strings.HasPrefix(dest, root+string(filepath.Separator)) {
+			if mount.ReadOnly {
+				return ErrPermissionDenied
+			}
+			return nil
+		}
+	}
+	return ErrMountPointNotFound
+}
+
+// validateJobParams checks job parameters, returning the sync options with
+// defaults applied for sync jobs
+func validateJobParams(params model.JobParams) (*model.SyncOptions, error) {
 	// Validate job type
 	if !params.Type.IsValid() {
 		return nil, ErrInvalidJobType
 	}
 
 	// Validate parameters
-	if params.SourcePath == "" {
+	if params.SourcePath == "" || !params.Priority.IsValid() {
 		return nil, ErrInvalidJobParams
 	}
 
-	// Copy and move require destination path
-	if (params.Type == model.JobTypeCopy || params.Type == model.JobTypeMove) && params.DestPath == "" {
+	// Copy, move and sync require destination path
+	if params.Type.NeedsDestination() && params.DestPath == "" {
 		return nil, ErrInvalidJobParams
 	}
 
-	// Create job
-	job := &model.Job{
-		ID:         uuid.New().String(),
-		Type:       params.Type,
-		State:      model.JobStatePending,
-		Progress:   0,
-		SourcePath: params.SourcePath,
-		DestPath:   params.DestPath,
-		CreatedAt:  time.Now(),
+	// A fetch job's source is a URL
+	if params.Type == model.JobTypeFetch {
+		_, err := validateFetchParams(params)
+		return nil, err
 	}
 
-	// Store job
-	s.allJobs.Store(job.ID, job)
+	// Items must stay inside the source root
+	for _, item := range params.Items {
+		if _, err := validator.SanitizePath(params.SourcePath, item); err != nil {
+			return nil, ErrInvalidJobParams
+		}
+	}
 
-	// Queue job for execution
-	select {
-	case s.workQueue <- job:
-		// Job queued successfully
-	default:
-		// Queue is full, mark as failed
-		job.State = model.JobStateFailed
-		job.Error = "job queue is full"
-		job.CompletedAt = time.Now()
-		s.broadcastUpdate(job)
-		return job, nil
+	if params.Type != model.JobTypeSync {
+		return nil, nil
 	}
 
-	return job, nil
+	// Sync always covers the whole tree
+	if len(params.Items) > 0 {
+		return nil, ErrInvalidJobParams
+	}
+	// Overlapping trees would copy the source into itself, or delete it
+	if pathsOverlap(params.SourcePath, params.DestPath) {
+		return nil, ErrInvalidJobParams
+	}
+	return validateSyncOptions(params.Sync)
+}
+
+// submit stores a job and queues it for execution, returning a snapshot
+func (s *jobService) submit(job *model.Job) *model.Job {
+	s.allJobs.Store(job.ID, job)
+	position := s.queue.push(job)
+	snapshot := s.snapshot(job)
+	snapshot.QueuePosition = position
+	return snapshot
+}
+
+// snapshot returns a copy of a stored job that is safe to read while the
+// job runs. Its queue position is not set.
+func (s *jobService) snapshot(job *model.Job) *model.Job {
+	s.jobsMu.RLock()
+	defer s.jobsMu.RUnlock()
+	clone := *job
+	return &clone
 }
 
-// Get returns a job by ID
+// Get returns a snapshot of a job by ID
 func (s *jobService) Get(ctx context.Context, jobID string) (*model.Job, error) {
 	if value, ok := s.allJobs.Load(jobID); ok {
-		return value.(*model.Job), nil
+		job := s.snapshot(value.(*model.Job))
+		job.QueuePosition = s.queue.position(jobID)
+		return job, nil
 	}
 	return nil, ErrJobNotFound
 }
 
-// List returns all jobs
+// List returns snapshots of all jobs
 func (s *jobService) List(ctx context.Context) ([]*model.Job, error) {
+	positions := s.queue.positions()
 	var jobs []*model.Job
 	s.allJobs.Range(func(key, value interface{}) bool {
-		jobs = append(jobs, value.(*model.Job))
+		job := s.snapshot(value.(*model.Job))
+		job.QueuePosition = positions[job.ID]
+		jobs = append(jobs, job)
 		return true
 	})
 	return jobs, nil
@@ -224,24 +383,165 @@ func (s *jobService) Cancel(ctx context.Context, jobID string) error {
 	job := jobValue.(*model.Job)
 
 	// Check if job is in a cancellable state
+	s.jobsMu.Lock()
 	if job.State != model.JobStatePending && job.State != model.JobStateRunning {
+		s.jobsMu.Unlock()
 		return ErrJobNotCancellable
 	}
+	job.State = model.JobStateCancelled
+	job.CompletedAt = time.Now()
+	s.jobsMu.Unlock()
 
-	// If job is running, cancel it
+	// Pending jobs leave the queue, running jobs are cancelled
+	s.queue.remove(jobID)
 	if rj, ok := s.jobs.Load(jobID); ok {
 		runningJob := rj.(*runningJob)
 		runningJob.cancel()
 	}
-
-	// Update job state
-	job.State = model.JobStateCancelled
-	job.CompletedAt = time.Now()
 	s.broadcastUpdate(job)
 
 	return nil
 }
 
+// Queue returns snapshots of the pending jobs in the order they will run
+func (s *jobService) Queue(ctx context.Context) ([]*model.Job, error) {
+	queued := s.queue.snapshot()
+	jobs := make([]*model.Job, len(queued))
+	for i, job := range queued {
+		jobs[i] = s.snapshot(job)
+		jobs[i].QueuePosition = i + 1
+	}
+	return jobs, nil
+}
+
+// Move places a pending job at a 1-based position in the queue
+func (s *jobService) Move(ctx context.Context, jobID string, position int) (*model.Job, error) {
+	value, ok := s.allJobs.Load(jobID)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if !s.queue.move(jobID, position) {
+		return nil, ErrJobNotQueued
+	}
+	job := s.snapshot(value.(*model.Job))
+	job.QueuePosition = s.queue.position(jobID)
+	return job, nil
+}
+
+// Errors returns the per-item errors recorded for a job
+func (s *jobService) Errors(ctx context.Context, jobID string) ([]model.JobError, error) {
+	if _, ok := s.allJobs.Load(jobID); !ok {
+		return nil, ErrJobNotFound
+	}
+
+	s.resultsMu.RLock()
+	defer s.resultsMu.RUnlock()
+	result := make([]model.JobError, 0)
+	if res, ok := s.results[jobID]; ok {
+		result = append(result, res.errors...)
+	}
+	return result, nil
+}
+
+// Checksums returns the verified file hashes recorded for a job
+func (s *jobService) Checksums(ctx context.Context, jobID string) ([]model.FileChecksum, error) {
+	if _, ok := s.allJobs.Load(jobID); !ok {
+		return nil, ErrJobNotFound
+	}
+
+	s.resultsMu.RLock()
+	defer s.resultsMu.RUnlock()
+	result := make([]model.FileChecksum, 0)
+	if res, ok := s.results[jobID]; ok {
+		result = append(result, res.checksums...)
+	}
+	return result, nil
+}
+
+// result returns the result record for a job, creating it if needed.
+// The caller must hold resultsMu.
+func (s *jobService) result(jobID string) *jobResult {
+	res, ok := s.results[jobID]
+	if !ok {
+		res = &jobResult{}
+		s.results[jobID] = res
+	}
+	return res
+}
+
+// Retry creates a new job that re-runs the failed items of a finished job.
+// Jobs that failed outright or were cancelled are re-run in full.
+func (s *jobService) Retry(ctx context.Context, jobID string) (*model.Job, error) {
+	value, ok := s.allJobs.Load(jobID)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	prev := s.snapshot(value.(*model.Job))
+
+	params := model.JobParams{
+		Type:            prev.Type,
+		SourcePath:      prev.SourcePath,
+		DestPath:        prev.DestPath,
+		ContinueOnError: prev.ContinueOnError,
+		Verify:          prev.Verify,
+		Items:           prev.Items,
+		Sync:            prev.Sync,
+		Fetch:           prev.Fetch,
+		Owner:           prev.Owner,
+		Priority:        prev.Priority,
+	}
+
+	switch prev.State {
+	case model.JobStateFailed, model.JobStateCancelled:
+		// Re-run everything the previous job covered
+	case model.JobStateCompletedWithErrors:
+		if prev.Type == model.JobTypeSync {
+			// A sync re-plans the whole tree and only redoes what still differs
+			break
+		}
+		items, err := s.failedItems(prev)
+		if err != nil {
+			return nil, err
+		}
+		params.Items = items
+	default:
+		return nil, ErrJobNotRetryable
+	}
+
+	job, err := s.newJob(params)
+	if err != nil {
+		return nil, err
+	}
+	job.RetryOf = prev.ID
+	return s.submit(job), nil
+}
+
+// failedItems converts a job's recorded errors into item paths relative to its source
+func (s *jobService) failedItems(job *model.Job) ([]string, error) {
+	jobErrors, err := s.Errors(context.Background(), job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	items := make([]string, 0, len(jobErrors))
+	for _, jobErr := range jobErrors {
+		rel, err := filepath.Rel(job.SourcePath, jobErr.Path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			// The failure was not attributable to a single item
+			return job.Items, nil
+		}
+		if !seen[rel] {
+			seen[rel] = true
+			items = append(items, rel)
+		}
+	}
+	if len(items) == 0 {
+		return nil, ErrJobNotRetryable
+	}
+	return items, nil
+}
+
 
 // execute runs a job
 func (s *jobService) execute(ctx context.Context, job *model.Job) {
@@ -254,19 +554,33 @@ func (s *jobService) execute(ctx context.Context, job *model.Job) {
 		cancel()
 	}()
 
+	// Skip jobs cancelled between leaving the queue and starting
+	s.jobsMu.Lock()
+	if job.State != model.JobStatePending {
+		s.jobsMu.Unlock()
+		return
+	}
+
 	// Update job state to running
 	job.State = model.JobStateRunning
 	job.StartedAt = time.Now()
+	s.jobsMu.Unlock()
 	s.broadcastUpdate(job)
 
+	run := &jobRun{job: job, failed: make(map[string]bool)}
+
 	var err error
 	switch job.Type {
 	case model.JobTypeCopy:
-		err = s.executeCopy(jobCtx, job)
+		err = s.executeCopy(jobCtx, run)
 	case model.JobTypeMove:
-		err = s.executeMove(jobCtx, job)
+		err = s.executeMove(jobCtx, run)
 	case model.JobTypeDelete:
-		err = s.executeDelete(jobCtx, job)
+		err = s.executeDelete(jobCtx, run)
+	case model.JobTypeSync:
+		err = s.executeSync(jobCtx, run)
+	case model.JobTypeFetch:
+		err = s.executeFetch(jobCtx, run)
 	default:
 		err = ErrInvalidJobType
 	}
@@ -277,52 +591,315 @@ func (s *jobService) execute(ctx context.Context, job *model.Job) {
 		return
 	}
 
-	// Update final state
+	// Update final state, unless the job was cancelled just now
+	s.jobsMu.Lock()
+	if job.State == model.JobStateCancelled {
+		s.jobsMu.Unlock()
+		return
+	}
 	if err != nil {
 		job.State = model.JobStateFailed
 		job.Error = err.Error()
+	} else if job.ErrorCount > 0 {
+		job.State = model.JobStateCompletedWithErrors
+		job.Progress = 100
 	} else {
 		job.State = model.JobStateCompleted
 		job.Progress = 100
 	}
 	job.CompletedAt = time.Now()
+	s.jobsMu.Unlock()
+	s.broadcastUpdate(job)
+}
+
+// jobRun holds the state of a single job execution shared by the recursive helpers
+type jobRun struct {
+	job    *model.Job
+	total  int             // units of work (files) for progress tracking
+	done   int             // units of work completed
+	failed map[string]bool // source paths that failed in continue-on-error mode
+}
+
+// jobTarget is a source/destination pair processed by a job
+type jobTarget struct {
+	src string
+	dst string
+}
+
+// targets returns the paths a job operates on: its source and destination,
+// or each of its items resolved under those roots
+func (s *jobService) targets(job *model.Job) []jobTarget {
+	if len(job.Items) == 0 {
+		return []jobTarget{{src: job.SourcePath, dst: job.DestPath}}
+	}
+
+	targets := make([]jobTarget, 0, len(job.Items))
+	for _, item := range job.Items {
+		// Items were validated against the source root in Create
+		src, _ := validator.SanitizePath(job.SourcePath, item)
+		var dst string
+		if job.DestPath != "" {
+			dst = filepath.Join(job.DestPath, filepath.Clean(string(filepath.Separator)+item))
+		}
+		targets = append(targets, jobTarget{src: src, dst: dst})
+	}
+	return targets
+}
+
+// itemFailed handles an error for a single item. In continue-on-error mode the
+// error is recorded and nil is returned so the caller can skip the item;
+// otherwise (or if the job was cancelled) the error is returned unchanged.
+func (s *jobService) itemFailed(ctx context.Context, run *jobRun, path string, err error) error {
+	if !run.job.ContinueOnError || ctx.Err() != nil {
+		return err
+	}
+
+	jobErr := model.JobError{
+		Code:    model.ErrCodeIOError,
+		Message: "failed to " + string(run.job.Type) + " item",
+		Path:    path,
+		Cause:   err.Error(),
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		jobErr.Code = model.ErrCodeNotFound
+	case errors.Is(err, fs.ErrPermission):
+		jobErr.Code = model.ErrCodePermissionDenied
+	case errors.Is(err, ErrChecksumMismatch):
+		jobErr.Code = model.ErrCodeChecksumMismatch
+	}
+
+	s.resultsMu.Lock()
+	res := s.result(run.job.ID)
+	res.errors = append(res.errors, jobErr)
+	s.resultsMu.Unlock()
+
+	run.failed[path] = true
+	s.jobsMu.Lock()
+	run.job.ErrorCount++
+	s.jobsMu.Unlock()
+	s.broadcastUpdate(run.job)
+	return nil
+}
+
+// advance marks n units of work as done and broadcasts progress changes
+func (s *jobService) advance(run *jobRun, n int) {
+	run.done += n
+	if run.total > 0 {
+		progress := int(float64(run.done) / float64(run.total) * 100)
+		if progress > 100 {
+			progress = 100
+		}
+		if progress != run.job.Progress {
+			s.setProgress(run.job, progress)
+		}
+	}
+}
+
+// setProgress updates a running job's progress and broadcasts it
+func (s *jobService) setProgress(job *model.Job, progress int) {
+	s.jobsMu.Lock()
+	job.Progress = progress
+	s.jobsMu.Unlock()
 	s.broadcastUpdate(job)
 }
 
 // executeCopy copies a file or directory
-func (s *jobService) executeCopy(ctx context.Context, job *model.Job) error {
-	srcInfo, err := s.fs.Stat(job.SourcePath)
+func (s *jobService) executeCopy(ctx context.Context, run *jobRun) error {
+	// A single file reports progress by bytes copied
+	if len(run.job.Items) == 0 {
+		srcInfo, err := s.fs.Stat(run.job.SourcePath)
+		if err != nil {
+			return err
+		}
+		if !srcInfo.IsDir() {
+			return s.copySingleFile(ctx, run, run.job.SourcePath, run.job.DestPath, srcInfo.Size())
+		}
+	}
+
+	targets := s.targets(run.job)
+	run.total = s.countTargets(run, targets)
+	for _, t := range targets {
+		if err := s.copyPath(ctx, run, t.src, t.dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySingleFile copies one file, reporting byte-level progress on the job
+func (s *jobService) copySingleFile(ctx context.Context, run *jobRun, src, dst string, totalSize int64) error {
+	return s.transferFile(ctx, run, src, dst, func(copied int64) {
+		if totalSize > 0 {
+			progress := int(float64(copied) / float64(totalSize) * 100)
+			if progress != run.job.Progress {
+				s.setProgress(run.job, progress)
+			}
+		}
+	})
+}
+
+// copyPath copies a file or directory as one unit of a job
+func (s *jobService) copyPath(ctx context.Context, run *jobRun, src, dst string) error {
+	info, err := s.fs.Stat(src)
+	if err != nil {
+		return s.itemFailed(ctx, run, src, err)
+	}
+
+	if info.IsDir() {
+		return s.copyDirRecursive(ctx, run, src, dst)
+	}
+
+	if err := s.transferFile(ctx, run, src, dst, nil); err != nil {
+		return s.itemFailed(ctx, run, src, err)
+	}
+	s.advance(run, 1)
+	return nil
+}
+
+// transferFile copies one file for a job. With verification enabled the source
+// is hashed while it is copied and the destination is re-read afterwards; on a
+// mismatch the destination is removed and ErrChecksumMismatch is returned.
+func (s *jobService) transferFile(ctx context.Context, run *jobRun, src, dst string, onProgress func(copied int64)) error {
+	srcInfo, err := s.fs.Stat(src)
 	if err != nil {
 		return err
 	}
 
-	if srcInfo.IsDir() {
-		return s.copyDir(ctx, job)
+	if !run.job.Verify {
+		if err := s.copyFile(ctx, src, dst, nil, onProgress); err != nil {
+			return err
+		}
+		return s.preserveMetadata(src, dst, srcInfo)
 	}
-	return s.copyFile(ctx, job, srcInfo.Size())
+
+	srcHash := sha256.New()
+	if err := s.copyFile(ctx, src, dst, srcHash, onProgress); err != nil {
+		return err
+	}
+	expected := hex.EncodeToString(srcHash.Sum(nil))
+
+	actual, err := s.hashFile(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		s.fs.Remove(dst)
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, dst)
+	}
+
+	s.resultsMu.Lock()
+	res := s.result(run.job.ID)
+	res.checksums = append(res.checksums, model.FileChecksum{
+		Path:      src,
+		DestPath:  dst,
+		Algorithm: model.ChecksumSHA256,
+		Hash:      expected,
+	})
+	s.resultsMu.Unlock()
+	s.jobsMu.Lock()
+	run.job.VerifiedCount++
+	s.jobsMu.Unlock()
+	if err := s.preserveMetadata(src, dst, srcInfo); err != nil {
+		return err
+	}
+
+	s.recordHash(dst, expected)
+	if run.job.Type != model.JobTypeMove {
+		s.recordHash(src, expected)
+	}
+	return nil
+}
+
+// recordHash notes a file's verified hash in the hash index, if there is
+// one. Index failures never fail the job.
+func (s *jobService) recordHash(path, hash string) {
+	if s.hashes != nil {
+		s.hashes.Record(path, hash)
+	}
+}
+
+// preserveMetadata copies timestamps and permission bits from src to dst,
+// plus ownership and extended attributes when running as root
+func (s *jobService) preserveMetadata(src, dst string, srcInfo fs.FileInfo) error {
+	if s.asRoot {
+		if xfs, ok := s.fs.(filesystem.XattrFS); ok {
+			if err := xfs.CopyXattrs(src, dst); err != nil {
+				return err
+			}
+		}
+	}
+	return filesystem.ApplyMetadata(s.fs, dst, filesystem.MetadataOf(srcInfo), s.asRoot)
 }
 
-// copyFile copies a single file with progress tracking
-func (s *jobService) copyFile(ctx context.Context, job *model.Job, totalSize int64) error {
-	src, err := s.fs.Open(job.SourcePath)
+// hashFile computes the SHA-256 of a file's contents
+func (s *jobService) hashFile(ctx context.Context, path string) (string, error) {
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	buf := make([]byte, config.FileCopyBufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			hasher.Write(buf[:n])
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", readErr
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// copyFile copies a single file, feeding the source bytes to srcHash and
+// reporting the bytes copied so far to onProgress when they are set.
+// Without a hash the filesystem's fast copy path is used when it has one.
+func (s *jobService) copyFile(ctx context.Context, srcPath, dstPath string, srcHash hash.Hash, onProgress func(copied int64)) error {
+	src, err := s.fs.Open(srcPath)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
 
 	// Ensure destination directory exists
-	destDir := filepath.Dir(job.DestPath)
+	destDir := filepath.Dir(dstPath)
 	if err := s.fs.MkdirAll(destDir, 0755); err != nil {
 		return err
 	}
 
-	dst, err := s.fs.Create(job.DestPath)
+	dst, err := s.fs.Create(dstPath)
 	if err != nil {
 		return err
 	}
 	defer dst.Close()
 
-	buf := make([]byte, 1024*1024) // 1MB buffer
+	// Verified copies stream through the hash, so only plain copies can
+	// leave the bytes to the kernel
+	if fc, ok := s.fs.(filesystem.FastCopier); ok && srcHash == nil {
+		copied, err := fc.FastCopy(ctx, dst, src, onProgress)
+		if copied {
+			if err != nil {
+				if ctx.Err() != nil {
+					// Cleanup partial file on cancellation
+					dst.Close()
+					s.fs.Remove(dstPath)
+				}
+				return err
+			}
+			return dst.Close()
+		}
+	}
+
+	buf := make([]byte, config.FileCopyBufferSize)
 	var copied int64
 
 	for {
@@ -330,7 +907,7 @@ func (s *jobService) copyFile(ctx context.Context, job *model.Job, totalSize int
 		case <-ctx.Done():
 			// Cleanup partial file on cancellation
 			dst.Close()
-			s.fs.Remove(job.DestPath)
+			s.fs.Remove(dstPath)
 			return ctx.Err()
 		default:
 		}
@@ -341,15 +918,13 @@ func (s *jobService) copyFile(ctx context.Context, job *model.Job, totalSize int
 			if writeErr != nil {
 				return writeErr
 			}
+			if srcHash != nil {
+				srcHash.Write(buf[:n])
+			}
 			copied += int64(n)
 
-			// Update progress
-			if totalSize > 0 {
-				progress := int(float64(copied) / float64(totalSize) * 100)
-				if progress != job.Progress {
-					job.Progress = progress
-					s.broadcastUpdate(job)
-				}
+			if onProgress != nil {
+				onProgress(copied)
 			}
 		}
 		if readErr == io.EOF {
@@ -360,101 +935,128 @@ func (s *jobService) copyFile(ctx context.Context, job *model.Job, totalSize int
 		}
 	}
 
-	return nil
-}
-
-// copyDir copies a directory recursively with progress tracking
-func (s *jobService) copyDir(ctx context.Context, job *model.Job) error {
-	// First, count total files for progress tracking
-	totalFiles, err := s.countFiles(job.SourcePath)
-	if err != nil {
-		return err
-	}
-
-	var copiedFiles int
-	return s.copyDirRecursive(ctx, job, job.SourcePath, job.DestPath, totalFiles, &copiedFiles)
+	return dst.Close()
 }
 
 // copyDirRecursive recursively copies a directory
-func (s *jobService) copyDirRecursive(ctx context.Context, job *model.Job, srcDir, dstDir string, totalFiles int, copiedFiles *int) error {
+func (s *jobService) copyDirRecursive(ctx context.Context, run *jobRun, srcDir, dstDir string) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
 	}
 
+	srcInfo, err := s.fs.Stat(srcDir)
+	if err != nil {
+		return s.itemFailed(ctx, run, srcDir, err)
+	}
+
 	// Create destination directory
 	if err := s.fs.MkdirAll(dstDir, 0755); err != nil {
-		return err
+		return s.itemFailed(ctx, run, srcDir, err)
 	}
 
 	entries, err := s.fs.ReadDir(srcDir)
 	if err != nil {
-		return err
+		return s.itemFailed(ctx, run, srcDir, err)
 	}
 
 	for _, entry := range entries {
+		// Unfinished uploads are not copied
+		if fileutil.IsUploadTemp(entry.Name()) {
+			continue
+		}
 		srcPath := filepath.Join(srcDir, entry.Name())
 		dstPath := filepath.Join(dstDir, entry.Name())
 
 		if entry.IsDir() {
-			if err := s.copyDirRecursive(ctx, job, srcPath, dstPath, totalFiles, copiedFiles); err != nil {
-				return err
-			}
-		} else {
-			info, err := entry.Info()
-			if err != nil {
+			if err := s.copyDirRecursive(ctx, run, srcPath, dstPath); err != nil {
 				return err
 			}
+			continue
+		}
 
-			// Create a temporary job for file copy (to track individual file progress)
-			tempJob := &model.Job{
-				SourcePath: srcPath,
-				DestPath:   dstPath,
-			}
-			if err := s.copyFile(ctx, tempJob, info.Size()); err != nil {
+		if err := s.transferFile(ctx, run, srcPath, dstPath, nil); err != nil {
+			if err := s.itemFailed(ctx, run, srcPath, err); err != nil {
 				return err
 			}
-
-			*copiedFiles++
-			if totalFiles > 0 {
-				progress := int(float64(*copiedFiles) / float64(totalFiles) * 100)
-				if progress != job.Progress {
-					job.Progress = progress
-					s.broadcastUpdate(job)
-				}
-			}
+			continue
 		}
+		s.advance(run, 1)
 	}
 
+	// Apply directory metadata last, as writing entries updates its mtime
+	if err := s.preserveMetadata(srcDir, dstDir, srcInfo); err != nil {
+		return s.itemFailed(ctx, run, srcDir, err)
+	}
 	return nil
 }
 
-
 // executeMove moves a file or directory
-func (s *jobService) executeMove(ctx context.Context, job *model.Job) error {
+func (s *jobService) executeMove(ctx context.Context, run *jobRun) error {
+	targets := s.targets(run.job)
+	if len(targets) > 1 {
+		run.total = len(targets)
+	}
+
+	for _, t := range targets {
+		if err := s.movePath(ctx, run, t.src, t.dst, len(targets) == 1); err != nil {
+			return err
+		}
+		if len(targets) > 1 {
+			s.advance(run, 1)
+		}
+	}
+	return nil
+}
+
+// movePath moves a single file or directory, falling back to copy and delete
+// across filesystems. trackProgress reports copy progress on the job.
+func (s *jobService) movePath(ctx context.Context, run *jobRun, src, dst string, trackProgress bool) error {
 	// Try simple rename first (works if on same filesystem)
-	err := s.fs.Rename(job.SourcePath, job.DestPath)
+	err := s.fs.Rename(src, dst)
 	if err == nil {
-		job.Progress = 100
-		s.broadcastUpdate(job)
+		if s.hashes != nil {
+			s.hashes.Rename(src, dst)
+		}
+		if trackProgress {
+			s.setProgress(run.job, 100)
+		}
 		return nil
 	}
 
 	// If rename fails, fall back to copy + delete
-	srcInfo, err := s.fs.Stat(job.SourcePath)
+	return s.moveByCopy(ctx, run, src, dst, trackProgress)
+}
+
+// moveByCopy moves a file or directory by copying it and deleting the source
+func (s *jobService) moveByCopy(ctx context.Context, run *jobRun, src, dst string, trackProgress bool) error {
+	srcInfo, err := s.fs.Stat(src)
 	if err != nil {
-		return err
+		return s.itemFailed(ctx, run, src, err)
 	}
 
 	// Copy first
 	if srcInfo.IsDir() {
-		if err := s.copyDir(ctx, job); err != nil {
+		dirRun := run
+		if !trackProgress {
+			// Keep per-item progress on the parent job
+			dirRun = &jobRun{job: run.job, failed: run.failed}
+		} else {
+			run.total = s.countTargets(run, []jobTarget{{src: src, dst: dst}})
+		}
+		if err := s.copyDirRecursive(ctx, dirRun, src, dst); err != nil {
 			return err
 		}
 	} else {
-		if err := s.copyFile(ctx, job, srcInfo.Size()); err != nil {
-			return err
+		var err error
+		if trackProgress {
+			err = s.copySingleFile(ctx, run, src, dst, srcInfo.Size())
+		} else {
+			err = s.transferFile(ctx, run, src, dst, nil)
+		}
+		if err != nil {
+			return s.itemFailed(ctx, run, src, err)
 		}
 	}
 
@@ -462,49 +1064,105 @@ func (s *jobService) executeMove(ctx context.Context, job *model.Job) error {
 	select {
 	case <-ctx.Done():
 		// Cleanup destination on cancellation
-		s.fs.RemoveAll(job.DestPath)
+		s.fs.RemoveAll(dst)
 		return ctx.Err()
 	default:
 	}
 
-	// Delete source
-	return s.fs.RemoveAll(job.SourcePath)
+	// Delete source, keeping anything that failed to copy
+	if srcInfo.IsDir() && (run.failed[src] || s.containsFailed(run, src)) {
+		return s.removeCopied(ctx, run, src)
+	}
+	return s.fs.RemoveAll(src)
 }
 
-// executeDelete deletes a file or directory
-func (s *jobService) executeDelete(ctx context.Context, job *model.Job) error {
-	info, err := s.fs.Stat(job.SourcePath)
+// removeCopied removes a moved directory tree while keeping the entries that
+// failed to copy (and the directories containing them) in place
+func (s *jobService) removeCopied(ctx context.Context, run *jobRun, dir string) error {
+	if run.failed[dir] {
+		return nil
+	}
+
+	entries, err := s.fs.ReadDir(dir)
 	if err != nil {
-		return err
+		return s.itemFailed(ctx, run, dir, err)
 	}
 
-	if info.IsDir() {
-		return s.deleteDir(ctx, job)
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+		if run.failed[entryPath] {
+			continue
+		}
+		if entry.IsDir() {
+			if err := s.removeCopied(ctx, run, entryPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.fs.Remove(entryPath); err != nil {
+			if err := s.itemFailed(ctx, run, entryPath, err); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Simple file delete
-	if err := s.fs.Remove(job.SourcePath); err != nil {
-		return err
+	if s.containsFailed(run, dir) {
+		return nil
 	}
-	job.Progress = 100
-	s.broadcastUpdate(job)
-	return nil
+	return s.fs.Remove(dir)
 }
 
-// deleteDir deletes a directory recursively with progress tracking
-func (s *jobService) deleteDir(ctx context.Context, job *model.Job) error {
-	// Count total files for progress tracking
-	totalFiles, err := s.countFiles(job.SourcePath)
-	if err != nil {
-		return err
+// containsFailed reports whether any failed path lies inside dir
+func (s *jobService) containsFailed(run *jobRun, dir string) bool {
+	prefix := dir + string(filepath.Separator)
+	for path := range run.failed {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
 	}
+	return false
+}
+
+// executeDelete deletes a file or directory
+func (s *jobService) executeDelete(ctx context.Context, run *jobRun) error {
+	targets := s.targets(run.job)
+	run.total = s.countTargets(run, targets)
+
+	for _, t := range targets {
+		info, err := s.fs.Stat(t.src)
+		if err != nil {
+			if err := s.itemFailed(ctx, run, t.src, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if s.hashes != nil {
+			// Files that survive a failed delete just stop being deduplication sources
+			s.hashes.Forget(t.src)
+		}
+
+		if info.IsDir() {
+			if err := s.deleteDirRecursive(ctx, run, t.src); err != nil {
+				return err
+			}
+			continue
+		}
 
-	var deletedFiles int
-	return s.deleteDirRecursive(ctx, job, job.SourcePath, totalFiles, &deletedFiles)
+		// Simple file delete
+		if err := s.fs.Remove(t.src); err != nil {
+			if err := s.itemFailed(ctx, run, t.src, err); err != nil {
+				return err
+			}
+			continue
+		}
+		s.advance(run, 1)
+	}
+	return nil
 }
 
 // deleteDirRecursive recursively deletes a directory
-func (s *jobService) deleteDirRecursive(ctx context.Context, job *model.Job, dirPath string, totalFiles int, deletedFiles *int) error {
+func (s *jobService) deleteDirRecursive(ctx context.Context, run *jobRun, dirPath string) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -513,38 +1171,59 @@ func (s *jobService) deleteDirRecursive(ctx context.Context, job *model.Job, dir
 
 	entries, err := s.fs.ReadDir(dirPath)
 	if err != nil {
-		return err
+		return s.itemFailed(ctx, run, dirPath, err)
 	}
 
+	failedBefore := run.job.ErrorCount
 	for _, entry := range entries {
 		entryPath := filepath.Join(dirPath, entry.Name())
 
 		if entry.IsDir() {
-			if err := s.deleteDirRecursive(ctx, job, entryPath, totalFiles, deletedFiles); err != nil {
-				return err
-			}
-		} else {
-			if err := s.fs.Remove(entryPath); err != nil {
+			if err := s.deleteDirRecursive(ctx, run, entryPath); err != nil {
 				return err
 			}
+			continue
+		}
 
-			*deletedFiles++
-			if totalFiles > 0 {
-				progress := int(float64(*deletedFiles) / float64(totalFiles) * 100)
-				if progress != job.Progress {
-					job.Progress = progress
-					s.broadcastUpdate(job)
-				}
+		if err := s.fs.Remove(entryPath); err != nil {
+			if err := s.itemFailed(ctx, run, entryPath, err); err != nil {
+				return err
 			}
+			continue
 		}
+		s.advance(run, 1)
+	}
+
+	// A directory with failed entries cannot be removed; those are already reported
+	if run.job.ErrorCount > failedBefore {
+		return nil
 	}
 
 	// Remove the directory itself
-	return s.fs.Remove(dirPath)
+	if err := s.fs.Remove(dirPath); err != nil {
+		return s.itemFailed(ctx, run, dirPath, err)
+	}
+	return nil
+}
+
+// countTargets counts the files under all targets for progress tracking.
+// Unreadable paths count as zero in continue-on-error mode, where they are
+// reported when the job reaches them.
+func (s *jobService) countTargets(run *jobRun, targets []jobTarget) int {
+	var total int
+	for _, t := range targets {
+		count, err := s.countFiles(t.src, run.job.ContinueOnError)
+		if err != nil {
+			continue
+		}
+		total += count
+	}
+	return total
 }
 
-// countFiles counts the total number of files in a directory recursively
-func (s *jobService) countFiles(path string) (int, error) {
+// countFiles counts the total number of files in a directory recursively.
+// With skipErrors set, unreadable subdirectories are left out of the count.
+func (s *jobService) countFiles(path string, skipErrors bool) (int, error) {
 	info, err := s.fs.Stat(path)
 	if err != nil {
 		return 0, err
@@ -561,9 +1240,15 @@ func (s *jobService) countFiles(path string) (int, error) {
 	}
 
 	for _, entry := range entries {
+		if fileutil.IsUploadTemp(entry.Name()) {
+			continue
+		}
 		if entry.IsDir() {
-			subCount, err := s.countFiles(filepath.Join(path, entry.Name()))
+			subCount, err := s.countFiles(filepath.Join(path, entry.Name()), skipErrors)
 			if err != nil {
+				if skipErrors {
+					continue
+				}
 				return 0, err
 			}
 			count += subCount
@@ -578,6 +1263,6 @@ func (s *jobService) countFiles(path string) (int, error) {
 // broadcastUpdate sends a job update via WebSocket
 func (s *jobService) broadcastUpdate(job *model.Job) {
 	if s.hub != nil {
-		s.hub.BroadcastJobUpdate(job)
+		s.hub.BroadcastJobUpdate(s.snapshot(job))
 	}
 }
@@ -4,8 +4,14 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	iofs "io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -16,6 +22,7 @@ import (
 	"github.com/leanovate/gopter"
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
+	"github.com/spf13/afero"
 )
 
 // capturingHub wraps a real Hub and captures all job updates
@@ -981,3 +988,727 @@ func verifyJobUpdateMessage(data []byte) (model.JobUpdate, bool) {
 
 	return update, true
 }
+
+// failingFS wraps an AferoFS and fails to open any file whose name is listed
+type failingFS struct {
+	*filesystem.AferoFS
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+// Open opens the named file, failing with a permission error for listed paths
+func (f *failingFS) Open(name string) (afero.File, error) {
+	f.mu.Lock()
+	fail := f.failing[name]
+	f.mu.Unlock()
+	if fail {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrPermission}
+	}
+	return f.AferoFS.Open(name)
+}
+
+// heal stops failing opens for all paths
+func (f *failingFS) heal() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = map[string]bool{}
+}
+
+// waitForTerminal polls a job until it reaches a terminal state
+func waitForTerminal(ctx context.Context, svc JobService, jobID string) *model.Job {
+	for i := 0; i < 200; i++ {
+		j, _ := svc.Get(ctx, jobID)
+		if j != nil && j.State.IsTerminal() {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// **Feature: homelab-file-manager, Property 19: Continue-On-Error Job Reporting**
+//
+// Property: For any directory job in continue-on-error mode, every unreadable file SHALL be
+// reported as a JobError, every other file SHALL be processed, the job SHALL finish in the
+// completed_with_errors state, and a retry SHALL cover exactly the failed items.
+
+func TestProperty_ContinueOnErrorReporting(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 30
+	parameters.MaxSize = 20
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("copy skips unreadable files and retries only those", prop.ForAll(
+		func(numFiles, numFailing int) bool {
+			if numFailing > numFiles {
+				numFailing = numFiles
+			}
+
+			memFS := filesystem.NewMemMapFS()
+			fsys := &failingFS{AferoFS: memFS, failing: map[string]bool{}}
+			svc := NewJobService(fsys, nil, JobServiceConfig{Workers: 1})
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			svc.Start(ctx)
+			defer svc.Stop()
+
+			for i := 0; i < numFiles; i++ {
+				path := fmt.Sprintf("/data/media/src/sub%d/file%d.txt", i%3, i)
+				memFS.WriteFile(path, []byte(path), 0644)
+				if i < numFailing {
+					fsys.failing[path] = true
+				}
+			}
+
+			job, err := svc.Create(ctx, model.JobParams{
+				Type:            model.JobTypeCopy,
+				SourcePath:      "/data/media/src",
+				DestPath:        "/data/backup/dst",
+				ContinueOnError: true,
+			})
+			if err != nil {
+				return false
+			}
+
+			finalJob := waitForTerminal(ctx, svc, job.ID)
+			if finalJob == nil {
+				return false
+			}
+
+			jobErrors, err := svc.Errors(ctx, job.ID)
+			if err != nil || len(jobErrors) != numFailing || finalJob.ErrorCount != numFailing {
+				return false
+			}
+			for _, jobErr := range jobErrors {
+				if !fsys.failing[jobErr.Path] || jobErr.Code != model.ErrCodePermissionDenied || jobErr.Cause == "" {
+					return false
+				}
+			}
+
+			// Every readable file was copied despite the failures
+			for i := numFailing; i < numFiles; i++ {
+				if ok, _ := memFS.Exists(fmt.Sprintf("/data/backup/dst/sub%d/file%d.txt", i%3, i)); !ok {
+					return false
+				}
+			}
+
+			if numFailing == 0 {
+				_, err := svc.Retry(ctx, job.ID)
+				return finalJob.State == model.JobStateCompleted && err == ErrJobNotRetryable
+			}
+			if finalJob.State != model.JobStateCompletedWithErrors {
+				return false
+			}
+
+			// Retrying after the cause is fixed copies just the failed items
+			fsys.heal()
+			retry, err := svc.Retry(ctx, job.ID)
+			if err != nil || retry.RetryOf != job.ID || len(retry.Items) != numFailing {
+				return false
+			}
+			retried := waitForTerminal(ctx, svc, retry.ID)
+			if retried == nil || retried.State != model.JobStateCompleted {
+				return false
+			}
+			for i := 0; i < numFailing; i++ {
+				if ok, _ := memFS.Exists(fmt.Sprintf("/data/backup/dst/sub%d/file%d.txt", i%3, i)); !ok {
+					return false
+				}
+			}
+			return true
+		},
+		gen.IntRange(1, 15),
+		gen.IntRange(0, 5),
+	))
+
+	properties.Property("move keeps sources that failed to copy", prop.ForAll(
+		func(numFiles int) bool {
+			memFS := filesystem.NewMemMapFS()
+			fsys := &failingFS{AferoFS: memFS, failing: map[string]bool{}}
+			svc := NewJobService(fsys, nil, JobServiceConfig{Workers: 1}).(*jobService)
+
+			for i := 0; i < numFiles; i++ {
+				memFS.WriteFile(fmt.Sprintf("/data/media/src/file%d.txt", i), []byte("x"), 0644)
+			}
+			fsys.failing["/data/media/src/file0.txt"] = true
+
+			job, err := svc.newJob(model.JobParams{
+				Type:            model.JobTypeMove,
+				SourcePath:      "/data/media/src",
+				DestPath:        "/data/backup/dst",
+				ContinueOnError: true,
+			})
+			if err != nil {
+				return false
+			}
+			// Force the copy + delete fallback used across filesystems
+			run := &jobRun{job: job, failed: make(map[string]bool)}
+			if err := svc.moveByCopy(context.Background(), run, job.SourcePath, job.DestPath, false); err != nil {
+				return false
+			}
+
+			if ok, _ := memFS.Exists("/data/media/src/file0.txt"); !ok {
+				return false
+			}
+			for i := 1; i < numFiles; i++ {
+				if ok, _ := memFS.Exists(fmt.Sprintf("/data/media/src/file%d.txt", i)); ok {
+					return false
+				}
+				if ok, _ := memFS.Exists(fmt.Sprintf("/data/backup/dst/file%d.txt", i)); !ok {
+					return false
+				}
+			}
+			return job.ErrorCount == 1
+		},
+		gen.IntRange(1, 10),
+	))
+
+	properties.TestingRun(t)
+}
+
+// corruptingFS wraps an AferoFS and flips the first byte of every file it creates
+type corruptingFS struct {
+	*filesystem.AferoFS
+}
+
+// corruptingFile flips the first byte written to it
+type corruptingFile struct {
+	afero.File
+	written bool
+}
+
+func (f *corruptingFile) Write(p []byte) (int, error) {
+	if !f.written && len(p) > 0 {
+		f.written = true
+		buf := append([]byte(nil), p...)
+		buf[0] ^= 0xFF
+		return f.File.Write(buf)
+	}
+	return f.File.Write(p)
+}
+
+// Create creates the named file with a corrupting writer
+func (c *corruptingFS) Create(name string) (afero.File, error) {
+	f, err := c.AferoFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &corruptingFile{File: f}, nil
+}
+
+// Rename always fails, forcing moves through the copy + delete fallback
+func (c *corruptingFS) Rename(oldpath, newpath string) error {
+	return &iofs.PathError{Op: "rename", Path: oldpath, Err: iofs.ErrInvalid}
+}
+
+// **Feature: homelab-file-manager, Property 20: Copy Verification**
+//
+// Property: For any verified copy job, the recorded checksum SHALL equal the SHA-256 of the
+// source content, and for any verified move whose destination does not match the source, the
+// job SHALL fail, the destination SHALL be removed and the source SHALL be kept.
+
+func TestProperty_CopyVerification(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 30
+	parameters.MaxSize = 50
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("verified copy records the source hash", prop.ForAll(
+		func(content []byte) bool {
+			fsys := filesystem.NewMemMapFS()
+			svc := NewJobService(fsys, nil, JobServiceConfig{Workers: 1})
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			svc.Start(ctx)
+			defer svc.Stop()
+
+			fsys.WriteFile("/data/media/photo.jpg", content, 0644)
+			job, err := svc.Create(ctx, model.JobParams{
+				Type:       model.JobTypeCopy,
+				SourcePath: "/data/media/photo.jpg",
+				DestPath:   "/data/backup/photo.jpg",
+				Verify:     true,
+			})
+			if err != nil {
+				return false
+			}
+
+			finalJob := waitForTerminal(ctx, svc, job.ID)
+			if finalJob == nil || finalJob.State != model.JobStateCompleted || finalJob.VerifiedCount != 1 {
+				return false
+			}
+
+			checksums, err := svc.Checksums(ctx, job.ID)
+			if err != nil || len(checksums) != 1 {
+				return false
+			}
+			sum := sha256.Sum256(content)
+			return checksums[0].Hash == hex.EncodeToString(sum[:]) &&
+				checksums[0].Algorithm == model.ChecksumSHA256 &&
+				checksums[0].DestPath == "/data/backup/photo.jpg"
+		},
+		gen.SliceOf(gen.UInt8()),
+	))
+
+	properties.Property("verified move keeps the source on mismatch", prop.ForAll(
+		func(content []byte, asDir bool) bool {
+			if len(content) == 0 {
+				return true
+			}
+
+			memFS := filesystem.NewMemMapFS()
+			svc := NewJobService(&corruptingFS{AferoFS: memFS}, nil, JobServiceConfig{Workers: 1})
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			svc.Start(ctx)
+			defer svc.Stop()
+
+			src, dst := "/data/media/photo.jpg", "/data/backup/photo.jpg"
+			srcFile, dstFile := src, dst
+			if asDir {
+				src, dst = "/data/media/album", "/data/backup/album"
+				srcFile, dstFile = src+"/photo.jpg", dst+"/photo.jpg"
+			}
+			memFS.WriteFile(srcFile, content, 0644)
+
+			job, err := svc.Create(ctx, model.JobParams{
+				Type:       model.JobTypeMove,
+				SourcePath: src,
+				DestPath:   dst,
+				Verify:     true,
+			})
+			if err != nil {
+				return false
+			}
+
+			finalJob := waitForTerminal(ctx, svc, job.ID)
+			if finalJob == nil || finalJob.State != model.JobStateFailed {
+				return false
+			}
+
+			kept, _ := memFS.ReadFile(srcFile)
+			dstExists, _ := memFS.Exists(dstFile)
+			return string(kept) == string(content) && !dstExists
+		},
+		gen.SliceOf(gen.UInt8()),
+		gen.Bool(),
+	))
+
+	properties.TestingRun(t)
+}
+
+// **Feature: homelab-file-manager, Property 21: Copy Metadata Preservation**
+//
+// Property: For any copied file or directory, the destination SHALL keep the source's
+// modification time and permission bits.
+
+func TestProperty_CopyMetadataPreservation(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 30
+	parameters.MaxSize = 20
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("copy keeps mtime and mode of files and directories", prop.ForAll(
+		func(daysAgo int, perm uint32, verify bool) bool {
+			fsys := filesystem.NewMemMapFS()
+			svc := NewJobService(fsys, nil, JobServiceConfig{Workers: 1})
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			svc.Start(ctx)
+			defer svc.Stop()
+
+			mode := iofs.FileMode(perm) | 0600 // keep the source readable
+			mtime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, -daysAgo)
+			dirMtime := mtime.Add(-time.Hour)
+
+			fsys.WriteFile("/data/media/photos/2019/IMG_0001.jpg", []byte("jpeg"), 0644)
+			fsys.Chmod("/data/media/photos/2019/IMG_0001.jpg", mode)
+			fsys.Chtimes("/data/media/photos/2019/IMG_0001.jpg", mtime, mtime)
+			fsys.Chtimes("/data/media/photos/2019", dirMtime, dirMtime)
+
+			job, err := svc.Create(ctx, model.JobParams{
+				Type:       model.JobTypeCopy,
+				SourcePath: "/data/media/photos",
+				DestPath:   "/data/backup/photos",
+				Verify:     verify,
+			})
+			if err != nil {
+				return false
+			}
+			finalJob := waitForTerminal(ctx, svc, job.ID)
+			if finalJob == nil || finalJob.State != model.JobStateCompleted {
+				return false
+			}
+
+			fileInfo, err := fsys.Stat("/data/backup/photos/2019/IMG_0001.jpg")
+			if err != nil {
+				return false
+			}
+			dirInfo, err := fsys.Stat("/data/backup/photos/2019")
+			if err != nil {
+				return false
+			}
+			return fileInfo.ModTime().Equal(mtime) &&
+				fileInfo.Mode().Perm() == mode.Perm() &&
+				dirInfo.ModTime().Equal(dirMtime)
+		},
+		gen.IntRange(0, 3650),
+		gen.UInt32Range(0, 0777),
+		gen.Bool(),
+	))
+
+	properties.TestingRun(t)
+}
+
+// snapshotTree maps each path below root to its contents ("/" for directories)
+func snapshotTree(fsys *filesystem.AferoFS, root string) map[string]string {
+	tree := make(map[string]string)
+	afero.Walk(fsys.Underlying(), root, func(path string, info iofs.FileInfo, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if info.IsDir() {
+			tree[rel] = "/"
+			return nil
+		}
+		data, _ := fsys.ReadFile(path)
+		tree[rel] = string(data)
+		return nil
+	})
+	return tree
+}
+
+// **Feature: homelab-file-manager, Property 22: Sync Mirror Convergence**
+//
+// Property: For any source and destination trees, a dry-run sync SHALL leave the
+// destination untouched, a mirroring sync SHALL make it match the source except for
+// excluded entries, and a following sync SHALL plan no changes.
+
+func TestProperty_SyncMirrorConvergence(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 50
+	parameters.MaxSize = 20
+
+	properties := gopter.NewProperties(parameters)
+
+	names := []interface{}{"a.txt", "b.txt", "sub/c.txt", "sub/deep/d.txt", "e.tmp", "sub/f.tmp", "old/g.txt"}
+	contents := gen.OneConstOf("x", "yy", "zz", "www")
+
+	properties.Property("sync converges destination to source", prop.ForAll(
+		func(srcFiles, dstFiles map[string]string, conflict bool, checksum bool) bool {
+			fsys := filesystem.NewMemMapFS()
+			svc := NewJobService(fsys, nil, JobServiceConfig{
+				Workers:     1,
+				MountPoints: []model.MountPoint{{Name: "data", Path: "/data"}},
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			svc.Start(ctx)
+			defer svc.Stop()
+
+			srcTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			fsys.MkdirAll("/data/src", 0755)
+			for name, content := range srcFiles {
+				path := filepath.Join("/data/src", name)
+				fsys.MkdirAll(filepath.Dir(path), 0755)
+				fsys.WriteFile(path, []byte(content), 0644)
+				fsys.Chtimes(path, srcTime, srcTime)
+			}
+			fsys.MkdirAll("/data/dst", 0755)
+			if conflict {
+				// A file where the source may have a directory
+				fsys.WriteFile("/data/dst/sub", []byte("file"), 0644)
+			}
+			for name, content := range dstFiles {
+				path := filepath.Join("/data/dst", name)
+				fsys.MkdirAll(filepath.Dir(path), 0755)
+				fsys.WriteFile(path, []byte(content), 0644)
+			}
+
+			opts := model.SyncOptions{Delete: true, Exclude: []string{"*.tmp"}, DryRun: true}
+			if checksum {
+				opts.Compare = model.SyncCompareChecksum
+			}
+			runSync := func(opts model.SyncOptions) *model.SyncReport {
+				job, err := svc.Create(ctx, model.JobParams{
+					Type:       model.JobTypeSync,
+					SourcePath: "/data/src",
+					DestPath:   "/data/dst",
+					Sync:       &opts,
+				})
+				if err != nil {
+					return nil
+				}
+				finalJob := waitForTerminal(ctx, svc, job.ID)
+				if finalJob == nil || finalJob.State != model.JobStateCompleted {
+					return nil
+				}
+				report, err := svc.SyncReport(ctx, job.ID)
+				if err != nil {
+					return nil
+				}
+				return report
+			}
+
+			// Dry run changes nothing
+			before := snapshotTree(fsys, "/data/dst")
+			if runSync(opts) == nil || !reflect.DeepEqual(before, snapshotTree(fsys, "/data/dst")) {
+				return false
+			}
+
+			opts.DryRun = false
+			if runSync(opts) == nil {
+				return false
+			}
+
+			// Destination matches the source apart from excluded files
+			src := snapshotTree(fsys, "/data/src")
+			dst := snapshotTree(fsys, "/data/dst")
+			for rel, content := range src {
+				if strings.HasSuffix(rel, ".tmp") {
+					if _, ok := dst[rel]; ok && before[rel] != dst[rel] {
+						return false
+					}
+					continue
+				}
+				if dst[rel] != content {
+					return false
+				}
+			}
+			for rel, content := range dst {
+				if _, ok := src[rel]; ok {
+					continue
+				}
+				if !strings.HasSuffix(rel, ".tmp") || before[rel] != content {
+					return false
+				}
+			}
+
+			// A second sync has nothing left to do
+			opts.DryRun = true
+			report := runSync(opts)
+			return report != nil && len(report.Actions) == 0
+		},
+		gen.MapOf(gen.OneConstOf(names...), contents),
+		gen.MapOf(gen.OneConstOf(names...), contents),
+		gen.Bool(),
+		gen.Bool(),
+	))
+
+	properties.TestingRun(t)
+}
+
+// TestSyncRequiresWritableDestination checks that a sync into a read-only
+// mount point, or outside any mount point, fails without changing anything
+func TestSyncRequiresWritableDestination(t *testing.T) {
+	fsys := filesystem.NewMemMapFS()
+	fsys.MkdirAll("/data/media", 0755)
+	fsys.WriteFile("/data/media/a.txt", []byte("a"), 0644)
+	fsys.MkdirAll("/data/archive", 0755)
+	fsys.WriteFile("/data/archive/old.txt", []byte("old"), 0644)
+	fsys.MkdirAll("/elsewhere", 0755)
+	fsys.WriteFile("/elsewhere/old.txt", []byte("old"), 0644)
+
+	svc := NewJobService(fsys, nil, JobServiceConfig{
+		Workers: 1,
+		MountPoints: []model.MountPoint{
+			{Name: "media", Path: "/data/media"},
+			{Name: "archive", Path: "/data/archive", ReadOnly: true},
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	svc.Start(ctx)
+	defer svc.Stop()
+
+	for _, dest := range []string{"/data/archive", "/data/archive/new", "/elsewhere", "/data/media/../../elsewhere"} {
+		job, err := svc.Create(ctx, model.JobParams{
+			Type:       model.JobTypeSync,
+			SourcePath: "/data/media",
+			DestPath:   dest,
+			Sync:       &model.SyncOptions{Delete: true},
+		})
+		if err != nil {
+			t.Fatalf("%s: create: %v", dest, err)
+		}
+		if finalJob := waitForTerminal(ctx, svc, job.ID); finalJob == nil || finalJob.State != model.JobStateFailed {
+			t.Errorf("%s: expected the sync to fail, got %+v", dest, finalJob)
+		}
+	}
+
+	for _, path := range []string{"/data/archive/old.txt", "/elsewhere/old.txt"} {
+		if _, err := fsys.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept: %v", path, err)
+		}
+	}
+	for _, path := range []string{"/data/archive/a.txt", "/data/archive/new", "/elsewhere/a.txt"} {
+		if _, err := fsys.Stat(path); err == nil {
+			t.Errorf("expected %s not to be written", path)
+		}
+	}
+}
+
+// TestJobsSkipUploadTempFiles checks that copy and sync jobs leave the temp
+// files of unfinished uploads alone on both sides
+func TestJobsSkipUploadTempFiles(t *testing.T) {
+	fsys := filesystem.NewMemMapFS()
+	fsys.MkdirAll("/data/src/sub", 0755)
+	fsys.WriteFile("/data/src/a.txt", []byte("a"), 0644)
+	fsys.WriteFile("/data/src/sub/b.txt.uploading.1234", []byte("partial"), 0644)
+	fsys.MkdirAll("/data/mirror", 0755)
+	fsys.WriteFile("/data/mirror/c.txt.uploading.5678", []byte("partial"), 0644)
+
+	svc := NewJobService(fsys, nil, JobServiceConfig{
+		Workers:     1,
+		MountPoints: []model.MountPoint{{Name: "data", Path: "/data"}},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	svc.Start(ctx)
+	defer svc.Stop()
+
+	for _, params := range []model.JobParams{
+		{Type: model.JobTypeCopy, SourcePath: "/data/src", DestPath: "/data/copy"},
+		{Type: model.JobTypeSync, SourcePath: "/data/src", DestPath: "/data/mirror", Sync: &model.SyncOptions{Delete: true}},
+	} {
+		job, err := svc.Create(ctx, params)
+		if err != nil {
+			t.Fatalf("%s: create: %v", params.Type, err)
+		}
+		if finalJob := waitForTerminal(ctx, svc, job.ID); finalJob == nil || finalJob.State != model.JobStateCompleted {
+			t.Fatalf("%s: expected the job to complete, got %+v", params.Type, finalJob)
+		}
+	}
+
+	for _, path := range []string{"/data/copy/a.txt", "/data/mirror/a.txt", "/data/mirror/c.txt.uploading.5678"} {
+		if _, err := fsys.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+		}
+	}
+	for _, path := range []string{"/data/copy/sub/b.txt.uploading.1234", "/data/mirror/sub/b.txt.uploading.1234"} {
+		if _, err := fsys.Stat(path); err == nil {
+			t.Errorf("expected %s not to be copied", path)
+		}
+	}
+}
+
+// TestSyncRejectsOverlappingTrees checks that a sync whose destination is,
+// contains or sits inside its source is refused when the job is created
+func TestSyncRejectsOverlappingTrees(t *testing.T) {
+	svc := NewJobService(filesystem.NewMemMapFS(), nil, JobServiceConfig{Workers: 1})
+	ctx := context.Background()
+
+	cases := []struct {
+		src, dst string
+		wantErr  error
+	}{
+		{"/data/photos", "/data", ErrInvalidJobParams},
+		{"/data/photos", "/data/photos/backup", ErrInvalidJobParams},
+		{"/data/photos", "/data/photos", ErrInvalidJobParams},
+		{"/data/photos", "/data/photos/", ErrInvalidJobParams},
+		{"/data/photos/2024", "/data/photos/../photos", ErrInvalidJobParams},
+		{"/data/photos", "/data/photos-backup", nil},
+		{"/data/photos", "/backup/photos", nil},
+	}
+	for _, tc := range cases {
+		_, err := svc.Create(ctx, model.JobParams{
+			Type:       model.JobTypeSync,
+			SourcePath: tc.src,
+			DestPath:   tc.dst,
+			Sync:       &model.SyncOptions{Delete: true},
+		})
+		if err != tc.wantErr {
+			t.Errorf("sync %s -> %s: expected %v, got %v", tc.src, tc.dst, tc.wantErr, err)
+		}
+	}
+}
+
+// **Feature: homelab-file-manager, Property 25: Fair Job Queue**
+//
+// Property: For any set of submitted jobs, the queue SHALL accept all of them, SHALL
+// dispatch higher priorities first, SHALL keep each user's jobs in submission order,
+// and within a priority SHALL NOT dispatch a user's (n+1)th job before another user's
+// nth job.
+
+func TestProperty_FairJobQueue(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 200
+
+	properties := gopter.NewProperties(parameters)
+
+	owners := []interface{}{"alice", "bob", "carol"}
+	priorities := []interface{}{model.JobPriorityLow, model.JobPriorityNormal, model.JobPriorityHigh}
+
+	properties.Property("queue is unbounded, prioritized and fair", prop.ForAll(
+		func(submissions []int) bool {
+			ctx := context.Background()
+			svc := NewJobService(filesystem.NewMemMapFS(), nil, JobServiceConfig{Workers: 1})
+
+			// Workers are not started, so every job stays queued
+			created := make(map[string]int)
+			for i, n := range submissions {
+				job, err := svc.Create(ctx, model.JobParams{
+					Type:       model.JobTypeDelete,
+					SourcePath: fmt.Sprintf("/data/file%d", i),
+					Owner:      owners[n%len(owners)].(string),
+					Priority:   priorities[n/len(owners)%len(priorities)].(model.JobPriority),
+				})
+				if err != nil || job.State != model.JobStatePending {
+					return false
+				}
+				created[job.ID] = i
+			}
+
+			queue, err := svc.Queue(ctx)
+			if err != nil || len(queue) != len(submissions) {
+				return false
+			}
+
+			lastSeq := make(map[string]int)
+			turns := make(map[model.JobPriority]map[string]int)
+			for i, job := range queue {
+				if job.QueuePosition != i+1 {
+					return false
+				}
+				if i > 0 && job.Priority.Rank() > queue[i-1].Priority.Rank() {
+					return false
+				}
+
+				// Submission order per owner and priority
+				key := job.Owner + "/" + string(job.Priority)
+				if seq, ok := lastSeq[key]; ok && created[job.ID] < seq {
+					return false
+				}
+				lastSeq[key] = created[job.ID]
+
+				// No owner gets a turn ahead of an owner with fewer turns that still has jobs waiting
+				if turns[job.Priority] == nil {
+					turns[job.Priority] = make(map[string]int)
+				}
+				for _, other := range queue[i+1:] {
+					if other.Priority == job.Priority && turns[job.Priority][other.Owner] < turns[job.Priority][job.Owner] {
+						return false
+					}
+				}
+				turns[job.Priority][job.Owner]++
+			}
+
+			// Bumping a job moves it to the front
+			if len(queue) > 0 {
+				last := queue[len(queue)-1]
+				if moved, err := svc.Move(ctx, last.ID, 1); err != nil || moved.QueuePosition != 1 {
+					return false
+				}
+			}
+			return true
+		},
+		gen.SliceOf(gen.IntRange(0, 8)),
+	))
+
+	properties.TestingRun(t)
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/homelab/filemanager/internal/model"
+)
+
+// jobQueue is an unbounded queue of pending jobs. Higher priorities are
+// dispatched first; within a priority, owners take turns so that one user's
+// bulk submissions cannot starve everyone else. Admins may reorder it.
+type jobQueue struct {
+	mu      sync.Mutex
+	pending []*model.Job
+	ready   chan struct{} // signalled when jobs are available
+}
+
+// newJobQueue creates an empty job queue
+func newJobQueue() *jobQueue {
+	return &jobQueue{ready: make(chan struct{}, 1)}
+}
+
+// push inserts a job at its fair position: after every job of a higher
+// priority, and within its priority after every job whose owner has had no
+// more turns than the job's owner. It returns the job's 1-based position.
+func (q *jobQueue) push(job *model.Job) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	rank := job.Priority.Rank()
+	turn := 0
+	for _, queued := range q.pending {
+		if queued.Owner == job.Owner && queued.Priority.Rank() == rank {
+			turn++
+		}
+	}
+
+	pos := len(q.pending)
+	turns := make(map[string]int)
+	for i, queued := range q.pending {
+		queuedRank := queued.Priority.Rank()
+		if queuedRank < rank {
+			pos = i
+			break
+		}
+		if queuedRank > rank {
+			continue
+		}
+		queuedTurn := turns[queued.Owner]
+		turns[queued.Owner]++
+		if queuedTurn > turn {
+			pos = i
+			break
+		}
+	}
+
+	q.pending = append(q.pending, nil)
+	copy(q.pending[pos+1:], q.pending[pos:])
+	q.pending[pos] = job
+	q.signal()
+	return pos + 1
+}
+
+// next blocks until a job is available and removes it from the queue.
+// It returns nil when ctx is done or stopCh is closed.
+func (q *jobQueue) next(ctx context.Context, stopCh <-chan struct{}) *model.Job {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			job := q.pending[0]
+			q.pending = q.pending[1:]
+			if len(q.pending) > 0 {
+				// Wake another worker for the remaining jobs
+				q.signal()
+			}
+			q.mu.Unlock()
+			return job
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-stopCh:
+			return nil
+		case <-q.ready:
+		}
+	}
+}
+
+// remove takes a job out of the queue, reporting whether it was queued
+func (q *jobQueue) remove(jobID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, queued := range q.pending {
+		if queued.ID == jobID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// move places a queued job at a 1-based position, clamped to the queue
+// length, reporting whether the job was queued
+func (q *jobQueue) move(jobID string, position int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	from := -1
+	for i, queued := range q.pending {
+		if queued.ID == jobID {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return false
+	}
+
+	to := position - 1
+	if to < 0 {
+		to = 0
+	}
+	if to > len(q.pending)-1 {
+		to = len(q.pending) - 1
+	}
+
+	job := q.pending[from]
+	if from < to {
+		copy(q.pending[from:to], q.pending[from+1:to+1])
+	} else {
+		copy(q.pending[to+1:from+1], q.pending[to:from])
+	}
+	q.pending[to] = job
+	return true
+}
+
+// snapshot returns the queued jobs in dispatch order
+func (q *jobQueue) snapshot() []*model.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*model.Job(nil), q.pending...)
+}
+
+// position returns the 1-based position of a queued job, or 0 if it is not
+// queued
+func (q *jobQueue) position(jobID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, queued := range q.pending {
+		if queued.ID == jobID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// positions returns the 1-based positions of the queued jobs by ID
+func (q *jobQueue) positions() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	result := make(map[string]int, len(q.pending))
+	for i, queued := range q.pending {
+		result[queued.ID] = i + 1
+	}
+	return result
+}
+
+// signal wakes a waiting worker without blocking
+func (q *jobQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
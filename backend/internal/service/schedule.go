@@ -0,0 +1,508 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/cron"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+)
+
+// Schedule service errors
+var (
+	ErrScheduleNotFound   = errors.New("schedule not found")
+	ErrInvalidSchedule    = errors.New("invalid schedule")
+	ErrPriorityNotAllowed = errors.New("high priority requires admin rights")
+)
+
+// ScheduleService defines the recurring job scheduler interface
+type ScheduleService interface {
+	// List returns all schedules
+	List(ctx context.Context) ([]*model.Schedule, error)
+	// Get returns a schedule by ID
+	Get(ctx context.Context, id string) (*model.Schedule, error)
+	// Create adds a new schedule
+	Create(ctx context.Context, params model.ScheduleParams) (*model.Schedule, error)
+	// Update replaces the timetable and job template of a schedule
+	Update(ctx context.Context, id string, params model.ScheduleParams) (*model.Schedule, error)
+	// Delete removes a schedule
+	Delete(ctx context.Context, id string) error
+	// Start starts checking for due schedules
+	Start(ctx context.Context)
+	// Stop stops the scheduler
+	Stop()
+}
+
+// scheduleService implements ScheduleService
+type scheduleService struct {
+	fs        filesystem.FS
+	jobs      JobService
+	isAdmin   func(username string) bool
+	filePath  string
+	now       func() time.Time
+	interval  time.Duration
+	mu        sync.Mutex
+	loaded    bool
+	schedules map[string]*model.Schedule
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// SchedulesData is the on-disk format of the schedules file
+type SchedulesData struct {
+	Schedules []*model.Schedule `json:"schedules"`
+}
+
+// ScheduleServiceConfig holds configuration for the schedule service
+type ScheduleServiceConfig struct {
+	DataDir       string
+	Now           func() time.Time // Clock used for run times, defaults to time.Now
+	CheckInterval time.Duration
+	IsAdmin       func(username string) bool // Whether an owner may schedule high priority jobs; nobody may when nil
+}
+
+// NewScheduleService creates a new schedule service that submits jobs to jobs
+func NewScheduleService(fsys filesystem.FS, jobs JobService, cfg ScheduleServiceConfig) ScheduleService {
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = config.DefaultDataDir
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	interval := cfg.CheckInterval
+	if interval <= 0 {
+		interval = config.ScheduleCheckInterval
+	}
+
+	return &scheduleService{
+		fs:        fsys,
+		jobs:      jobs,
+		isAdmin:   cfg.IsAdmin,
+		filePath:  filepath.Join(dataDir, config.SchedulesFileName),
+		now:       now,
+		interval:  interval,
+		schedules: make(map[string]*model.Schedule),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start starts checking for due schedules
+func (s *scheduleService) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		s.tick(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.tick(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler
+func (s *scheduleService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// tick submits a job for every schedule that is due. Schedules missed while
+// the server was down run once on the first tick.
+func (s *scheduleService) tick(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return
+	}
+
+	now := s.now()
+	changed := s.refreshRuns(ctx, now)
+	for _, sched := range s.sorted() {
+		if !sched.Enabled || sched.NextRun.IsZero() || now.Before(sched.NextRun) {
+			continue
+		}
+		s.fire(ctx, sched)
+		sched.NextRun = nextRun(sched, now)
+		changed = true
+	}
+
+	if changed {
+		s.save()
+	}
+}
+
+// fire records a run of a schedule, submitting its job unless the previous
+// run is still in progress
+func (s *scheduleService) fire(ctx context.Context, sched *model.Schedule) {
+	run := model.ScheduleRun{ScheduledAt: sched.NextRun}
+
+	if running(sched) {
+		run.Outcome = model.ScheduleRunSkipped
+		run.Error = "previous run still in progress"
+		run.CompletedAt = run.ScheduledAt
+	} else if err := s.checkPriority(sched.Job); err != nil {
+		// The owner may have lost admin rights since saving the schedule
+		run.Outcome = model.ScheduleRunFailed
+		run.Error = err.Error()
+		run.CompletedAt = run.ScheduledAt
+	} else if job, err := s.jobs.Create(ctx, sched.Job); err != nil {
+		run.Outcome = model.ScheduleRunFailed
+		run.Error = err.Error()
+		run.CompletedAt = run.ScheduledAt
+	} else {
+		run.JobID = job.ID
+		run.Outcome = model.ScheduleRunRunning
+	}
+
+	sched.Runs = append(sched.Runs, run)
+	if len(sched.Runs) > config.ScheduleRunHistory {
+		sched.Runs = sched.Runs[len(sched.Runs)-config.ScheduleRunHistory:]
+	}
+}
+
+// running reports whether the most recent job of a schedule is still in progress
+func running(sched *model.Schedule) bool {
+	for i := len(sched.Runs) - 1; i >= 0; i-- {
+		if sched.Runs[i].JobID != "" {
+			return sched.Runs[i].Outcome == model.ScheduleRunRunning
+		}
+	}
+	return false
+}
+
+// refreshRuns copies the outcome of finished jobs into the run history and
+// reports whether anything changed. The caller must hold mu.
+func (s *scheduleService) refreshRuns(ctx context.Context, now time.Time) bool {
+	changed := false
+	for _, sched := range s.schedules {
+		for i := range sched.Runs {
+			run := &sched.Runs[i]
+			if run.Outcome != model.ScheduleRunRunning {
+				continue
+			}
+
+			job, err := s.jobs.Get(ctx, run.JobID)
+			if err != nil {
+				// Jobs do not survive restarts or history cleanup
+				run.Outcome = model.ScheduleRunFailed
+				run.Error = "job is no longer tracked"
+				run.CompletedAt = now
+				changed = true
+				continue
+			}
+			if !job.State.IsTerminal() {
+				continue
+			}
+
+			run.Outcome = model.ScheduleRunOutcome(job.State)
+			run.Error = job.Error
+			run.CompletedAt = job.CompletedAt
+			changed = true
+		}
+	}
+	return changed
+}
+
+// nextRun returns the first run time of a schedule after now
+func nextRun(sched *model.Schedule, now time.Time) time.Time {
+	if sched.EveryHours > 0 {
+		interval := time.Duration(sched.EveryHours) * time.Hour
+		next := sched.NextRun
+		if next.IsZero() {
+			return now.Add(interval)
+		}
+		if !next.After(now) {
+			// Skip the intervals that were missed
+			next = next.Add((now.Sub(next)/interval + 1) * interval)
+		}
+		return next
+	}
+
+	expr, err := cron.Parse(sched.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return expr.Next(now)
+}
+
+// validateScheduleParams checks a schedule's timetable and job template
+func validateScheduleParams(params model.ScheduleParams) error {
+	if strings.TrimSpace(params.Name) == "" {
+		return ErrInvalidSchedule
+	}
+
+	// Exactly one of cron and everyHours
+	if (params.Cron == "") == (params.EveryHours <= 0) || params.EveryHours < 0 {
+		return ErrInvalidSchedule
+	}
+	if params.Cron != "" {
+		if _, err := cron.Parse(params.Cron); err != nil {
+			return ErrInvalidSchedule
+		}
+	}
+
+	if _, err := validateJobParams(params.Job); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkPriority refuses high priority job templates of owners without
+// admin rights, who could otherwise jump the queue through a schedule
+func (s *scheduleService) checkPriority(params model.JobParams) error {
+	if params.Priority == model.JobPriorityHigh && (s.isAdmin == nil || !s.isAdmin(params.Owner)) {
+		return ErrPriorityNotAllowed
+	}
+	return nil
+}
+
+// List returns all schedules ordered by creation time
+func (s *scheduleService) List(ctx context.Context) ([]*model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if s.refreshRuns(ctx, s.now()) {
+		s.save()
+	}
+
+	result := make([]*model.Schedule, 0, len(s.schedules))
+	for _, sched := range s.sorted() {
+		result = append(result, cloneSchedule(sched))
+	}
+	return result, nil
+}
+
+// Get returns a schedule by ID
+func (s *scheduleService) Get(ctx context.Context, id string) (*model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	sched, ok := s.schedules[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	if s.refreshRuns(ctx, s.now()) {
+		s.save()
+	}
+	return cloneSchedule(sched), nil
+}
+
+// Create adds a new schedule
+func (s *scheduleService) Create(ctx context.Context, params model.ScheduleParams) (*model.Schedule, error) {
+	if err := validateScheduleParams(params); err != nil {
+		return nil, err
+	}
+	// Fetch templates are held to the host policy and a writable
+	// destination, like fetch jobs
+	if err := s.jobs.Validate(params.Job); err != nil {
+		return nil, err
+	}
+	if err := s.checkPriority(params.Job); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	sched := &model.Schedule{
+		ID:         uuid.New().String(),
+		Name:       strings.TrimSpace(params.Name),
+		Owner:      params.Job.Owner,
+		Cron:       params.Cron,
+		EveryHours: params.EveryHours,
+		Job:        params.Job,
+		Enabled:    params.Enabled,
+		CreatedAt:  now,
+		Runs:       []model.ScheduleRun{},
+	}
+	sched.NextRun = nextRun(sched, now)
+
+	s.schedules[sched.ID] = sched
+	if err := s.save(); err != nil {
+		delete(s.schedules, sched.ID)
+		return nil, err
+	}
+	return cloneSchedule(sched), nil
+}
+
+// Update replaces the timetable and job template of a schedule. The run
+// history is kept; the next run is recomputed if the timetable changed or
+// the schedule was re-enabled. Its jobs stay owned by the schedule's owner.
+func (s *scheduleService) Update(ctx context.Context, id string, params model.ScheduleParams) (*model.Schedule, error) {
+	if err := validateScheduleParams(params); err != nil {
+		return nil, err
+	}
+	if err := s.jobs.Validate(params.Job); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	sched, ok := s.schedules[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	params.Job.Owner = sched.Owner
+	if err := s.checkPriority(params.Job); err != nil {
+		return nil, err
+	}
+
+	previous := *sched
+	retimed := sched.Cron != params.Cron || sched.EveryHours != params.EveryHours ||
+		(params.Enabled && !sched.Enabled)
+
+	sched.Name = strings.TrimSpace(params.Name)
+	sched.Cron = params.Cron
+	sched.EveryHours = params.EveryHours
+	sched.Job = params.Job
+	sched.Enabled = params.Enabled
+	if retimed {
+		sched.NextRun = time.Time{}
+		sched.NextRun = nextRun(sched, s.now())
+	}
+
+	if err := s.save(); err != nil {
+		*sched = previous
+		return nil, err
+	}
+	return cloneSchedule(sched), nil
+}
+
+// Delete removes a schedule. Jobs it already submitted keep running.
+func (s *scheduleService) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	sched, ok := s.schedules[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+
+	delete(s.schedules, id)
+	if err := s.save(); err != nil {
+		s.schedules[id] = sched
+		return err
+	}
+	return nil
+}
+
+// load reads the schedules file on first use. The caller must hold mu.
+func (s *scheduleService) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	exists, err := s.fs.Exists(s.filePath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		file, err := s.fs.ReadFile(s.filePath)
+		if err != nil {
+			return err
+		}
+		if len(file) > 0 {
+			var data SchedulesData
+			if err := json.Unmarshal(file, &data); err != nil {
+				return err
+			}
+			for _, sched := range data.Schedules {
+				if sched.Runs == nil {
+					sched.Runs = []model.ScheduleRun{}
+				}
+				if sched.Owner == "" {
+					// Saved before schedules had owners
+					sched.Owner = sched.Job.Owner
+				}
+				s.schedules[sched.ID] = sched
+			}
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// save writes all schedules to the schedules file. The caller must hold mu.
+func (s *scheduleService) save() error {
+	data := SchedulesData{Schedules: s.sorted()}
+	fileData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := s.fs.MkdirAll(filepath.Dir(s.filePath), 0755); err != nil {
+		return err
+	}
+	return s.fs.WriteFile(s.filePath, fileData, 0644)
+}
+
+// sorted returns the schedules ordered by creation time. The caller must hold mu.
+func (s *scheduleService) sorted() []*model.Schedule {
+	result := make([]*model.Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		result = append(result, sched)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// cloneSchedule returns a copy of a schedule that is safe to hand out
+func cloneSchedule(sched *model.Schedule) *model.Schedule {
+	clone := *sched
+	clone.Runs = append([]model.ScheduleRun{}, sched.Runs...)
+	clone.Job.Items = append([]string(nil), sched.Job.Items...)
+	if sched.Job.Sync != nil {
+		syncOpts := *sched.Job.Sync
+		syncOpts.Exclude = append([]string(nil), sched.Job.Sync.Exclude...)
+		clone.Job.Sync = &syncOpts
+	}
+	if sched.Job.Fetch != nil {
+		fetchOpts := *sched.Job.Fetch
+		clone.Job.Fetch = &fetchOpts
+	}
+	return &clone
+}
@@ -0,0 +1,315 @@
+// Package service provides business logic for the file manager.
+// This file contains property-based tests for the job scheduler.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// stubJobService records created jobs and lets tests decide when they finish
+type stubJobService struct {
+	JobService
+	jobs map[string]*model.Job
+}
+
+func newStubJobService() *stubJobService {
+	return &stubJobService{jobs: make(map[string]*model.Job)}
+}
+
+func (s *stubJobService) Create(ctx context.Context, params model.JobParams) (*model.Job, error) {
+	job := &model.Job{
+		ID:         fmt.Sprintf("job-%d", len(s.jobs)+1),
+		Type:       params.Type,
+		State:      model.JobStateRunning,
+		SourcePath: params.SourcePath,
+		DestPath:   params.DestPath,
+	}
+	s.jobs[job.ID] = job
+	return job, nil
+}
+
+func (s *stubJobService) Validate(params model.JobParams) error {
+	_, err := validateJobParams(params)
+	return err
+}
+
+func (s *stubJobService) Get(ctx context.Context, jobID string) (*model.Job, error) {
+	if job, ok := s.jobs[jobID]; ok {
+		return job, nil
+	}
+	return nil, ErrJobNotFound
+}
+
+// finishAll marks every running job as completed at the given time
+func (s *stubJobService) finishAll(at time.Time) {
+	for _, job := range s.jobs {
+		if job.State == model.JobStateRunning {
+			job.State = model.JobStateCompleted
+			job.CompletedAt = at
+		}
+	}
+}
+
+// fakeClock is a manually advanced clock for the scheduler
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// **Feature: homelab-file-manager, Property 24: Schedule Runs**
+//
+// Property: For any interval schedule and sequence of clock advances, the scheduler
+// SHALL record exactly one run each time the schedule comes due, SHALL skip a run
+// while the previous job is still running, and SHALL persist the run history.
+
+func TestProperty_ScheduleRuns(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 30
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("due schedules run once and skip while running", prop.ForAll(
+		func(everyHours int, advances []int, finishes []bool) bool {
+			ctx := context.Background()
+			fsys := filesystem.NewMemMapFS()
+			jobs := newStubJobService()
+			clock := &fakeClock{now: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+			cfg := ScheduleServiceConfig{DataDir: "/data", Now: clock.Now}
+			svc := NewScheduleService(fsys, jobs, cfg).(*scheduleService)
+
+			sched, err := svc.Create(ctx, model.ScheduleParams{
+				Name:       "nightly mirror",
+				EveryHours: everyHours,
+				Job: model.JobParams{
+					Type:       model.JobTypeSync,
+					SourcePath: "/data/media",
+					DestPath:   "/data/backup",
+				},
+				Enabled: true,
+			})
+			if err != nil {
+				return false
+			}
+
+			// Model of the expected runs
+			interval := time.Duration(everyHours) * time.Hour
+			nextDue := clock.now.Add(interval)
+			runningIdx := -1
+			var expected []model.ScheduleRunOutcome
+
+			for i, minutes := range advances {
+				clock.now = clock.now.Add(time.Duration(minutes) * time.Minute)
+				svc.tick(ctx)
+
+				if !clock.now.Before(nextDue) {
+					if runningIdx >= 0 {
+						expected = append(expected, model.ScheduleRunSkipped)
+					} else {
+						runningIdx = len(expected)
+						expected = append(expected, model.ScheduleRunRunning)
+					}
+					for !nextDue.After(clock.now) {
+						nextDue = nextDue.Add(interval)
+					}
+				}
+
+				if i < len(finishes) && finishes[i] {
+					jobs.finishAll(clock.now)
+					if runningIdx >= 0 {
+						expected[runningIdx] = model.ScheduleRunCompleted
+						runningIdx = -1
+					}
+				}
+			}
+
+			got, err := svc.Get(ctx, sched.ID)
+			if err != nil || len(got.Runs) != len(expected) || !got.NextRun.Equal(nextDue) {
+				return false
+			}
+			for i, run := range got.Runs {
+				if run.Outcome != expected[i] {
+					return false
+				}
+				if run.Outcome == model.ScheduleRunSkipped && run.JobID != "" {
+					return false
+				}
+			}
+			if len(jobs.jobs) != countNotSkipped(expected) {
+				return false
+			}
+
+			// A new service on the same data dir sees the same schedule
+			reloaded, err := NewScheduleService(fsys, jobs, cfg).Get(ctx, sched.ID)
+			return err == nil && reflect.DeepEqual(reloaded.Runs, got.Runs) && reloaded.NextRun.Equal(got.NextRun)
+		},
+		gen.IntRange(1, 24),
+		gen.SliceOf(gen.IntRange(1, 600)),
+		gen.SliceOf(gen.Bool()),
+	))
+
+	properties.TestingRun(t)
+}
+
+// countNotSkipped counts the runs that submitted a job
+func countNotSkipped(outcomes []model.ScheduleRunOutcome) int {
+	n := 0
+	for _, outcome := range outcomes {
+		if outcome != model.ScheduleRunSkipped {
+			n++
+		}
+	}
+	return n
+}
+
+// TestSchedulePriority checks that only admins can schedule high priority
+// jobs, and that a schedule stops creating them once its owner is no
+// longer an admin
+func TestSchedulePriority(t *testing.T) {
+	ctx := context.Background()
+	jobs := newStubJobService()
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	admins := map[string]bool{"alice": true}
+	svc := NewScheduleService(filesystem.NewMemMapFS(), jobs, ScheduleServiceConfig{
+		DataDir: "/data",
+		Now:     clock.Now,
+		IsAdmin: func(username string) bool { return admins[username] },
+	}).(*scheduleService)
+
+	params := func(owner string) model.ScheduleParams {
+		return model.ScheduleParams{
+			Name:       "urgent mirror",
+			EveryHours: 1,
+			Job: model.JobParams{
+				Type:       model.JobTypeSync,
+				SourcePath: "/data/media",
+				DestPath:   "/data/backup",
+				Owner:      owner,
+				Priority:   model.JobPriorityHigh,
+			},
+			Enabled: true,
+		}
+	}
+
+	if _, err := svc.Create(ctx, params("bob")); !errors.Is(err, ErrPriorityNotAllowed) {
+		t.Fatalf("expected bob's high priority schedule to be refused, got %v", err)
+	}
+	sched, err := svc.Create(ctx, params("alice"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	normal := params("bob")
+	normal.Job.Priority = model.JobPriorityNormal
+	bobs, err := svc.Create(ctx, normal)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Even an admin cannot raise the priority of bob's jobs
+	if _, err := svc.Update(ctx, bobs.ID, params("alice")); !errors.Is(err, ErrPriorityNotAllowed) {
+		t.Fatalf("expected raising bob's schedule to high priority to be refused, got %v", err)
+	}
+	svc.Delete(ctx, bobs.ID)
+
+	delete(admins, "alice")
+	clock.now = clock.now.Add(time.Hour)
+	svc.tick(ctx)
+	got, err := svc.Get(ctx, sched.ID)
+	if err != nil || len(got.Runs) != 1 || got.Runs[0].Outcome != model.ScheduleRunFailed {
+		t.Fatalf("expected a failed run, got %+v, %v", got, err)
+	}
+	if len(jobs.jobs) != 0 {
+		t.Fatalf("expected no job to be created, got %d", len(jobs.jobs))
+	}
+}
+
+// TestScheduleFetchPolicy checks that fetch templates are held to the host
+// policy and need a writable destination when they are saved
+func TestScheduleFetchPolicy(t *testing.T) {
+	jobs, fs := setupFetchJobService(t, FetchConfig{})
+	svc := NewScheduleService(fs, jobs, ScheduleServiceConfig{DataDir: "/appdata"})
+	ctx := context.Background()
+
+	params := func(source, dest string) model.ScheduleParams {
+		return model.ScheduleParams{
+			Name:       "fetch",
+			EveryHours: 24,
+			Enabled:    true,
+			Job:        model.JobParams{Type: model.JobTypeFetch, SourcePath: source, DestPath: dest, Owner: "alice"},
+		}
+	}
+
+	for _, tc := range []struct {
+		source, dest string
+		expected     error
+	}{
+		{"http://127.0.0.1/file", "/data/media/a", ErrFetchNotAllowed},
+		{"http://192.0.2.1/file", "/data/other/a", ErrMountPointNotFound},
+		{"http://192.0.2.1/file", "/data/readonly/a", ErrPermissionDenied},
+	} {
+		if _, err := svc.Create(ctx, params(tc.source, tc.dest)); !errors.Is(err, tc.expected) {
+			t.Errorf("create fetch of %s to %s: expected %v, got %v", tc.source, tc.dest, tc.expected, err)
+		}
+	}
+
+	sched, err := svc.Create(ctx, params("http://192.0.2.1/file", "/data/media/a"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := svc.Update(ctx, sched.ID, params("http://127.0.0.1/file", "/data/media/a")); !errors.Is(err, ErrFetchNotAllowed) {
+		t.Errorf("expected an update to a loopback address to be refused, got %v", err)
+	}
+	if _, err := svc.Update(ctx, sched.ID, params("http://192.0.2.1/file", "/data/readonly/a")); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("expected an update to a read-only destination to be refused, got %v", err)
+	}
+	if stored, err := svc.Get(ctx, sched.ID); err != nil || stored.Job.DestPath != "/data/media/a" {
+		t.Errorf("expected the schedule to be unchanged, got %+v (%v)", stored, err)
+	}
+}
+
+// TestScheduleCopiesFetchOptions checks that the schedules handed out do not
+// share their fetch options with the stored ones
+func TestScheduleCopiesFetchOptions(t *testing.T) {
+	jobs, fs := setupFetchJobService(t, FetchConfig{})
+	svc := NewScheduleService(fs, jobs, ScheduleServiceConfig{DataDir: "/appdata"})
+	ctx := context.Background()
+
+	sched, err := svc.Create(ctx, model.ScheduleParams{
+		Name:       "fetch",
+		EveryHours: 24,
+		Enabled:    true,
+		Job: model.JobParams{
+			Type:       model.JobTypeFetch,
+			SourcePath: "http://192.0.2.1/file",
+			DestPath:   "/data/media/a",
+			Owner:      "alice",
+			Fetch:      &model.FetchOptions{MaxBytes: 1024},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	sched.Job.Fetch.MaxBytes = 1
+
+	got, err := svc.Get(ctx, sched.ID)
+	if err != nil || got.Job.Fetch == nil || got.Job.Fetch.MaxBytes != 1024 {
+		t.Fatalf("expected the stored fetch options to be unchanged, got %+v (%v)", got.Job.Fetch, err)
+	}
+	got.Job.Fetch.MaxBytes = 2
+	if again, _ := svc.Get(ctx, sched.ID); again.Job.Fetch.MaxBytes != 1024 {
+		t.Fatalf("expected the stored fetch options to be unchanged, got %d", again.Job.Fetch.MaxBytes)
+	}
+}
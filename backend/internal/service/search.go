@@ -110,6 +110,9 @@ func (s *searchService) searchRecursive(ctx context.Context, fsPath, virtualPath
 		}
 
 		name := entry.Name()
+		if fileutil.IsUploadTemp(name) {
+			continue
+		}
 		entryFsPath := filepath.Join(fsPath, name)
 		entryVirtualPath := virtualPath + "/" + name
 		if virtualPath == "" {
@@ -6,8 +6,10 @@
 //   - AuthService: User authentication and JWT token management
 //   - FileService: File system operations (CRUD, listing, stats)
 //   - JobService: Background job execution with progress tracking
+//   - ScheduleService: Recurring jobs from cron expressions or fixed intervals
 //   - SearchService: Recursive file search
 //   - SystemService: System information and drive discovery
+//   - WatchService: Directory change notifications for WebSocket clients
 //
 // # Error Handling
 //
@@ -0,0 +1,687 @@
+package service
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+)
+
+// Share service errors
+var (
+	ErrShareNotFound         = errors.New("share not found")
+	ErrInvalidShare          = errors.New("invalid share")
+	ErrShareExpired          = errors.New("share has expired")
+	ErrShareExhausted        = errors.New("share usage limit reached")
+	ErrSharePasswordRequired = errors.New("share password required")
+	ErrShareInvalidPassword  = errors.New("invalid share password")
+	ErrShareUploadOnly       = errors.New("share only accepts uploads")
+	ErrShareNotWritable      = errors.New("share does not accept uploads")
+	ErrShareFileTooLarge     = errors.New("file exceeds the share's size limit")
+	ErrShareQuotaExceeded    = errors.New("share upload quota exceeded")
+	ErrInvalidUploadName     = errors.New("invalid upload name")
+)
+
+// ShareService defines the public share link interface
+type ShareService interface {
+	// List returns the shares of owner, or all shares if owner is empty
+	List(ctx context.Context, owner string) ([]*model.Share, error)
+	// Get returns a share by ID
+	Get(ctx context.Context, id string) (*model.Share, error)
+	// Create adds a share link for a file or folder
+	Create(ctx context.Context, params model.ShareParams) (*model.Share, error)
+	// Delete revokes a share link
+	Delete(ctx context.Context, id string) error
+	// Open checks a visitor's request against the share link's restrictions,
+	// records it in the link's access log and returns the share with the
+	// virtual path the request refers to
+	Open(ctx context.Context, req model.ShareRequest) (*model.Share, string, error)
+	// CompleteUpload checks a finished upload through a drop link against the
+	// link's restrictions again and, if it is accepted, calls place with its
+	// virtual target path to move it into place. place returns the virtual
+	// path the file ended up at; the upload is then counted and logged.
+	CompleteUpload(ctx context.Context, req model.ShareRequest, place func(target string) (string, error)) (*model.Share, string, error)
+	// Flush writes access log entries that are waiting to be saved
+	Flush() error
+}
+
+// shareService implements ShareService
+type shareService struct {
+	fs         filesystem.FS
+	files      FileService
+	filePath   string
+	now        func() time.Time
+	iterations int // PBKDF2 iterations for new passwords
+	mu         sync.Mutex
+	loaded     bool
+	shares     map[string]*model.Share
+	transfers  map[string]time.Time   // When each visitor's last counted download of a file started
+	unsaved    bool                   // Access log entries wait for a delayed save
+	placing    map[string]*sync.Mutex // Held while an upload is placed into a drop folder, by folder
+}
+
+// SharesData is the on-disk format of the shares file
+type SharesData struct {
+	Shares []*model.Share `json:"shares"`
+}
+
+// ShareServiceConfig holds configuration for the share service
+type ShareServiceConfig struct {
+	DataDir string
+	Now     func() time.Time // Clock used for expiry, defaults to time.Now
+}
+
+// NewShareService creates a new share service for the files of fileService
+func NewShareService(fsys filesystem.FS, fileService FileService, cfg ShareServiceConfig) ShareService {
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = config.DefaultDataDir
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &shareService{
+		fs:         fsys,
+		files:      fileService,
+		filePath:   filepath.Join(dataDir, config.SharesFileName),
+		now:        now,
+		iterations: config.SharePasswordIterations,
+		shares:     make(map[string]*model.Share),
+		transfers:  make(map[string]time.Time),
+		placing:    make(map[string]*sync.Mutex),
+	}
+}
+
+// List returns the shares of owner, or all shares if owner is empty,
+// ordered by creation time
+func (s *shareService) List(ctx context.Context, owner string) ([]*model.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Share, 0, len(s.shares))
+	for _, share := range s.sorted() {
+		if owner == "" || share.Owner == owner {
+			result = append(result, cloneShare(share))
+		}
+	}
+	return result, nil
+}
+
+// Get returns a share by ID
+func (s *shareService) Get(ctx context.Context, id string) (*model.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	share, ok := s.shares[id]
+	if !ok {
+		return nil, ErrShareNotFound
+	}
+	return cloneShare(share), nil
+}
+
+// Create adds a share link for an existing file or folder
+func (s *shareService) Create(ctx context.Context, params model.ShareParams) (*model.Share, error) {
+	now := s.now()
+	if params.MaxDownloads < 0 || (!params.ExpiresAt.IsZero() && !params.ExpiresAt.After(now)) {
+		return nil, ErrInvalidShare
+	}
+
+	sharePath := strings.Trim(params.Path, "/")
+	if sharePath == "" {
+		return nil, ErrInvalidShare
+	}
+	info, err := s.files.GetInfo(ctx, sharePath)
+	if err != nil {
+		return nil, err
+	}
+	if params.Drop != nil {
+		params.Path = sharePath
+		if err := s.checkDrop(params, info.IsDir); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+	share := &model.Share{
+		ID:           uuid.New().String(),
+		Token:        token,
+		Path:         sharePath,
+		IsDir:        info.IsDir,
+		Owner:        params.Owner,
+		ExpiresAt:    params.ExpiresAt,
+		MaxDownloads: params.MaxDownloads,
+		Drop:         params.Drop,
+		CreatedAt:    now,
+		Access:       []model.ShareAccess{},
+	}
+	if params.Password != "" {
+		if share.PasswordHash, err = hashSharePassword(params.Password, s.iterations); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.shares[share.ID] = share
+	if err := s.save(); err != nil {
+		delete(s.shares, share.ID)
+		return nil, err
+	}
+	return cloneShare(share), nil
+}
+
+// checkDrop checks the parameters of a drop link, which needs a folder on a
+// writable mount point
+func (s *shareService) checkDrop(params model.ShareParams, isDir bool) error {
+	drop := params.Drop
+	if !isDir || params.MaxDownloads != 0 || drop.MaxFiles < 0 || drop.MaxFileBytes < 0 || drop.MaxBytes < 0 {
+		return ErrInvalidShare
+	}
+	mount, _, err := s.files.ResolvePath(params.Path)
+	if err != nil {
+		return err
+	}
+	if mount.ReadOnly {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// Delete revokes a share link. Downloads already in progress are not
+// interrupted.
+func (s *shareService) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	share, ok := s.shares[id]
+	if !ok {
+		return ErrShareNotFound
+	}
+
+	delete(s.shares, id)
+	if err := s.save(); err != nil {
+		s.shares[id] = share
+		return err
+	}
+	return nil
+}
+
+// Open checks a visitor's request against the share link's restrictions and
+// records it, refused or not, in the link's access log. A counted request
+// uses up one of the link's downloads; once all are used up the link stops
+// working. The password and the file are checked without holding the lock,
+// and only counted requests are saved right away, so that busy links do not
+// hold up each other.
+func (s *shareService) Open(ctx context.Context, req model.ShareRequest) (*model.Share, string, error) {
+	share, err := s.snapshot(req.Token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := s.now()
+	relPath := strings.Trim(path.Clean("/"+req.Path), "/")
+	target, err := checkShareRequest(share, req, relPath, now)
+	if err == nil && (req.Action == model.ShareActionDownload || req.Action == model.ShareActionPreview) {
+		// Only files are served, and a request for anything else must not
+		// use up a download
+		info, statErr := s.files.GetInfo(ctx, target)
+		if statErr != nil {
+			err = statErr
+		} else if info.IsDir {
+			err = ErrNotFile
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The link may have been revoked or used up in the meantime
+	share, ok := s.shares[share.ID]
+	if !ok {
+		return nil, "", ErrShareNotFound
+	}
+	if err == nil {
+		err = checkShareState(share, now)
+	}
+	counted := err == nil && req.Counted && !s.resumes(share, req, relPath, now)
+	if counted {
+		share.Downloads++
+	}
+	logShareAccess(share, req.Action, relPath, req.RemoteAddr, err, now)
+
+	if !counted {
+		s.saveLater()
+	} else if saveErr := s.save(); saveErr != nil {
+		// A download that is not persisted could be repeated after a restart
+		share.Downloads--
+		return nil, "", saveErr
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return cloneShare(share), target, nil
+}
+
+// snapshot returns a copy of the share with the given token
+func (s *shareService) snapshot(token string) (*model.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	share := s.byToken(token)
+	if share == nil {
+		return nil, ErrShareNotFound
+	}
+	return cloneShare(share), nil
+}
+
+// logShareAccess appends a request to a share link's access log, dropping
+// the oldest entries beyond the history limit
+func logShareAccess(share *model.Share, action model.ShareAction, relPath, remoteAddr string, err error, now time.Time) {
+	share.Access = append(share.Access, model.ShareAccess{
+		Time:       now,
+		Action:     action,
+		Path:       relPath,
+		RemoteAddr: remoteAddr,
+		Error:      errorText(err),
+	})
+	if len(share.Access) > config.ShareAccessHistory {
+		share.Access = share.Access[len(share.Access)-config.ShareAccessHistory:]
+	}
+}
+
+// saveLater saves the shares after a delay, so that the access log entries
+// of a burst of requests are written at once. The caller must hold mu.
+func (s *shareService) saveLater() {
+	if s.unsaved {
+		return
+	}
+	s.unsaved = true
+	time.AfterFunc(config.ShareAccessSaveDelay, func() {
+		s.Flush()
+	})
+}
+
+// Flush writes access log entries that are waiting to be saved
+func (s *shareService) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.unsaved {
+		return nil
+	}
+	return s.save()
+}
+
+// resumes reports whether a counted request continues a download the
+// visitor started recently, and otherwise records it as the start of one.
+// Requests that read from the start of the file always start a new
+// download. The caller must hold mu.
+func (s *shareService) resumes(share *model.Share, req model.ShareRequest, relPath string, now time.Time) bool {
+	visitor := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(visitor); err == nil {
+		visitor = host
+	}
+	key := share.ID + "\x00" + relPath + "\x00" + visitor
+	if started, ok := s.transfers[key]; ok && req.Resumed && now.Sub(started) < config.ShareResumeWindow {
+		return true
+	}
+
+	for k, started := range s.transfers {
+		if now.Sub(started) >= config.ShareResumeWindow {
+			delete(s.transfers, k)
+		}
+	}
+	s.transfers[key] = now
+	return false
+}
+
+// CompleteUpload checks a finished drop upload against the link's
+// restrictions again, since other uploads may have finished in the meantime,
+// and counts it once place has moved it into place. Uploads into one folder
+// are placed one at a time, which holds the link's slot for the upload until
+// it is counted; the share lock is not held while a file is placed, so that
+// a slow upload does not hold up other links.
+func (s *shareService) CompleteUpload(ctx context.Context, req model.ShareRequest, place func(target string) (string, error)) (*model.Share, string, error) {
+	snapshot, err := s.snapshot(req.Token)
+	if err != nil {
+		return nil, "", err
+	}
+	passwordErr := checkShareRequestPassword(snapshot, req)
+
+	placing := s.placeLock(snapshot.Path)
+	placing.Lock()
+	defer placing.Unlock()
+
+	s.mu.Lock()
+	share, ok := s.shares[snapshot.ID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, "", ErrShareNotFound
+	}
+
+	now := s.now()
+	req.Action = model.ShareActionUpload
+	relPath := strings.Trim(path.Clean("/"+req.Path), "/")
+	target, err := "", checkShareState(share, now)
+	if err == nil {
+		err = passwordErr
+	}
+	if err == nil {
+		target, err = checkShareTarget(share, req, relPath)
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		target, err = place(target)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		share.Uploads++
+		share.UploadedBytes += req.Size
+		relPath = strings.TrimPrefix(target, share.Path+"/")
+	}
+	logShareAccess(share, model.ShareActionUpload, relPath, req.RemoteAddr, err, now)
+
+	// The file is in place by now, so a failed save only loses the count
+	// across a restart
+	s.save()
+	if err != nil {
+		return nil, "", err
+	}
+	return cloneShare(share), target, nil
+}
+
+// placeLock returns the lock held while an upload is placed into a folder
+func (s *shareService) placeLock(folder string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.placing[folder]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.placing[folder] = lock
+	}
+	return lock
+}
+
+// checkShareRequest returns the virtual path a request refers to, or why the
+// share refuses it
+func checkShareRequest(share *model.Share, req model.ShareRequest, relPath string, now time.Time) (string, error) {
+	if err := checkShareState(share, now); err != nil {
+		return "", err
+	}
+	if err := checkShareRequestPassword(share, req); err != nil {
+		return "", err
+	}
+	return checkShareTarget(share, req, relPath)
+}
+
+// checkShareState returns why a share link no longer works, if it does not
+func checkShareState(share *model.Share, now time.Time) error {
+	if !share.ExpiresAt.IsZero() && !now.Before(share.ExpiresAt) {
+		return ErrShareExpired
+	}
+	if shareExhausted(share) {
+		return ErrShareExhausted
+	}
+	return nil
+}
+
+// checkShareRequestPassword checks the password of a request to a
+// protected share link. It is slow by design, so callers should not hold
+// the lock.
+func checkShareRequestPassword(share *model.Share, req model.ShareRequest) error {
+	if share.PasswordHash == "" {
+		return nil
+	}
+	if req.Password == "" {
+		return ErrSharePasswordRequired
+	}
+	if !checkSharePassword(share.PasswordHash, req.Password) {
+		return ErrShareInvalidPassword
+	}
+	return nil
+}
+
+// checkShareTarget returns the virtual path a request refers to, or why
+// the share refuses it
+func checkShareTarget(share *model.Share, req model.ShareRequest, relPath string) (string, error) {
+	if share.Drop != nil {
+		return checkDropRequest(share, req, relPath)
+	}
+	if req.Action == model.ShareActionUpload {
+		return "", ErrShareNotWritable
+	}
+
+	if relPath == "" {
+		return share.Path, nil
+	}
+	if !share.IsDir {
+		return "", ErrPathNotFound
+	}
+	return share.Path + "/" + relPath, nil
+}
+
+// checkDropRequest returns the virtual target path of an upload through a
+// drop link, or why the link refuses it. Guests may only see the link's
+// limits and upload single files into the folder.
+func checkDropRequest(share *model.Share, req model.ShareRequest, relPath string) (string, error) {
+	switch req.Action {
+	case model.ShareActionInfo:
+		return share.Path, nil
+	case model.ShareActionUpload:
+	default:
+		return "", ErrShareUploadOnly
+	}
+
+	if relPath == "" || strings.Contains(relPath, "/") {
+		return "", ErrInvalidUploadName
+	}
+	drop := share.Drop
+	if drop.MaxFileBytes > 0 && req.Size > drop.MaxFileBytes {
+		return "", ErrShareFileTooLarge
+	}
+	if drop.MaxBytes > 0 && share.UploadedBytes+req.Size > drop.MaxBytes {
+		return "", ErrShareQuotaExceeded
+	}
+	return share.Path + "/" + relPath, nil
+}
+
+// shareExhausted reports whether a share link's downloads, or for a drop
+// link its files, are used up
+func shareExhausted(share *model.Share) bool {
+	if share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+		return true
+	}
+	return share.Drop != nil && share.Drop.MaxFiles > 0 && share.Uploads >= share.Drop.MaxFiles
+}
+
+// errorText returns the message of err, or an empty string if it is nil
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// byToken returns the share with the given token. The caller must hold mu.
+func (s *shareService) byToken(token string) *model.Share {
+	if token == "" {
+		return nil
+	}
+	for _, share := range s.shares {
+		if subtle.ConstantTimeCompare([]byte(share.Token), []byte(token)) == 1 {
+			return share
+		}
+	}
+	return nil
+}
+
+// newShareToken returns a random URL-safe share link token
+func newShareToken() (string, error) {
+	b := make([]byte, config.ShareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSharePassword returns a salted PBKDF2 hash of a share link password
+// in the form pbkdf2-sha256$iterations$salt$key
+func hashSharePassword(password string, iterations int) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", iterations,
+		hex.EncodeToString(salt), hex.EncodeToString(key)), nil
+}
+
+// checkSharePassword reports whether password matches a hash made by
+// hashSharePassword
+func checkSharePassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
+
+// load reads the shares file on first use. The caller must hold mu.
+func (s *shareService) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	exists, err := s.fs.Exists(s.filePath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		file, err := s.fs.ReadFile(s.filePath)
+		if err != nil {
+			return err
+		}
+		if len(file) > 0 {
+			var data SharesData
+			if err := json.Unmarshal(file, &data); err != nil {
+				return err
+			}
+			for _, share := range data.Shares {
+				if share.Access == nil {
+					share.Access = []model.ShareAccess{}
+				}
+				s.shares[share.ID] = share
+			}
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// save writes all shares to the shares file. The caller must hold mu.
+func (s *shareService) save() error {
+	s.unsaved = false
+	data := SharesData{Shares: s.sorted()}
+	fileData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := s.fs.MkdirAll(filepath.Dir(s.filePath), 0755); err != nil {
+		return err
+	}
+	// The file holds the link tokens, so only the server may read it
+	return s.fs.WriteFile(s.filePath, fileData, 0600)
+}
+
+// sorted returns the shares ordered by creation time. The caller must hold mu.
+func (s *shareService) sorted() []*model.Share {
+	result := make([]*model.Share, 0, len(s.shares))
+	for _, share := range s.shares {
+		result = append(result, share)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// cloneShare returns a copy of a share that is safe to hand out
+func cloneShare(share *model.Share) *model.Share {
+	clone := *share
+	clone.Access = append([]model.ShareAccess{}, share.Access...)
+	if share.Drop != nil {
+		drop := *share.Drop
+		clone.Drop = &drop
+	}
+	return &clone
+}
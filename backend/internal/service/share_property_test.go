@@ -0,0 +1,470 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// shareClock is a settable clock for share expiry tests
+type shareClock struct {
+	now time.Time
+}
+
+func (c *shareClock) Now() time.Time { return c.now }
+
+// setupShareService creates a share service over an in-memory filesystem
+// holding a shared folder and file below the media mount
+func setupShareService(t *testing.T, clock *shareClock) (ShareService, *filesystem.AferoFS, FileService) {
+	t.Helper()
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media/album/sub", 0755)
+	fs.MkdirAll("/data/documents", 0755)
+	fs.WriteFile("/data/media/album/a.jpg", []byte("photo a"), 0644)
+	fs.WriteFile("/data/media/album/sub/b.jpg", []byte("photo b"), 0644)
+	fs.WriteFile("/data/media/song.mp3", []byte("song"), 0644)
+	fs.WriteFile("/data/documents/private.txt", []byte("private"), 0644)
+
+	files := NewFileService(fs, FileServiceConfig{MountPoints: []model.MountPoint{
+		{Name: "media", Path: "/data/media"},
+		{Name: "documents", Path: "/data/documents"},
+	}})
+	return newTestShareService(fs, files, clock), fs, files
+}
+
+// newTestShareService creates a share service with cheap password hashing
+func newTestShareService(fs filesystem.FS, files FileService, clock *shareClock) ShareService {
+	svc := NewShareService(fs, files, ShareServiceConfig{DataDir: "/appdata", Now: clock.Now})
+	svc.(*shareService).iterations = 1
+	return svc
+}
+
+// shareAttempt is one visitor request in a generated sequence
+type shareAttempt struct {
+	Password int // 0 = none, 1 = correct, 2 = wrong
+	Counted  bool
+	Advance  int // Minutes the clock moves forward before the request
+}
+
+// **Feature: homelab-file-manager, Property 39: Share Link Restrictions**
+//
+// Property: For any share link and any sequence of requests, a request SHALL succeed only
+// if the link has not expired, its downloads are not used up and, for a protected link, the
+// correct password is given. Successful counted requests SHALL never exceed the download
+// limit, every request SHALL be recorded in the access log, the download count SHALL survive
+// a restart, and no request path SHALL resolve outside the shared folder.
+
+func TestProperty_ShareLinkRestrictions(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+
+	properties := gopter.NewProperties(parameters)
+
+	attemptGen := gopter.CombineGens(
+		gen.IntRange(0, 2),
+		gen.Bool(),
+		gen.IntRange(0, 30),
+	).Map(func(values []interface{}) shareAttempt {
+		return shareAttempt{Password: values[0].(int), Counted: values[1].(bool), Advance: values[2].(int)}
+	})
+
+	properties.Property("share links enforce expiry, password and download limit", prop.ForAll(
+		func(maxDownloads int, protected bool, expiresIn int, attempts []shareAttempt) bool {
+			clock := &shareClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			svc, fs, files := setupShareService(t, clock)
+			ctx := context.Background()
+
+			params := model.ShareParams{Path: "media/song.mp3", MaxDownloads: maxDownloads, Owner: "alice"}
+			if protected {
+				params.Password = "secret"
+			}
+			if expiresIn > 0 {
+				params.ExpiresAt = clock.now.Add(time.Duration(expiresIn) * time.Minute)
+			}
+			share, err := svc.Create(ctx, params)
+			if err != nil || share.IsDir || share.Token == "" {
+				t.Logf("create failed: %v", err)
+				return false
+			}
+
+			downloads := 0
+			for i, attempt := range attempts {
+				clock.now = clock.now.Add(time.Duration(attempt.Advance) * time.Minute)
+				password := ""
+				switch attempt.Password {
+				case 1:
+					password = "secret"
+				case 2:
+					password = "guess"
+				}
+
+				var want error
+				switch {
+				case expiresIn > 0 && !clock.now.Before(params.ExpiresAt):
+					want = ErrShareExpired
+				case maxDownloads > 0 && downloads >= maxDownloads:
+					want = ErrShareExhausted
+				case protected && password == "":
+					want = ErrSharePasswordRequired
+				case protected && password != "secret":
+					want = ErrShareInvalidPassword
+				}
+
+				got, target, err := svc.Open(ctx, model.ShareRequest{
+					Token:    share.Token,
+					Password: password,
+					Action:   model.ShareActionDownload,
+					Counted:  attempt.Counted,
+				})
+				if want != nil {
+					if !errors.Is(err, want) {
+						t.Logf("attempt %d: expected %v, got %v", i, want, err)
+						return false
+					}
+					continue
+				}
+				if err != nil || target != "media/song.mp3" {
+					t.Logf("attempt %d: unexpected refusal %v (target %q)", i, err, target)
+					return false
+				}
+				if attempt.Counted {
+					downloads++
+				}
+				if got.Downloads != downloads {
+					t.Logf("attempt %d: downloads %d, want %d", i, got.Downloads, downloads)
+					return false
+				}
+			}
+			if maxDownloads > 0 && downloads > maxDownloads {
+				return false
+			}
+
+			stored, err := svc.Get(ctx, share.ID)
+			if err != nil || len(stored.Access) != len(attempts) || stored.Downloads != downloads {
+				t.Logf("access log has %d entries for %d attempts", len(stored.Access), len(attempts))
+				return false
+			}
+			if protected && (stored.PasswordHash == "" || strings.Contains(stored.PasswordHash, "secret")) {
+				t.Log("password is not stored hashed")
+				return false
+			}
+
+			// The count survives a restart, and so does the access log once
+			// it has been flushed on shutdown
+			if err := svc.Flush(); err != nil {
+				return false
+			}
+			reloaded, err := newTestShareService(fs, files, clock).Get(ctx, share.ID)
+			return err == nil && reloaded.Downloads == downloads && len(reloaded.Access) == len(attempts)
+		},
+		gen.IntRange(0, 4),
+		gen.Bool(),
+		gen.IntRange(0, 120),
+		gen.SliceOfN(12, attemptGen),
+	))
+
+	properties.Property("folder share paths stay inside the shared folder", prop.ForAll(
+		func(segments []string) bool {
+			clock := &shareClock{now: time.Now()}
+			svc, _, _ := setupShareService(t, clock)
+			ctx := context.Background()
+
+			share, err := svc.Create(ctx, model.ShareParams{Path: "/media/album/"})
+			if err != nil || !share.IsDir || share.Path != "media/album" {
+				return false
+			}
+
+			_, target, err := svc.Open(ctx, model.ShareRequest{
+				Token:  share.Token,
+				Path:   strings.Join(segments, "/"),
+				Action: model.ShareActionList,
+			})
+			if err != nil {
+				return false
+			}
+			return target == "media/album" || strings.HasPrefix(target, "media/album/")
+		},
+		gen.SliceOf(gen.OneConstOf("..", ".", "sub", "", "a.jpg", "...", "documents")),
+	))
+
+	properties.TestingRun(t)
+}
+
+// TestShareRefusesDirectoriesAndMissingFiles checks that downloads of
+// anything but a file are refused without using up the link
+func TestShareRefusesDirectoriesAndMissingFiles(t *testing.T) {
+	clock := &shareClock{now: time.Now()}
+	svc, _, _ := setupShareService(t, clock)
+	ctx := context.Background()
+
+	share, err := svc.Create(ctx, model.ShareParams{Path: "media/album", MaxDownloads: 1})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for _, path := range []string{"", "sub", "missing.jpg"} {
+		if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Path: path, Action: model.ShareActionDownload, Counted: true}); err == nil {
+			t.Errorf("download of %q succeeded", path)
+		}
+	}
+	if _, target, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Path: "sub/b.jpg", Action: model.ShareActionDownload, Counted: true}); err != nil || target != "media/album/sub/b.jpg" {
+		t.Fatalf("download of a file was refused: %v (target %q)", err, target)
+	}
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Action: model.ShareActionList}); !errors.Is(err, ErrShareExhausted) {
+		t.Errorf("expected the used-up link to stop working, got %v", err)
+	}
+
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: "nope", Action: model.ShareActionInfo}); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("expected unknown token to be not found, got %v", err)
+	}
+	if err := svc.Delete(ctx, share.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Action: model.ShareActionInfo}); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("expected revoked link to be not found, got %v", err)
+	}
+
+	if _, err := svc.Create(ctx, model.ShareParams{Path: "media/album", ExpiresAt: clock.now.Add(-time.Minute)}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("expected an already expired link to be rejected, got %v", err)
+	}
+	if _, err := svc.Create(ctx, model.ShareParams{Path: "media/gone"}); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("expected a missing path to be rejected, got %v", err)
+	}
+}
+
+// TestShareAccessLogIsSavedLater checks that only counted downloads are
+// written to the shares file right away, while access log entries wait for
+// a flush
+func TestShareAccessLogIsSavedLater(t *testing.T) {
+	clock := &shareClock{now: time.Now()}
+	svc, fs, files := setupShareService(t, clock)
+	ctx := context.Background()
+
+	share, err := svc.Create(ctx, model.ShareParams{Path: "media/song.mp3", MaxDownloads: 2})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	reload := func() *model.Share {
+		t.Helper()
+		stored, err := newTestShareService(fs, files, clock).Get(ctx, share.ID)
+		if err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+		return stored
+	}
+
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Action: model.ShareActionInfo}); err != nil {
+		t.Fatalf("info: %v", err)
+	}
+	if stored := reload(); len(stored.Access) != 0 {
+		t.Fatalf("expected the access log to wait for a flush, got %d entries", len(stored.Access))
+	}
+
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Action: model.ShareActionDownload, Counted: true}); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if stored := reload(); stored.Downloads != 1 || len(stored.Access) != 2 {
+		t.Fatalf("expected the download to be saved right away, got %d downloads and %d entries", stored.Downloads, len(stored.Access))
+	}
+
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Action: model.ShareActionPreview}); err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if err := svc.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if stored := reload(); len(stored.Access) != 3 {
+		t.Fatalf("expected the flush to save the access log, got %d entries", len(stored.Access))
+	}
+}
+
+// **Feature: homelab-file-manager, Property 40: Drop Link Upload Limits**
+//
+// Property: For any drop link and any sequence of guest uploads, an upload SHALL be accepted
+// only if it fits the link's per-file size limit, its total size cap and its file count, the
+// accepted uploads SHALL never exceed those limits, and the link SHALL refuse every attempt
+// to list, download or preview the folder.
+
+func TestProperty_DropLinkUploadLimits(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("drop links only accept uploads within their limits", prop.ForAll(
+		func(maxFiles int, maxFileBytes, maxBytes int64, sizes []int64) bool {
+			clock := &shareClock{now: time.Now()}
+			svc, fs, _ := setupShareService(t, clock)
+			ctx := context.Background()
+
+			drop := &model.DropOptions{MaxFiles: maxFiles, MaxFileBytes: maxFileBytes, MaxBytes: maxBytes}
+			share, err := svc.Create(ctx, model.ShareParams{Path: "media/album", Drop: drop, Owner: "alice"})
+			if err != nil {
+				t.Logf("create failed: %v", err)
+				return false
+			}
+
+			files, total := 0, int64(0)
+			for i, size := range sizes {
+				var want error
+				switch {
+				case maxFiles > 0 && files >= maxFiles:
+					want = ErrShareExhausted
+				case maxFileBytes > 0 && size > maxFileBytes:
+					want = ErrShareFileTooLarge
+				case maxBytes > 0 && total+size > maxBytes:
+					want = ErrShareQuotaExceeded
+				}
+
+				req := model.ShareRequest{Token: share.Token, Path: "photo.jpg", Size: size}
+				placed := ""
+				_, target, err := svc.CompleteUpload(ctx, req, func(target string) (string, error) {
+					placed = fmt.Sprintf("%s.%d", target, i)
+					return placed, fs.WriteFile("/data/"+placed, make([]byte, size), 0644)
+				})
+				if want != nil {
+					if !errors.Is(err, want) || placed != "" {
+						t.Logf("upload %d of %d bytes: expected %v, got %v", i, size, want, err)
+						return false
+					}
+					continue
+				}
+				if err != nil || target != placed {
+					t.Logf("upload %d of %d bytes refused: %v", i, size, err)
+					return false
+				}
+				files++
+				total += size
+			}
+
+			stored, err := svc.Get(ctx, share.ID)
+			if err != nil || stored.Uploads != files || stored.UploadedBytes != total {
+				return false
+			}
+			if (maxFiles > 0 && files > maxFiles) || (maxBytes > 0 && total > maxBytes) {
+				return false
+			}
+
+			for _, action := range []model.ShareAction{model.ShareActionList, model.ShareActionDownload, model.ShareActionPreview} {
+				if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Path: "a.jpg", Action: action}); err == nil {
+					t.Logf("%s through a drop link succeeded", action)
+					return false
+				}
+			}
+			return true
+		},
+		gen.IntRange(0, 4),
+		gen.Int64Range(0, 40),
+		gen.Int64Range(0, 100),
+		gen.SliceOfN(8, gen.Int64Range(0, 50)),
+	))
+
+	properties.TestingRun(t)
+}
+
+// TestDropUploadPlacedOutsideShareLock checks that other links keep working
+// while an upload is moved into place, and that a second upload into the
+// same folder waits for it
+func TestDropUploadPlacedOutsideShareLock(t *testing.T) {
+	clock := &shareClock{now: time.Now()}
+	svc, _, _ := setupShareService(t, clock)
+	ctx := context.Background()
+
+	drop, err := svc.Create(ctx, model.ShareParams{Path: "media/album", Drop: &model.DropOptions{MaxFiles: 1}, Owner: "alice"})
+	if err != nil {
+		t.Fatalf("create drop link: %v", err)
+	}
+	other, err := svc.Create(ctx, model.ShareParams{Path: "media/song.mp3", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("create share link: %v", err)
+	}
+
+	placing, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := svc.CompleteUpload(ctx, model.ShareRequest{Token: drop.Token, Path: "a.jpg", Size: 1}, func(target string) (string, error) {
+			close(placing)
+			<-release
+			return target, nil
+		})
+		done <- err
+	}()
+	<-placing
+
+	opened := make(chan error, 1)
+	go func() {
+		_, _, err := svc.Open(ctx, model.ShareRequest{Token: other.Token, Action: model.ShareActionDownload, Counted: true})
+		opened <- err
+	}()
+	select {
+	case err := <-opened:
+		if err != nil {
+			t.Errorf("open other link: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("another link was blocked by an upload being placed")
+	}
+
+	// The second upload waits for the first and then finds the link used up
+	second := make(chan error, 1)
+	go func() {
+		_, _, err := svc.CompleteUpload(ctx, model.ShareRequest{Token: drop.Token, Path: "b.jpg", Size: 1}, func(target string) (string, error) {
+			return target, nil
+		})
+		second <- err
+	}()
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	if err := <-second; !errors.Is(err, ErrShareExhausted) {
+		t.Errorf("expected the second upload to be refused, got %v", err)
+	}
+}
+
+// TestDropLinkRequiresWritableFolder checks which paths can become drop links
+func TestDropLinkRequiresWritableFolder(t *testing.T) {
+	clock := &shareClock{now: time.Now()}
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media/inbox", 0755)
+	fs.MkdirAll("/data/archive", 0755)
+	fs.WriteFile("/data/media/song.mp3", []byte("song"), 0644)
+	files := NewFileService(fs, FileServiceConfig{MountPoints: []model.MountPoint{
+		{Name: "media", Path: "/data/media"},
+		{Name: "archive", Path: "/data/archive", ReadOnly: true},
+	}})
+	svc := newTestShareService(fs, files, clock)
+	ctx := context.Background()
+
+	drop := &model.DropOptions{}
+	if _, err := svc.Create(ctx, model.ShareParams{Path: "archive", Drop: drop}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("expected a read-only drop folder to be refused, got %v", err)
+	}
+	if _, err := svc.Create(ctx, model.ShareParams{Path: "media/song.mp3", Drop: drop}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("expected a file drop link to be refused, got %v", err)
+	}
+	share, err := svc.Create(ctx, model.ShareParams{Path: "media/inbox", Drop: drop})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: share.Token, Path: "sub/x.jpg", Action: model.ShareActionUpload}); !errors.Is(err, ErrInvalidUploadName) {
+		t.Errorf("expected an upload into a subfolder to be refused, got %v", err)
+	}
+
+	plain, err := svc.Create(ctx, model.ShareParams{Path: "media/inbox"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, _, err := svc.Open(ctx, model.ShareRequest{Token: plain.Token, Path: "x.jpg", Action: model.ShareActionUpload}); !errors.Is(err, ErrShareNotWritable) {
+		t.Errorf("expected a download link to refuse uploads, got %v", err)
+	}
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+)
+
+// ErrNoSyncReport is returned when a job has no sync report (yet)
+var ErrNoSyncReport = errors.New("sync report not available")
+
+// validateSyncOptions checks sync options and fills in defaults
+func validateSyncOptions(opts *model.SyncOptions) (*model.SyncOptions, error) {
+	result := model.SyncOptions{Compare: model.SyncCompareSizeMtime}
+	if opts != nil {
+		result = *opts
+		result.Exclude = append([]string(nil), opts.Exclude...)
+	}
+
+	if !result.Compare.IsValid() {
+		return nil, ErrInvalidJobParams
+	}
+	if result.Compare == "" {
+		result.Compare = model.SyncCompareSizeMtime
+	}
+	for _, pattern := range result.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, ErrInvalidJobParams
+		}
+	}
+	return &result, nil
+}
+
+// pathsOverlap reports whether a and b are the same path or one contains the other
+func pathsOverlap(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if a == b {
+		return true
+	}
+	within := func(child, parent string) bool {
+		rel, err := filepath.Rel(parent, child)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	return within(a, b) || within(b, a)
+}
+
+// SyncReport returns the changes a sync job planned or applied
+func (s *jobService) SyncReport(ctx context.Context, jobID string) (*model.SyncReport, error) {
+	if _, ok := s.allJobs.Load(jobID); !ok {
+		return nil, ErrJobNotFound
+	}
+
+	s.resultsMu.RLock()
+	defer s.resultsMu.RUnlock()
+	res, ok := s.results[jobID]
+	if !ok || res.syncReport == nil {
+		return nil, ErrNoSyncReport
+	}
+	report := *res.syncReport
+	report.Actions = append([]model.SyncAction(nil), res.syncReport.Actions...)
+	return &report, nil
+}
+
+// executeSync makes DestPath mirror SourcePath. The trees are compared first
+// and the resulting plan is stored as the job's report; a dry run stops there.
+func (s *jobService) executeSync(ctx context.Context, run *jobRun) error {
+	job := run.job
+	// A sync deletes and overwrites files, so it must not touch anything
+	// outside a writable mount point
+	if err := s.checkWritableDest(job.DestPath); err != nil {
+		return err
+	}
+
+	srcInfo, err := s.fs.Stat(job.SourcePath)
+	if err != nil {
+		return err
+	}
+	if !srcInfo.IsDir() {
+		return ErrNotDirectory
+	}
+
+	plan := &syncPlan{opts: job.Sync}
+	dstExists := true
+	if _, err := s.fs.Stat(job.DestPath); errors.Is(err, fs.ErrNotExist) {
+		dstExists = false
+		plan.add(model.SyncAction{Action: model.SyncActionMkdir, Path: ".", IsDir: true})
+	} else if err != nil {
+		return err
+	}
+	if err := s.planSyncDir(ctx, run, plan, ".", dstExists); err != nil {
+		return err
+	}
+
+	plan.report.DryRun = job.Sync.DryRun
+	s.resultsMu.Lock()
+	s.result(job.ID).syncReport = &plan.report
+	s.resultsMu.Unlock()
+
+	if job.Sync.DryRun {
+		return nil
+	}
+
+	run.total = len(plan.report.Actions)
+	var created []string
+	for _, action := range plan.report.Actions {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		src := filepath.Join(job.SourcePath, filepath.FromSlash(action.Path))
+		dst := filepath.Join(job.DestPath, filepath.FromSlash(action.Path))
+
+		var err error
+		switch action.Action {
+		case model.SyncActionMkdir:
+			err = s.fs.MkdirAll(dst, 0755)
+			created = append(created, action.Path)
+		case model.SyncActionCopy, model.SyncActionUpdate:
+			err = s.transferFile(ctx, run, src, dst, nil)
+		case model.SyncActionDelete:
+			err = s.fs.RemoveAll(dst)
+			src = dst
+		}
+		if err != nil {
+			if err := s.itemFailed(ctx, run, src, err); err != nil {
+				return err
+			}
+		}
+		s.advance(run, 1)
+	}
+
+	// Apply directory metadata deepest first, once their contents are written
+	for i := len(created) - 1; i >= 0; i-- {
+		src := filepath.Join(job.SourcePath, filepath.FromSlash(created[i]))
+		dst := filepath.Join(job.DestPath, filepath.FromSlash(created[i]))
+		info, err := s.fs.Stat(src)
+		if err == nil {
+			err = s.preserveMetadata(src, dst, info)
+		}
+		if err != nil {
+			if err := s.itemFailed(ctx, run, src, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncPlan accumulates the actions of a sync job
+type syncPlan struct {
+	opts   *model.SyncOptions
+	report model.SyncReport
+}
+
+// add appends an action to the plan and updates the report totals
+func (p *syncPlan) add(action model.SyncAction) {
+	p.report.Actions = append(p.report.Actions, action)
+	switch action.Action {
+	case model.SyncActionCopy:
+		p.report.CopyCount++
+		p.report.Bytes += action.Size
+	case model.SyncActionUpdate:
+		p.report.UpdateCount++
+		p.report.Bytes += action.Size
+	case model.SyncActionDelete:
+		p.report.DeleteCount++
+	}
+}
+
+// excluded reports whether a relative path matches one of the exclude globs,
+// either as a whole or by its base name
+func (p *syncPlan) excluded(rel string) bool {
+	for _, pattern := range p.opts.Exclude {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// planSyncDir compares one directory of the source tree with its counterpart
+// in the destination. dstExists is false when the destination directory is
+// itself being created, in which case everything below it is copied.
+func (s *jobService) planSyncDir(ctx context.Context, run *jobRun, plan *syncPlan, rel string, dstExists bool) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	job := run.job
+	srcDir := filepath.Join(job.SourcePath, filepath.FromSlash(rel))
+	dstDir := filepath.Join(job.DestPath, filepath.FromSlash(rel))
+
+	srcEntries, err := s.readDirInfos(srcDir)
+	if err != nil {
+		// Skip the subtree so nothing below it is deleted from the destination
+		return s.itemFailed(ctx, run, srcDir, err)
+	}
+
+	var dstList []fs.FileInfo
+	if dstExists {
+		dstList, err = s.readDirInfos(dstDir)
+		if err != nil {
+			return s.itemFailed(ctx, run, dstDir, err)
+		}
+	}
+	dstEntries := make(map[string]fs.FileInfo, len(dstList))
+	for _, info := range dstList {
+		dstEntries[info.Name()] = info
+	}
+
+	for _, srcEntry := range srcEntries {
+		name := srcEntry.Name()
+		childRel := path.Join(rel, name)
+		if plan.excluded(childRel) {
+			continue
+		}
+
+		dstEntry, exists := dstEntries[name]
+		if exists && dstEntry.IsDir() != srcEntry.IsDir() {
+			// A file replaces a directory or vice versa
+			plan.add(model.SyncAction{Action: model.SyncActionDelete, Path: childRel, IsDir: dstEntry.IsDir()})
+			exists = false
+		}
+
+		if srcEntry.IsDir() {
+			if !exists {
+				plan.add(model.SyncAction{Action: model.SyncActionMkdir, Path: childRel, IsDir: true})
+			}
+			if err := s.planSyncDir(ctx, run, plan, childRel, exists); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !exists {
+			plan.add(model.SyncAction{Action: model.SyncActionCopy, Path: childRel, Size: srcEntry.Size()})
+			continue
+		}
+
+		changed, err := s.syncChanged(ctx, plan.opts, srcEntry, dstEntry,
+			filepath.Join(srcDir, name), filepath.Join(dstDir, name))
+		if err != nil {
+			if err := s.itemFailed(ctx, run, filepath.Join(srcDir, name), err); err != nil {
+				return err
+			}
+			continue
+		}
+		if changed {
+			plan.add(model.SyncAction{Action: model.SyncActionUpdate, Path: childRel, Size: srcEntry.Size()})
+		}
+	}
+
+	if !plan.opts.Delete {
+		return nil
+	}
+
+	// Destination entries missing from the source are extraneous
+	srcNames := make(map[string]bool, len(srcEntries))
+	for _, srcEntry := range srcEntries {
+		srcNames[srcEntry.Name()] = true
+	}
+	for _, dstEntry := range dstList {
+		childRel := path.Join(rel, dstEntry.Name())
+		if srcNames[dstEntry.Name()] || plan.excluded(childRel) {
+			continue
+		}
+		plan.add(model.SyncAction{Action: model.SyncActionDelete, Path: childRel, IsDir: dstEntry.IsDir()})
+	}
+	return nil
+}
+
+// syncChanged reports whether a source file differs from its destination copy
+func (s *jobService) syncChanged(ctx context.Context, opts *model.SyncOptions, srcInfo, dstInfo fs.FileInfo, src, dst string) (bool, error) {
+	if srcInfo.Size() != dstInfo.Size() {
+		return true, nil
+	}
+
+	if opts.Compare == model.SyncCompareChecksum {
+		srcHash, err := s.hashFile(ctx, src)
+		if err != nil {
+			return false, err
+		}
+		dstHash, err := s.hashFile(ctx, dst)
+		if err != nil {
+			return false, err
+		}
+		s.recordHash(src, srcHash)
+		s.recordHash(dst, dstHash)
+		return srcHash != dstHash, nil
+	}
+
+	diff := srcInfo.ModTime().Sub(dstInfo.ModTime())
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff >= config.SyncModTimeWindow, nil
+}
+
+// readDirInfos lists a directory as file infos, in name order. Unfinished
+// uploads are neither copied nor deleted.
+func (s *jobService) readDirInfos(dir string) ([]fs.FileInfo, error) {
+	entries, err := s.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if fileutil.IsUploadTemp(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,486 @@
+// Package service provides business logic for the file manager.
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+	"github.com/homelab/filemanager/internal/pkg/validator"
+	"github.com/homelab/filemanager/internal/websocket"
+)
+
+// Watch service errors
+var (
+	ErrTooManyWatches = errors.New("too many watched directories")
+)
+
+// WatchService watches the directories clients subscribe to through the
+// WebSocket hub and pushes their changes back to them
+type WatchService interface {
+	websocket.DirWatcher
+	// Start begins delivering change notifications and polling
+	Start(ctx context.Context)
+	// Stop stops watching all directories
+	Stop()
+}
+
+// watchService implements WatchService with fsnotify, falling back to
+// polling for directories the OS does not notify
+type watchService struct {
+	fs           filesystem.FS
+	hub          *websocket.Hub
+	mountPoints  []model.MountPoint
+	maxDirs      int
+	debounce     time.Duration
+	pollInterval time.Duration
+
+	mu       sync.Mutex
+	dirs     map[string]*watchedDir // by virtual path
+	byFsPath map[string]*watchedDir // by filesystem path, for notified dirs
+	notify   *fsnotify.Watcher      // nil until started or when unavailable
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// watchedDir is a directory with at least one subscribed client
+type watchedDir struct {
+	path    string
+	fsPath  string
+	refs    int
+	polled  bool                  // no change notifications, re-listed periodically
+	entries map[string]entryState // last known listing
+	pending []dirOp               // notified changes waiting for the debounce
+}
+
+// entryState is what is known about one directory entry
+type entryState struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// dirOp is a notified change to one entry of a watched directory
+type dirOp struct {
+	name string
+	op   fsnotify.Op
+}
+
+// WatchServiceConfig holds configuration for the watch service
+type WatchServiceConfig struct {
+	MountPoints  []model.MountPoint
+	MaxDirs      int           // Defaults to config.MaxWatchedDirs
+	Debounce     time.Duration // Defaults to config.WatchDebounce
+	PollInterval time.Duration // Defaults to config.WatchPollInterval
+}
+
+// NewWatchService creates a new watch service and registers it with the hub
+func NewWatchService(fsys filesystem.FS, hub *websocket.Hub, cfg WatchServiceConfig) WatchService {
+	maxDirs := cfg.MaxDirs
+	if maxDirs <= 0 {
+		maxDirs = config.MaxWatchedDirs
+	}
+	debounce := cfg.Debounce
+	if debounce <= 0 {
+		debounce = config.WatchDebounce
+	}
+	pollInterval := cfg.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = config.WatchPollInterval
+	}
+
+	s := &watchService{
+		fs:           fsys,
+		hub:          hub,
+		mountPoints:  cfg.MountPoints,
+		maxDirs:      maxDirs,
+		debounce:     debounce,
+		pollInterval: pollInterval,
+		dirs:         make(map[string]*watchedDir),
+		byFsPath:     make(map[string]*watchedDir),
+		stopCh:       make(chan struct{}),
+	}
+	if hub != nil {
+		hub.SetDirWatcher(s)
+	}
+	return s
+}
+
+// Start begins delivering change notifications and polling. Directories
+// watched before Start are polled.
+func (s *watchService) Start(ctx context.Context) {
+	if _, ok := s.fs.(filesystem.NotifyFS); ok {
+		if w, err := fsnotify.NewWatcher(); err == nil {
+			s.mu.Lock()
+			s.notify = w
+			s.mu.Unlock()
+		}
+	}
+
+	s.wg.Add(1)
+	go s.run(ctx)
+}
+
+// Stop stops watching all directories
+func (s *watchService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.notify != nil {
+		s.notify.Close()
+		s.notify = nil
+	}
+	s.dirs = make(map[string]*watchedDir)
+	s.byFsPath = make(map[string]*watchedDir)
+}
+
+// run delivers change notifications and polls until stopped
+func (s *watchService) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	var events chan fsnotify.Event
+	var errs chan error
+	s.mu.Lock()
+	if s.notify != nil {
+		events = s.notify.Events
+		errs = s.notify.Errors
+	}
+	s.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.poll()
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			s.record(ev)
+		case _, ok := <-errs:
+			// Queue overflows lose events; the next change of the
+			// directory brings it up to date again
+			if !ok {
+				errs = nil
+			}
+		}
+	}
+}
+
+// Watch starts watching the directory at a virtual path, or adds a
+// reference if it is already watched
+func (s *watchService) Watch(path string) error {
+	_, fsPath, err := validator.ValidatePathAgainstMounts(path, s.mountPoints)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if dir, ok := s.dirs[path]; ok {
+		dir.refs++
+		s.mu.Unlock()
+		return nil
+	}
+	if len(s.dirs) >= s.maxDirs {
+		s.mu.Unlock()
+		return ErrTooManyWatches
+	}
+	s.mu.Unlock()
+
+	isDir, err := s.fs.IsDir(fsPath)
+	if err != nil {
+		return ErrPathNotFound
+	}
+	if !isDir {
+		return ErrNotDirectory
+	}
+
+	// Subscribe to notifications before listing so that no change is missed
+	notified := s.addNotify(fsPath)
+	entries, err := s.readEntries(fsPath)
+	if err != nil {
+		if notified {
+			s.removeNotify(fsPath)
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	if dir, ok := s.dirs[path]; ok {
+		// Another client watched the directory meanwhile
+		dir.refs++
+		s.mu.Unlock()
+		return nil
+	}
+	if len(s.dirs) >= s.maxDirs {
+		// Other directories were watched meanwhile
+		s.mu.Unlock()
+		if notified {
+			s.removeNotify(fsPath)
+		}
+		return ErrTooManyWatches
+	}
+	dir := &watchedDir{
+		path:    path,
+		fsPath:  fsPath,
+		refs:    1,
+		polled:  !notified,
+		entries: entries,
+	}
+	s.dirs[path] = dir
+	if notified {
+		s.byFsPath[fsPath] = dir
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Unwatch releases one reference to a watched directory and stops watching
+// it when none are left
+func (s *watchService) Unwatch(path string) {
+	s.mu.Lock()
+	dir, ok := s.dirs[path]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	dir.refs--
+	if dir.refs > 0 {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.dirs, path)
+	if s.byFsPath[dir.fsPath] == dir {
+		delete(s.byFsPath, dir.fsPath)
+	}
+	s.mu.Unlock()
+
+	if !dir.polled {
+		s.removeNotify(dir.fsPath)
+	}
+}
+
+// addNotify subscribes to OS change notifications for a directory,
+// reporting false if it has to be polled instead
+func (s *watchService) addNotify(fsPath string) bool {
+	s.mu.Lock()
+	w := s.notify
+	s.mu.Unlock()
+	if w == nil {
+		return false
+	}
+	if nfs, ok := s.fs.(filesystem.NotifyFS); !ok || !nfs.SupportsNotify(fsPath) {
+		return false
+	}
+	// Fails when the kernel's watch limit is reached
+	return w.Add(fsPath) == nil
+}
+
+// removeNotify unsubscribes from OS change notifications for a directory
+func (s *watchService) removeNotify(fsPath string) {
+	s.mu.Lock()
+	w := s.notify
+	s.mu.Unlock()
+	if w != nil {
+		w.Remove(fsPath)
+	}
+}
+
+// record queues a notified change and schedules the directory's flush
+func (s *watchService) record(ev fsnotify.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, ok := s.byFsPath[filepath.Dir(ev.Name)]
+	if !ok {
+		return
+	}
+	if len(dir.pending) == 0 {
+		time.AfterFunc(s.debounce, func() { s.flush(dir) })
+	}
+	dir.pending = append(dir.pending, dirOp{name: filepath.Base(ev.Name), op: ev.Op})
+}
+
+// flush sends the changes collected for a notified directory
+func (s *watchService) flush(dir *watchedDir) {
+	s.mu.Lock()
+	ops := dir.pending
+	dir.pending = nil
+	if s.dirs[dir.path] != dir {
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	// Look at the entries as they are now, outside the lock
+	current := make(map[string]entryState)
+	for _, op := range ops {
+		if _, ok := current[op.name]; ok {
+			continue
+		}
+		if info, err := s.fs.Stat(filepath.Join(dir.fsPath, op.name)); err == nil {
+			current[op.name] = stateOf(info)
+		}
+	}
+
+	s.mu.Lock()
+	events := coalesce(dir.entries, ops, current)
+	s.mu.Unlock()
+
+	if len(events) > 0 && s.hub != nil {
+		s.hub.SendDirChanges(dir.path, events)
+	}
+}
+
+// poll re-lists the directories without change notifications and sends
+// their differences
+func (s *watchService) poll() {
+	s.mu.Lock()
+	var polled []*watchedDir
+	for _, dir := range s.dirs {
+		if dir.polled {
+			polled = append(polled, dir)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, dir := range polled {
+		entries, err := s.readEntries(dir.fsPath)
+		if err != nil {
+			// The directory itself is gone; its parent reports that
+			continue
+		}
+
+		s.mu.Lock()
+		if s.dirs[dir.path] != dir {
+			s.mu.Unlock()
+			continue
+		}
+		events := diffEntries(dir.entries, entries)
+		dir.entries = entries
+		s.mu.Unlock()
+
+		if len(events) > 0 && s.hub != nil {
+			s.hub.SendDirChanges(dir.path, events)
+		}
+	}
+}
+
+// readEntries lists a directory
+func (s *watchService) readEntries(fsPath string) (map[string]entryState, error) {
+	dirEntries, err := s.fs.ReadDir(fsPath)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]entryState, len(dirEntries))
+	for _, e := range dirEntries {
+		if fileutil.IsUploadTemp(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entries[e.Name()] = stateOf(info)
+	}
+	return entries, nil
+}
+
+// stateOf extracts the compared attributes of a directory entry
+func stateOf(info fs.FileInfo) entryState {
+	return entryState{isDir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+}
+
+// coalesce turns a burst of notified changes into at most one event per
+// entry by comparing the known listing with the current state of the
+// touched entries, and updates the listing. A rename notification directly
+// followed by a create is reported as one renamed event when the old name
+// disappeared and the new one appeared.
+func coalesce(entries map[string]entryState, ops []dirOp, current map[string]entryState) []model.FileEvent {
+	var order []string
+	touched := make(map[string]bool)
+	renames := make(map[string]string) // new name -> old name
+	for i, op := range ops {
+		if !touched[op.name] {
+			touched[op.name] = true
+			order = append(order, op.name)
+		}
+		if op.op.Has(fsnotify.Rename) && i+1 < len(ops) && ops[i+1].op.Has(fsnotify.Create) && ops[i+1].name != op.name {
+			renames[ops[i+1].name] = op.name
+		}
+	}
+
+	byName := make(map[string]*model.FileEvent)
+	for _, name := range order {
+		before, existed := entries[name]
+		now, exists := current[name]
+		switch {
+		case existed && exists:
+			byName[name] = &model.FileEvent{Type: model.FileEventModified, Name: name, IsDir: now.isDir}
+			entries[name] = now
+		case existed:
+			byName[name] = &model.FileEvent{Type: model.FileEventDeleted, Name: name, IsDir: before.isDir}
+			delete(entries, name)
+		case exists:
+			byName[name] = &model.FileEvent{Type: model.FileEventCreated, Name: name, IsDir: now.isDir}
+			entries[name] = now
+		}
+	}
+
+	for newName, oldName := range renames {
+		created, deleted := byName[newName], byName[oldName]
+		if created == nil || deleted == nil || created.Type != model.FileEventCreated || deleted.Type != model.FileEventDeleted {
+			continue
+		}
+		created.Type = model.FileEventRenamed
+		created.OldName = oldName
+		delete(byName, oldName)
+	}
+
+	var events []model.FileEvent
+	for _, name := range order {
+		if ev, ok := byName[name]; ok {
+			events = append(events, *ev)
+		}
+	}
+	return events
+}
+
+// diffEntries compares two listings of a polled directory
+func diffEntries(before, after map[string]entryState) []model.FileEvent {
+	var events []model.FileEvent
+	for name, now := range after {
+		old, existed := before[name]
+		switch {
+		case !existed:
+			events = append(events, model.FileEvent{Type: model.FileEventCreated, Name: name, IsDir: now.isDir})
+		case old.isDir != now.isDir || old.size != now.size || !old.modTime.Equal(now.modTime):
+			events = append(events, model.FileEvent{Type: model.FileEventModified, Name: name, IsDir: now.isDir})
+		}
+	}
+	for name, old := range before {
+		if _, exists := after[name]; !exists {
+			events = append(events, model.FileEvent{Type: model.FileEventDeleted, Name: name, IsDir: old.isDir})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
@@ -0,0 +1,231 @@
+// Package service provides business logic for the file manager.
+// This file contains property-based tests for directory change events.
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+var watchNames = []string{"a", "b", "c", "d"}
+
+// applyFileEvents applies change events to a set of names as a client would,
+// reporting false if an event does not fit the set or names an entry twice
+func applyFileEvents(names map[string]bool, events []model.FileEvent) bool {
+	seen := make(map[string]bool)
+	for _, ev := range events {
+		for _, name := range []string{ev.Name, ev.OldName} {
+			if name == "" {
+				continue
+			}
+			if seen[name] {
+				return false
+			}
+			seen[name] = true
+		}
+
+		switch ev.Type {
+		case model.FileEventCreated:
+			if names[ev.Name] {
+				return false
+			}
+			names[ev.Name] = true
+		case model.FileEventModified:
+			if !names[ev.Name] {
+				return false
+			}
+		case model.FileEventDeleted:
+			if !names[ev.Name] {
+				return false
+			}
+			delete(names, ev.Name)
+		case model.FileEventRenamed:
+			if !names[ev.OldName] || names[ev.Name] {
+				return false
+			}
+			delete(names, ev.OldName)
+			names[ev.Name] = true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// listingOf builds a directory listing for a set of names
+func listingOf(names map[string]bool, modTime time.Time) map[string]entryState {
+	entries := make(map[string]entryState)
+	for name := range names {
+		entries[name] = entryState{modTime: modTime}
+	}
+	return entries
+}
+
+// **Feature: homelab-file-manager, Property 28: Directory Change Events**
+//
+// Property: For any burst of changes to a watched directory, the coalesced events
+// SHALL name each entry at most once, and applying them to the previous listing
+// SHALL yield the current listing. The same SHALL hold for the differences found
+// by polling.
+
+func TestProperty_DirectoryChangeEvents(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 200
+	parameters.MaxSize = 20
+
+	properties := gopter.NewProperties(parameters)
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	properties.Property("coalesced notifications bring a listing up to date", prop.ForAll(
+		func(initial []bool, steps []int) bool {
+			names := make(map[string]bool)
+			for i, present := range initial {
+				if present && i < len(watchNames) {
+					names[watchNames[i]] = true
+				}
+			}
+			entries := listingOf(names, start)
+
+			// Apply random operations, recording the notifications inotify sends
+			final := make(map[string]bool)
+			for name := range names {
+				final[name] = true
+			}
+			var ops []dirOp
+			for _, step := range steps {
+				x := watchNames[step/4%len(watchNames)]
+				y := watchNames[step/16%len(watchNames)]
+				switch step % 4 {
+				case 0:
+					if !final[x] {
+						final[x] = true
+						ops = append(ops, dirOp{name: x, op: fsnotify.Create})
+					}
+				case 1:
+					if final[x] {
+						ops = append(ops, dirOp{name: x, op: fsnotify.Write})
+					}
+				case 2:
+					if final[x] {
+						delete(final, x)
+						ops = append(ops, dirOp{name: x, op: fsnotify.Remove})
+					}
+				case 3:
+					if final[x] && x != y {
+						delete(final, x)
+						final[y] = true
+						ops = append(ops, dirOp{name: x, op: fsnotify.Rename}, dirOp{name: y, op: fsnotify.Create})
+					}
+				}
+			}
+
+			events := coalesce(entries, ops, listingOf(final, start.Add(time.Hour)))
+			if !applyFileEvents(names, events) {
+				return false
+			}
+			// The client and the watcher's listing both match the directory
+			listed := make(map[string]bool)
+			for name := range entries {
+				listed[name] = true
+			}
+			return reflect.DeepEqual(names, final) && reflect.DeepEqual(listed, final)
+		},
+		gen.SliceOfN(len(watchNames), gen.Bool()),
+		gen.SliceOf(gen.IntRange(0, 63)),
+	))
+
+	properties.Property("a lone rename is reported as renamed", prop.ForAll(
+		func(from, to int) bool {
+			if from == to {
+				return true
+			}
+			oldName, newName := watchNames[from], watchNames[to]
+			entries := map[string]entryState{oldName: {size: 1}}
+			events := coalesce(entries, []dirOp{
+				{name: oldName, op: fsnotify.Rename},
+				{name: newName, op: fsnotify.Create},
+			}, map[string]entryState{newName: {size: 1}})
+
+			return len(events) == 1 &&
+				events[0] == model.FileEvent{Type: model.FileEventRenamed, Name: newName, OldName: oldName}
+		},
+		gen.IntRange(0, len(watchNames)-1),
+		gen.IntRange(0, len(watchNames)-1),
+	))
+
+	properties.Property("polled differences bring a listing up to date", prop.ForAll(
+		func(before, after []int) bool {
+			// Each value is absent (0) or a file size
+			oldNames, newNames := make(map[string]bool), make(map[string]bool)
+			oldEntries, newEntries := make(map[string]entryState), make(map[string]entryState)
+			for i, name := range watchNames {
+				if i < len(before) && before[i] > 0 {
+					oldNames[name] = true
+					oldEntries[name] = entryState{size: int64(before[i]), modTime: start}
+				}
+				if i < len(after) && after[i] > 0 {
+					newNames[name] = true
+					newEntries[name] = entryState{size: int64(after[i]), modTime: start}
+				}
+			}
+
+			events := diffEntries(oldEntries, newEntries)
+			for _, ev := range events {
+				if ev.Type == model.FileEventModified && oldEntries[ev.Name] == newEntries[ev.Name] {
+					return false
+				}
+			}
+			return applyFileEvents(oldNames, events) && reflect.DeepEqual(oldNames, newNames)
+		},
+		gen.SliceOfN(len(watchNames), gen.IntRange(0, 2)),
+		gen.SliceOfN(len(watchNames), gen.IntRange(0, 2)),
+	))
+
+	properties.TestingRun(t)
+}
+
+func TestConcurrentWatchesKeepTheCap(t *testing.T) {
+	fs := filesystem.NewMemMapFS()
+	for _, name := range watchNames {
+		fs.MkdirAll("/data/media/"+name, 0755)
+	}
+	svc := NewWatchService(fs, nil, WatchServiceConfig{
+		MountPoints: []model.MountPoint{{Name: "media", Path: "/data/media"}},
+		MaxDirs:     2,
+	}).(*watchService)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(watchNames))
+	for _, name := range watchNames {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- svc.Watch("media/" + name)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	refused := 0
+	for err := range errs {
+		if errors.Is(err, ErrTooManyWatches) {
+			refused++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(svc.dirs) != 2 || refused != len(watchNames)-2 {
+		t.Fatalf("expected 2 watched directories and %d refused, got %d and %d", len(watchNames)-2, len(svc.dirs), refused)
+	}
+}
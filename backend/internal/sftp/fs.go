@@ -0,0 +1,264 @@
+package sftp
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/homelab/filemanager/internal/gateway"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+	"github.com/pkg/sftp"
+)
+
+// fileSystem implements the SFTP request handlers on top of the file
+// service's mount points. The root is a read-only folder holding one folder
+// per mount.
+type fileSystem struct {
+	mounts *gateway.Mounts
+	fs     filesystem.FS
+}
+
+// handlers returns the request handlers serving the file system
+func (f *fileSystem) handlers() sftp.Handlers {
+	return sftp.Handlers{FileGet: f, FilePut: f, FileCmd: f, FileList: f}
+}
+
+// Fileread opens a file for reading
+func (f *fileSystem) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	t, err := f.mounts.Resolve("open", r.Filepath, false)
+	if err != nil {
+		return nil, err
+	}
+	if t.Mount == nil {
+		return nil, &os.PathError{Op: "open", Path: r.Filepath, Err: os.ErrInvalid}
+	}
+	return f.fs.Open(t.FsPath)
+}
+
+// Filewrite opens a file for writing. Files are created only in existing
+// folders.
+func (f *fileSystem) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	t, err := f.mounts.Resolve("open", r.Filepath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pflags := r.Pflags()
+	flag := os.O_WRONLY
+	if pflags.Read {
+		flag = os.O_RDWR
+	}
+	if pflags.Creat {
+		flag |= os.O_CREATE
+		if err := f.mounts.CheckParent("open", r.Filepath, t); err != nil {
+			return nil, err
+		}
+	}
+	if pflags.Trunc {
+		flag |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flag |= os.O_EXCL
+	}
+	// Appends are written at the offsets the client sends, which os.File
+	// refuses in append mode
+	return f.fs.OpenFile(t.FsPath, flag, 0644)
+}
+
+// Filecmd handles the commands that change files and folders
+func (f *fileSystem) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		return f.setstat(r)
+	case "Rename":
+		return f.rename(r, false)
+	case "Rmdir":
+		return f.remove(r, true)
+	case "Remove":
+		return f.remove(r, false)
+	case "Mkdir":
+		return f.mkdir(r)
+	}
+	// Links could point outside the mount points
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// PosixRename moves a file or folder, replacing the destination
+func (f *fileSystem) PosixRename(r *sftp.Request) error {
+	return f.rename(r, true)
+}
+
+// Filelist handles the requests that read folders and file information
+func (f *fileSystem) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		return f.list(r)
+	case "Stat":
+		info, err := f.stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// setstat changes a file's size, permissions and times. Ownership is left
+// to the user the server runs as.
+func (f *fileSystem) setstat(r *sftp.Request) error {
+	t, err := f.mounts.Resolve("setstat", r.Filepath, true)
+	if err != nil {
+		return err
+	}
+
+	flags := r.AttrFlags()
+	attrs := r.Attributes()
+	if flags.Size {
+		file, err := f.fs.OpenFile(t.FsPath, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = file.Truncate(int64(attrs.Size))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := f.fs.Chmod(t.FsPath, attrs.FileMode().Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		atime := time.Unix(int64(attrs.Atime), 0)
+		if err := f.fs.Chtimes(t.FsPath, atime, attrs.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rename moves a file or folder. Without replace an existing destination
+// is an error. Mount points themselves cannot be moved.
+func (f *fileSystem) rename(r *sftp.Request, replace bool) error {
+	src, err := f.mounts.Resolve("rename", r.Filepath, true)
+	if err != nil {
+		return err
+	}
+	dst, err := f.mounts.Resolve("rename", r.Target, true)
+	if err != nil {
+		return err
+	}
+	if src.IsMount() || dst.IsMount() {
+		return f.mounts.Denied("rename", r.Filepath)
+	}
+	if err := f.mounts.CheckParent("rename", r.Target, dst); err != nil {
+		return err
+	}
+	if !replace {
+		if exists, err := f.fs.Exists(dst.FsPath); err != nil {
+			return err
+		} else if exists {
+			return &os.PathError{Op: "rename", Path: r.Target, Err: os.ErrExist}
+		}
+	}
+
+	return f.fs.Rename(src.FsPath, dst.FsPath)
+}
+
+// remove deletes a file, or an empty folder when dir is set. Mount points
+// themselves cannot be deleted.
+func (f *fileSystem) remove(r *sftp.Request, dir bool) error {
+	t, err := f.mounts.Resolve("remove", r.Filepath, true)
+	if err != nil {
+		return err
+	}
+	if t.IsMount() {
+		return f.mounts.Denied("remove", r.Filepath)
+	}
+
+	info, err := f.fs.Stat(t.FsPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() != dir {
+		return &os.PathError{Op: "remove", Path: r.Filepath, Err: os.ErrInvalid}
+	}
+	return f.fs.Remove(t.FsPath)
+}
+
+// mkdir creates a folder whose parent exists
+func (f *fileSystem) mkdir(r *sftp.Request) error {
+	t, err := f.mounts.Resolve("mkdir", r.Filepath, true)
+	if err != nil {
+		return err
+	}
+	if exists, err := f.fs.Exists(t.FsPath); err != nil {
+		return err
+	} else if exists {
+		return &os.PathError{Op: "mkdir", Path: r.Filepath, Err: os.ErrExist}
+	}
+	if err := f.mounts.CheckParent("mkdir", r.Filepath, t); err != nil {
+		return err
+	}
+
+	return f.fs.MkdirAll(t.FsPath, 0755)
+}
+
+// list returns the entries of a folder. The root lists the mount points
+// whose folders exist.
+func (f *fileSystem) list(r *sftp.Request) (sftp.ListerAt, error) {
+	t, err := f.mounts.Resolve("readdir", r.Filepath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Mount == nil {
+		return listerAt(f.mounts.List()), nil
+	}
+
+	var entries listerAt
+	dirEntries, err := f.fs.ReadDir(t.FsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range dirEntries {
+		if fileutil.IsUploadTemp(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
+
+// stat returns information about a file or folder
+func (f *fileSystem) stat(name string) (fs.FileInfo, error) {
+	t, err := f.mounts.Resolve("stat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return f.mounts.Stat(t)
+}
+
+// listerAt serves a fixed list of file information
+type listerAt []fs.FileInfo
+
+// ListAt copies entries starting at offset, like sftp.ListerAt requires
+func (l listerAt) ListAt(entries []fs.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(entries, l[offset:])
+	if n < len(entries) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,289 @@
+// Package sftp serves the mount points over SFTP, for clients such as WinSCP
+// and backup tools. Users log in with their password or an authorized key.
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/gateway"
+	"github.com/homelab/filemanager/internal/middleware"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP server errors
+var (
+	ErrServerClosed      = errors.New("sftp server closed")
+	ErrTooManyAttempts   = errors.New("too many failed login attempts")
+	ErrInvalidHostKey    = errors.New("invalid sftp host key")
+	ErrInvalidAuthorized = errors.New("invalid authorized key")
+)
+
+// Server accepts SSH connections and serves the SFTP subsystem on them
+type Server struct {
+	auth    service.AuthService
+	fsys    *fileSystem
+	ssh     *ssh.ServerConfig
+	limiter *middleware.RateLimiter
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// Config holds configuration for the SFTP server
+type Config struct {
+	HostKeyPath  string  // Private key in PEM format; an ed25519 key is generated there if missing
+	RateLimitRPS float64 // Failed password logins per second and IP
+}
+
+// NewServer creates an SFTP server for the file service's mount points,
+// loading or generating its host key
+func NewServer(fileService service.FileService, authService service.AuthService, cfg Config) (*Server, error) {
+	hostKey, err := loadHostKey(fileService.GetFilesystem(), cfg.HostKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		auth: authService,
+		fsys: &fileSystem{
+			mounts: gateway.NewMounts(fileService, sftp.ErrSSHFxPermissionDenied),
+			fs:     fileService.GetFilesystem(),
+		},
+		limiter: middleware.NewRateLimiter(cfg.RateLimitRPS),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	s.ssh = &ssh.ServerConfig{
+		PasswordCallback:  s.checkPassword,
+		PublicKeyCallback: s.checkKey,
+	}
+	s.ssh.AddHostKey(hostKey)
+	return s, nil
+}
+
+// ParseAuthorizedKeys converts the configured authorized_keys lines of each
+// user to keys in SSH wire format, as the auth service expects them
+func ParseAuthorizedKeys(keys map[string][]string) (map[string][][]byte, error) {
+	parsed := make(map[string][][]byte, len(keys))
+	for username, lines := range keys {
+		for _, line := range lines {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+			if err != nil {
+				return nil, fmt.Errorf("%w for %s: %v", ErrInvalidAuthorized, username, err)
+			}
+			parsed[username] = append(parsed[username], key.Marshal())
+		}
+	}
+	return parsed, nil
+}
+
+// ListenAndServe listens on the TCP address and serves connections until
+// the server is closed
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the listener until the server is closed. It
+// always returns a non-nil error, ErrServerClosed after Close.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops accepting connections and closes the open ones
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// handleConn performs the SSH handshake and serves the connection's
+// sessions
+func (s *Server) handleConn(conn net.Conn) {
+	if !s.track(conn) {
+		conn.Close()
+		return
+	}
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(config.SFTPHandshakeTimeout))
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.ssh)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	conn.SetDeadline(time.Time{})
+
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(channel, requests)
+	}
+}
+
+// handleSession serves the SFTP subsystem on a session. Shells and commands
+// are refused. Every user sees every mount point, as in the web interface,
+// so the session does not depend on who logged in.
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		// The payload is the subsystem name as an SSH string
+		if req.Type != "subsystem" || len(req.Payload) < 4 || string(req.Payload[4:]) != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+
+		server := sftp.NewRequestServer(channel, s.fsys.handlers())
+		server.Serve()
+		server.Close()
+		return
+	}
+}
+
+// checkPassword authenticates a user by password. Failures count towards
+// the per-IP rate limit.
+func (s *Server) checkPassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	ip := remoteIP(conn.RemoteAddr())
+	// Refuse before checking, so guesses past the limit reveal nothing
+	if s.limiter.Blocked(ip) {
+		return nil, ErrTooManyAttempts
+	}
+
+	if _, err := s.auth.Authenticate(context.Background(), conn.User(), string(password)); err != nil {
+		s.limiter.Allow(ip)
+		return nil, err
+	}
+	return &ssh.Permissions{}, nil
+}
+
+// checkKey authenticates a user by public key. Clients offer every key they
+// have, so failures do not count towards the rate limit.
+func (s *Server) checkKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if _, err := s.auth.AuthenticateKey(context.Background(), conn.User(), key.Marshal()); err != nil {
+		return nil, err
+	}
+	return &ssh.Permissions{}, nil
+}
+
+// track adds a connection to the open ones unless the server is closed
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack removes a closed connection
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+}
+
+// remoteIP returns the IP address of a connection's peer
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// loadHostKey reads the server's private key, generating and saving an
+// ed25519 key on first start so that clients see the same host key
+func loadHostKey(fsys filesystem.FS, path string) (ssh.Signer, error) {
+	exists, err := fsys.Exists(path)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		data, err := fsys.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidHostKey, err)
+		}
+		return signer, nil
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := fsys.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
@@ -0,0 +1,355 @@
+package sftp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// setupSFTPFS creates an in-memory filesystem with a writable and a
+// read-only mount
+func setupSFTPFS() (*filesystem.AferoFS, service.FileService) {
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media", 0755)
+	fs.MkdirAll("/data/archive", 0755)
+	fs.WriteFile("/data/archive/old.txt", []byte("old"), 0644)
+
+	files := service.NewFileService(fs, service.FileServiceConfig{MountPoints: []model.MountPoint{
+		{Name: "media", Path: "/data/media"},
+		{Name: "archive", Path: "/data/archive", ReadOnly: true},
+	}})
+	return fs, files
+}
+
+// newSigner returns a fresh ed25519 key for a client
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// startSFTPServer serves the file service over SFTP for alice, who may log
+// in with her password or the given key, and returns the server's address
+func startSFTPServer(t *testing.T, files service.FileService, rps float64, key ssh.Signer) string {
+	t.Helper()
+	keys, err := ParseAuthorizedKeys(map[string][]string{
+		"alice": {string(ssh.MarshalAuthorizedKey(key.PublicKey()))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authService := service.NewAuthService(service.AuthServiceConfig{
+		JWTSecret:      "test-secret",
+		Users:          map[string]string{"alice": "secret"},
+		AuthorizedKeys: keys,
+	})
+	server, err := NewServer(files, authService, Config{HostKeyPath: "/appdata/sftp-host-key", RateLimitRPS: rps})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+// dial logs in over SSH and starts an SFTP session
+func dial(t *testing.T, addr, username string, auth ssh.AuthMethod) (*sftp.Client, error) {
+	t.Helper()
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	return client, nil
+}
+
+// login logs in as alice with her password and fails the test otherwise
+func login(t *testing.T, addr string) *sftp.Client {
+	t.Helper()
+	client, err := dial(t, addr, "alice", ssh.Password("secret"))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return client
+}
+
+// TestSFTPLogin checks that users log in with their password or an
+// authorized key, and that password guessing is slowed down
+func TestSFTPLogin(t *testing.T) {
+	_, files := setupSFTPFS()
+	key := newSigner(t)
+	addr := startSFTPServer(t, files, 1, key)
+
+	if _, err := dial(t, addr, "alice", ssh.PublicKeys(key)); err != nil {
+		t.Fatalf("expected alice's key to be accepted: %v", err)
+	}
+	if _, err := dial(t, addr, "alice", ssh.PublicKeys(newSigner(t))); err == nil {
+		t.Fatal("expected an unknown key to be refused")
+	}
+	if _, err := dial(t, addr, "bob", ssh.PublicKeys(key)); err == nil {
+		t.Fatal("expected alice's key to be refused for another user")
+	}
+	login(t, addr)
+
+	for i := 0; i < 2; i++ {
+		if _, err := dial(t, addr, "alice", ssh.Password("guess")); err == nil {
+			t.Fatalf("guess %d: expected the login to fail", i)
+		}
+	}
+	if _, err := dial(t, addr, "alice", ssh.Password("secret")); err == nil {
+		t.Fatal("expected repeated failures to be rate limited")
+	}
+	if _, err := dial(t, addr, "alice", ssh.PublicKeys(key)); err != nil {
+		t.Fatalf("expected key logins to ignore the rate limit: %v", err)
+	}
+}
+
+// **Feature: homelab-file-manager, Property 42: SFTP Mount Enforcement**
+//
+// Property: For any file written through SFTP, a write to a writable mount SHALL store
+// the content where the file service finds it, while every request that would create,
+// change or remove anything on a read-only mount or at the root SHALL be refused with a
+// permission error and leave the filesystem unchanged.
+
+func TestProperty_SFTPMountEnforcement(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+
+	fs, files := setupSFTPFS()
+	client := login(t, startSFTPServer(t, files, 10, newSigner(t)))
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("read-only mounts and the root cannot be changed", prop.ForAll(
+		func(name, content string) bool {
+			src := "/media/" + name
+			file, err := client.Create(src)
+			if err != nil {
+				t.Logf("create %s: %v", src, err)
+				return false
+			}
+			file.Write([]byte(content))
+			if err := file.Close(); err != nil {
+				return false
+			}
+			data, err := fs.ReadFile("/data/media/" + name)
+			if err != nil || string(data) != content {
+				return false
+			}
+
+			refused := []error{
+				func() error { _, err := client.Create("/archive/" + name); return err }(),
+				func() error { _, err := client.Create("/media/../archive/" + name); return err }(),
+				func() error { _, err := client.Create("/" + name); return err }(),
+				client.Mkdir("/archive/" + name),
+				client.Mkdir("/" + name),
+				client.Rename(src, "/archive/"+name),
+				client.PosixRename(src, "/archive/"+name),
+				client.Remove("/archive/old.txt"),
+				client.Truncate("/archive/old.txt", 0),
+				client.Rename("/media", "/"+name),
+				client.RemoveDirectory("/media"),
+			}
+			for i, err := range refused {
+				if !errors.Is(err, os.ErrPermission) {
+					t.Logf("request %d for %q: expected a permission error, got %v", i, name, err)
+					return false
+				}
+			}
+
+			if exists, _ := fs.Exists("/data/archive/" + name); exists {
+				return false
+			}
+			if data, _ := fs.ReadFile("/data/archive/old.txt"); string(data) != "old" {
+				return false
+			}
+			exists, _ := fs.Exists("/data/media/" + name)
+			return exists
+		},
+		gen.Identifier(),
+		gen.AlphaString(),
+	))
+
+	properties.TestingRun(t)
+}
+
+// TestSFTPRootListsMounts checks that the root folder shows the mount points
+// and nothing outside them can be reached
+func TestSFTPRootListsMounts(t *testing.T) {
+	_, files := setupSFTPFS()
+	client := login(t, startSFTPServer(t, files, 10, newSigner(t)))
+
+	entries, err := client.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			t.Fatalf("expected %s to be a folder", entry.Name())
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "archive" || names[1] != "media" {
+		t.Fatalf("expected the mount points, got %v", names)
+	}
+
+	if info, err := client.Stat("/archive"); err != nil || info.Name() != "archive" || !info.IsDir() {
+		t.Fatalf("expected the archive folder, got %v %v", info, err)
+	}
+	if _, err := client.Stat("/elsewhere"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected paths outside the mounts to be missing, got %v", err)
+	}
+	if _, err := client.Stat("/../data/archive/old.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the real paths to be unreachable, got %v", err)
+	}
+
+	file, err := client.Open("/archive/old.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if data, err := io.ReadAll(file); err != nil || string(data) != "old" {
+		t.Fatalf("expected to read the read-only file, got %q %v", data, err)
+	}
+}
+
+// TestSFTPFileCommands checks the commands clients use to manage files on a
+// writable mount
+func TestSFTPFileCommands(t *testing.T) {
+	fs, files := setupSFTPFS()
+	client := login(t, startSFTPServer(t, files, 10, newSigner(t)))
+
+	if err := client.Mkdir("/media/photos"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Mkdir("/media/photos"); err == nil {
+		t.Fatal("expected an existing folder to be refused")
+	}
+	if err := client.Mkdir("/media/a/b"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing parent to be refused, got %v", err)
+	}
+	if _, err := client.Create("/media/a/b.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing parent to be refused, got %v", err)
+	}
+
+	for _, name := range []string{"/media/one.txt", "/media/two.txt"} {
+		file, err := client.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte("content of " + name))
+		file.Close()
+	}
+	if err := client.Rename("/media/one.txt", "/media/two.txt"); err == nil {
+		t.Fatal("expected a plain rename not to replace a file")
+	}
+	if err := client.PosixRename("/media/one.txt", "/media/photos/two.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PosixRename("/media/two.txt", "/media/photos/two.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := fs.ReadFile("/data/media/photos/two.txt"); string(data) != "content of /media/two.txt" {
+		t.Fatalf("expected the replaced file, got %q", data)
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := client.Chtimes("/media/photos/two.txt", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Truncate("/media/photos/two.txt", 7); err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.Stat("/data/media/photos/two.txt")
+	if err != nil || info.Size() != 7 {
+		t.Fatalf("expected the file to be truncated, got %v %v", info, err)
+	}
+
+	if err := client.Symlink("/media/photos/two.txt", "/media/link"); err == nil {
+		t.Fatal("expected links to be unsupported")
+	}
+	if err := client.RemoveDirectory("/media/photos/two.txt"); err == nil {
+		t.Fatal("expected rmdir to refuse a file")
+	}
+	if err := client.Remove("/media/photos/two.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveDirectory("/media/photos"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := fs.Exists("/data/media/photos"); exists {
+		t.Fatal("expected the folder to be removed")
+	}
+}
+
+// TestSFTPHostKey checks that the generated host key is kept across
+// restarts and that broken keys are reported
+func TestSFTPHostKey(t *testing.T) {
+	fs, files := setupSFTPFS()
+	authService := service.NewAuthService(service.AuthServiceConfig{JWTSecret: "test-secret"})
+
+	first, err := loadHostKey(fs, "/appdata/sftp-host-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loadHostKey(fs, "/appdata/sftp-host-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.PublicKey().Marshal()) != string(second.PublicKey().Marshal()) {
+		t.Fatal("expected the saved host key to be reused")
+	}
+	if info, err := fs.Stat("/appdata/sftp-host-key"); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected a private key file, got %v %v", info, err)
+	}
+
+	fs.WriteFile("/appdata/broken-key", []byte("not a key"), 0600)
+	if _, err := NewServer(files, authService, Config{HostKeyPath: "/appdata/broken-key"}); !errors.Is(err, ErrInvalidHostKey) {
+		t.Fatalf("expected ErrInvalidHostKey, got %v", err)
+	}
+	if _, err := ParseAuthorizedKeys(map[string][]string{"alice": {"ssh-ed25519 garbage"}}); !errors.Is(err, ErrInvalidAuthorized) {
+		t.Fatalf("expected ErrInvalidAuthorized, got %v", err)
+	}
+}
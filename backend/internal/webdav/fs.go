@@ -0,0 +1,215 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/homelab/filemanager/internal/gateway"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/pkg/fileutil"
+	"github.com/spf13/afero"
+	"golang.org/x/net/webdav"
+)
+
+// fileSystem implements webdav.FileSystem on top of the file service's mount
+// points. The root is a read-only folder holding one folder per mount.
+type fileSystem struct {
+	mounts *gateway.Mounts
+	fs     filesystem.FS
+	props  *propStore
+}
+
+// Mkdir creates a folder whose parent exists
+func (f *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	t, err := f.mounts.Resolve("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	if exists, err := f.fs.Exists(t.FsPath); err != nil {
+		return err
+	} else if exists {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if err := f.mounts.CheckParent("mkdir", name, t); err != nil {
+		return err
+	}
+
+	if err := f.fs.MkdirAll(t.FsPath, 0755); err != nil {
+		return err
+	}
+	return f.props.forget(t.Path)
+}
+
+// OpenFile opens a file or folder. Files are created only in existing
+// folders, and a new file starts without properties.
+func (f *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	t, err := f.mounts.Resolve("open", name, write)
+	if err != nil {
+		return nil, err
+	}
+	if t.Mount == nil {
+		return f.openRoot()
+	}
+
+	if flag&os.O_CREATE != 0 {
+		exists, err := f.fs.Exists(t.FsPath)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if err := f.mounts.CheckParent("open", name, t); err != nil {
+				return nil, err
+			}
+			if err := f.props.forget(t.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	file, err := f.fs.OpenFile(t.FsPath, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{File: file, path: t.Path, mount: t.Mount, props: f.props}, nil
+}
+
+// RemoveAll deletes a file or folder with its properties. Mount points
+// themselves cannot be deleted.
+func (f *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	t, err := f.mounts.Resolve("remove", name, true)
+	if err != nil {
+		return err
+	}
+	if t.IsMount() {
+		return f.mounts.Denied("remove", name)
+	}
+	if exists, err := f.fs.Exists(t.FsPath); err != nil {
+		return err
+	} else if !exists {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+
+	if err := f.fs.RemoveAll(t.FsPath); err != nil {
+		return err
+	}
+	return f.props.forget(t.Path)
+}
+
+// Rename moves a file or folder with its properties. Mount points
+// themselves cannot be moved.
+func (f *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	src, err := f.mounts.Resolve("rename", oldName, true)
+	if err != nil {
+		return err
+	}
+	dst, err := f.mounts.Resolve("rename", newName, true)
+	if err != nil {
+		return err
+	}
+	if src.IsMount() || dst.IsMount() {
+		return f.mounts.Denied("rename", oldName)
+	}
+	if err := f.mounts.CheckParent("rename", newName, dst); err != nil {
+		return err
+	}
+
+	if err := f.fs.Rename(src.FsPath, dst.FsPath); err != nil {
+		return err
+	}
+	return f.props.rename(src.Path, dst.Path)
+}
+
+// Stat returns information about a file or folder
+func (f *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	t, err := f.mounts.Resolve("stat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return f.mounts.Stat(t)
+}
+
+// openRoot returns the root folder, which lists the mount points whose
+// folders exist
+func (f *fileSystem) openRoot() (webdav.File, error) {
+	return &rootFile{entries: f.mounts.List()}, nil
+}
+
+// davFile is an open file or folder below a mount point. It holds the dead
+// properties stored for its path.
+type davFile struct {
+	afero.File
+	path  string
+	mount *model.MountPoint
+	props *propStore
+}
+
+// DeadProps returns the file's stored properties
+func (f *davFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return f.props.get(f.path)
+}
+
+// Readdir lists the folder like os.File.Readdir, leaving out upload temp files
+func (f *davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	for {
+		infos, err := f.File.Readdir(count)
+		kept := infos[:0]
+		for _, info := range infos {
+			if !fileutil.IsUploadTemp(info.Name()) {
+				kept = append(kept, info)
+			}
+		}
+		if len(kept) > 0 || err != nil || count <= 0 {
+			return kept, err
+		}
+	}
+}
+
+// Patch sets or removes properties of the file. They are refused on
+// read-only mounts.
+func (f *davFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	if f.mount.ReadOnly {
+		pstat := webdav.Propstat{Status: http.StatusForbidden}
+		for _, patch := range patches {
+			for _, p := range patch.Props {
+				pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+			}
+		}
+		return []webdav.Propstat{pstat}, nil
+	}
+	return f.props.patch(f.path, patches)
+}
+
+// rootFile is the read-only root folder listing the mount points
+type rootFile struct {
+	entries []fs.FileInfo
+	pos     int
+}
+
+func (f *rootFile) Close() error                                 { return nil }
+func (f *rootFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (f *rootFile) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (f *rootFile) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (f *rootFile) Stat() (fs.FileInfo, error)                   { return gateway.RootInfo{}, nil }
+
+// Readdir returns the mount point folders, like os.File.Readdir
+func (f *rootFile) Readdir(count int) ([]fs.FileInfo, error) {
+	rest := f.entries[f.pos:]
+	if count <= 0 {
+		f.pos = len(f.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	f.pos += count
+	return rest[:count], nil
+}
@@ -0,0 +1,239 @@
+package webdav
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"golang.org/x/net/webdav"
+)
+
+// propStore keeps the dead properties WebDAV clients set on files and
+// folders, such as the Windows file times, keyed by virtual path
+type propStore struct {
+	fs       filesystem.FS
+	filePath string
+	mu       sync.Mutex
+	loaded   bool
+	props    map[string][]storedProp
+}
+
+// storedProp is one dead property as persisted
+type storedProp struct {
+	Space    string `json:"space"`
+	Local    string `json:"local"`
+	Lang     string `json:"lang,omitempty"`
+	InnerXML string `json:"innerXml,omitempty"`
+}
+
+// propsData is the structure persisted to the properties file
+type propsData struct {
+	Properties map[string][]storedProp `json:"properties"`
+}
+
+// newPropStore creates a property store persisted in the data directory
+func newPropStore(fsys filesystem.FS, dataDir string) *propStore {
+	return &propStore{
+		fs:       fsys,
+		filePath: filepath.Join(dataDir, config.WebDAVPropsFileName),
+		props:    make(map[string][]storedProp),
+	}
+}
+
+// get returns the properties of a path
+func (s *propStore) get(path string) (map[xml.Name]webdav.Property, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	stored := s.props[path]
+	if len(stored) == 0 {
+		return nil, nil
+	}
+	props := make(map[xml.Name]webdav.Property, len(stored))
+	for _, p := range stored {
+		name := xml.Name{Space: p.Space, Local: p.Local}
+		props[name] = webdav.Property{XMLName: name, Lang: p.Lang, InnerXML: []byte(p.InnerXML)}
+	}
+	return props, nil
+}
+
+// patch sets and removes properties of a path. All patches are applied, or
+// none if they cannot be saved.
+func (s *propStore) patch(path string, patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	props := make(map[xml.Name]storedProp)
+	for _, p := range s.props[path] {
+		props[xml.Name{Space: p.Space, Local: p.Local}] = p
+	}
+	pstat := webdav.Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+			if patch.Remove {
+				delete(props, p.XMLName)
+				continue
+			}
+			props[p.XMLName] = storedProp{
+				Space:    p.XMLName.Space,
+				Local:    p.XMLName.Local,
+				Lang:     p.Lang,
+				InnerXML: string(p.InnerXML),
+			}
+		}
+	}
+
+	previous, existed := s.props[path]
+	s.set(path, props)
+	if err := s.save(); err != nil {
+		if existed {
+			s.props[path] = previous
+		} else {
+			delete(s.props, path)
+		}
+		return nil, err
+	}
+	return []webdav.Propstat{pstat}, nil
+}
+
+// rename moves the properties at or below oldPath to newPath
+func (s *propStore) rename(oldPath, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	moved := make(map[string][]storedProp)
+	for path, props := range s.props {
+		if rel, ok := below(path, oldPath); ok {
+			moved[newPath+rel] = props
+			delete(s.props, path)
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	// Whatever was at the destination was replaced
+	s.forgetLocked(newPath)
+	for path, props := range moved {
+		s.props[path] = props
+	}
+	return s.save()
+}
+
+// forget drops the properties at or below path
+func (s *propStore) forget(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if !s.forgetLocked(path) {
+		return nil
+	}
+	return s.save()
+}
+
+// forgetLocked drops the properties at or below path and reports whether
+// there were any. The caller must hold mu.
+func (s *propStore) forgetLocked(path string) bool {
+	found := false
+	for p := range s.props {
+		if _, ok := below(p, path); ok {
+			delete(s.props, p)
+			found = true
+		}
+	}
+	return found
+}
+
+// set replaces the properties of a path. The caller must hold mu.
+func (s *propStore) set(path string, props map[xml.Name]storedProp) {
+	if len(props) == 0 {
+		delete(s.props, path)
+		return
+	}
+	stored := make([]storedProp, 0, len(props))
+	for _, p := range props {
+		stored = append(stored, p)
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		if stored[i].Space != stored[j].Space {
+			return stored[i].Space < stored[j].Space
+		}
+		return stored[i].Local < stored[j].Local
+	})
+	s.props[path] = stored
+}
+
+// load reads the properties file on first use. The caller must hold mu.
+func (s *propStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	exists, err := s.fs.Exists(s.filePath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		file, err := s.fs.ReadFile(s.filePath)
+		if err != nil {
+			return err
+		}
+		if len(file) > 0 {
+			var data propsData
+			if err := json.Unmarshal(file, &data); err != nil {
+				return err
+			}
+			for path, props := range data.Properties {
+				s.props[path] = props
+			}
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// save writes all properties to the properties file. The caller must hold mu.
+func (s *propStore) save() error {
+	data := propsData{Properties: s.props}
+	fileData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := s.fs.MkdirAll(filepath.Dir(s.filePath), 0755); err != nil {
+		return err
+	}
+	return s.fs.WriteFile(s.filePath, fileData, 0644)
+}
+
+// below reports whether path is root or inside it, and returns the rest of
+// path after root
+func below(path, root string) (string, bool) {
+	if path == root {
+		return "", true
+	}
+	if strings.HasPrefix(path, root+"/") {
+		return path[len(root):], true
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+// Package webdav serves the mount points over WebDAV (class 1 and 2), so
+// they can be mounted as a network drive.
+package webdav
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/gateway"
+	"github.com/homelab/filemanager/internal/service"
+	"golang.org/x/net/webdav"
+)
+
+// methods are the WebDAV methods beyond plain HTTP, which the router must
+// know about before routes are registered for them
+var methods = []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"}
+
+// Handler serves WebDAV requests for the file service's mount points.
+// Authentication is left to middleware.
+type Handler struct {
+	dav *webdav.Handler
+	fs  *fileSystem
+}
+
+// Config holds configuration for the WebDAV handler
+type Config struct {
+	Prefix  string // URL path the handler is served at
+	DataDir string // Where properties set by clients are stored
+}
+
+// NewHandler creates a WebDAV handler. Locks are held in memory and do not
+// survive a restart; properties are persisted in the data directory.
+func NewHandler(fileService service.FileService, cfg Config) *Handler {
+	fsys := &fileSystem{
+		mounts: gateway.NewMounts(fileService, os.ErrPermission),
+		fs:     fileService.GetFilesystem(),
+		props:  newPropStore(fileService.GetFilesystem(), cfg.DataDir),
+	}
+	return &Handler{
+		dav: &webdav.Handler{
+			Prefix:     cfg.Prefix,
+			FileSystem: fsys,
+			LockSystem: webdav.NewMemLS(),
+		},
+		fs: fsys,
+	}
+}
+
+// RegisterRoutes registers the WebDAV routes for every path below the router
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	for _, method := range methods {
+		chi.RegisterMethod(method)
+	}
+	r.Handle("/", h)
+	r.Handle("/*", h)
+}
+
+// ServeHTTP handles a WebDAV request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Refuse writes to read-only mounts up front; the WebDAV library would
+	// report them as missing files
+	if h.deniesWrite(r) {
+		http.Error(w, "Mount point is read-only", http.StatusForbidden)
+		return
+	}
+
+	// A file upload may take longer than the server's read timeout
+	if r.Method == http.MethodPut {
+		http.NewResponseController(w).SetReadDeadline(time.Time{})
+	}
+
+	h.dav.ServeHTTP(w, r)
+}
+
+// deniesWrite reports whether a request would change the root folder or a
+// read-only mount
+func (h *Handler) deniesWrite(r *http.Request) bool {
+	var paths []string
+	switch r.Method {
+	case http.MethodPut, http.MethodDelete, "MKCOL", "PROPPATCH", "LOCK":
+		paths = []string{r.URL.Path}
+	case "MOVE":
+		paths = []string{r.URL.Path, destinationPath(r)}
+	case "COPY":
+		paths = []string{destinationPath(r)}
+	}
+
+	for _, p := range paths {
+		if h.readOnly(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnly reports whether a request path is the root folder, directly
+// below it or on a read-only mount. Other invalid paths are left to the
+// WebDAV library.
+func (h *Handler) readOnly(urlPath string) bool {
+	name, ok := strings.CutPrefix(urlPath, h.dav.Prefix)
+	if !ok {
+		return false
+	}
+	t, err := h.fs.mounts.Resolve("check", name, false)
+	if err != nil {
+		// New entries directly below the root would be mount points
+		return os.IsNotExist(err) && !strings.Contains(strings.Trim(path.Clean("/"+name), "/"), "/")
+	}
+	return t.Mount == nil || t.Mount.ReadOnly
+}
+
+// destinationPath returns the path of a COPY or MOVE request's destination
+func destinationPath(r *http.Request) string {
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
@@ -0,0 +1,291 @@
+package webdav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/homelab/filemanager/internal/middleware"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/homelab/filemanager/internal/pkg/filesystem"
+	"github.com/homelab/filemanager/internal/service"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// davClient is a minimal WebDAV client for an in-process server
+type davClient struct {
+	t        *testing.T
+	base     string
+	username string
+	password string
+}
+
+// davResponse is the status, headers and body of a WebDAV response
+type davResponse struct {
+	status int
+	header http.Header
+	body   string
+}
+
+// do sends a WebDAV request; headers are given as name, value pairs
+func (c *davClient) do(method, path, body string, headers ...string) davResponse {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.base+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return davResponse{status: resp.StatusCode, header: resp.Header, body: string(data)}
+}
+
+// setupDAVFS creates an in-memory filesystem with a writable and a
+// read-only mount
+func setupDAVFS() (*filesystem.AferoFS, service.FileService) {
+	fs := filesystem.NewMemMapFS()
+	fs.MkdirAll("/data/media", 0755)
+	fs.MkdirAll("/data/archive", 0755)
+	fs.WriteFile("/data/archive/old.txt", []byte("old"), 0644)
+
+	files := service.NewFileService(fs, service.FileServiceConfig{MountPoints: []model.MountPoint{
+		{Name: "media", Path: "/data/media"},
+		{Name: "archive", Path: "/data/archive", ReadOnly: true},
+	}})
+	return fs, files
+}
+
+// startDAVServer serves the file service over WebDAV with Basic auth for
+// alice, and returns a client logged in as her
+func startDAVServer(t *testing.T, files service.FileService, rps float64) *davClient {
+	t.Helper()
+	authService := service.NewAuthService(service.AuthServiceConfig{
+		JWTSecret: "test-secret",
+		Users:     map[string]string{"alice": "secret"},
+	})
+	h := NewHandler(files, Config{Prefix: "/dav", DataDir: "/appdata"})
+
+	r := chi.NewRouter()
+	r.Route("/dav", func(r chi.Router) {
+		r.Use(middleware.BasicAuth(authService, "test", rps))
+		h.RegisterRoutes(r)
+	})
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return &davClient{t: t, base: server.URL, username: "alice", password: "secret"}
+}
+
+// TestWebDAVBasicAuth checks that the drive requires a configured user's
+// credentials and slows down password guessing
+func TestWebDAVBasicAuth(t *testing.T) {
+	_, files := setupDAVFS()
+	client := startDAVServer(t, files, 1)
+
+	anonymous := &davClient{t: t, base: client.base}
+	resp := anonymous.do("PROPFIND", "/dav/", "", "Depth", "0")
+	if resp.status != http.StatusUnauthorized || !strings.HasPrefix(resp.header.Get("WWW-Authenticate"), "Basic ") {
+		t.Fatalf("expected a Basic auth challenge, got %d %q", resp.status, resp.header.Get("WWW-Authenticate"))
+	}
+
+	if resp := client.do("PROPFIND", "/dav/", "", "Depth", "0"); resp.status != http.StatusMultiStatus {
+		t.Fatalf("expected alice to be let in, got %d", resp.status)
+	}
+	if resp := client.do("OPTIONS", "/dav/media/", ""); !strings.Contains(resp.header.Get("DAV"), "2") {
+		t.Fatalf("expected class 2 support, got DAV: %q", resp.header.Get("DAV"))
+	}
+
+	guesser := &davClient{t: t, base: client.base, username: "alice", password: "guess"}
+	for i := 0; i < 2; i++ {
+		if resp := guesser.do("PROPFIND", "/dav/", "", "Depth", "0"); resp.status != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d", i, resp.status)
+		}
+	}
+	if resp := client.do("PROPFIND", "/dav/", "", "Depth", "0"); resp.status != http.StatusTooManyRequests {
+		t.Fatalf("expected repeated failures to be rate limited, got %d", resp.status)
+	}
+}
+
+// **Feature: homelab-file-manager, Property 41: WebDAV Mount Enforcement**
+//
+// Property: For any file written through WebDAV, a write to a writable mount SHALL store
+// the content where the file service finds it, while every request that would create,
+// change or remove anything on a read-only mount or at the root SHALL be refused and leave
+// the filesystem unchanged.
+
+func TestProperty_WebDAVMountEnforcement(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+
+	fs, files := setupDAVFS()
+	client := startDAVServer(t, files, 10)
+
+	properties := gopter.NewProperties(parameters)
+
+	properties.Property("read-only mounts and the root cannot be changed", prop.ForAll(
+		func(name, content string) bool {
+			src := "/dav/media/" + name
+			if resp := client.do(http.MethodPut, src, content); resp.status != http.StatusCreated {
+				t.Logf("PUT %s: %d", src, resp.status)
+				return false
+			}
+			data, err := fs.ReadFile("/data/media/" + name)
+			if err != nil || string(data) != content {
+				return false
+			}
+			if resp := client.do(http.MethodGet, src, ""); resp.body != content {
+				return false
+			}
+
+			dst := client.base + "/dav/archive/" + name
+			refused := []davResponse{
+				client.do(http.MethodPut, "/dav/archive/"+name, content),
+				client.do(http.MethodPut, "/dav/media/../archive/"+name, content),
+				client.do("MKCOL", "/dav/archive/"+name, ""),
+				client.do("MKCOL", "/dav/"+name, ""),
+				client.do("MOVE", src, "", "Destination", dst),
+				client.do("COPY", src, "", "Destination", dst),
+				client.do(http.MethodDelete, "/dav/archive/old.txt", ""),
+				client.do("MOVE", "/dav/media", "", "Destination", client.base+"/dav/"+name),
+			}
+			for i, resp := range refused {
+				if resp.status != http.StatusForbidden {
+					t.Logf("request %d for %q: expected 403, got %d", i, name, resp.status)
+					return false
+				}
+			}
+
+			if exists, _ := fs.Exists("/data/archive/" + name); exists {
+				return false
+			}
+			if exists, _ := fs.Exists("/data/archive/old.txt"); !exists {
+				return false
+			}
+			exists, _ := fs.Exists("/data/media/" + name)
+			return exists
+		},
+		gen.Identifier(),
+		gen.AlphaString(),
+	))
+
+	properties.TestingRun(t)
+}
+
+// TestWebDAVLocking checks that a locked file can only be changed with its
+// lock token
+func TestWebDAVLocking(t *testing.T) {
+	_, files := setupDAVFS()
+	client := startDAVServer(t, files, 10)
+
+	if resp := client.do(http.MethodPut, "/dav/media/doc.txt", "v1"); resp.status != http.StatusCreated {
+		t.Fatalf("PUT: %d", resp.status)
+	}
+
+	lockInfo := `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>bob</D:owner></D:lockinfo>`
+	resp := client.do("LOCK", "/dav/media/doc.txt", lockInfo, "Timeout", "Second-600")
+	token := resp.header.Get("Lock-Token")
+	if resp.status != http.StatusOK || token == "" {
+		t.Fatalf("LOCK: %d %q", resp.status, token)
+	}
+
+	if resp := client.do(http.MethodPut, "/dav/media/doc.txt", "v2"); resp.status != http.StatusLocked {
+		t.Fatalf("expected a PUT without the lock token to be refused, got %d", resp.status)
+	}
+	if resp := client.do(http.MethodDelete, "/dav/media/doc.txt", ""); resp.status != http.StatusLocked {
+		t.Fatalf("expected a DELETE without the lock token to be refused, got %d", resp.status)
+	}
+	if resp := client.do(http.MethodPut, "/dav/media/doc.txt", "v2", "If", "("+token+")"); resp.status != http.StatusCreated {
+		t.Fatalf("PUT with the lock token: %d", resp.status)
+	}
+
+	if resp := client.do("UNLOCK", "/dav/media/doc.txt", "", "Lock-Token", token); resp.status != http.StatusNoContent {
+		t.Fatalf("UNLOCK: %d", resp.status)
+	}
+	if resp := client.do(http.MethodPut, "/dav/media/doc.txt", "v3"); resp.status != http.StatusCreated {
+		t.Fatalf("PUT after UNLOCK: %d", resp.status)
+	}
+	if resp := client.do(http.MethodGet, "/dav/media/doc.txt", ""); resp.body != "v3" {
+		t.Fatalf("expected v3, got %q", resp.body)
+	}
+}
+
+// TestWebDAVProperties checks that properties set by clients are stored,
+// follow their file and survive a restart
+func TestWebDAVProperties(t *testing.T) {
+	_, files := setupDAVFS()
+	client := startDAVServer(t, files, 10)
+
+	setColor := `<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:test"><D:set><D:prop><Z:color>blue</Z:color></D:prop></D:set></D:propertyupdate>`
+	getColor := `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><Z:color xmlns:Z="urn:test"/></D:prop></D:propfind>`
+
+	client.do("MKCOL", "/dav/media/album", "")
+	client.do(http.MethodPut, "/dav/media/album/a.jpg", "photo")
+	if resp := client.do("PROPPATCH", "/dav/media/album/a.jpg", setColor); resp.status != http.StatusMultiStatus || !strings.Contains(resp.body, "200 OK") {
+		t.Fatalf("PROPPATCH: %d %s", resp.status, resp.body)
+	}
+
+	// Moving the folder takes the file's properties along
+	if resp := client.do("MOVE", "/dav/media/album", "", "Destination", client.base+"/dav/media/photos"); resp.status != http.StatusCreated {
+		t.Fatalf("MOVE: %d", resp.status)
+	}
+	restarted := startDAVServer(t, files, 10)
+	if resp := restarted.do("PROPFIND", "/dav/media/photos/a.jpg", getColor, "Depth", "0"); !strings.Contains(resp.body, "blue") {
+		t.Fatalf("expected the property to survive the move and a restart: %s", resp.body)
+	}
+
+	// A new file at the same path starts without properties
+	restarted.do(http.MethodDelete, "/dav/media/photos/a.jpg", "")
+	restarted.do(http.MethodPut, "/dav/media/photos/a.jpg", "another photo")
+	if resp := restarted.do("PROPFIND", "/dav/media/photos/a.jpg", getColor, "Depth", "0"); strings.Contains(resp.body, "blue") {
+		t.Fatalf("expected the property to be gone: %s", resp.body)
+	}
+
+	if resp := restarted.do("PROPPATCH", "/dav/archive/old.txt", setColor); resp.status != http.StatusForbidden {
+		t.Fatalf("expected properties on a read-only mount to be refused, got %d", resp.status)
+	}
+}
+
+// TestWebDAVRootListsMounts checks that the root folder shows the mount
+// points and that folders are only created inside existing ones
+func TestWebDAVRootListsMounts(t *testing.T) {
+	_, files := setupDAVFS()
+	client := startDAVServer(t, files, 10)
+
+	resp := client.do("PROPFIND", "/dav/", "", "Depth", "1")
+	if resp.status != http.StatusMultiStatus || !strings.Contains(resp.body, "/dav/media/") || !strings.Contains(resp.body, "/dav/archive/") {
+		t.Fatalf("expected the mounts in the root listing: %d %s", resp.status, resp.body)
+	}
+	if resp := client.do("PROPFIND", "/dav/documents/", "", "Depth", "0"); resp.status != http.StatusNotFound {
+		t.Fatalf("expected an unknown mount to be missing, got %d", resp.status)
+	}
+
+	if resp := client.do("MKCOL", "/dav/media/a/b", ""); resp.status != http.StatusConflict {
+		t.Fatalf("expected MKCOL without a parent to conflict, got %d", resp.status)
+	}
+	if resp := client.do("MKCOL", "/dav/media/a", ""); resp.status != http.StatusCreated {
+		t.Fatalf("MKCOL: %d", resp.status)
+	}
+	if resp := client.do("MKCOL", "/dav/media/a", ""); resp.status != http.StatusMethodNotAllowed {
+		t.Fatalf("expected MKCOL of an existing folder to be refused, got %d", resp.status)
+	}
+	if resp := client.do(http.MethodDelete, "/dav/media", ""); resp.status == http.StatusNoContent {
+		t.Fatal("expected a mount point not to be deletable")
+	}
+}
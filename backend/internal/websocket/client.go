@@ -2,6 +2,8 @@ package websocket
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -10,27 +12,40 @@ import (
 
 
 
-// Client represents a WebSocket client connection
+// Client represents a WebSocket or Server-Sent Events client connection
 type Client struct {
 	hub *Hub
 
-	// The websocket connection
+	// The websocket connection, nil for Server-Sent Events clients
 	conn *websocket.Conn
 
 	// Buffered channel of outbound messages
 	send chan []byte
 
-	// User ID from JWT claims (if authenticated)
-	userID string
+	// Username from JWT claims
+	username string
+
+	// Whether the user may see every user's jobs
+	admin bool
+
+	// Whether the client reconnected, and the epoch and sequence number of
+	// the last message it saw before
+	resume      bool
+	resumeEpoch string
+	resumeAfter uint64
+
+	// Number of directories the client watches, guarded by the hub's mu
+	watches int
 }
 
 // NewClient creates a new Client instance
-func NewClient(hub *Hub, conn *websocket.Conn, userID string) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, username string, admin bool) *Client {
 	return &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, config.WSSendBufferSize),
-		userID: userID,
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan []byte, config.WSSendBufferSize),
+		username: username,
+		admin:    admin,
 	}
 }
 
@@ -113,12 +128,20 @@ func (c *Client) handleMessage(message []byte) {
 		c.hub.SendError(c, "Invalid message format")
 		return
 	}
+	c.Handle(msg)
+}
 
+// Handle applies a client message, whichever transport it arrived on
+func (c *Client) Handle(msg ClientMessage) {
 	switch msg.Type {
 	case MessageTypeSubscribe:
 		c.handleSubscribe(msg)
 	case MessageTypeUnsubscribe:
 		c.handleUnsubscribe(msg)
+	case MessageTypeWatch:
+		c.handleWatch(msg)
+	case MessageTypeUnwatch:
+		c.handleUnwatch(msg)
 	case MessageTypePing:
 		c.handlePing()
 	default:
@@ -144,14 +167,69 @@ func (c *Client) handleUnsubscribe(msg ClientMessage) {
 	c.hub.UnsubscribeFromJob(c, msg.JobID)
 }
 
+// handleWatch handles directory watch requests
+func (c *Client) handleWatch(msg ClientMessage) {
+	if msg.Path == "" {
+		c.hub.SendError(c, "Path is required for watching")
+		return
+	}
+	if err := c.hub.WatchDir(c, msg.Path); err != nil {
+		c.hub.SendError(c, "Cannot watch "+msg.Path+": "+err.Error())
+	}
+}
+
+// handleUnwatch handles directory unwatch requests
+func (c *Client) handleUnwatch(msg ClientMessage) {
+	if msg.Path == "" {
+		c.hub.SendError(c, "Path is required for unwatching")
+		return
+	}
+	c.hub.UnwatchDir(c, msg.Path)
+}
+
 // handlePing handles ping messages from the client
 func (c *Client) handlePing() {
 	c.hub.SendPong(c)
 }
 
-// UserID returns the user ID associated with this client
-func (c *Client) UserID() string {
-	return c.userID
+// ResumeAfter makes the hub replay the job events after seq when the client
+// is registered, or send a resync message if epoch is not the hub's. It must
+// be called before Register.
+func (c *Client) ResumeAfter(epoch string, seq uint64) {
+	c.resume = true
+	c.resumeEpoch = epoch
+	c.resumeAfter = seq
+}
+
+// ResumeToken returns the resume point for a sequence number of a server
+// run, as clients pass it back when they reconnect
+func ResumeToken(epoch string, seq uint64) string {
+	return epoch + ":" + strconv.FormatUint(seq, 10)
+}
+
+// ParseResumeToken splits a resume point into its epoch and sequence number.
+// A bare sequence number has no epoch, so resuming from it resyncs.
+func ParseResumeToken(token string) (string, uint64, bool) {
+	epoch, seqText, ok := strings.Cut(token, ":")
+	if !ok {
+		epoch, seqText = "", token
+	}
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return epoch, seq, true
+}
+
+// Username returns the username associated with this client
+func (c *Client) Username() string {
+	return c.username
+}
+
+// canSee reports whether the client may receive events for a job owned by
+// the given user
+func (c *Client) canSee(owner string) bool {
+	return c.admin || c.username == owner
 }
 
 // Send sends a message to the client
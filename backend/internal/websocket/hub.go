@@ -2,9 +2,14 @@ package websocket
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"path"
+	"strings"
 	"sync"
 
+	"github.com/homelab/filemanager/internal/config"
 	"github.com/homelab/filemanager/internal/model"
 )
 
@@ -16,8 +21,27 @@ type Hub struct {
 	// Job subscriptions - maps job ID to subscribed clients
 	jobSubscriptions map[string]map[*Client]bool
 
-	// Inbound messages from clients
-	broadcast chan []byte
+	// Directory subscriptions - maps virtual directory path to watching clients
+	dirSubscriptions map[string]map[*Client]bool
+
+	// Watches directories for changes on behalf of clients (optional)
+	watcher DirWatcher
+
+	// Random ID of this server run. Sequence numbers restart with every run,
+	// so a resume point is only valid with the epoch it was taken in.
+	epoch string
+
+	// Sequence number of the last job event
+	seq uint64
+
+	// Recent job events per username, for clients that reconnect
+	replay map[string]*eventRing
+
+	// Usernames of admins, who receive every user's job events
+	admins map[string]bool
+
+	// Job events waiting to be delivered to their owners' clients
+	broadcast chan jobMessage
 
 	// Register requests from clients
 	register chan *Client
@@ -29,17 +53,53 @@ type Hub struct {
 	mu sync.RWMutex
 }
 
+// DirWatcher watches directories on behalf of the hub's clients. Watch and
+// Unwatch are called once per client subscription, so implementations keep
+// their own reference counts. They must not call back into the hub while
+// holding locks of their own.
+type DirWatcher interface {
+	// Watch starts watching the directory at a virtual path
+	Watch(path string) error
+	// Unwatch releases one watch of the directory at a virtual path
+	Unwatch(path string)
+}
+
+// jobMessage is a job event and the user who owns the job
+type jobMessage struct {
+	owner string
+	msg   ServerMessage
+}
+
 // NewHub creates a new Hub instance
 func NewHub() *Hub {
 	return &Hub{
 		clients:          make(map[*Client]bool),
+		epoch:            newEpoch(),
 		jobSubscriptions: make(map[string]map[*Client]bool),
-		broadcast:        make(chan []byte, 256),
+		dirSubscriptions: make(map[string]map[*Client]bool),
+		replay:           make(map[string]*eventRing),
+		admins:           make(map[string]bool),
+		broadcast:        make(chan jobMessage, 256),
 		register:         make(chan *Client),
 		unregister:       make(chan *Client),
 	}
 }
 
+// newEpoch returns a random ID for a server run
+func newEpoch() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Epoch returns the random ID of this server run, which resume points
+// carry alongside the sequence number
+func (h *Hub) Epoch() string {
+	return h.epoch
+}
+
 // Run starts the hub's main event loop
 func (h *Hub) Run(ctx context.Context) {
 	for {
@@ -57,18 +117,97 @@ func (h *Hub) Run(ctx context.Context) {
 	}
 }
 
-// registerClient adds a client to the hub
+// registerClient adds a client to the hub. A client resuming after a
+// sequence number first gets the job events it missed, or a resync message
+// when they are no longer buffered; every client then gets a connected
+// message with the current epoch and sequence number.
 func (h *Hub) registerClient(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.clients[client] = true
+	if client.admin {
+		h.admins[client.username] = true
+	}
+
+	if client.resume {
+		missed, ok := h.missedEvents(client)
+		if !ok {
+			h.sendSeq(client, MessageTypeResync)
+			return
+		}
+		for _, data := range missed {
+			select {
+			case client.send <- data:
+			default:
+				// Client buffer full, skip
+			}
+		}
+	}
+	h.sendSeq(client, MessageTypeConnected)
+}
+
+// missedEvents returns the buffered job events after the client's resume
+// point. It reports false when some of them are no longer buffered, or the
+// resume point is from another server run. The caller must hold mu.
+func (h *Hub) missedEvents(client *Client) ([][]byte, bool) {
+	if client.resumeEpoch != h.epoch || client.resumeAfter > h.seq {
+		return nil, false
+	}
+	ring, ok := h.replay[client.username]
+	if !ok {
+		return nil, true
+	}
+	return ring.since(client.resumeAfter)
+}
+
+// sendSeq sends a message carrying the current epoch and sequence number to
+// a client. The caller must hold mu.
+func (h *Hub) sendSeq(client *Client, msgType MessageType) {
+	data, err := json.Marshal(ServerMessage{Type: msgType, Epoch: h.epoch, Seq: h.seq})
+	if err != nil {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+		// Client buffer full
+	}
+}
+
+// record assigns the next sequence number to a job event, encodes it and
+// buffers it for the job's owner and all admins. It returns nil if the
+// message cannot be encoded. The caller must hold mu.
+func (h *Hub) record(owner string, msg ServerMessage) []byte {
+	msg.Seq = h.seq + 1
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	h.seq = msg.Seq
+
+	users := make(map[string]bool, len(h.admins)+1)
+	if owner != "" {
+		users[owner] = true
+	}
+	for admin := range h.admins {
+		users[admin] = true
+	}
+	for user := range users {
+		ring, ok := h.replay[user]
+		if !ok {
+			ring = newEventRing(config.WSReplayBufferSize)
+			h.replay[user] = ring
+		}
+		ring.add(msg.Seq, data)
+	}
+	return data
 }
 
 // unregisterClient removes a client from the hub and all subscriptions
 func (h *Hub) unregisterClient(client *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
+	var watched []string
 	if _, ok := h.clients[client]; ok {
 		delete(h.clients, client)
 
@@ -80,18 +219,47 @@ func (h *Hub) unregisterClient(client *Client) {
 			}
 		}
 
+		// Remove from all directory subscriptions
+		for dir, subscribers := range h.dirSubscriptions {
+			if subscribers[client] {
+				watched = append(watched, dir)
+				delete(subscribers, client)
+				if len(subscribers) == 0 {
+					delete(h.dirSubscriptions, dir)
+				}
+			}
+		}
+		client.watches = 0
+
 		close(client.send)
 	}
+	watcher := h.watcher
+	h.mu.Unlock()
+
+	if watcher != nil {
+		for _, dir := range watched {
+			watcher.Unwatch(dir)
+		}
+	}
 }
 
-// broadcastMessage sends a message to all connected clients
-func (h *Hub) broadcastMessage(message []byte) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// broadcastMessage sequences a job event and sends it to the connected
+// clients of the job's owner and to admin clients
+func (h *Hub) broadcastMessage(message jobMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data := h.record(message.owner, message.msg)
+	if data == nil {
+		return
+	}
 
 	for client := range h.clients {
+		if !client.canSee(message.owner) {
+			continue
+		}
 		select {
-		case client.send <- message:
+		case client.send <- data:
 		default:
 			// Client buffer full, skip this message
 		}
@@ -143,18 +311,88 @@ func (h *Hub) UnsubscribeFromJob(client *Client, jobID string) {
 	}
 }
 
-// BroadcastJobUpdate sends a job update to all connected clients
-func (h *Hub) BroadcastJobUpdate(job *model.Job) {
-	update := model.JobUpdate{
-		JobID:    job.ID,
-		State:    job.State,
-		Progress: job.Progress,
-		Error:    job.Error,
+// SetDirWatcher sets the watcher that WatchDir and UnwatchDir use
+func (h *Hub) SetDirWatcher(watcher DirWatcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watcher = watcher
+}
+
+// WatchDir subscribes a client to changes of a directory, given as a
+// virtual path. Subscribing twice to the same directory has no effect. A
+// client watches at most config.MaxWatchedDirsPerClient directories.
+func (h *Hub) WatchDir(client *Client, dir string) error {
+	dir = cleanDir(dir)
+
+	h.mu.RLock()
+	watcher := h.watcher
+	subscribed := h.dirSubscriptions[dir][client]
+	full := client.watches >= config.MaxWatchedDirsPerClient
+	h.mu.RUnlock()
+
+	if watcher == nil {
+		return ErrWatchUnavailable
+	}
+	if subscribed {
+		return nil
 	}
+	if full {
+		return ErrTooManyClientWatches
+	}
+	if err := watcher.Watch(dir); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	if h.dirSubscriptions[dir][client] {
+		// Lost a race with a concurrent watch request of the same client
+		h.mu.Unlock()
+		watcher.Unwatch(dir)
+		return nil
+	}
+	if client.watches >= config.MaxWatchedDirsPerClient {
+		// Concurrent watch requests of the same client reached the limit
+		h.mu.Unlock()
+		watcher.Unwatch(dir)
+		return ErrTooManyClientWatches
+	}
+	if h.dirSubscriptions[dir] == nil {
+		h.dirSubscriptions[dir] = make(map[*Client]bool)
+	}
+	h.dirSubscriptions[dir][client] = true
+	client.watches++
+	h.mu.Unlock()
+	return nil
+}
+
+// UnwatchDir unsubscribes a client from changes of a directory
+func (h *Hub) UnwatchDir(client *Client, dir string) {
+	dir = cleanDir(dir)
 
+	h.mu.Lock()
+	subscribers, ok := h.dirSubscriptions[dir]
+	if !ok || !subscribers[client] {
+		h.mu.Unlock()
+		return
+	}
+	delete(subscribers, client)
+	client.watches--
+	if len(subscribers) == 0 {
+		delete(h.dirSubscriptions, dir)
+	}
+	watcher := h.watcher
+	h.mu.Unlock()
+
+	if watcher != nil {
+		watcher.Unwatch(dir)
+	}
+}
+
+// SendDirChanges sends a batch of changes to the clients watching a directory
+func (h *Hub) SendDirChanges(dir string, events []model.FileEvent) {
 	msg := ServerMessage{
-		Type:    MessageTypeJobUpdate,
-		Payload: update,
+		Type:    MessageTypeDirChanges,
+		Payload: model.DirChanges{Path: dir, Events: events},
 	}
 
 	data, err := json.Marshal(msg)
@@ -162,28 +400,106 @@ func (h *Hub) BroadcastJobUpdate(job *model.Job) {
 		return
 	}
 
-	h.broadcast <- data
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.dirSubscriptions[dir] {
+		select {
+		case client.send <- data:
+		default:
+			// Client buffer full, skip
+		}
+	}
+}
+
+// SendUploadUpdate sends a change to an upload session to the clients of
+// the user who owns it. Upload updates are not sequenced or replayed.
+func (h *Hub) SendUploadUpdate(owner string, update model.UploadUpdate) {
+	h.sendToUser(owner, ServerMessage{
+		Type:    MessageTypeUpload,
+		Payload: update,
+	})
+}
+
+// SendShareUpload tells the clients of a drop link's owner that a guest
+// uploaded a file. Like upload updates, it is not sequenced or replayed.
+func (h *Hub) SendShareUpload(owner string, event model.ShareUploadEvent) {
+	h.sendToUser(owner, ServerMessage{
+		Type:    MessageTypeShareUpload,
+		Payload: event,
+	})
+}
+
+// sendToUser sends an unsequenced message to the clients of a user
+func (h *Hub) sendToUser(username string, msg ServerMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients {
+		if client.username != username {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			// Client buffer full, skip
+		}
+	}
+}
+
+// cleanDir normalizes a virtual directory path so that equivalent spellings
+// share one subscription
+func cleanDir(dir string) string {
+	return strings.Trim(path.Clean("/"+dir), "/")
+}
+
+// BroadcastJobUpdate sends a job update to the clients of the job's owner
+// and to admin clients
+func (h *Hub) BroadcastJobUpdate(job *model.Job) {
+	update := model.JobUpdate{
+		JobID:      job.ID,
+		State:      job.State,
+		Progress:   job.Progress,
+		Error:      job.Error,
+		ErrorCount: job.ErrorCount,
+		BytesDone:  job.BytesDone,
+		BytesTotal: job.BytesTotal,
+	}
+
+	msg := ServerMessage{
+		Type:    MessageTypeJobUpdate,
+		Payload: update,
+	}
+
+	h.broadcast <- jobMessage{owner: job.Owner, msg: msg}
 }
 
 // SendJobUpdateToSubscribers sends a job update only to subscribed clients
+// that may see the job
 func (h *Hub) SendJobUpdateToSubscribers(job *model.Job) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	subscribed := len(h.jobSubscriptions[job.ID]) > 0
+	h.mu.RUnlock()
 
-	subscribers, ok := h.jobSubscriptions[job.ID]
-	if !ok || len(subscribers) == 0 {
-		// No subscribers, broadcast to all
-		h.mu.RUnlock()
+	if !subscribed {
+		// No subscribers, broadcast to everyone allowed to see it
 		h.BroadcastJobUpdate(job)
-		h.mu.RLock()
 		return
 	}
 
 	update := model.JobUpdate{
-		JobID:    job.ID,
-		State:    job.State,
-		Progress: job.Progress,
-		Error:    job.Error,
+		JobID:      job.ID,
+		State:      job.State,
+		Progress:   job.Progress,
+		Error:      job.Error,
+		ErrorCount: job.ErrorCount,
+		BytesDone:  job.BytesDone,
+		BytesTotal: job.BytesTotal,
 	}
 
 	msgType := MessageTypeJobUpdate
@@ -196,12 +512,18 @@ func (h *Hub) SendJobUpdateToSubscribers(job *model.Job) {
 		Payload: update,
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data := h.record(job.Owner, msg)
+	if data == nil {
 		return
 	}
 
-	for client := range subscribers {
+	for client := range h.jobSubscriptions[job.ID] {
+		if !client.canSee(job.Owner) {
+			continue
+		}
 		select {
 		case client.send <- data:
 		default:
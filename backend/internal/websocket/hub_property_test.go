@@ -0,0 +1,324 @@
+// Package websocket provides real-time job updates over WebSocket.
+// This file contains property-based tests for job event delivery.
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/homelab/filemanager/internal/config"
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// sentMessage is a decoded server message
+type sentMessage struct {
+	Type    MessageType     `json:"type"`
+	Epoch   string          `json:"epoch"`
+	Seq     uint64          `json:"seq"`
+	Payload model.JobUpdate `json:"payload"`
+}
+
+// sent decodes the messages queued for a client
+func sent(c *Client) []sentMessage {
+	var msgs []sentMessage
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				return msgs
+			}
+			var msg sentMessage
+			if err := json.Unmarshal(data, &msg); err == nil {
+				msgs = append(msgs, msg)
+			}
+		default:
+			return msgs
+		}
+	}
+}
+
+// received returns the job IDs of the job events queued for a client
+func received(c *Client) []string {
+	var ids []string
+	for _, msg := range sent(c) {
+		if msg.Type == MessageTypeJobUpdate || msg.Type == MessageTypeJobComplete {
+			ids = append(ids, msg.Payload.JobID)
+		}
+	}
+	return ids
+}
+
+// **Feature: homelab-file-manager, Property 26: Job Event Visibility**
+//
+// Property: For any set of clients and jobs, a job event SHALL be delivered to every
+// client of the job's owner and to every admin client, and SHALL NOT be delivered to
+// any other client, whether it is broadcast or sent to subscribers.
+
+func TestProperty_JobEventVisibility(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 30
+
+	properties := gopter.NewProperties(parameters)
+
+	users := []string{"alice", "bob", "carol"}
+
+	properties.Property("job events only reach the owner and admins", prop.ForAll(
+		func(clientSpecs []int, jobOwners []int, subscribe bool) bool {
+			hub := NewHub()
+
+			clients := make([]*Client, len(clientSpecs))
+			for i, spec := range clientSpecs {
+				clients[i] = NewClient(hub, nil, users[spec%len(users)], spec >= len(users))
+				hub.registerClient(clients[i])
+			}
+
+			jobs := make([]*model.Job, len(jobOwners))
+			for i, n := range jobOwners {
+				jobs[i] = &model.Job{
+					ID:    fmt.Sprintf("job-%d", i),
+					State: model.JobStateRunning,
+					Owner: users[n%len(users)],
+				}
+				if subscribe {
+					// Every client asks for every job, including other users' jobs
+					for _, c := range clients {
+						hub.SubscribeToJob(c, jobs[i].ID)
+					}
+					hub.SendJobUpdateToSubscribers(jobs[i])
+				} else {
+					hub.BroadcastJobUpdate(jobs[i])
+					hub.broadcastMessage(<-hub.broadcast)
+				}
+			}
+
+			for _, c := range clients {
+				var expected []string
+				for _, job := range jobs {
+					if c.admin || c.username == job.Owner {
+						expected = append(expected, job.ID)
+					}
+				}
+				got := received(c)
+				if len(got) != len(expected) {
+					return false
+				}
+				for i := range got {
+					if got[i] != expected[i] {
+						return false
+					}
+				}
+			}
+			return true
+		},
+		gen.SliceOf(gen.IntRange(0, 2*len(users)-1)),
+		gen.SliceOfN(20, gen.IntRange(0, len(users)-1)),
+		gen.Bool(),
+	))
+
+	properties.TestingRun(t)
+}
+
+// **Feature: homelab-file-manager, Property 29: Job Event Replay**
+//
+// Property: For any sequence of job events during which a client disconnects, the
+// client reconnecting with the last sequence number it saw SHALL receive exactly the
+// events it missed, in order and with increasing sequence numbers, when they are still
+// buffered, and SHALL be told to resync otherwise.
+
+func TestProperty_JobEventReplay(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 3 * config.WSReplayBufferSize
+
+	properties := gopter.NewProperties(parameters)
+
+	users := []string{"alice", "bob"}
+
+	properties.Property("reconnecting clients catch up or resync", prop.ForAll(
+		func(owners []int, disconnectAt int, admin bool) bool {
+			hub := NewHub()
+			first := NewClient(hub, nil, "alice", admin)
+			hub.registerClient(first)
+			hub.registerClient(NewClient(hub, nil, "bob", false))
+
+			cut := disconnectAt % (len(owners) + 1)
+			var lastSeen uint64
+			read := func() {
+				// Read as a connected client does, so its buffer never fills
+				for _, msg := range sent(first) {
+					lastSeen = msg.Seq
+				}
+			}
+			read()
+
+			var missed []string
+			for i, n := range owners {
+				if i == cut {
+					hub.unregisterClient(first)
+				}
+				job := &model.Job{ID: fmt.Sprintf("job-%d", i), State: model.JobStateRunning, Owner: users[n]}
+				hub.BroadcastJobUpdate(job)
+				hub.broadcastMessage(<-hub.broadcast)
+				if i < cut {
+					read()
+				} else if admin || job.Owner == "alice" {
+					missed = append(missed, job.ID)
+				}
+			}
+			if cut == len(owners) {
+				hub.unregisterClient(first)
+			}
+
+			second := NewClient(hub, nil, "alice", admin)
+			second.ResumeAfter(hub.Epoch(), lastSeen)
+			hub.registerClient(second)
+			msgs := sent(second)
+
+			if len(missed) > config.WSReplayBufferSize {
+				return len(msgs) == 1 && msgs[0].Type == MessageTypeResync && msgs[0].Seq == hub.seq
+			}
+			if len(msgs) != len(missed)+1 {
+				return false
+			}
+			prev := lastSeen
+			for i, id := range missed {
+				if msgs[i].Payload.JobID != id || msgs[i].Seq <= prev {
+					return false
+				}
+				prev = msgs[i].Seq
+			}
+			last := msgs[len(msgs)-1]
+			return last.Type == MessageTypeConnected && last.Seq == hub.seq
+		},
+		gen.SliceOf(gen.IntRange(0, len(users)-1)),
+		gen.IntRange(0, 3*config.WSReplayBufferSize),
+		gen.Bool(),
+	))
+
+	properties.TestingRun(t)
+}
+
+func TestResumeAfterRestartResyncs(t *testing.T) {
+	// Job events that a client saw before the restart
+	hub := NewHub()
+	client := NewClient(hub, nil, "alice", false)
+	hub.registerClient(client)
+	for i := 0; i < 3; i++ {
+		hub.BroadcastJobUpdate(&model.Job{ID: fmt.Sprintf("old-%d", i), State: model.JobStateRunning, Owner: "alice"})
+		hub.broadcastMessage(<-hub.broadcast)
+	}
+	var epoch string
+	var lastSeen uint64
+	for _, msg := range sent(client) {
+		if msg.Type == MessageTypeConnected {
+			epoch = msg.Epoch
+		}
+		lastSeen = msg.Seq
+	}
+	if epoch != hub.Epoch() || lastSeen != 3 {
+		t.Fatalf("expected to have seen seq 3 of epoch %s, got %d of %q", hub.Epoch(), lastSeen, epoch)
+	}
+
+	// The restarted hub numbers its events from 1 again and has passed the
+	// client's sequence number by the time it reconnects
+	restarted := NewHub()
+	if restarted.Epoch() == epoch {
+		t.Fatal("expected a new epoch after a restart")
+	}
+	restarted.registerClient(NewClient(restarted, nil, "alice", false))
+	for i := 0; i < 5; i++ {
+		restarted.BroadcastJobUpdate(&model.Job{ID: fmt.Sprintf("new-%d", i), State: model.JobStateRunning, Owner: "alice"})
+		restarted.broadcastMessage(<-restarted.broadcast)
+	}
+
+	for _, resumeEpoch := range []string{epoch, ""} {
+		resumed := NewClient(restarted, nil, "alice", false)
+		resumed.ResumeAfter(resumeEpoch, lastSeen)
+		restarted.registerClient(resumed)
+
+		msgs := sent(resumed)
+		if len(msgs) != 1 || msgs[0].Type != MessageTypeResync || msgs[0].Epoch != restarted.Epoch() || msgs[0].Seq != 5 {
+			t.Fatalf("resuming from epoch %q: expected a single resync message, got %+v", resumeEpoch, msgs)
+		}
+	}
+}
+
+func TestParseResumeToken(t *testing.T) {
+	cases := []struct {
+		token string
+		epoch string
+		seq   uint64
+		ok    bool
+	}{
+		{ResumeToken("0123456789abcdef", 42), "0123456789abcdef", 42, true},
+		{"42", "", 42, true},
+		{"abc:", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tc := range cases {
+		epoch, seq, ok := ParseResumeToken(tc.token)
+		if epoch != tc.epoch || seq != tc.seq || ok != tc.ok {
+			t.Errorf("ParseResumeToken(%q) = %q, %d, %v; want %q, %d, %v", tc.token, epoch, seq, ok, tc.epoch, tc.seq, tc.ok)
+		}
+	}
+}
+
+// countingWatcher counts the watches of each directory
+type countingWatcher struct {
+	mu      sync.Mutex
+	watches map[string]int
+}
+
+func (w *countingWatcher) Watch(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watches[path]++
+	return nil
+}
+
+func (w *countingWatcher) Unwatch(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watches[path]--
+}
+
+func TestWatchDirLimitsEachClient(t *testing.T) {
+	hub := NewHub()
+	watcher := &countingWatcher{watches: make(map[string]int)}
+	hub.SetDirWatcher(watcher)
+	greedy := NewClient(hub, nil, "alice", false)
+	other := NewClient(hub, nil, "bob", false)
+	hub.registerClient(greedy)
+	hub.registerClient(other)
+
+	for i := 0; i < config.MaxWatchedDirsPerClient; i++ {
+		if err := hub.WatchDir(greedy, fmt.Sprintf("media/%d", i)); err != nil {
+			t.Fatalf("watch %d: %v", i, err)
+		}
+	}
+	if err := hub.WatchDir(greedy, "media/extra"); !errors.Is(err, ErrTooManyClientWatches) {
+		t.Fatalf("expected the client's limit to be reached, got %v", err)
+	}
+	if watcher.watches["media/extra"] != 0 {
+		t.Fatal("expected no watch past the client's limit")
+	}
+	if err := hub.WatchDir(other, "media/extra"); err != nil {
+		t.Fatalf("expected other clients to keep watching, got %v", err)
+	}
+
+	// Unwatching makes room again
+	hub.UnwatchDir(greedy, "media/0")
+	if err := hub.WatchDir(greedy, "media/extra"); err != nil {
+		t.Fatalf("expected room after unwatching, got %v", err)
+	}
+	if watcher.watches["media/extra"] != 2 {
+		t.Fatalf("expected 2 watches of media/extra, got %d", watcher.watches["media/extra"])
+	}
+}
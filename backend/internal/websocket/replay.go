@@ -0,0 +1,53 @@
+package websocket
+
+// eventRing keeps the most recent sequenced events sent to one user so that
+// a reconnecting client can catch up on what it missed
+type eventRing struct {
+	events  []sequencedEvent
+	start   int    // index of the oldest event
+	count   int    // number of events held
+	dropped uint64 // sequence number of the newest event pushed out
+}
+
+// sequencedEvent is an encoded server message and its sequence number
+type sequencedEvent struct {
+	seq  uint64
+	data []byte
+}
+
+// newEventRing creates a ring holding up to size events
+func newEventRing(size int) *eventRing {
+	return &eventRing{events: make([]sequencedEvent, size)}
+}
+
+// add appends an event, pushing out the oldest one when full
+func (r *eventRing) add(seq uint64, data []byte) {
+	if len(r.events) == 0 {
+		r.dropped = seq
+		return
+	}
+	if r.count == len(r.events) {
+		r.dropped = r.events[r.start].seq
+		r.events[r.start] = sequencedEvent{seq: seq, data: data}
+		r.start = (r.start + 1) % len(r.events)
+		return
+	}
+	r.events[(r.start+r.count)%len(r.events)] = sequencedEvent{seq: seq, data: data}
+	r.count++
+}
+
+// since returns the events after seq, oldest first. It reports false when
+// events after seq have already been pushed out.
+func (r *eventRing) since(seq uint64) ([][]byte, bool) {
+	if seq < r.dropped {
+		return nil, false
+	}
+	var missed [][]byte
+	for i := 0; i < r.count; i++ {
+		e := r.events[(r.start+i)%len(r.events)]
+		if e.seq > seq {
+			missed = append(missed, e.data)
+		}
+	}
+	return missed, true
+}
@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/homelab/filemanager/internal/config"
+)
+
+// NewStreamClient creates a client without a WebSocket connection, for
+// streaming events as Server-Sent Events with WriteEvents. It is registered,
+// subscribed and resumed like any other client.
+func NewStreamClient(hub *Hub, username string, admin bool) *Client {
+	return NewClient(hub, nil, username, admin)
+}
+
+// WriteEvents writes the client's messages to w as Server-Sent Events,
+// calling flush after each batch, until the hub closes the client or ctx is
+// done. It returns nil when the hub closed the client.
+func (c *Client) WriteEvents(ctx context.Context, w io.Writer, flush func()) error {
+	ticker := time.NewTicker(config.SSEKeepAlivePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message, ok := <-c.send:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(w, message, c.hub.Epoch()); err != nil {
+				return err
+			}
+
+			// Add queued messages to the same flush
+			n := len(c.send)
+			for i := 0; i < n; i++ {
+				message, ok := <-c.send
+				if !ok {
+					flush()
+					return nil
+				}
+				if err := writeEvent(w, message, c.hub.Epoch()); err != nil {
+					return err
+				}
+			}
+			flush()
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return err
+			}
+			flush()
+		}
+	}
+}
+
+// writeEvent frames an encoded server message as a Server-Sent Event named
+// after its type, with the whole message as data. Job events, connected and
+// resync carry their resume token in epoch as the event ID, which the
+// browser sends back as Last-Event-ID when it reconnects.
+func writeEvent(w io.Writer, message []byte, epoch string) error {
+	var header struct {
+		Type MessageType `json:"type"`
+		Seq  uint64      `json:"seq"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if header.Seq > 0 || header.Type == MessageTypeConnected || header.Type == MessageTypeResync {
+		b.WriteString("id: " + ResumeToken(epoch, header.Seq) + "\n")
+	}
+	b.WriteString("event: " + string(header.Type) + "\n")
+	b.WriteString("data: ")
+	b.Write(message)
+	b.WriteString("\n\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
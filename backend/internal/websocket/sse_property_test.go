@@ -0,0 +1,143 @@
+// Package websocket provides real-time job updates over WebSocket.
+// This file contains property-based tests for the Server-Sent Events stream.
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/homelab/filemanager/internal/model"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// streamEvent is one parsed Server-Sent Event
+type streamEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// parseEvents splits a Server-Sent Events stream into events, skipping comments
+func parseEvents(stream []byte) []streamEvent {
+	var events []streamEvent
+	var cur streamEvent
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			events = append(events, cur)
+			cur = streamEvent{}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			cur.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			cur.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			cur.data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+// **Feature: homelab-file-manager, Property 30: Event Stream Equivalence**
+//
+// Property: For any sequence of job events, a Server-Sent Events client SHALL receive
+// the same messages in the same order as a WebSocket client of the same user, each as
+// an event named after the message type, and every job event SHALL carry its sequence
+// number as the event ID, so that resuming from the last event ID replays exactly the
+// events that followed it.
+
+func TestProperty_EventStreamEquivalence(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 100
+	parameters.MaxSize = 40
+
+	properties := gopter.NewProperties(parameters)
+
+	users := []string{"alice", "bob"}
+
+	properties.Property("streamed events match WebSocket messages", prop.ForAll(
+		func(owners []int, admin bool, resumeAt int) bool {
+			hub := NewHub()
+			socket := NewClient(hub, nil, "alice", admin)
+			stream := NewStreamClient(hub, "alice", admin)
+			hub.registerClient(socket)
+			hub.registerClient(stream)
+
+			for i, n := range owners {
+				job := &model.Job{ID: fmt.Sprintf("job-%d", i), State: model.JobStateRunning, Owner: users[n]}
+				hub.BroadcastJobUpdate(job)
+				hub.broadcastMessage(<-hub.broadcast)
+			}
+
+			var want []string
+			for len(socket.send) > 0 {
+				want = append(want, string(<-socket.send))
+			}
+			var buf bytes.Buffer
+			hub.unregisterClient(stream)
+			if err := stream.WriteEvents(context.Background(), &buf, func() {}); err != nil {
+				return false
+			}
+
+			events := parseEvents(buf.Bytes())
+			if len(events) != len(want) {
+				return false
+			}
+			var ids []uint64
+			for i, ev := range events {
+				msg := sent(&Client{send: singleMessage(ev.data)})
+				if ev.data != want[i] || len(msg) != 1 || ev.event != string(msg[0].Type) {
+					return false
+				}
+				if msg[0].Type == MessageTypeConnected {
+					continue
+				}
+				epoch, id, ok := ParseResumeToken(ev.id)
+				if !ok || epoch != hub.Epoch() || id != msg[0].Seq {
+					return false
+				}
+				ids = append(ids, id)
+			}
+
+			// Resume from one of the streamed event IDs
+			if len(ids) == 0 {
+				return true
+			}
+			from := resumeAt % len(ids)
+			resumed := NewStreamClient(hub, "alice", admin)
+			resumed.ResumeAfter(hub.Epoch(), ids[from])
+			hub.registerClient(resumed)
+			replayed := sent(resumed)
+			if len(replayed) != len(ids)-from {
+				return false
+			}
+			for i, id := range ids[from+1:] {
+				if replayed[i].Seq != id {
+					return false
+				}
+			}
+			return replayed[len(replayed)-1].Type == MessageTypeConnected
+		},
+		gen.SliceOf(gen.IntRange(0, len(users)-1)),
+		gen.Bool(),
+		gen.IntRange(0, 100),
+	))
+
+	properties.TestingRun(t)
+}
+
+// singleMessage returns a closed channel holding one message
+func singleMessage(data string) chan []byte {
+	ch := make(chan []byte, 1)
+	ch <- []byte(data)
+	close(ch)
+	return ch
+}
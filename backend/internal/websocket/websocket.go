@@ -1,5 +1,14 @@
 package websocket
 
+import "errors"
+
+// ErrWatchUnavailable is returned when directory watching is not configured
+var ErrWatchUnavailable = errors.New("directory watching is not available")
+
+// ErrTooManyClientWatches is returned when a client already watches
+// config.MaxWatchedDirsPerClient directories
+var ErrTooManyClientWatches = errors.New("too many watched directories for this connection")
+
 // MessageType represents the type of WebSocket message
 type MessageType string
 
@@ -7,11 +16,18 @@ const (
 	// Client -> Server message types
 	MessageTypeSubscribe   MessageType = "subscribe"
 	MessageTypeUnsubscribe MessageType = "unsubscribe"
+	MessageTypeWatch       MessageType = "watch"
+	MessageTypeUnwatch     MessageType = "unwatch"
 	MessageTypePing        MessageType = "ping"
 
 	// Server -> Client message types
 	MessageTypeJobUpdate   MessageType = "job_update"
 	MessageTypeJobComplete MessageType = "job_complete"
+	MessageTypeDirChanges  MessageType = "dir_changes"
+	MessageTypeUpload      MessageType = "upload_update"
+	MessageTypeShareUpload MessageType = "share_upload"
+	MessageTypeConnected   MessageType = "connected"
+	MessageTypeResync      MessageType = "resync"
 	MessageTypeError       MessageType = "error"
 	MessageTypePong        MessageType = "pong"
 )
@@ -20,10 +36,15 @@ const (
 type ClientMessage struct {
 	Type  MessageType `json:"type"`
 	JobID string      `json:"jobId,omitempty"`
+	Path  string      `json:"path,omitempty"` // Directory for watch and unwatch
 }
 
-// ServerMessage represents a message from server to client
+// ServerMessage represents a message from server to client. Job events carry
+// an increasing sequence number; connected and resync carry the current one
+// and the epoch of the server run it belongs to.
 type ServerMessage struct {
 	Type    MessageType `json:"type"`
+	Epoch   string      `json:"epoch,omitempty"`
+	Seq     uint64      `json:"seq,omitempty"`
 	Payload interface{} `json:"payload,omitempty"`
 }
@@ -48,16 +48,73 @@ export {
 	createCopyJob,
 	createMoveJob,
 	createDeleteJob,
+	createSyncJob,
+	createFetchJob,
 	cancelJob,
+	getJobErrors,
+	getJobChecksums,
+	retryJob,
+	getSyncReport,
+	getJobQueue,
+	moveJob,
+	bumpJob,
 	isJobTerminal,
 	isJobActive,
 	type Job,
 	type JobType,
+	type JobPriority,
 	type JobState,
 	type JobListResponse,
+	type JobError,
+	type JobErrorsResponse,
+	type FileChecksum,
+	type JobChecksumsResponse,
+	type SyncOptions,
+	type FetchOptions,
+	type SyncAction,
+	type SyncReportResponse,
 	type CreateJobRequest
 } from './jobs';
 
+// Schedules API
+export {
+	schedulesApi,
+	listSchedules,
+	getSchedule,
+	createSchedule,
+	updateSchedule,
+	deleteSchedule,
+	type Schedule,
+	type ScheduleJobTemplate,
+	type ScheduleRun,
+	type ScheduleRunOutcome,
+	type ScheduleListResponse,
+	type ScheduleRequest
+} from './schedules';
+
+// Shares API
+export {
+	sharesApi,
+	listShares,
+	getShare,
+	createShare,
+	revokeShare,
+	getShareInfo,
+	listSharedDirectory,
+	getShareDownloadUrl,
+	getSharePreviewUrl,
+	downloadSharedFile,
+	uploadToDrop,
+	type DropOptions,
+	type DropUploadResult,
+	type Share,
+	type ShareAccess,
+	type ShareAction,
+	type ShareInfo,
+	type ShareListResponse,
+	type CreateShareRequest
+} from './shares';
+
 // System API
 export {
 	getSystemDrives,
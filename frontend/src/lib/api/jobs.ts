@@ -8,12 +8,41 @@ import { api } from './client';
 /**
  * Job types for background operations
  */
-export type JobType = 'copy' | 'move' | 'delete';
+export type JobType = 'copy' | 'move' | 'delete' | 'sync' | 'fetch';
+
+/**
+ * Job scheduling priorities
+ */
+export type JobPriority = 'low' | 'normal' | 'high';
 
 /**
  * Job states
  */
-export type JobState = 'pending' | 'running' | 'completed' | 'failed' | 'cancelled';
+export type JobState =
+	| 'pending'
+	| 'running'
+	| 'completed'
+	| 'completed_with_errors'
+	| 'failed'
+	| 'cancelled';
+
+/**
+ * Options for sync jobs
+ */
+export interface SyncOptions {
+	compare?: 'sizeMtime' | 'checksum';
+	delete?: boolean;
+	exclude?: string[];
+	dryRun?: boolean;
+}
+
+/**
+ * Options for fetch jobs
+ */
+export interface FetchOptions {
+	checksum?: string; // Expected SHA-256, hex with optional "sha256:" prefix
+	maxBytes?: number;
+}
 
 /**
  * Job information
@@ -26,6 +55,19 @@ export interface Job {
 	sourcePath: string;
 	destPath?: string;
 	error?: string;
+	continueOnError?: boolean;
+	verify?: boolean;
+	items?: string[];
+	errorCount?: number;
+	verifiedCount?: number;
+	retryOf?: string;
+	sync?: SyncOptions;
+	fetch?: FetchOptions;
+	bytesDone?: number; // Bytes downloaded by a fetch job
+	bytesTotal?: number; // Size of a fetch job's download, when known
+	owner?: string;
+	priority?: JobPriority;
+	queuePosition?: number;
 	createdAt: string;
 	startedAt?: string;
 	completedAt?: string;
@@ -38,6 +80,65 @@ export interface JobListResponse {
 	jobs: Job[];
 }
 
+/**
+ * A single item that failed in a continue-on-error job
+ */
+export interface JobError {
+	code: 'NOT_FOUND' | 'PERMISSION_DENIED' | 'CHECKSUM_MISMATCH' | 'IO_ERROR';
+	message: string;
+	path?: string;
+	cause?: string;
+}
+
+/**
+ * Job errors response
+ */
+export interface JobErrorsResponse {
+	jobId: string;
+	errors: JobError[];
+}
+
+/**
+ * Verified hash of a copied file
+ */
+export interface FileChecksum {
+	path: string;
+	destPath: string;
+	algorithm: 'sha256';
+	hash: string;
+}
+
+/**
+ * Job checksums response
+ */
+export interface JobChecksumsResponse {
+	jobId: string;
+	checksums: FileChecksum[];
+}
+
+/**
+ * A single change planned or applied by a sync job
+ */
+export interface SyncAction {
+	action: 'mkdir' | 'copy' | 'update' | 'delete';
+	path: string;
+	isDir?: boolean;
+	size?: number;
+}
+
+/**
+ * Sync job report response
+ */
+export interface SyncReportResponse {
+	jobId: string;
+	dryRun: boolean;
+	actions: SyncAction[];
+	copyCount: number;
+	updateCount: number;
+	deleteCount: number;
+	bytes: number;
+}
+
 /**
  * Create job request
  */
@@ -45,6 +146,11 @@ export interface CreateJobRequest {
 	type: JobType;
 	sourcePath: string;
 	destPath?: string;
+	continueOnError?: boolean;
+	verify?: boolean;
+	sync?: SyncOptions;
+	fetch?: FetchOptions;
+	priority?: JobPriority;
 }
 
 /**
@@ -99,6 +205,29 @@ export async function createDeleteJob(sourcePath: string): Promise<Job> {
 	return createJob({ type: 'delete', sourcePath });
 }
 
+/**
+ * Create a sync job
+ */
+export async function createSyncJob(
+	sourcePath: string,
+	destPath: string,
+	options: SyncOptions = {}
+): Promise<Job> {
+	return createJob({ type: 'sync', sourcePath, destPath, sync: options });
+}
+
+/**
+ * Create a fetch job that downloads a URL on the server into destPath, a
+ * file or a directory
+ */
+export async function createFetchJob(
+	url: string,
+	destPath: string,
+	options: FetchOptions = {}
+): Promise<Job> {
+	return createJob({ type: 'fetch', sourcePath: url, destPath, fetch: options });
+}
+
 /**
  * Cancel a running job
  * DELETE /api/v1/jobs/:id
@@ -107,11 +236,72 @@ export async function cancelJob(jobId: string): Promise<MessageResponse> {
 	return api.delete<MessageResponse>(`/jobs/${jobId}`);
 }
 
+/**
+ * Get the per-item errors of a job
+ * GET /api/v1/jobs/:id/errors
+ */
+export async function getJobErrors(jobId: string): Promise<JobErrorsResponse> {
+	return api.get<JobErrorsResponse>(`/jobs/${jobId}/errors`);
+}
+
+/**
+ * Get the verified checksums of a job
+ * GET /api/v1/jobs/:id/checksums
+ */
+export async function getJobChecksums(jobId: string): Promise<JobChecksumsResponse> {
+	return api.get<JobChecksumsResponse>(`/jobs/${jobId}/checksums`);
+}
+
+/**
+ * Retry the failed items of a job
+ * POST /api/v1/jobs/:id/retry
+ */
+export async function retryJob(jobId: string): Promise<Job> {
+	return api.post<Job>(`/jobs/${jobId}/retry`);
+}
+
+/**
+ * Get the planned or applied changes of a sync job
+ * GET /api/v1/jobs/:id/report
+ */
+export async function getSyncReport(jobId: string): Promise<SyncReportResponse> {
+	return api.get<SyncReportResponse>(`/jobs/${jobId}/report`);
+}
+
+/**
+ * List pending jobs in the order they will run
+ * GET /api/v1/jobs/queue
+ */
+export async function getJobQueue(): Promise<JobListResponse> {
+	return api.get<JobListResponse>('/jobs/queue');
+}
+
+/**
+ * Move a pending job to a 1-based queue position (admin only)
+ * POST /api/v1/jobs/:id/move
+ */
+export async function moveJob(jobId: string, position: number): Promise<Job> {
+	return api.post<Job>(`/jobs/${jobId}/move`, { position });
+}
+
+/**
+ * Move a pending job to the front of the queue (admin only)
+ * POST /api/v1/jobs/:id/bump
+ */
+export async function bumpJob(jobId: string): Promise<Job> {
+	return api.post<Job>(`/jobs/${jobId}/bump`);
+}
+
 /**
  * Check if a job is in a terminal state
  */
 export function isJobTerminal(job: Job): boolean {
-	return job.state === 'completed' || job.state === 'failed' || job.state === 'cancelled';
+	return (
+		job.state === 'completed' ||
+		job.state === 'completed_with_errors' ||
+		job.state === 'failed' ||
+		job.state === 'cancelled'
+	);
 }
 
 /**
@@ -131,7 +321,16 @@ export const jobsApi = {
 	createCopy: createCopyJob,
 	createMove: createMoveJob,
 	createDelete: createDeleteJob,
+	createSync: createSyncJob,
+	createFetch: createFetchJob,
 	cancel: cancelJob,
+	errors: getJobErrors,
+	checksums: getJobChecksums,
+	retry: retryJob,
+	syncReport: getSyncReport,
+	queue: getJobQueue,
+	move: moveJob,
+	bump: bumpJob,
 	isTerminal: isJobTerminal,
 	isActive: isJobActive
 };
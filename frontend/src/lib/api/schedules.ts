@@ -0,0 +1,119 @@
+/**
+ * Schedule API module for recurring background jobs
+ */
+
+import { api } from './client';
+import type { JobPriority, JobState, JobType, SyncOptions } from './jobs';
+
+/**
+ * Template for the jobs a schedule creates
+ */
+export interface ScheduleJobTemplate {
+	type: JobType;
+	sourcePath: string;
+	destPath?: string;
+	continueOnError?: boolean;
+	verify?: boolean;
+	sync?: SyncOptions;
+	priority?: JobPriority;
+}
+
+/**
+ * Outcome of a scheduled run
+ */
+export type ScheduleRunOutcome = Exclude<JobState, 'pending'> | 'skipped';
+
+/**
+ * A single firing of a schedule
+ */
+export interface ScheduleRun {
+	scheduledAt: string;
+	jobId?: string;
+	outcome: ScheduleRunOutcome;
+	error?: string;
+	completedAt?: string;
+}
+
+/**
+ * Recurring job schedule
+ */
+export interface Schedule {
+	id: string;
+	name: string;
+	cron?: string;
+	everyHours?: number;
+	job: ScheduleJobTemplate;
+	enabled: boolean;
+	nextRun?: string;
+	createdAt: string;
+	runs: ScheduleRun[];
+}
+
+/**
+ * Schedule list response
+ */
+export interface ScheduleListResponse {
+	schedules: Schedule[];
+}
+
+/**
+ * Create or update schedule request. Exactly one of cron and everyHours is required.
+ */
+export interface ScheduleRequest {
+	name: string;
+	cron?: string;
+	everyHours?: number;
+	job: ScheduleJobTemplate;
+	enabled?: boolean;
+}
+
+/**
+ * List all schedules
+ * GET /api/v1/schedules
+ */
+export async function listSchedules(): Promise<ScheduleListResponse> {
+	return api.get<ScheduleListResponse>('/schedules');
+}
+
+/**
+ * Get a schedule with its run history
+ * GET /api/v1/schedules/:id
+ */
+export async function getSchedule(scheduleId: string): Promise<Schedule> {
+	return api.get<Schedule>(`/schedules/${scheduleId}`);
+}
+
+/**
+ * Create a schedule
+ * POST /api/v1/schedules
+ */
+export async function createSchedule(request: ScheduleRequest): Promise<Schedule> {
+	return api.post<Schedule>('/schedules', request);
+}
+
+/**
+ * Update a schedule
+ * PUT /api/v1/schedules/:id
+ */
+export async function updateSchedule(scheduleId: string, request: ScheduleRequest): Promise<Schedule> {
+	return api.put<Schedule>(`/schedules/${scheduleId}`, request);
+}
+
+/**
+ * Delete a schedule
+ * DELETE /api/v1/schedules/:id
+ */
+export async function deleteSchedule(scheduleId: string): Promise<void> {
+	return api.delete<void>(`/schedules/${scheduleId}`);
+}
+
+/**
+ * Schedule API object with all methods
+ */
+export const schedulesApi = {
+	list: listSchedules,
+	get: getSchedule,
+	create: createSchedule,
+	update: updateSchedule,
+	delete: deleteSchedule
+};
@@ -0,0 +1,267 @@
+/**
+ * Share API module for public links to files and folders
+ */
+
+import { apiRequest, api } from './client';
+import type { FileList, ListOptions } from './files';
+
+// Chunk size of uploads through drop links: 10MB
+const DROP_CHUNK_SIZE = 10 * 1024 * 1024;
+
+/**
+ * What a visitor did with a share link
+ */
+export type ShareAction = 'info' | 'list' | 'download' | 'preview' | 'upload';
+
+/**
+ * One use of a share link
+ */
+export interface ShareAccess {
+	time: string;
+	action: ShareAction;
+	path?: string;
+	remoteAddr?: string;
+	error?: string;
+}
+
+/**
+ * Limits of an upload-only drop link; 0 or missing means unlimited
+ */
+export interface DropOptions {
+	maxFiles?: number;
+	maxFileBytes?: number;
+	maxBytes?: number;
+}
+
+/**
+ * Public share link as seen by its owner
+ */
+export interface Share {
+	id: string;
+	token: string;
+	url: string;
+	path: string;
+	isDir: boolean;
+	owner?: string;
+	hasPassword: boolean;
+	expiresAt?: string;
+	maxDownloads?: number;
+	downloads: number;
+	drop?: DropOptions;
+	uploads?: number;
+	uploadedBytes?: number;
+	createdAt: string;
+	access?: ShareAccess[];
+}
+
+/**
+ * Share list response
+ */
+export interface ShareListResponse {
+	shares: Share[];
+}
+
+/**
+ * Create share link request
+ */
+export interface CreateShareRequest {
+	path: string;
+	password?: string;
+	expiresAt?: string;
+	maxDownloads?: number;
+	drop?: DropOptions; // Makes the link an upload-only drop folder
+}
+
+/**
+ * Shared file or folder as seen by a visitor
+ */
+export interface ShareInfo {
+	name: string;
+	isDir: boolean;
+	size: number;
+	modTime: string;
+	mimeType?: string;
+	expiresAt?: string;
+	downloadsLeft?: number;
+	upload?: boolean; // The link is a drop folder that only accepts uploads
+	uploadsLeft?: number;
+	bytesLeft?: number;
+	maxFileBytes?: number;
+}
+
+/**
+ * Final response of an upload through a drop link
+ */
+export interface DropUploadResult {
+	uploadId: string;
+	complete: boolean;
+	path?: string; // Name the file was stored under
+}
+
+/**
+ * List the user's share links (all links for admins)
+ * GET /api/v1/shares
+ */
+export async function listShares(): Promise<ShareListResponse> {
+	return api.get<ShareListResponse>('/shares');
+}
+
+/**
+ * Get a share link with its access log
+ * GET /api/v1/shares/:id
+ */
+export async function getShare(shareId: string): Promise<Share> {
+	return api.get<Share>(`/shares/${shareId}`);
+}
+
+/**
+ * Create a share link
+ * POST /api/v1/shares
+ */
+export async function createShare(request: CreateShareRequest): Promise<Share> {
+	return api.post<Share>('/shares', request);
+}
+
+/**
+ * Revoke a share link
+ * DELETE /api/v1/shares/:id
+ */
+export async function revokeShare(shareId: string): Promise<void> {
+	return api.delete<void>(`/shares/${shareId}`);
+}
+
+/**
+ * Get the shared file or folder behind a link
+ * GET /api/v1/s/:token
+ */
+export async function getShareInfo(token: string, password?: string): Promise<ShareInfo> {
+	return apiRequest<ShareInfo>(`/s/${token}`, { skipAuth: true, headers: sharePasswordHeaders(password) });
+}
+
+/**
+ * List a directory of a shared folder; paths are relative to the folder
+ * GET /api/v1/s/:token/list/*path
+ */
+export async function listSharedDirectory(
+	token: string,
+	path = '',
+	options: ListOptions = {},
+	password?: string
+): Promise<FileList> {
+	return apiRequest<FileList>(`/s/${token}/list/${encodeSharePath(path)}`, {
+		skipAuth: true,
+		headers: sharePasswordHeaders(password),
+		params: {
+			page: options.page,
+			pageSize: options.pageSize,
+			sortBy: options.sortBy,
+			sortDir: options.sortDir,
+			filter: options.filter
+		}
+	});
+}
+
+/**
+ * Get the download URL of a shared file, or of a file in a shared folder.
+ * Protected links need the password header, see downloadSharedFile.
+ */
+export function getShareDownloadUrl(token: string, path = ''): string {
+	return shareUrl(token, 'download', path);
+}
+
+/**
+ * Get the preview URL of a shared file, or of a file in a shared folder.
+ * For unprotected links it can be used directly in <video>, <audio>, <img>
+ * and <iframe> src.
+ */
+export function getSharePreviewUrl(token: string, path = ''): string {
+	return shareUrl(token, 'preview', path);
+}
+
+/**
+ * Download a shared file, or a file in a shared folder, sending the
+ * password of a protected link in a header so that it stays out of URLs
+ * GET /api/v1/s/:token/download/*path
+ */
+export async function downloadSharedFile(token: string, path = '', password?: string): Promise<Blob> {
+	const response = await fetch(shareUrl(token, 'download', path), {
+		headers: sharePasswordHeaders(password)
+	});
+	if (!response.ok) {
+		const errorData = await response.json().catch(() => ({ error: 'Download failed' }));
+		throw new Error(errorData.error || `Download failed with status ${response.status}`);
+	}
+	return response.blob();
+}
+
+/**
+ * Upload a file into a drop link in chunks. Resolves with the name the file
+ * was stored under, which differs from file.name if that was taken.
+ * POST /api/v1/s/:token/upload/:name
+ */
+export async function uploadToDrop(
+	token: string,
+	file: File,
+	password?: string,
+	chunkSize = DROP_CHUNK_SIZE
+): Promise<string> {
+	const uploadId = crypto.randomUUID();
+	const totalChunks = Math.max(1, Math.ceil(file.size / chunkSize));
+	let result: DropUploadResult | null = null;
+
+	for (let index = 0; index < totalChunks; index++) {
+		const chunk = file.slice(index * chunkSize, (index + 1) * chunkSize);
+		const response = await fetch(`/api/v1/s/${token}/upload/${encodeURIComponent(file.name)}`, {
+			method: 'POST',
+			headers: {
+				...sharePasswordHeaders(password),
+				'X-Upload-ID': uploadId,
+				'X-Chunk-Index': index.toString(),
+				'X-Total-Chunks': totalChunks.toString(),
+				'X-Chunk-Size': chunk.size.toString(),
+				'X-Total-Size': file.size.toString(),
+				'Content-Type': 'application/octet-stream'
+			},
+			body: chunk
+		});
+		if (!response.ok) {
+			const errorData = await response.json().catch(() => ({ error: 'Upload failed' }));
+			throw new Error(errorData.error || `Upload failed with status ${response.status}`);
+		}
+		result = await response.json();
+	}
+
+	return result?.path ?? file.name;
+}
+
+function shareUrl(token: string, kind: 'download' | 'preview', path: string): string {
+	return `/api/v1/s/${token}/${kind}/${encodeSharePath(path)}`;
+}
+
+function encodeSharePath(path: string): string {
+	return path
+		.split('/')
+		.filter(Boolean)
+		.map((segment) => encodeURIComponent(segment))
+		.join('/');
+}
+
+function sharePasswordHeaders(password?: string): Record<string, string> {
+	return password ? { 'X-Share-Password': password } : {};
+}
+
+/**
+ * Share API object with all methods
+ */
+export const sharesApi = {
+	list: listShares,
+	get: getShare,
+	create: createShare,
+	revoke: revokeShare,
+	info: getShareInfo,
+	listDirectory: listSharedDirectory,
+	downloadUrl: getShareDownloadUrl,
+	previewUrl: getSharePreviewUrl,
+	download: downloadSharedFile,
+	uploadToDrop
+};
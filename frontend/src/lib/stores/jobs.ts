@@ -24,6 +24,7 @@ export interface JobUpdate {
 	state: JobState;
 	progress: number;
 	error?: string;
+	errorCount?: number;
 }
 
 /**
@@ -100,7 +101,8 @@ function createJobsStore() {
 				...existingJob,
 				state: jobUpdate.state,
 				progress: jobUpdate.progress,
-				error: jobUpdate.error
+				error: jobUpdate.error,
+				errorCount: jobUpdate.errorCount
 			};
 
 			// Set completedAt if job is now terminal
@@ -15,20 +15,96 @@ export type ConnectionState = 'disconnected' | 'connecting' | 'connected' | 'rec
 /**
  * WebSocket message types from server
  */
-export type ServerMessageType = 'job_update' | 'job_complete' | 'error' | 'pong';
+export type ServerMessageType =
+	| 'job_update'
+	| 'job_complete'
+	| 'dir_changes'
+	| 'upload_update'
+	| 'share_upload'
+	| 'connected'
+	| 'resync'
+	| 'error'
+	| 'pong';
+
+/**
+ * Change to an entry of a watched directory
+ */
+export interface FileEvent {
+	type: 'created' | 'modified' | 'deleted' | 'renamed';
+	name: string;
+	oldName?: string; // Previous name of a renamed entry
+	isDir?: boolean;
+}
+
+/**
+ * Batch of changes to a watched directory
+ */
+export interface DirChanges {
+	path: string;
+	events: FileEvent[];
+}
+
+/**
+ * Listener for directory changes
+ */
+export type DirChangesListener = (changes: DirChanges) => void;
+
+/**
+ * Change to one of the current user's upload sessions, from any device
+ */
+export interface UploadUpdate {
+	uploadId: string;
+	event:
+		| 'created'
+		| 'progress'
+		| 'assembled'
+		| 'checksum_failed'
+		| 'failed'
+		| 'cancelled'
+		| 'expired';
+	path: string;
+	receivedChunks: number;
+	totalChunks: number; // 0 for tus uploads
+	receivedBytes: number;
+	totalSize: number;
+	error?: string;
+}
+
+/**
+ * Listener for upload session changes
+ */
+export type UploadUpdateListener = (update: UploadUpdate) => void;
+
+/**
+ * File a guest uploaded through one of the user's drop links
+ */
+export interface ShareUpload {
+	shareId: string;
+	path: string; // Where the file was stored
+	size: number;
+	remoteAddr?: string;
+	time: string;
+}
+
+/**
+ * Listener for uploads through drop links
+ */
+export type ShareUploadListener = (upload: ShareUpload) => void;
 
 /**
  * WebSocket message from server
  */
 export interface WSServerMessage {
 	type: ServerMessageType;
-	payload: JobUpdate | { message: string };
+	epoch?: string; // connected/resync: random ID of the server run the sequence numbers belong to
+	seq?: number; // Job events: event sequence number; connected/resync: the current one
+	payload?: JobUpdate | DirChanges | UploadUpdate | { message: string };
 }
 
 /**
  * WebSocket message types to server
  */
-export type ClientMessageType = 'subscribe' | 'unsubscribe' | 'ping';
+export type ClientMessageType = 'subscribe' | 'unsubscribe' | 'watch' | 'unwatch' | 'ping';
 
 /**
  * WebSocket message to server
@@ -36,6 +112,7 @@ export type ClientMessageType = 'subscribe' | 'unsubscribe' | 'ping';
 export interface WSClientMessage {
 	type: ClientMessageType;
 	jobId?: string;
+	path?: string; // Directory for watch and unwatch
 }
 
 /**
@@ -47,6 +124,7 @@ export interface WebSocketState {
 	reconnectAttempts: number;
 	lastConnectedAt: Date | null;
 	subscribedJobs: Set<string>;
+	watchedDirs: Set<string>;
 }
 
 /**
@@ -57,7 +135,8 @@ const initialState: WebSocketState = {
 	error: null,
 	reconnectAttempts: 0,
 	lastConnectedAt: null,
-	subscribedJobs: new Set()
+	subscribedJobs: new Set(),
+	watchedDirs: new Set()
 };
 
 /**
@@ -75,6 +154,26 @@ const BACKOFF_CONFIG = {
  */
 const PING_INTERVAL_MS = 30000;
 
+/**
+ * Number of WebSocket connections that fail before opening after which the
+ * Server-Sent Events stream is used instead
+ */
+const EVENTS_FALLBACK_ATTEMPTS = 2;
+
+/**
+ * Server message types delivered as named Server-Sent Events
+ */
+const SERVER_MESSAGE_TYPES: ServerMessageType[] = [
+	'job_update',
+	'job_complete',
+	'dir_changes',
+	'upload_update',
+	'share_upload',
+	'connected',
+	'resync',
+	'error'
+];
+
 /**
  * Create the WebSocket store
  */
@@ -82,17 +181,55 @@ function createWebSocketStore() {
 	const { subscribe, set, update } = writable<WebSocketState>(initialState);
 
 	let socket: WebSocket | null = null;
+	let events: EventSource | null = null; // Fallback when WebSocket upgrades fail
+	let useEvents = false;
+	let failedUpgrades = 0; // WebSocket connections that closed before opening
 	let reconnectTimeout: ReturnType<typeof setTimeout> | null = null;
 	let pingInterval: ReturnType<typeof setInterval> | null = null;
+	let lastSeq: number | null = null; // Sequence number of the last job event seen
+	let epoch = ''; // Server run that lastSeq belongs to
+	const dirListeners = new Set<DirChangesListener>();
+	const uploadListeners = new Set<UploadUpdateListener>();
+	const shareUploadListeners = new Set<ShareUploadListener>();
 
 	/**
-	 * Get WebSocket URL with auth token
+	 * Get WebSocket URL with auth token, resuming after the last job event seen
 	 */
 	function getWebSocketUrl(): string {
 		const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
 		const token = getAccessToken();
+		const params = new URLSearchParams();
+		if (token) {
+			params.set('token', token);
+		}
+		if (lastSeq !== null) {
+			params.set('since', `${epoch}:${lastSeq}`);
+		}
+		const query = params.toString();
 		const baseUrl = `${protocol}//${window.location.host}/api/v1/ws`;
-		return token ? `${baseUrl}?token=${encodeURIComponent(token)}` : baseUrl;
+		return query ? `${baseUrl}?${query}` : baseUrl;
+	}
+
+	/**
+	 * Get Server-Sent Events URL with auth token, subscriptions and resume point
+	 */
+	function getEventsUrl(): string {
+		const state = get({ subscribe });
+		const params = new URLSearchParams();
+		const token = getAccessToken();
+		if (token) {
+			params.set('token', token);
+		}
+		if (lastSeq !== null) {
+			params.set('since', `${epoch}:${lastSeq}`);
+		}
+		for (const jobId of state.subscribedJobs) {
+			params.append('job', jobId);
+		}
+		for (const path of state.watchedDirs) {
+			params.append('watch', path);
+		}
+		return `/api/v1/events?${params.toString()}`;
 	}
 
 	/**
@@ -146,9 +283,41 @@ function createWebSocketStore() {
 				case 'job_update':
 				case 'job_complete':
 					// Update jobs store with the job update
+					lastSeq = message.seq ?? lastSeq;
 					jobsStore.updateFromWebSocket(message.payload as JobUpdate);
 					break;
 
+				case 'connected':
+					// Any missed job events have been replayed
+					epoch = message.epoch ?? '';
+					lastSeq = message.seq ?? 0;
+					break;
+
+				case 'resync':
+					// Missed job events are no longer available, reload instead
+					epoch = message.epoch ?? '';
+					lastSeq = message.seq ?? 0;
+					jobsStore.loadJobs();
+					break;
+
+				case 'dir_changes':
+					for (const listener of dirListeners) {
+						listener(message.payload as DirChanges);
+					}
+					break;
+
+				case 'upload_update':
+					for (const listener of uploadListeners) {
+						listener(message.payload as UploadUpdate);
+					}
+					break;
+
+				case 'share_upload':
+					for (const listener of shareUploadListeners) {
+						listener(message.payload as ShareUpload);
+					}
+					break;
+
 				case 'error': {
 					const errorPayload = message.payload as { message: string };
 					update((state) => ({
@@ -170,6 +339,47 @@ function createWebSocketStore() {
 		}
 	}
 
+	/**
+	 * Connect to the Server-Sent Events stream. Subscriptions are part of the
+	 * URL, so changing them reconnects.
+	 */
+	function connectEvents(): void {
+		events?.close();
+		events = new EventSource(getEventsUrl());
+
+		events.onopen = () => {
+			update((state) => ({
+				...state,
+				connectionState: 'connected',
+				error: null,
+				reconnectAttempts: 0,
+				lastConnectedAt: new Date()
+			}));
+		};
+
+		events.onerror = () => {
+			// The browser reconnects by itself, sending the last event ID
+			update((state) => ({
+				...state,
+				connectionState: events?.readyState === EventSource.CLOSED ? 'disconnected' : 'reconnecting',
+				error: 'Event stream connection error'
+			}));
+		};
+
+		for (const type of SERVER_MESSAGE_TYPES) {
+			events.addEventListener(type, (event) => handleMessage(event as MessageEvent));
+		}
+	}
+
+	/**
+	 * Reconnect the Server-Sent Events stream after subscriptions changed
+	 */
+	function refreshEvents(): void {
+		if (events) {
+			connectEvents();
+		}
+	}
+
 	/**
 	 * Connect to WebSocket server
 	 */
@@ -200,10 +410,18 @@ function createWebSocketStore() {
 			error: null
 		}));
 
+		if (useEvents) {
+			connectEvents();
+			return;
+		}
+
 		try {
 			socket = new WebSocket(getWebSocketUrl());
+			let opened = false;
 
 			socket.onopen = () => {
+				opened = true;
+				failedUpgrades = 0;
 				update((state) => ({
 					...state,
 					connectionState: 'connected',
@@ -218,6 +436,9 @@ function createWebSocketStore() {
 				for (const jobId of state.subscribedJobs) {
 					sendMessage({ type: 'subscribe', jobId });
 				}
+				for (const path of state.watchedDirs) {
+					sendMessage({ type: 'watch', path });
+				}
 			};
 
 			socket.onclose = (event) => {
@@ -233,6 +454,14 @@ function createWebSocketStore() {
 					return;
 				}
 
+				// Fall back to Server-Sent Events when upgrades keep failing
+				if (!opened && ++failedUpgrades >= EVENTS_FALLBACK_ATTEMPTS) {
+					useEvents = true;
+					update((s) => ({ ...s, connectionState: 'disconnected' }));
+					connect();
+					return;
+				}
+
 				// Attempt reconnection with exponential backoff
 				const state = get({ subscribe });
 				if (state.reconnectAttempts < BACKOFF_CONFIG.maxAttempts) {
@@ -283,7 +512,13 @@ function createWebSocketStore() {
 			socket.close(1000, 'Client disconnecting');
 			socket = null;
 		}
+		events?.close();
+		events = null;
+		useEvents = false;
+		failedUpgrades = 0;
 
+		lastSeq = null;
+		epoch = '';
 		set(initialState);
 	}
 
@@ -309,6 +544,7 @@ function createWebSocketStore() {
 		});
 
 		sendMessage({ type: 'subscribe', jobId });
+		refreshEvents();
 	}
 
 	/**
@@ -322,6 +558,63 @@ function createWebSocketStore() {
 		});
 
 		sendMessage({ type: 'unsubscribe', jobId });
+		refreshEvents();
+	}
+
+	/**
+	 * Watch a directory for created, modified, deleted and renamed entries
+	 */
+	function watchDir(path: string): void {
+		update((state) => {
+			const newWatched = new Set(state.watchedDirs);
+			newWatched.add(path);
+			return { ...state, watchedDirs: newWatched };
+		});
+
+		sendMessage({ type: 'watch', path });
+		refreshEvents();
+	}
+
+	/**
+	 * Stop watching a directory
+	 */
+	function unwatchDir(path: string): void {
+		update((state) => {
+			const newWatched = new Set(state.watchedDirs);
+			newWatched.delete(path);
+			return { ...state, watchedDirs: newWatched };
+		});
+
+		sendMessage({ type: 'unwatch', path });
+		refreshEvents();
+	}
+
+	/**
+	 * Register a listener for changes to watched directories.
+	 * Returns a function that removes the listener.
+	 */
+	function onDirChanges(listener: DirChangesListener): () => void {
+		dirListeners.add(listener);
+		return () => dirListeners.delete(listener);
+	}
+
+	/**
+	 * Register a listener for changes to the user's upload sessions. Updates
+	 * are not replayed after a reconnect; list the sessions again instead.
+	 * Returns a function that removes the listener.
+	 */
+	function onUploadUpdate(listener: UploadUpdateListener): () => void {
+		uploadListeners.add(listener);
+		return () => uploadListeners.delete(listener);
+	}
+
+	/**
+	 * Register a listener for files guests upload through the user's drop
+	 * links. Returns a function that removes the listener.
+	 */
+	function onShareUpload(listener: ShareUploadListener): () => void {
+		shareUploadListeners.add(listener);
+		return () => shareUploadListeners.delete(listener);
 	}
 
 	/**
@@ -354,6 +647,11 @@ function createWebSocketStore() {
 		sendMessage,
 		subscribeToJob,
 		unsubscribeFromJob,
+		watchDir,
+		unwatchDir,
+		onDirChanges,
+		onUploadUpdate,
+		onShareUpload,
 		isConnected,
 		clearError,
 		forceReconnect
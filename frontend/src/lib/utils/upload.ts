@@ -45,6 +45,7 @@ export interface UploadOptions {
  */
 interface UploadResponse {
 	uploadId: string;
+	batchId?: string;
 	chunkIndex: number;
 	receivedChunks: number;
 	totalChunks: number;
@@ -66,6 +67,63 @@ interface UploadStatusResponse {
 	lastActivity: string;
 }
 
+/**
+ * In-flight upload session of the current user, from any of their devices
+ */
+export interface UploadSession {
+	uploadId: string;
+	path: string;
+	totalSize: number;
+	totalChunks: number;
+	receivedChunks: number;
+	missingCount: number;
+	receivedBytes: number;
+	tus?: boolean; // Uploaded by a tus client, without chunks
+	createdAt: string;
+	lastActivity: string;
+}
+
+/**
+ * File of a folder upload batch
+ */
+export interface UploadBatchFile {
+	path: string;
+	uploadId?: string; // Empty files have no upload session
+	totalSize: number;
+	totalChunks: number;
+	receivedBytes: number;
+	complete: boolean;
+}
+
+/**
+ * Folder upload batch
+ */
+export interface UploadBatch {
+	batchId: string;
+	root: string;
+	atomic: boolean;
+	state: 'uploading' | 'committing' | 'complete' | 'failed';
+	error?: string;
+	chunkSize: number;
+	totalFiles: number;
+	completedFiles: number;
+	totalSize: number;
+	receivedBytes: number;
+	files: UploadBatchFile[];
+	createdAt: string;
+	lastActivity: string;
+}
+
+/**
+ * Folder upload options
+ */
+export interface FolderUploadOptions {
+	atomic?: boolean; // Move no file into place until all of them are uploaded
+	directories?: string[]; // Directories to create even if empty, relative to the root
+	onProgress?: UploadProgressCallback;
+	signal?: AbortSignal;
+}
+
 /**
  * Generate a unique upload ID
  */
@@ -142,7 +200,8 @@ async function uploadChunk(
 	totalSize: number,
 	chunkData: Blob,
 	checksum?: string,
-	signal?: AbortSignal
+	signal?: AbortSignal,
+	batchId?: string
 ): Promise<UploadResponse> {
 	const headers: Record<string, string> = {
 		'X-Upload-ID': uploadId,
@@ -153,11 +212,22 @@ async function uploadChunk(
 		'Content-Type': 'application/octet-stream'
 	};
 
+	// Files of a folder upload name their batch
+	if (batchId) {
+		headers['X-Batch-ID'] = batchId;
+	}
+
 	// Add checksum on final chunk
 	if (checksum) {
 		headers['X-Checksum'] = `sha256:${checksum}`;
 	}
 
+	// Let the server reject a corrupted chunk right away, so only it is resent
+	const chunkHash = await crypto.subtle.digest('SHA-256', await chunkData.arrayBuffer());
+	headers['X-Chunk-Checksum'] = Array.from(new Uint8Array(chunkHash))
+		.map((b) => b.toString(16).padStart(2, '0'))
+		.join('');
+
 	// Add auth token
 	const token = getAccessToken();
 	if (token) {
@@ -179,6 +249,44 @@ async function uploadChunk(
 	return response.json();
 }
 
+/**
+ * Ask the server to place a copy of a file it already has at path instead of
+ * uploading it. Returns the path when it did, or null when the file must be
+ * uploaded.
+ */
+async function tryInstantUpload(
+	path: string,
+	checksum: string,
+	size: number,
+	signal?: AbortSignal
+): Promise<string | null> {
+	const headers: Record<string, string> = {
+		'Content-Type': 'application/json'
+	};
+
+	const token = getAccessToken();
+	if (token) {
+		headers['Authorization'] = `Bearer ${token}`;
+	}
+
+	try {
+		const response = await fetch(`${API_BASE_URL}/instant/${path}`, {
+			method: 'POST',
+			headers,
+			body: JSON.stringify({ checksum: `sha256:${checksum}`, size }),
+			signal
+		});
+		if (!response.ok) {
+			return null;
+		}
+		const data: { path: string; deduplicated: boolean } = await response.json();
+		return data.deduplicated ? data.path : null;
+	} catch {
+		// Fall back to a normal upload
+		return null;
+	}
+}
+
 /**
  * Get upload status for resuming
  */
@@ -213,6 +321,30 @@ export async function getUploadStatus(uploadId: string): Promise<UploadStatusRes
 	}
 }
 
+/**
+ * List the current user's in-flight upload sessions
+ */
+export async function listUploadSessions(): Promise<UploadSession[]> {
+	const token = getAccessToken();
+	const headers: Record<string, string> = {};
+
+	if (token) {
+		headers['Authorization'] = `Bearer ${token}`;
+	}
+
+	const response = await fetch(`${API_BASE_URL}/uploads`, {
+		method: 'GET',
+		headers
+	});
+
+	if (!response.ok) {
+		throw new Error('Failed to list uploads');
+	}
+
+	const data: { uploads: UploadSession[] } = await response.json();
+	return data.uploads;
+}
+
 /**
  * Upload a file with chunking, progress tracking, and resume support
  */
@@ -251,6 +383,16 @@ export async function uploadFile(
 
 		const checksum = await calculateChecksumStreaming(file, chunkSize);
 
+		// Skip the transfer if the server already has the same content
+		const instantPath = await tryInstantUpload(destinationPath, checksum, file.size, signal);
+		if (instantPath) {
+			progress.status = 'complete';
+			progress.percentage = 100;
+			progress.uploadedSize = file.size;
+			reportProgress();
+			return { success: true, path: instantPath };
+		}
+
 		// Upload chunks
 		for (const chunk of splitFileIntoChunks(file, chunkSize)) {
 			// Check for cancellation
@@ -305,6 +447,146 @@ export async function uploadFile(
 	}
 }
 
+/**
+ * Upload a folder as one batch. files maps paths relative to root to their
+ * contents; directories are created from the paths. An atomic batch moves no
+ * file into place until every file is uploaded, and none at all if one fails.
+ */
+export async function uploadFolder(
+	root: string,
+	files: Map<string, File>,
+	options: FolderUploadOptions = {}
+): Promise<{ success: boolean; batch?: UploadBatch; error?: string }> {
+	const { atomic = false, directories = [], onProgress, signal } = options;
+
+	const headers: Record<string, string> = {
+		'Content-Type': 'application/json'
+	};
+
+	const token = getAccessToken();
+	if (token) {
+		headers['Authorization'] = `Bearer ${token}`;
+	}
+
+	let batch: UploadBatch;
+	try {
+		const response = await fetch(`${API_BASE_URL}/batches`, {
+			method: 'POST',
+			headers,
+			body: JSON.stringify({
+				root,
+				atomic,
+				directories,
+				files: Array.from(files, ([path, file]) => ({ path, size: file.size }))
+			}),
+			signal
+		});
+		if (!response.ok) {
+			const errorData = await response.json().catch(() => ({ error: 'Upload failed' }));
+			return { success: false, error: errorData.error || `Upload failed with status ${response.status}` };
+		}
+		batch = await response.json();
+	} catch (error) {
+		return { success: false, error: error instanceof Error ? error.message : 'Upload failed' };
+	}
+
+	// The server lists the files in the order they were sent
+	const contents = Array.from(files.values());
+	let uploadedSize = 0;
+
+	try {
+		for (const [i, entry] of batch.files.entries()) {
+			if (!entry.uploadId) {
+				continue;
+			}
+			const file = contents[i];
+			const checksum = await calculateChecksumStreaming(file, batch.chunkSize);
+
+			for (const chunk of splitFileIntoChunks(file, batch.chunkSize)) {
+				if (signal?.aborted) {
+					await cancelUploadBatch(batch.batchId);
+					return { success: false, error: 'Upload cancelled' };
+				}
+
+				await uploadChunk(
+					entry.path,
+					entry.uploadId,
+					chunk.index,
+					entry.totalChunks,
+					batch.chunkSize,
+					file.size,
+					chunk.blob,
+					chunk.isLast ? checksum : undefined,
+					signal,
+					batch.batchId
+				);
+
+				uploadedSize += chunk.blob.size;
+				onProgress?.({
+					uploadId: batch.batchId,
+					fileName: file.name,
+					totalSize: batch.totalSize,
+					uploadedSize,
+					percentage: batch.totalSize ? Math.round((uploadedSize / batch.totalSize) * 100) : 100,
+					currentChunk: chunk.index,
+					totalChunks: entry.totalChunks,
+					status: 'uploading'
+				});
+			}
+		}
+	} catch (error) {
+		return { success: false, error: error instanceof Error ? error.message : 'Upload failed' };
+	}
+
+	const status = await getUploadBatch(batch.batchId);
+	if (!status || status.state === 'failed') {
+		return { success: false, batch: status ?? undefined, error: status?.error || 'Upload failed' };
+	}
+	return { success: true, batch: status };
+}
+
+/**
+ * Get the progress of a folder upload batch
+ */
+export async function getUploadBatch(batchId: string): Promise<UploadBatch | null> {
+	const token = getAccessToken();
+	const headers: Record<string, string> = {};
+
+	if (token) {
+		headers['Authorization'] = `Bearer ${token}`;
+	}
+
+	try {
+		const response = await fetch(`${API_BASE_URL}/batches/${encodeURIComponent(batchId)}`, {
+			method: 'GET',
+			headers
+		});
+		if (!response.ok) {
+			return null;
+		}
+		return response.json();
+	} catch {
+		return null;
+	}
+}
+
+/**
+ * Cancel a folder upload batch, keeping the files already in place
+ */
+export async function cancelUploadBatch(batchId: string): Promise<void> {
+	const token = getAccessToken();
+	const headers: Record<string, string> = {};
+
+	if (token) {
+		headers['Authorization'] = `Bearer ${token}`;
+	}
+
+	await fetch(`${API_BASE_URL}/batches/${encodeURIComponent(batchId)}`, {
+		method: 'DELETE',
+		headers
+	}).catch(() => undefined);
+}
+
 /**
  * Resume an interrupted upload
  */